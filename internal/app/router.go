@@ -5,12 +5,14 @@ import (
 	"database/sql"
 	"net/http"
 	"os"
+	"path"
 	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	platformhttp "goecommerce/internal/platform/http"
 	storcustomers "goecommerce/internal/storage/customers"
+	storidempotency "goecommerce/internal/storage/idempotency"
 )
 
 type readyResp struct {
@@ -30,7 +32,15 @@ func NewRouter(deps Deps) http.Handler {
 		uploadsDir = "./tmp/uploads"
 	}
 	_ = os.MkdirAll(uploadsDir, 0o755)
-	mux.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir(uploadsDir))))
+	uploads := http.StripPrefix("/uploads/", http.FileServer(http.Dir(uploadsDir)))
+	mux.HandleFunc("/uploads/", func(w http.ResponseWriter, r *http.Request) {
+		// Invoices and other private media live below uploads/private.
+		if p := path.Clean(r.URL.Path); p == "/uploads/private" || strings.HasPrefix(p, "/uploads/private/") {
+			http.NotFound(w, r)
+			return
+		}
+		uploads.ServeHTTP(w, r)
+	})
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		_ = platformhttp.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
 	})
@@ -61,19 +71,31 @@ func NewRouter(deps Deps) http.Handler {
 			ipBlockChecker = customerStore
 		}
 	}
-	wrapped := applyAdminMiddleware(mux, rateLimiter)
+	var idempotencyStore platformhttp.IdempotencyStore
+	if s, err := storidempotency.NewStore(deps.Redis, deps.DB); err == nil {
+		idempotencyStore = s
+	}
+	wrapped := applyAdminMiddleware(mux, rateLimiter, idempotencyStore)
 	wrapped = platformhttp.IPBlockMiddleware(wrapped, ipBlockChecker)
 	wrapped = platformhttp.CORS(wrapped, platformhttp.ParseAllowedOrigins(os.Getenv("CORS_ALLOWED_ORIGINS")))
 	return wrapped
 }
 
-func applyAdminMiddleware(mux *http.ServeMux, rateLimiter *platformhttp.RateLimiter) http.Handler {
+// storefrontCaller scopes storefront idempotency keys to the customer
+// session and cart cookies the storefront authenticates with.
+var storefrontCaller = platformhttp.CallerFromCredentials("customer_session", "cart_id")
+
+// applyAdminMiddleware adds the admin security middleware to /admin routes
+// and idempotency to the rest. Admin handlers apply idempotency themselves
+// once the admin is authenticated.
+func applyAdminMiddleware(mux *http.ServeMux, rateLimiter *platformhttp.RateLimiter, idempotencyStore platformhttp.IdempotencyStore) http.Handler {
+	storefront := platformhttp.IdempotencyMiddleware(mux, idempotencyStore, storefrontCaller)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if strings.HasPrefix(r.URL.Path, "/admin") {
 			handler := platformhttp.SecurityHeaders(rateLimiter.Middleware(mux))
 			handler.ServeHTTP(w, r)
 			return
 		}
-		mux.ServeHTTP(w, r)
+		storefront.ServeHTTP(w, r)
 	})
 }
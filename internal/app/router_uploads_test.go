@@ -42,3 +42,23 @@ func TestRouterServesUploadsDirectory(t *testing.T) {
 		t.Fatalf("expected body %q, got %q", "hello", string(body))
 	}
 }
+
+func TestRouterHidesPrivateUploads(t *testing.T) {
+	uploadsDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(uploadsDir, "private"), 0o755); err != nil {
+		t.Fatalf("mkdir private dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(uploadsDir, "private", "invoice.pdf"), []byte("%PDF"), 0o644); err != nil {
+		t.Fatalf("write private file: %v", err)
+	}
+	t.Setenv("UPLOADS_DIR", uploadsDir)
+
+	router := NewRouter(Deps{})
+	for _, p := range []string{"/uploads/private/invoice.pdf", "/uploads/private/", "/uploads/./private/invoice.pdf", "/uploads/x/../private/invoice.pdf"} {
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, p, nil))
+		if res.Code == http.StatusOK {
+			t.Fatalf("%s: private upload was served", p)
+		}
+	}
+}
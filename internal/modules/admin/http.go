@@ -13,13 +13,19 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"goecommerce/internal/app"
 	platformhttp "goecommerce/internal/platform/http"
+	"goecommerce/internal/platform/invoices"
 	storcat "goecommerce/internal/storage/catalog"
 	storcustomers "goecommerce/internal/storage/customers"
+	storidempotency "goecommerce/internal/storage/idempotency"
 	stormedia "goecommerce/internal/storage/media"
 	stororders "goecommerce/internal/storage/orders"
+	storpayments "goecommerce/internal/storage/payments"
+	storshiping "goecommerce/internal/storage/shipping"
+	stortax "goecommerce/internal/storage/tax"
 )
 
 type module struct {
@@ -27,9 +33,14 @@ type module struct {
 	customers           customersStore
 	catalog             catalogStore
 	media               mediaStore
+	payments            storpayments.ProvidersStore
+	shipping            shippingProvidersStore
+	tax                 taxStore
 	validateImportHost  func(context.Context, string) error
 	downloadImportImage func(context.Context, string) ([]byte, string, error)
 	uploadsDir          string
+	invoiceSeller       invoices.Party
+	idempotency         platformhttp.IdempotencyStore
 	user                string
 	pass                string
 }
@@ -59,19 +70,46 @@ func NewModule(deps app.Deps) app.Module {
 			mst = s
 		}
 	}
+	var pst storpayments.ProvidersStore
+	if deps.DB != nil {
+		if s, err := storpayments.NewStore(context.Background(), deps.DB); err == nil {
+			pst = s
+		}
+	}
+	var sst shippingProvidersStore
+	if deps.DB != nil {
+		if s, err := storshiping.NewStore(context.Background(), deps.DB); err == nil {
+			sst = s
+		}
+	}
+	var tst taxStore
+	if deps.DB != nil {
+		if s, err := stortax.NewStore(context.Background(), deps.DB); err == nil {
+			tst = s
+		}
+	}
+	var idem platformhttp.IdempotencyStore
+	if s, err := storidempotency.NewStore(deps.Redis, deps.DB); err == nil {
+		idem = s
+	}
 	uploadsDir := strings.TrimSpace(os.Getenv("UPLOADS_DIR"))
 	if uploadsDir == "" {
 		uploadsDir = "./tmp/uploads"
 	}
 	_ = os.MkdirAll(uploadsDir, 0o755)
 	return &module{
-		orders:     ost,
-		customers:  cust,
-		catalog:    cst,
-		media:      mst,
-		uploadsDir: uploadsDir,
-		user:       strings.TrimSpace(os.Getenv("ADMIN_USER")),
-		pass:       strings.TrimSpace(os.Getenv("ADMIN_PASS")),
+		orders:        ost,
+		customers:     cust,
+		catalog:       cst,
+		media:         mst,
+		payments:      pst,
+		shipping:      sst,
+		tax:           tst,
+		uploadsDir:    uploadsDir,
+		invoiceSeller: invoices.SellerFromEnv(),
+		idempotency:   idem,
+		user:          strings.TrimSpace(os.Getenv("ADMIN_USER")),
+		pass:          strings.TrimSpace(os.Getenv("ADMIN_PASS")),
 	}
 }
 
@@ -96,6 +134,16 @@ func (m *module) Close() error {
 			_ = closer.Close()
 		}
 	}
+	if m.payments != nil {
+		if closer, ok := m.payments.(interface{ Close() error }); ok {
+			_ = closer.Close()
+		}
+	}
+	if m.tax != nil {
+		if closer, ok := m.tax.(interface{ Close() error }); ok {
+			_ = closer.Close()
+		}
+	}
 	return nil
 }
 
@@ -106,6 +154,7 @@ func (m *module) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/admin/orders", m.wrapAuth(m.handleOrders))
 	mux.HandleFunc("/admin/orders/", m.wrapAuth(m.handleOrderDetail))
 	mux.HandleFunc("/admin/orders/status", m.wrapAuth(m.handleUpdateOrderStatus))
+	mux.HandleFunc("/admin/returns", m.wrapAuth(m.handleReturnsQueue))
 	mux.HandleFunc("/admin/customers", m.wrapAuth(m.handleCustomers))
 	mux.HandleFunc("/admin/customers/", m.wrapAuth(m.handleCustomerDetailActions))
 	mux.HandleFunc("/admin/customers/logs", m.wrapAuth(m.handleCustomerActionLogs))
@@ -126,6 +175,11 @@ func (m *module) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/admin/custom-options", m.wrapAuth(m.handleCustomOptions))
 	mux.HandleFunc("/admin/custom-options/", m.wrapAuth(m.handleCustomOptionDetail))
 	mux.HandleFunc("/admin/products/", m.wrapAuth(m.handleProductCustomOptionAssignments))
+	mux.HandleFunc("/admin/payments/providers", m.wrapAuth(m.handlePaymentProviders))
+	mux.HandleFunc("/admin/payments/providers/", m.wrapAuth(m.handlePaymentProviderDetail))
+	mux.HandleFunc("/admin/tax/classes", m.wrapAuth(m.handleTaxClasses))
+	mux.HandleFunc("/admin/tax/rates", m.wrapAuth(m.handleTaxRates))
+	mux.HandleFunc("/admin/tax/rates/", m.wrapAuth(m.handleTaxRateDetail))
 }
 
 func (m *module) wrapAuth(next http.HandlerFunc) http.HandlerFunc {
@@ -140,10 +194,16 @@ func (m *module) wrapAuth(next http.HandlerFunc) http.HandlerFunc {
 			platformhttp.Error(w, http.StatusUnauthorized, "unauthorized")
 			return
 		}
-		next(w, r)
+		platformhttp.IdempotencyMiddleware(next, m.idempotency, adminCaller).ServeHTTP(w, r)
 	}
 }
 
+// adminCaller scopes admin idempotency keys to the authenticated admin.
+func adminCaller(r *http.Request) string {
+	u, _, _ := r.BasicAuth()
+	return "admin:" + u
+}
+
 func (m *module) handleDashboard(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.NotFound(w, r)
@@ -197,51 +257,89 @@ func (m *module) handleOrders(w http.ResponseWriter, r *http.Request) {
 		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
 		return
 	}
-	qp := r.URL.Query()
-	page := atoiDefault(qp.Get("page"), 1)
-	limit := atoiDefault(qp.Get("limit"), 20)
-	offset := (page - 1) * limit
-	items, err := m.orders.ListOrders(r.Context(), limit, offset)
+	in, err := parseOrderSearch(r.URL.Query())
+	if err != nil {
+		platformhttp.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	result, err := m.orders.SearchOrders(r.Context(), in)
 	if err != nil {
 		platformhttp.Error(w, http.StatusInternalServerError, "list error")
 		return
 	}
-	outItems := make([]map[string]any, 0, len(items))
-	for _, o := range items {
+	outItems := make([]map[string]any, 0, len(result.Items))
+	for _, o := range result.Items {
 		outItems = append(outItems, map[string]any{
-			"id":          o.ID,
-			"number":      o.Number,
-			"status":      o.Status,
-			"currency":    o.Currency,
-			"total_cents": o.TotalCents,
-			"created_at":  o.CreatedAt,
+			"id":             o.ID,
+			"number":         o.Number,
+			"status":         o.Status,
+			"currency":       o.Currency,
+			"total_cents":    o.TotalCents,
+			"customer_name":  orderCustomerName(o),
+			"email":          o.Email,
+			"payment_method": o.PaymentMethod,
+			"created_at":     o.CreatedAt,
 		})
 	}
 	_ = platformhttp.JSON(w, http.StatusOK, map[string]any{
 		"items": outItems,
-		"page":  page,
-		"limit": limit,
+		"total": result.Total,
+		"page":  result.Page,
+		"limit": result.Limit,
 	})
 }
 
 func (m *module) handleOrderDetail(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.NotFound(w, r)
-		return
-	}
 	if !strings.HasPrefix(r.URL.Path, "/admin/orders/") {
 		http.NotFound(w, r)
 		return
 	}
 	id := r.URL.Path[len("/admin/orders/"):]
+	action := ""
 	if i := strings.IndexByte(id, '/'); i >= 0 {
-		id = id[:i]
+		id, action = id[:i], id[i+1:]
 	}
 	id = strings.TrimSpace(id)
 	if id == "" {
 		http.NotFound(w, r)
 		return
 	}
+	if id == "export" && action == "" {
+		m.handleOrderExport(w, r)
+		return
+	}
+	if action == "mark-paid" && r.Method == http.MethodPost {
+		m.handleMarkOrderPaid(w, r, id)
+		return
+	}
+	if action == "refunds" || strings.HasPrefix(action, "refunds/") {
+		m.handleOrderRefunds(w, r, id, strings.TrimPrefix(action, "refunds"))
+		return
+	}
+	if action == "edits" {
+		m.handleOrderEdits(w, r, id)
+		return
+	}
+	if action == "notes" {
+		m.handleOrderNotes(w, r, id)
+		return
+	}
+	if action == "shipments" || strings.HasPrefix(action, "shipments/") {
+		m.handleOrderShipments(w, r, id, strings.TrimPrefix(action, "shipments"))
+		return
+	}
+	if action == "invoices" || strings.HasPrefix(action, "invoices/") {
+		m.handleOrderInvoices(w, r, id, strings.TrimPrefix(action, "invoices"))
+		return
+	}
+	if action == "returns" || strings.HasPrefix(action, "returns/") {
+		m.handleOrderReturns(w, r, id, strings.TrimPrefix(action, "returns"))
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
 	if m.orders == nil {
 		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
 		return
@@ -262,6 +360,7 @@ func (m *module) handleOrderDetail(w http.ResponseWriter, r *http.Request) {
 type updateOrderStatusRequest struct {
 	OrderID string `json:"order_id"`
 	Status  string `json:"status"`
+	Note    string `json:"note"`
 }
 
 func (m *module) handleUpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
@@ -285,26 +384,59 @@ func (m *module) handleUpdateOrderStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Validate status
-	validStatuses := map[string]bool{
-		"pending_payment": true,
-		"paid":            true,
-		"processing":      true,
-		"completed":       true,
-		"cancelled":       true,
+	// Validate status; refunded states are only reachable through refunds so
+	// the money movement is always recorded, and shipped states through
+	// shipments so they always match what left the warehouse.
+	switch req.Status {
+	case "partially_refunded", "refunded", "partially_shipped", "shipped":
+		platformhttp.Error(w, http.StatusBadRequest, "invalid status")
+		return
 	}
-	if !validStatuses[req.Status] {
+	if !stororders.IsValidStatus(req.Status) {
 		platformhttp.Error(w, http.StatusBadRequest, "invalid status")
 		return
 	}
 
-	if err := m.orders.UpdateOrderStatus(r.Context(), req.OrderID, req.Status); err != nil {
+	actor, _, _ := r.BasicAuth()
+	if err := m.orders.UpdateOrderStatus(r.Context(), req.OrderID, req.Status, actor, strings.TrimSpace(req.Note)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			platformhttp.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		if errors.Is(err, stororders.ErrInvalidTransition) {
+			platformhttp.Error(w, http.StatusConflict, "invalid status transition")
+			return
+		}
 		platformhttp.Error(w, http.StatusInternalServerError, "update error")
 		return
 	}
 	_ = platformhttp.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
+// handleMarkOrderPaid confirms a bank transfer or cash on delivery payment.
+// The admin basic auth user is recorded as the confirmer.
+func (m *module) handleMarkOrderPaid(w http.ResponseWriter, r *http.Request, id string) {
+	if m.orders == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	confirmedBy, _, _ := r.BasicAuth()
+	o, err := m.orders.MarkOrderPaid(r.Context(), id, confirmedBy)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			platformhttp.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		if errors.Is(err, stororders.ErrInvalidTransition) {
+			platformhttp.Error(w, http.StatusConflict, "order is not awaiting payment")
+			return
+		}
+		platformhttp.Error(w, http.StatusInternalServerError, "update error")
+		return
+	}
+	_ = platformhttp.JSON(w, http.StatusOK, o)
+}
+
 func atoiDefault(s string, def int) int {
 	n, err := strconv.Atoi(strings.TrimSpace(s))
 	if err != nil || n == 0 {
@@ -316,8 +448,29 @@ func atoiDefault(s string, def int) int {
 type ordersStore interface {
 	GetOrderMetrics(ctx context.Context) (stororders.OrderMetrics, error)
 	ListOrders(ctx context.Context, limit, offset int) ([]stororders.Order, error)
+	SearchOrders(ctx context.Context, in stororders.SearchOrdersParams) (stororders.OrdersPage, error)
+	ExportOrders(ctx context.Context, in stororders.SearchOrdersParams, fn func(stororders.Order) error) error
 	GetOrderByID(ctx context.Context, id string) (stororders.Order, error)
-	UpdateOrderStatus(ctx context.Context, id string, status string) error
+	UpdateOrderStatus(ctx context.Context, id string, status string, actor string, note string) error
+	MarkOrderPaid(ctx context.Context, id string, confirmedBy string) (stororders.Order, error)
+	CreateRefund(ctx context.Context, in stororders.CreateRefundInput, execute stororders.RefundExecutor) (stororders.Refund, error)
+	ListRefunds(ctx context.Context, orderID string) ([]stororders.Refund, error)
+	RetryRefund(ctx context.Context, orderID, refundID string, execute stororders.RefundExecutor) (stororders.Refund, error)
+	CreateShipment(ctx context.Context, in stororders.CreateShipmentInput, book stororders.ShipmentBooker) (stororders.Shipment, error)
+	UpdateShipment(ctx context.Context, in stororders.UpdateShipmentInput) (stororders.Shipment, error)
+	CancelShipment(ctx context.Context, orderID, shipmentID, actor string, cancel stororders.ShipmentCanceller) (stororders.Shipment, error)
+	GetShipment(ctx context.Context, orderID, shipmentID string) (stororders.Shipment, error)
+	ListShipments(ctx context.Context, orderID string) ([]stororders.Shipment, error)
+	ListReturns(ctx context.Context, orderID string) ([]stororders.Return, error)
+	ListReturnsByStatus(ctx context.Context, status string, limit int) ([]stororders.Return, error)
+	DecideReturn(ctx context.Context, orderID, returnID string, approve bool, note, actor string) (stororders.Return, error)
+	ReceiveReturn(ctx context.Context, in stororders.ReceiveReturnInput, execute stororders.RefundExecutor) (stororders.Return, error)
+	ListInvoices(ctx context.Context, orderID string) ([]stororders.Invoice, error)
+	InvoicePDF(ctx context.Context, in stororders.InvoicePDFInput) (stororders.Invoice, []byte, error)
+	EditOrder(ctx context.Context, in stororders.EditOrderInput, execute stororders.RefundExecutor) (stororders.OrderEdit, error)
+	ListOrderEdits(ctx context.Context, orderID string) ([]stororders.OrderEdit, error)
+	AddOrderNote(ctx context.Context, in stororders.AddOrderNoteInput) (stororders.OrderNote, error)
+	ListOrderNotes(ctx context.Context, orderID string, customerOnly bool) ([]stororders.OrderNote, error)
 }
 
 type customersStore interface {
@@ -349,6 +502,9 @@ type catalogStore interface {
 	BulkAssignProductCategories(ctx context.Context, productIDs []string, categoryIDs []string) (int64, error)
 	BulkRemoveProductCategories(ctx context.Context, productIDs []string, categoryIDs []string) (int64, error)
 	ApplyDiscountToProducts(ctx context.Context, productIDs []string, in storcat.ProductDiscountInput) (int64, error)
+	ListAdminProducts(ctx context.Context, in storcat.AdminProductsParams) (storcat.ProductListResult, error)
+	GetAdminProduct(ctx context.Context, id string) (storcat.Product, error)
+	RotateProductPreviewToken(ctx context.Context, id string) (storcat.Product, error)
 	ListCustomOptions(ctx context.Context, in storcat.ListCustomOptionsParams) ([]storcat.ProductCustomOption, error)
 	CreateCustomOption(ctx context.Context, in storcat.CustomOptionUpsertInput) (storcat.ProductCustomOption, error)
 	GetCustomOptionByID(ctx context.Context, id string) (storcat.ProductCustomOption, error)
@@ -382,6 +538,13 @@ type upsertProductRequest struct {
 	Tags           []string `json:"tags"`
 	SEOTitle       *string  `json:"seo_title"`
 	SEODescription *string  `json:"seo_description"`
+	TaxClass       *string  `json:"tax_class"`
+	// PublishAt and UnpublishAt are RFC 3339 timestamps. On update null or
+	// omitted keeps the current bound and the clear flags remove it.
+	PublishAt        *time.Time `json:"publish_at"`
+	UnpublishAt      *time.Time `json:"unpublish_at"`
+	ClearPublishAt   bool       `json:"clear_publish_at"`
+	ClearUnpublishAt bool       `json:"clear_unpublish_at"`
 }
 
 type createVariantRequest struct {
@@ -389,6 +552,7 @@ type createVariantRequest struct {
 	PriceCents int     `json:"price_cents"`
 	Currency   *string `json:"currency"`
 	Stock      int     `json:"stock"`
+	TaxClass   *string `json:"tax_class"`
 }
 
 type replaceProductCategoriesRequest struct {
@@ -509,7 +673,7 @@ func (m *module) handleCatalogCategoryDetail(w http.ResponseWriter, r *http.Requ
 }
 
 func (m *module) handleCatalogProducts(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost || r.URL.Path != "/admin/catalog/products" {
+	if (r.Method != http.MethodPost && r.Method != http.MethodGet) || r.URL.Path != "/admin/catalog/products" {
 		http.NotFound(w, r)
 		return
 	}
@@ -517,6 +681,26 @@ func (m *module) handleCatalogProducts(w http.ResponseWriter, r *http.Request) {
 		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
 		return
 	}
+	if r.Method == http.MethodGet {
+		// Admins see every product, including drafts and scheduled ones.
+		qp := r.URL.Query()
+		res, err := m.catalog.ListAdminProducts(r.Context(), storcat.AdminProductsParams{
+			Pagination: storcat.Pagination{Page: atoiDefault(qp.Get("page"), 1), Limit: atoiDefault(qp.Get("limit"), 20)},
+			Status:     strings.ToLower(strings.TrimSpace(qp.Get("status"))),
+			Query:      strings.TrimSpace(qp.Get("q")),
+		})
+		if err != nil {
+			platformhttp.Error(w, http.StatusInternalServerError, "list products error")
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, map[string]any{
+			"items": res.Items,
+			"total": res.Total,
+			"page":  res.Page,
+			"limit": res.Limit,
+		})
+		return
+	}
 
 	var req upsertProductRequest
 	if err := decodeRequest(r, &req); err != nil {
@@ -640,6 +824,15 @@ func (m *module) handleCatalogProductDetailActions(w http.ResponseWriter, r *htt
 	id := strings.TrimSpace(parts[0])
 
 	if len(parts) == 1 {
+		if r.Method == http.MethodGet {
+			item, err := m.catalog.GetAdminProduct(r.Context(), id)
+			if err != nil {
+				writeCatalogStoreError(w, err, "get product error")
+				return
+			}
+			_ = platformhttp.JSON(w, http.StatusOK, item)
+			return
+		}
 		if r.Method == http.MethodDelete {
 			if err := m.catalog.DeleteProduct(r.Context(), id); err != nil {
 				writeCatalogStoreError(w, err, "delete product error")
@@ -676,6 +869,22 @@ func (m *module) handleCatalogProductDetailActions(w http.ResponseWriter, r *htt
 		return
 	}
 	switch parts[1] {
+	case "preview-token":
+		// A new token invalidates previously shared preview links.
+		if r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		item, err := m.catalog.RotateProductPreviewToken(r.Context(), id)
+		if err != nil {
+			writeCatalogStoreError(w, err, "preview token error")
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, map[string]any{
+			"product_id":    item.ID,
+			"preview_token": item.PreviewToken,
+			"preview_url":   "/products/" + item.Slug + "?preview=" + item.PreviewToken,
+		})
 	case "categories":
 		if r.Method != http.MethodPut {
 			http.NotFound(w, r)
@@ -805,29 +1014,44 @@ func validateProductRequest(req upsertProductRequest) (storcat.ProductUpsertInpu
 	if title == "" {
 		return storcat.ProductUpsertInput{}, errors.New("title is required")
 	}
-	status := "published"
+	status := storcat.ProductStatusPublished
 	if req.Status != nil {
 		status = strings.TrimSpace(strings.ToLower(*req.Status))
 		if status == "" {
-			status = "published"
+			status = storcat.ProductStatusPublished
 		}
 	}
-	if status != "published" && status != "inactive" {
-		return storcat.ProductUpsertInput{}, errors.New("status must be one of: published, inactive")
+	if status != storcat.ProductStatusPublished && status != storcat.ProductStatusDraft && status != storcat.ProductStatusInactive {
+		return storcat.ProductUpsertInput{}, errors.New("status must be one of: draft, published, inactive")
+	}
+	if (req.PublishAt != nil && req.ClearPublishAt) || (req.UnpublishAt != nil && req.ClearUnpublishAt) {
+		return storcat.ProductUpsertInput{}, errors.New("a publishing bound cannot be set and cleared at once")
+	}
+	if req.PublishAt != nil && req.UnpublishAt != nil && !req.UnpublishAt.After(*req.PublishAt) {
+		return storcat.ProductUpsertInput{}, errors.New("unpublish_at must be after publish_at")
 	}
 	tags := cleanNonEmptyStrings(req.Tags)
 	seoTitle, seoDescription, err := validateSEO(req.SEOTitle, req.SEODescription)
 	if err != nil {
 		return storcat.ProductUpsertInput{}, err
 	}
+	taxClass := ""
+	if v := normalizeOptionalString(req.TaxClass); v != nil {
+		taxClass = strings.ToLower(*v)
+	}
 	return storcat.ProductUpsertInput{
-		Slug:           slug,
-		Title:          title,
-		Description:    strings.TrimSpace(req.Description),
-		Status:         status,
-		Tags:           tags,
-		SEOTitle:       seoTitle,
-		SEODescription: seoDescription,
+		Slug:             slug,
+		Title:            title,
+		Description:      strings.TrimSpace(req.Description),
+		Status:           status,
+		Tags:             tags,
+		SEOTitle:         seoTitle,
+		SEODescription:   seoDescription,
+		TaxClass:         taxClass,
+		PublishAt:        req.PublishAt,
+		UnpublishAt:      req.UnpublishAt,
+		ClearPublishAt:   req.ClearPublishAt,
+		ClearUnpublishAt: req.ClearUnpublishAt,
 	}, nil
 }
 
@@ -849,11 +1073,17 @@ func validateVariantCreateRequest(req createVariantRequest) (storcat.ProductVari
 			currency = normalized
 		}
 	}
+	taxClass := normalizeOptionalString(req.TaxClass)
+	if taxClass != nil {
+		lower := strings.ToLower(*taxClass)
+		taxClass = &lower
+	}
 	return storcat.ProductVariantCreateInput{
 		SKU:        sku,
 		PriceCents: req.PriceCents,
 		Currency:   currency,
 		Stock:      req.Stock,
+		TaxClass:   taxClass,
 	}, nil
 }
 
@@ -905,6 +1135,12 @@ func writeCatalogStoreError(w http.ResponseWriter, err error, fallbackMessage st
 		platformhttp.Error(w, http.StatusNotFound, "not found")
 	case errors.Is(err, storcat.ErrConflict):
 		platformhttp.Error(w, http.StatusConflict, "conflict")
+	case errors.Is(err, storcat.ErrInvalidTaxClass):
+		platformhttp.Error(w, http.StatusBadRequest, "invalid tax_class")
+	case errors.Is(err, storcat.ErrInvalidPublishWindow):
+		platformhttp.Error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, storcat.ErrCategoryCycle):
+		platformhttp.Error(w, http.StatusBadRequest, "parent_id cannot be the category or one of its subcategories")
 	default:
 		platformhttp.Error(w, http.StatusInternalServerError, fallbackMessage)
 	}
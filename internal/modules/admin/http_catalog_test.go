@@ -33,6 +33,9 @@ type fakeCatalogStore struct {
 	listAssignmentsFn       func(context.Context, string) ([]storcat.ProductCustomOptionAssignment, error)
 	attachAssignmentFn      func(context.Context, string, string, *int) (storcat.ProductCustomOptionAssignment, error)
 	detachAssignmentFn      func(context.Context, string, string) error
+	listAdminProductsFn     func(context.Context, storcat.AdminProductsParams) (storcat.ProductListResult, error)
+	getAdminProductFn       func(context.Context, string) (storcat.Product, error)
+	rotatePreviewTokenFn    func(context.Context, string) (storcat.Product, error)
 }
 
 func (f *fakeCatalogStore) CreateCategory(ctx context.Context, in storcat.CategoryUpsertInput) (storcat.Category, error) {
@@ -155,6 +158,24 @@ func (f *fakeCatalogStore) DetachProductCustomOption(ctx context.Context, produc
 	}
 	return f.detachAssignmentFn(ctx, productID, optionID)
 }
+func (f *fakeCatalogStore) ListAdminProducts(ctx context.Context, in storcat.AdminProductsParams) (storcat.ProductListResult, error) {
+	if f.listAdminProductsFn == nil {
+		return storcat.ProductListResult{Items: []storcat.Product{}}, nil
+	}
+	return f.listAdminProductsFn(ctx, in)
+}
+func (f *fakeCatalogStore) GetAdminProduct(ctx context.Context, id string) (storcat.Product, error) {
+	if f.getAdminProductFn == nil {
+		return storcat.Product{}, nil
+	}
+	return f.getAdminProductFn(ctx, id)
+}
+func (f *fakeCatalogStore) RotateProductPreviewToken(ctx context.Context, id string) (storcat.Product, error) {
+	if f.rotatePreviewTokenFn == nil {
+		return storcat.Product{}, nil
+	}
+	return f.rotatePreviewTokenFn(ctx, id)
+}
 
 func TestCatalogCreateCategorySuccess(t *testing.T) {
 	store := &fakeCatalogStore{
@@ -186,6 +207,26 @@ func TestCatalogCreateCategorySuccess(t *testing.T) {
 	}
 }
 
+func TestCatalogUpdateCategoryRejectsCycle(t *testing.T) {
+	store := &fakeCatalogStore{
+		updateCategoryFn: func(_ context.Context, id string, in storcat.CategoryUpsertInput) (storcat.Category, error) {
+			if id != "cat-1" || in.ParentID == nil || *in.ParentID != "cat-3" {
+				t.Fatalf("unexpected update %s %+v", id, in)
+			}
+			return storcat.Category{}, storcat.ErrCategoryCycle
+		},
+	}
+	m := &module{catalog: store, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	body := map[string]any{"slug": "parent", "name": "Parent", "parent_id": "cat-3"}
+	res := performAdminJSONRequest(t, mux, http.MethodPatch, "/admin/catalog/categories/cat-1", body)
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, res.Code, res.Body.String())
+	}
+}
+
 func TestCatalogCreateCategoryValidationError(t *testing.T) {
 	m := &module{catalog: &fakeCatalogStore{}, user: "admin", pass: "pass"}
 	mux := http.NewServeMux()
@@ -404,6 +445,116 @@ func TestCatalogCreateProductVariantSuccess(t *testing.T) {
 	}
 }
 
+func TestCatalogListProductsIncludesDraftsAndPreviewToken(t *testing.T) {
+	var got storcat.AdminProductsParams
+	store := &fakeCatalogStore{
+		listAdminProductsFn: func(_ context.Context, in storcat.AdminProductsParams) (storcat.ProductListResult, error) {
+			got = in
+			return storcat.ProductListResult{Items: []storcat.Product{{ID: "prod-1", Slug: "draft-shoe", Status: storcat.ProductStatusDraft}}, Total: 1, Page: 1, Limit: 20}, nil
+		},
+		rotatePreviewTokenFn: func(_ context.Context, id string) (storcat.Product, error) {
+			if id != "prod-1" {
+				return storcat.Product{}, storcat.ErrNotFound
+			}
+			return storcat.Product{ID: id, Slug: "draft-shoe", PreviewToken: "tok"}, nil
+		},
+	}
+	m := &module{catalog: store, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodGet, "/admin/catalog/products?status=Draft&q=shoe", nil)
+	if res.Code != http.StatusOK || !bytes.Contains(res.Body.Bytes(), []byte(`"draft-shoe"`)) {
+		t.Fatalf("expected product list, got %d body=%s", res.Code, res.Body.String())
+	}
+	if got.Status != storcat.ProductStatusDraft || got.Query != "shoe" {
+		t.Fatalf("unexpected filters %#v", got)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/catalog/products/prod-1/preview-token", nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if payload["preview_url"] != "/products/draft-shoe?preview=tok" {
+		t.Fatalf("unexpected response payload: %#v", payload)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/catalog/products/missing/preview-token", nil)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, res.Code)
+	}
+}
+
+func TestCatalogCreateProductValidatesSchedule(t *testing.T) {
+	var created storcat.ProductUpsertInput
+	store := &fakeCatalogStore{
+		createProductFn: func(_ context.Context, in storcat.ProductUpsertInput) (storcat.Product, error) {
+			created = in
+			return storcat.Product{ID: "prod-1", Slug: in.Slug, Status: in.Status}, nil
+		},
+	}
+	m := &module{catalog: store, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	body := map[string]any{
+		"slug":         "spring-jacket",
+		"title":        "Spring jacket",
+		"status":       "draft",
+		"publish_at":   "2027-03-01T00:00:00Z",
+		"unpublish_at": "2027-02-01T00:00:00Z",
+	}
+	res := performAdminJSONRequest(t, mux, http.MethodPost, "/admin/catalog/products", body)
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, res.Code)
+	}
+	body["unpublish_at"] = "2027-06-01T00:00:00Z"
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/catalog/products", body)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusCreated, res.Code, res.Body.String())
+	}
+	if created.Status != storcat.ProductStatusDraft || created.PublishAt == nil || created.PublishAt.Month() != 3 || created.UnpublishAt == nil {
+		t.Fatalf("unexpected input: %#v", created)
+	}
+}
+
+func TestCatalogUpdateProductKeepsOmittedTaxClassAndSchedule(t *testing.T) {
+	var updated storcat.ProductUpsertInput
+	store := &fakeCatalogStore{
+		updateProductFn: func(_ context.Context, id string, in storcat.ProductUpsertInput) (storcat.Product, error) {
+			updated = in
+			return storcat.Product{ID: id, Slug: in.Slug, Status: in.Status}, nil
+		},
+	}
+	m := &module{catalog: store, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	// The web admin sends only these fields when editing a product.
+	body := map[string]any{"slug": "spring-jacket", "title": "Spring jacket", "status": "published"}
+	res := performAdminJSONRequest(t, mux, http.MethodPatch, "/admin/catalog/products/prod-1", body)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusOK, res.Code, res.Body.String())
+	}
+	if updated.TaxClass != "" || updated.PublishAt != nil || updated.UnpublishAt != nil || updated.ClearPublishAt || updated.ClearUnpublishAt {
+		t.Fatalf("expected omitted fields to be left unchanged, got %#v", updated)
+	}
+
+	body["clear_unpublish_at"] = true
+	res = performAdminJSONRequest(t, mux, http.MethodPatch, "/admin/catalog/products/prod-1", body)
+	if res.Code != http.StatusOK || !updated.ClearUnpublishAt || updated.ClearPublishAt {
+		t.Fatalf("expected unpublish_at to be cleared, got %d %#v", res.Code, updated)
+	}
+
+	body["unpublish_at"] = "2027-06-01T00:00:00Z"
+	res = performAdminJSONRequest(t, mux, http.MethodPatch, "/admin/catalog/products/prod-1", body)
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected setting and clearing a bound to be rejected, got %d", res.Code)
+	}
+}
+
 func performAdminJSONRequest(t *testing.T, h http.Handler, method, path string, body map[string]any) *httptest.ResponseRecorder {
 	t.Helper()
 	raw, err := json.Marshal(body)
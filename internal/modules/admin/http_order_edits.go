@@ -0,0 +1,154 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	platformhttp "goecommerce/internal/platform/http"
+	stororders "goecommerce/internal/storage/orders"
+)
+
+type editOrderRequest struct {
+	Reason          string                 `json:"reason"`
+	Lines           []editOrderLineRequest `json:"lines"`
+	Add             []addOrderLineRequest  `json:"add"`
+	ShippingAddress *stororders.Address    `json:"shipping_address"`
+	BillingAddress  *stororders.Address    `json:"billing_address"`
+}
+
+type editOrderLineRequest struct {
+	OrderItemID    string `json:"order_item_id"`
+	Quantity       *int   `json:"quantity"`
+	UnitPriceCents *int   `json:"unit_price_cents"`
+	PriceReason    string `json:"price_reason"`
+}
+
+type addOrderLineRequest struct {
+	ProductVariantID string `json:"product_variant_id"`
+	Quantity         int    `json:"quantity"`
+	UnitPriceCents   *int   `json:"unit_price_cents"`
+	PriceReason      string `json:"price_reason"`
+}
+
+type addOrderNoteRequest struct {
+	Visibility string `json:"visibility"`
+	Body       string `json:"body"`
+}
+
+// handleOrderEdits lists the edit history of an order and applies new edits.
+// A lower total on a paid order is refunded through the payment provider.
+func (m *module) handleOrderEdits(w http.ResponseWriter, r *http.Request, orderID string) {
+	if m.orders == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		items, err := m.orders.ListOrderEdits(r.Context(), orderID)
+		if err != nil {
+			platformhttp.Error(w, http.StatusInternalServerError, "list edits error")
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"items": items})
+	case http.MethodPost:
+		var req editOrderRequest
+		if err := decodeRequest(r, &req); err != nil {
+			platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		in := stororders.EditOrderInput{
+			OrderID:         orderID,
+			Reason:          req.Reason,
+			ShippingAddress: req.ShippingAddress,
+			BillingAddress:  req.BillingAddress,
+		}
+		in.Actor, _, _ = r.BasicAuth()
+		for _, line := range req.Lines {
+			in.Lines = append(in.Lines, stororders.EditOrderLine{
+				OrderItemID:    line.OrderItemID,
+				Quantity:       line.Quantity,
+				UnitPriceCents: line.UnitPriceCents,
+				PriceReason:    line.PriceReason,
+			})
+		}
+		for _, line := range req.Add {
+			in.Add = append(in.Add, stororders.AddOrderLine{
+				ProductVariantID: line.ProductVariantID,
+				Quantity:         line.Quantity,
+				UnitPriceCents:   line.UnitPriceCents,
+				PriceReason:      line.PriceReason,
+			})
+		}
+		edit, err := m.orders.EditOrder(r.Context(), in, func(o stororders.Order, amountCents int, idempotencyKey string) (string, string, error) {
+			return m.executeRefund(r.Context(), o, amountCents, idempotencyKey)
+		})
+		if err != nil {
+			var stockErr *stororders.InsufficientStockError
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				platformhttp.Error(w, http.StatusNotFound, "not found")
+			case errors.As(err, &stockErr):
+				_ = platformhttp.JSON(w, http.StatusConflict, map[string]any{
+					"error": "insufficient stock",
+					"lines": stockErr.Lines,
+				})
+			case errors.Is(err, stororders.ErrInvalidOrderEdit):
+				platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			case errors.Is(err, errRefundProvider):
+				// The edit is saved; only its refund failed and can be
+				// retried through the order's refunds.
+				log.Printf("admin: edit order %s: %v", orderID, err)
+				platformhttp.Error(w, http.StatusBadGateway, "order edited but the refund failed at the payment provider; retry it from the order's refunds")
+			default:
+				platformhttp.Error(w, http.StatusInternalServerError, "edit order error")
+			}
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusCreated, edit)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleOrderNotes lists and adds order notes. Notes with visibility
+// "customer" are also shown to the customer on their order.
+func (m *module) handleOrderNotes(w http.ResponseWriter, r *http.Request, orderID string) {
+	if m.orders == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		items, err := m.orders.ListOrderNotes(r.Context(), orderID, false)
+		if err != nil {
+			platformhttp.Error(w, http.StatusInternalServerError, "list notes error")
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"items": items})
+	case http.MethodPost:
+		var req addOrderNoteRequest
+		if err := decodeRequest(r, &req); err != nil {
+			platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		in := stororders.AddOrderNoteInput{OrderID: orderID, Visibility: req.Visibility, Body: req.Body}
+		in.Author, _, _ = r.BasicAuth()
+		note, err := m.orders.AddOrderNote(r.Context(), in)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				platformhttp.Error(w, http.StatusNotFound, "not found")
+			case errors.Is(err, stororders.ErrInvalidOrderNote):
+				platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			default:
+				platformhttp.Error(w, http.StatusInternalServerError, "add note error")
+			}
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusCreated, note)
+	default:
+		http.NotFound(w, r)
+	}
+}
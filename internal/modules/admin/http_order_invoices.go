@@ -0,0 +1,60 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	platformhttp "goecommerce/internal/platform/http"
+	stororders "goecommerce/internal/storage/orders"
+)
+
+// handleOrderInvoices serves /admin/orders/{id}/invoices and
+// /admin/orders/{id}/invoices/{invoiceID}/pdf; rest is the path after
+// "invoices". Invoices and credit notes are issued by the orders store when
+// an order is paid or refunded, so there is nothing to create here.
+func (m *module) handleOrderInvoices(w http.ResponseWriter, r *http.Request, orderID, rest string) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	if m.orders == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	invoiceID, action, _ := strings.Cut(strings.Trim(rest, "/"), "/")
+	switch {
+	case invoiceID == "":
+		items, err := m.orders.ListInvoices(r.Context(), orderID)
+		if err != nil {
+			platformhttp.Error(w, http.StatusInternalServerError, "list invoices error")
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"items": items})
+	case action == "pdf":
+		inv, data, err := m.orders.InvoicePDF(r.Context(), stororders.InvoicePDFInput{
+			OrderID:    orderID,
+			InvoiceID:  invoiceID,
+			Seller:     m.invoiceSeller,
+			UploadsDir: m.uploadsDir,
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				platformhttp.Error(w, http.StatusNotFound, "not found")
+				return
+			}
+			log.Printf("admin: invoice %s of order %s: %v", invoiceID, orderID, err)
+			platformhttp.Error(w, http.StatusInternalServerError, "invoice error")
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(inv.Number+".pdf"))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(data)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,151 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	platformhttp "goecommerce/internal/platform/http"
+	"goecommerce/internal/platform/payments"
+	stororders "goecommerce/internal/storage/orders"
+)
+
+type createRefundRequest struct {
+	AmountCents int                       `json:"amount_cents"`
+	Lines       []createRefundLineRequest `json:"lines"`
+	Reason      string                    `json:"reason"`
+	Restock     bool                      `json:"restock"`
+}
+
+type createRefundLineRequest struct {
+	OrderItemID string `json:"order_item_id"`
+	Quantity    int    `json:"quantity"`
+	AmountCents int    `json:"amount_cents"`
+}
+
+// handleOrderRefunds serves /admin/orders/{id}/refunds and the
+// /refunds/{refundID}/retry action; rest is the path after "refunds".
+func (m *module) handleOrderRefunds(w http.ResponseWriter, r *http.Request, orderID, rest string) {
+	if m.orders == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	refundID, action, _ := strings.Cut(strings.Trim(rest, "/"), "/")
+	if refundID != "" {
+		if action != "retry" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		refund, err := m.orders.RetryRefund(r.Context(), orderID, refundID, func(o stororders.Order, amountCents int, idempotencyKey string) (string, string, error) {
+			return m.executeRefund(r.Context(), o, amountCents, idempotencyKey)
+		})
+		if err != nil {
+			writeRefundError(w, orderID, err)
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, refund)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		items, err := m.orders.ListRefunds(r.Context(), orderID)
+		if err != nil {
+			platformhttp.Error(w, http.StatusInternalServerError, "list refunds error")
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"items": items})
+	case http.MethodPost:
+		var req createRefundRequest
+		if err := decodeRequest(r, &req); err != nil {
+			platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		in := stororders.CreateRefundInput{
+			OrderID:     orderID,
+			AmountCents: req.AmountCents,
+			Reason:      req.Reason,
+			Restock:     req.Restock,
+		}
+		in.CreatedBy, _, _ = r.BasicAuth()
+		for _, line := range req.Lines {
+			in.Lines = append(in.Lines, stororders.RefundLine{
+				OrderItemID: line.OrderItemID,
+				Quantity:    line.Quantity,
+				AmountCents: line.AmountCents,
+			})
+		}
+		refund, err := m.orders.CreateRefund(r.Context(), in, func(o stororders.Order, amountCents int, idempotencyKey string) (string, string, error) {
+			return m.executeRefund(r.Context(), o, amountCents, idempotencyKey)
+		})
+		if err != nil {
+			writeRefundError(w, orderID, err)
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusCreated, refund)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeRefundError(w http.ResponseWriter, orderID string, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		platformhttp.Error(w, http.StatusNotFound, "not found")
+	case errors.Is(err, stororders.ErrInvalidTransition):
+		platformhttp.Error(w, http.StatusConflict, "order is not refundable")
+	case errors.Is(err, stororders.ErrInvalidRefund):
+		platformhttp.Error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, errRefundProvider):
+		log.Printf("admin: refund order %s: %v", orderID, err)
+		platformhttp.Error(w, http.StatusBadGateway, "payment provider error")
+	default:
+		platformhttp.Error(w, http.StatusInternalServerError, "refund error")
+	}
+}
+
+var errRefundProvider = errors.New("refund provider error")
+
+// executeRefund returns the money through the order's payment provider.
+// Providers without a refund API (bank transfer, cash on delivery) are
+// refunded by hand, so the refund is only recorded.
+func (m *module) executeRefund(ctx context.Context, o stororders.Order, amountCents int, idempotencyKey string) (string, string, error) {
+	key := o.PaymentMethod
+	if key == "" {
+		key = "stripe"
+	}
+	prov, err := m.paymentProvider(ctx, key)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", errRefundProvider, err)
+	}
+	refunder, ok := prov.(payments.Refunder)
+	if !ok {
+		return key, "", nil
+	}
+	ref, err := refunder.Refund(ctx, o.PaymentRef, amountCents, idempotencyKey)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", errRefundProvider, err)
+	}
+	return key, ref, nil
+}
+
+// paymentProvider builds the configured provider for key, falling back to the
+// env-configured Stripe provider like checkout does when none is stored.
+func (m *module) paymentProvider(ctx context.Context, key string) (payments.Provider, error) {
+	if m.payments != nil {
+		p, err := m.payments.GetProvider(ctx, key)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if p != nil {
+			return payments.FromConfig(p.Key, p.Mode, p.ConfigJSON)
+		}
+	}
+	if key != "stripe" {
+		return nil, fmt.Errorf("payment provider %q not configured", key)
+	}
+	return payments.NewFromEnv(), nil
+}
@@ -0,0 +1,119 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	platformhttp "goecommerce/internal/platform/http"
+	stororders "goecommerce/internal/storage/orders"
+)
+
+type decideReturnRequest struct {
+	Note string `json:"note"`
+}
+
+type receiveReturnRequest struct {
+	Restock bool   `json:"restock"`
+	Note    string `json:"note"`
+}
+
+// handleReturnsQueue serves GET /admin/returns?status=, the returns waiting
+// on an admin across all orders (requested by default).
+func (m *module) handleReturnsQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || r.URL.Path != "/admin/returns" {
+		http.NotFound(w, r)
+		return
+	}
+	if m.orders == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	status := strings.TrimSpace(r.URL.Query().Get("status"))
+	switch status {
+	case "":
+		status = stororders.ReturnStatusRequested
+	case stororders.ReturnStatusRequested, stororders.ReturnStatusApproved, stororders.ReturnStatusRejected, stororders.ReturnStatusReceived:
+	default:
+		platformhttp.Error(w, http.StatusBadRequest, "invalid status")
+		return
+	}
+	items, err := m.orders.ListReturnsByStatus(r.Context(), status, atoiDefault(r.URL.Query().Get("limit"), 50))
+	if err != nil {
+		platformhttp.Error(w, http.StatusInternalServerError, "list returns error")
+		return
+	}
+	_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// handleOrderReturns serves /admin/orders/{id}/returns and the
+// /returns/{returnID}/approve, /reject and /receive actions; rest is the path
+// after "returns".
+func (m *module) handleOrderReturns(w http.ResponseWriter, r *http.Request, orderID, rest string) {
+	if m.orders == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	returnID, action, _ := strings.Cut(strings.Trim(rest, "/"), "/")
+	actor, _, _ := r.BasicAuth()
+	switch {
+	case returnID == "" && r.Method == http.MethodGet:
+		items, err := m.orders.ListReturns(r.Context(), orderID)
+		if err != nil {
+			platformhttp.Error(w, http.StatusInternalServerError, "list returns error")
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"items": items})
+	case returnID != "" && (action == "approve" || action == "reject") && r.Method == http.MethodPost:
+		var req decideReturnRequest
+		if err := decodeRequest(r, &req); err != nil {
+			platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		ret, err := m.orders.DecideReturn(r.Context(), orderID, returnID, action == "approve", req.Note, actor)
+		if err != nil {
+			writeReturnError(w, orderID, err)
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, ret)
+	case returnID != "" && action == "receive" && r.Method == http.MethodPost:
+		var req receiveReturnRequest
+		if err := decodeRequest(r, &req); err != nil {
+			platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		in := stororders.ReceiveReturnInput{
+			OrderID:  orderID,
+			ReturnID: returnID,
+			Restock:  req.Restock,
+			Note:     req.Note,
+			Actor:    actor,
+		}
+		ret, err := m.orders.ReceiveReturn(r.Context(), in, func(o stororders.Order, amountCents int, idempotencyKey string) (string, string, error) {
+			return m.executeRefund(r.Context(), o, amountCents, idempotencyKey)
+		})
+		if err != nil {
+			writeReturnError(w, orderID, err)
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, ret)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeReturnError(w http.ResponseWriter, orderID string, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		platformhttp.Error(w, http.StatusNotFound, "not found")
+	case errors.Is(err, stororders.ErrInvalidReturn):
+		platformhttp.Error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, errRefundProvider):
+		log.Printf("admin: refund return of order %s: %v", orderID, err)
+		platformhttp.Error(w, http.StatusBadGateway, "payment provider error")
+	default:
+		platformhttp.Error(w, http.StatusInternalServerError, "return error")
+	}
+}
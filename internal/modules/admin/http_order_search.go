@@ -0,0 +1,213 @@
+package admin
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	platformhttp "goecommerce/internal/platform/http"
+	"goecommerce/internal/platform/xlsx"
+	stororders "goecommerce/internal/storage/orders"
+)
+
+// parseOrderSearch reads the order list filters shared by GET /admin/orders
+// and its export: status (comma separated or repeated), from/to (RFC 3339 or
+// YYYY-MM-DD, to inclusive of the whole day), email, number (prefix),
+// min_total/max_total (cents), payment_method and q (buyer name).
+func parseOrderSearch(qp url.Values) (stororders.SearchOrdersParams, error) {
+	in := stororders.SearchOrdersParams{
+		Page:          atoiDefault(qp.Get("page"), 1),
+		Limit:         atoiDefault(qp.Get("limit"), 20),
+		Email:         strings.TrimSpace(qp.Get("email")),
+		NumberPrefix:  strings.TrimSpace(qp.Get("number")),
+		PaymentMethod: strings.TrimSpace(qp.Get("payment_method")),
+		Query:         strings.TrimSpace(qp.Get("q")),
+		PaymentIssue:  qp.Get("payment_issue") == "true",
+	}
+	for _, raw := range qp["status"] {
+		for _, status := range strings.Split(raw, ",") {
+			status = strings.TrimSpace(status)
+			if status == "" {
+				continue
+			}
+			if !stororders.IsValidStatus(status) {
+				return in, fmt.Errorf("invalid status %q", status)
+			}
+			in.Statuses = append(in.Statuses, status)
+		}
+	}
+	from, err := parseLogDate(qp.Get("from"), false)
+	if err != nil {
+		return in, errors.New("invalid from date")
+	}
+	in.From = from
+	to, err := parseLogDate(qp.Get("to"), true)
+	if err != nil {
+		return in, errors.New("invalid to date")
+	}
+	if to != nil {
+		// parseLogDate ends a plain date at its last nanosecond; the store
+		// treats To as exclusive.
+		next := to.Add(time.Nanosecond)
+		in.To = &next
+	}
+	for _, bound := range []struct {
+		name string
+		dst  **int
+	}{{"min_total", &in.MinTotalCents}, {"max_total", &in.MaxTotalCents}} {
+		raw := strings.TrimSpace(qp.Get(bound.name))
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return in, fmt.Errorf("invalid %s", bound.name)
+		}
+		*bound.dst = &n
+	}
+	return in, nil
+}
+
+func orderCustomerName(o stororders.Order) string {
+	if o.BillingAddress != nil && o.BillingAddress.FullName != "" {
+		return o.BillingAddress.FullName
+	}
+	if o.ShippingAddress != nil {
+		return o.ShippingAddress.FullName
+	}
+	return ""
+}
+
+var orderExportHeader = []string{
+	"number", "created_at", "status", "customer_name", "email", "customer_vat", "payment_method", "payment_ref", "paid_at",
+	"currency", "subtotal", "shipping", "tax", "total",
+}
+
+// orderExportRow lists an order's export columns. Amounts are in major
+// units so spreadsheets can sum them directly.
+func orderExportRow(o stororders.Order) []any {
+	paidAt := ""
+	if o.PaidAt != nil {
+		paidAt = o.PaidAt.UTC().Format(time.RFC3339)
+	}
+	return []any{
+		o.Number, o.CreatedAt.UTC().Format(time.RFC3339), o.Status, orderCustomerName(o), o.Email, o.CustomerVAT,
+		o.PaymentMethod, o.PaymentRef, paidAt, o.Currency,
+		float64(o.SubtotalCents) / 100, float64(o.ShippingCents) / 100, float64(o.TaxCents) / 100, float64(o.TotalCents) / 100,
+	}
+}
+
+// csvCell formats a cell for CSV. Text starting like a formula is prefixed
+// with an apostrophe so spreadsheet apps do not evaluate customer input.
+func csvCell(v any) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// handleOrderExport streams GET /admin/orders/export?format=csv|xlsx with the
+// list filters. Rows go to the client as they are read, so nothing but the
+// current row is held in memory.
+func (m *module) handleOrderExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	if m.orders == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	qp := r.URL.Query()
+	in, err := parseOrderSearch(qp)
+	if err != nil {
+		platformhttp.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	format := strings.ToLower(strings.TrimSpace(qp.Get("format")))
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "xlsx" {
+		platformhttp.Error(w, http.StatusBadRequest, "format must be csv or xlsx")
+		return
+	}
+
+	filename := "orders-" + time.Now().UTC().Format("20060102-150405") + "." + format
+	var (
+		writeRow func([]any) error
+		finish   func() error
+	)
+	// Headers go out with the first row, so a failing query can still be
+	// answered with an error status.
+	started := false
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(filename))
+		if format == "xlsx" {
+			w.Header().Set("Content-Type", xlsx.ContentType)
+			xw, err := xlsx.NewWriter(w, "Orders")
+			if err != nil {
+				return err
+			}
+			writeRow = func(cells []any) error { return xw.WriteRow(cells...) }
+			finish = xw.Close
+		} else {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			cw := csv.NewWriter(w)
+			writeRow = func(cells []any) error {
+				record := make([]string, len(cells))
+				for i, c := range cells {
+					record[i] = csvCell(c)
+				}
+				return cw.Write(record)
+			}
+			finish = func() error {
+				cw.Flush()
+				return cw.Error()
+			}
+		}
+		header := make([]any, len(orderExportHeader))
+		for i, h := range orderExportHeader {
+			header[i] = h
+		}
+		return writeRow(header)
+	}
+
+	err = m.orders.ExportOrders(r.Context(), in, func(o stororders.Order) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return writeRow(orderExportRow(o))
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = finish()
+	}
+	if err != nil {
+		if !started {
+			platformhttp.Error(w, http.StatusInternalServerError, "export error")
+			return
+		}
+		// The response is already under way; the client gets a truncated
+		// file.
+		log.Printf("admin: order export: %v", err)
+	}
+}
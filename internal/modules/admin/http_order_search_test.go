@@ -0,0 +1,105 @@
+package admin
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	stororders "goecommerce/internal/storage/orders"
+)
+
+func TestAdminOrderListParsesFilters(t *testing.T) {
+	store := &fakeOrdersStore{items: map[string]stororders.Order{
+		"o1": {ID: "o1", Number: "ORD-20261017-000001", Status: "paid", Email: "jane@example.com", BillingAddress: &stororders.Address{FullName: "Jane Doe"}},
+		"o2": {ID: "o2", Number: "ORD-20261017-000002", Status: "shipped", Email: "john@example.com"},
+		"o3": {ID: "o3", Number: "ORD-20261016-000001", Status: "cancelled", Email: "jane@example.com"},
+	}}
+	m := &module{orders: store, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodGet,
+		"/admin/orders?status=paid,shipped&number=ORD-20261017&email=JANE@example.com&from=2026-10-01&to=2026-10-17&min_total=100&max_total=5000&payment_method=stripe&q=jan&page=2&limit=5", nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	if !strings.Contains(res.Body.String(), `"customer_name":"Jane Doe"`) || !strings.Contains(res.Body.String(), `"total":1`) {
+		t.Fatalf("unexpected body %s", res.Body.String())
+	}
+	in := store.lastSearch
+	if !slices.Equal(in.Statuses, []string{"paid", "shipped"}) || in.NumberPrefix != "ORD-20261017" || in.PaymentMethod != "stripe" || in.Query != "jan" || in.Page != 2 || in.Limit != 5 {
+		t.Fatalf("unexpected filter %+v", in)
+	}
+	if in.MinTotalCents == nil || *in.MinTotalCents != 100 || in.MaxTotalCents == nil || *in.MaxTotalCents != 5000 {
+		t.Fatalf("unexpected total range %+v", in)
+	}
+	if in.From == nil || !in.From.Equal(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)) || in.To == nil || !in.To.Equal(time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the to date to include the whole day, got %v - %v", in.From, in.To)
+	}
+
+	for _, query := range []string{"status=lost", "from=yesterday", "min_total=-1", "max_total=abc"} {
+		res := performAdminJSONRequest(t, mux, http.MethodGet, "/admin/orders?"+query, nil)
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", query, res.Code)
+		}
+	}
+}
+
+func TestAdminOrderExportStreamsCSVAndXLSX(t *testing.T) {
+	paidAt := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	store := &fakeOrdersStore{items: map[string]stororders.Order{
+		"o1": {
+			ID: "o1", Number: "ORD-1", Status: "paid", Currency: "EUR", Email: "jane@example.com", PaymentMethod: "stripe", PaidAt: &paidAt,
+			SubtotalCents: 1000, ShippingCents: 500, TaxCents: 260, TotalCents: 1500, CreatedAt: paidAt,
+			BillingAddress: &stororders.Address{FullName: "=HYPERLINK(\"x\")"},
+		},
+		"o2": {ID: "o2", Number: "ORD-2", Status: "cancelled", Currency: "EUR", TotalCents: 999},
+	}}
+	m := &module{orders: store, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodGet, "/admin/orders/export?status=paid", nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	if got := res.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Fatalf("unexpected content type %q", got)
+	}
+	if !strings.HasPrefix(res.Header().Get("Content-Disposition"), `attachment; filename="orders-`) {
+		t.Fatalf("unexpected content disposition %q", res.Header().Get("Content-Disposition"))
+	}
+	records, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(records) != 2 || records[0][0] != "number" {
+		t.Fatalf("expected header and one order, got %v", records)
+	}
+	row := records[1]
+	if row[0] != "ORD-1" || row[3] != "'=HYPERLINK(\"x\")" || row[8] != "2026-10-17T09:00:00Z" || row[13] != "15.00" {
+		t.Fatalf("unexpected row %q", row)
+	}
+
+	res = performAdminJSONRequest(t, mux, http.MethodGet, "/admin/orders/export?format=xlsx", nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(res.Body.Bytes()), int64(res.Body.Len()))
+	if err != nil {
+		t.Fatalf("expected an xlsx zip: %v", err)
+	}
+	if len(zr.File) != 5 {
+		t.Fatalf("expected 5 workbook parts, got %d", len(zr.File))
+	}
+
+	res = performAdminJSONRequest(t, mux, http.MethodGet, "/admin/orders/export?format=pdf", nil)
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown format, got %d", res.Code)
+	}
+}
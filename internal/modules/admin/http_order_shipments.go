@@ -0,0 +1,263 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	platformhttp "goecommerce/internal/platform/http"
+	"goecommerce/internal/platform/shipping"
+	_ "goecommerce/internal/platform/shipping/providers/omniva"
+	stororders "goecommerce/internal/storage/orders"
+	storshiping "goecommerce/internal/storage/shipping"
+)
+
+type shippingProvidersStore interface {
+	GetProvider(ctx context.Context, key string) (*storshiping.Provider, error)
+}
+
+type createShipmentRequest struct {
+	ProviderKey    string                      `json:"provider_key"`
+	TrackingNumber string                      `json:"tracking_number"`
+	TrackingURL    string                      `json:"tracking_url"`
+	ShippedAt      *time.Time                  `json:"shipped_at"`
+	Lines          []createShipmentLineRequest `json:"lines"`
+	CreateLabel    bool                        `json:"create_label"`
+}
+
+type createShipmentLineRequest struct {
+	OrderItemID string `json:"order_item_id"`
+	Quantity    int    `json:"quantity"`
+}
+
+type updateShipmentRequest struct {
+	TrackingNumber *string    `json:"tracking_number"`
+	TrackingURL    *string    `json:"tracking_url"`
+	Status         string     `json:"status"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+// handleOrderShipments serves /admin/orders/{id}/shipments,
+// /admin/orders/{id}/shipments/{shipmentID} and its /label and /cancel
+// actions; rest is the path after "shipments".
+func (m *module) handleOrderShipments(w http.ResponseWriter, r *http.Request, orderID, rest string) {
+	if m.orders == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	shipmentID, action, _ := strings.Cut(strings.Trim(rest, "/"), "/")
+	switch {
+	case shipmentID != "" && action == "label" && r.Method == http.MethodGet:
+		m.handleShipmentLabel(w, r, orderID, shipmentID)
+	case shipmentID != "" && action == "cancel" && r.Method == http.MethodPost:
+		actor, _, _ := r.BasicAuth()
+		shipment, err := m.orders.CancelShipment(r.Context(), orderID, shipmentID, actor, func(sh stororders.Shipment) error {
+			return m.cancelCarrierShipment(r.Context(), sh)
+		})
+		if err != nil {
+			writeShipmentError(w, err)
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, shipment)
+	case shipmentID == "" && r.Method == http.MethodGet:
+		items, err := m.orders.ListShipments(r.Context(), orderID)
+		if err != nil {
+			platformhttp.Error(w, http.StatusInternalServerError, "list shipments error")
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"items": items})
+	case shipmentID == "" && r.Method == http.MethodPost:
+		var req createShipmentRequest
+		if err := decodeRequest(r, &req); err != nil {
+			platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		in := stororders.CreateShipmentInput{
+			OrderID:        orderID,
+			ProviderKey:    req.ProviderKey,
+			TrackingNumber: req.TrackingNumber,
+			TrackingURL:    req.TrackingURL,
+			ShippedAt:      req.ShippedAt,
+		}
+		in.CreatedBy, _, _ = r.BasicAuth()
+		for _, line := range req.Lines {
+			in.Lines = append(in.Lines, stororders.ShipmentLine{OrderItemID: line.OrderItemID, Quantity: line.Quantity})
+		}
+		var book stororders.ShipmentBooker
+		if req.CreateLabel {
+			o, err := m.orders.GetOrderByID(r.Context(), orderID)
+			if err != nil {
+				writeShipmentError(w, err)
+				return
+			}
+			book = func(sh stororders.Shipment) (stororders.CarrierBooking, error) {
+				return m.bookCarrierShipment(r.Context(), o, sh)
+			}
+		}
+		shipment, err := m.orders.CreateShipment(r.Context(), in, book)
+		if err != nil {
+			writeShipmentError(w, err)
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusCreated, shipment)
+	case shipmentID != "" && action == "" && r.Method == http.MethodPatch:
+		var req updateShipmentRequest
+		if err := decodeRequest(r, &req); err != nil {
+			platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		status := strings.TrimSpace(req.Status)
+		if status != "" && status != stororders.ShipmentStatusDelivered {
+			platformhttp.Error(w, http.StatusBadRequest, "invalid status")
+			return
+		}
+		in := stororders.UpdateShipmentInput{
+			OrderID:        orderID,
+			ShipmentID:     shipmentID,
+			TrackingNumber: req.TrackingNumber,
+			TrackingURL:    req.TrackingURL,
+			Delivered:      status == stororders.ShipmentStatusDelivered,
+			DeliveredAt:    req.DeliveredAt,
+		}
+		in.Actor, _, _ = r.BasicAuth()
+		shipment, err := m.orders.UpdateShipment(r.Context(), in)
+		if err != nil {
+			writeShipmentError(w, err)
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, shipment)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeShipmentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		platformhttp.Error(w, http.StatusNotFound, "not found")
+	case errors.Is(err, stororders.ErrInvalidTransition):
+		platformhttp.Error(w, http.StatusConflict, "order cannot be shipped")
+	case errors.Is(err, stororders.ErrInvalidShipment):
+		platformhttp.Error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, errLabelsUnsupported):
+		platformhttp.Error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, errCarrier):
+		log.Printf("admin: shipment carrier call: %v", err)
+		platformhttp.Error(w, http.StatusBadGateway, "carrier error")
+	default:
+		platformhttp.Error(w, http.StatusInternalServerError, "shipment error")
+	}
+}
+
+// handleShipmentLabel downloads the carrier label of a shipment booked with
+// create_label. Labels are fetched from the carrier on every request rather
+// than stored.
+func (m *module) handleShipmentLabel(w http.ResponseWriter, r *http.Request, orderID, shipmentID string) {
+	sh, err := m.orders.GetShipment(r.Context(), orderID, shipmentID)
+	if err != nil {
+		writeShipmentError(w, err)
+		return
+	}
+	if sh.CarrierRef == "" {
+		platformhttp.Error(w, http.StatusNotFound, "shipment has no carrier label")
+		return
+	}
+	labels, err := m.labelProvider(r.Context(), sh.ProviderKey)
+	if err != nil {
+		writeShipmentError(w, err)
+		return
+	}
+	label, err := labels.GetLabel(r.Context(), sh.CarrierRef)
+	if err != nil {
+		writeShipmentError(w, fmt.Errorf("%w: %v", errCarrier, err))
+		return
+	}
+	name := sh.TrackingNumber
+	if name == "" {
+		name = sh.ID
+	}
+	w.Header().Set("Content-Type", label.ContentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote("label-"+name+".pdf"))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(label.Data)
+}
+
+var (
+	errLabelsUnsupported = errors.New("carrier does not support labels")
+	errCarrier           = errors.New("carrier error")
+)
+
+// bookCarrierShipment registers the shipment with its carrier, addressed to
+// the order's shipping address or parcel terminal.
+func (m *module) bookCarrierShipment(ctx context.Context, o stororders.Order, sh stororders.Shipment) (stororders.CarrierBooking, error) {
+	labels, err := m.labelProvider(ctx, sh.ProviderKey)
+	if err != nil {
+		return stororders.CarrierBooking{}, err
+	}
+	req := shipping.ShipmentRequest{
+		Reference:  o.Number,
+		TerminalID: o.Shipping.TerminalID,
+		Parcels:    1,
+		Recipient:  shipping.Address{Email: o.Email},
+	}
+	if sh.ProviderKey == o.Shipping.ProviderKey {
+		req.ServiceCode = o.Shipping.ServiceCode
+	}
+	if a := o.ShippingAddress; a != nil {
+		req.Recipient.Name = a.FullName
+		req.Recipient.Phone = a.Phone
+		req.Recipient.Street = strings.TrimSpace(a.Address1 + " " + a.Address2)
+		req.Recipient.City = a.City
+		req.Recipient.Postcode = a.Postcode
+		req.Recipient.Country = a.Country
+	}
+	created, err := labels.CreateShipment(ctx, req)
+	if err != nil {
+		return stororders.CarrierBooking{}, fmt.Errorf("%w: %v", errCarrier, err)
+	}
+	return stororders.CarrierBooking{Ref: created.Ref, TrackingNumber: created.TrackingNumber, TrackingURL: created.TrackingURL}, nil
+}
+
+func (m *module) cancelCarrierShipment(ctx context.Context, sh stororders.Shipment) error {
+	labels, err := m.labelProvider(ctx, sh.ProviderKey)
+	if err != nil {
+		return err
+	}
+	if err := labels.CancelShipment(ctx, sh.CarrierRef); err != nil {
+		return fmt.Errorf("%w: %v", errCarrier, err)
+	}
+	return nil
+}
+
+// labelProvider builds the configured shipping provider for key and checks
+// that it can print labels.
+func (m *module) labelProvider(ctx context.Context, key string) (shipping.LabelProvider, error) {
+	if m.shipping == nil {
+		return nil, fmt.Errorf("%w: shipping providers unavailable", errCarrier)
+	}
+	p, err := m.shipping.GetProvider(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCarrier, err)
+	}
+	factory, err := shipping.Get(p.Key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errLabelsUnsupported, key)
+	}
+	config := decodeProviderConfig(p.ConfigJSON)
+	config["mode"] = p.Mode
+	prov, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCarrier, err)
+	}
+	labels, ok := prov.(shipping.LabelProvider)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errLabelsUnsupported, key)
+	}
+	return labels, nil
+}
@@ -0,0 +1,1029 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"goecommerce/internal/platform/invoices"
+	stororders "goecommerce/internal/storage/orders"
+	storpayments "goecommerce/internal/storage/payments"
+	storshiping "goecommerce/internal/storage/shipping"
+)
+
+type fakeOrdersStore struct {
+	items     map[string]stororders.Order
+	refunds   []stororders.Refund
+	shipments []stororders.Shipment
+	returns   []stororders.Return
+	invoices  []stororders.Invoice
+	edits     []stororders.OrderEdit
+	notes     []stororders.OrderNote
+	// lastSearch is the filter of the latest SearchOrders call.
+	lastSearch stororders.SearchOrdersParams
+}
+
+func (f *fakeOrdersStore) GetOrderMetrics(context.Context) (stororders.OrderMetrics, error) {
+	return stororders.OrderMetrics{}, nil
+}
+
+func (f *fakeOrdersStore) ListOrders(context.Context, int, int) ([]stororders.Order, error) {
+	out := make([]stororders.Order, 0, len(f.items))
+	for _, o := range f.items {
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+// SearchOrders applies the status, email and number filters, which is all
+// the handler tests need; the SQL filters are covered in storage.
+func (f *fakeOrdersStore) SearchOrders(_ context.Context, in stororders.SearchOrdersParams) (stororders.OrdersPage, error) {
+	f.lastSearch = in
+	out := stororders.OrdersPage{Items: []stororders.Order{}, Page: in.Page, Limit: in.Limit}
+	_ = f.ExportOrders(context.Background(), in, func(o stororders.Order) error {
+		out.Items = append(out.Items, o)
+		return nil
+	})
+	out.Total = len(out.Items)
+	return out, nil
+}
+
+func (f *fakeOrdersStore) ExportOrders(_ context.Context, in stororders.SearchOrdersParams, fn func(stororders.Order) error) error {
+	ids := make([]string, 0, len(f.items))
+	for id := range f.items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		o := f.items[id]
+		if len(in.Statuses) > 0 && !slices.Contains(in.Statuses, o.Status) {
+			continue
+		}
+		if in.Email != "" && !strings.EqualFold(in.Email, o.Email) {
+			continue
+		}
+		if !strings.HasPrefix(o.Number, in.NumberPrefix) {
+			continue
+		}
+		if err := fn(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeOrdersStore) GetOrderByID(_ context.Context, id string) (stororders.Order, error) {
+	o, ok := f.items[id]
+	if !ok {
+		return stororders.Order{}, sql.ErrNoRows
+	}
+	return o, nil
+}
+
+func (f *fakeOrdersStore) UpdateOrderStatus(_ context.Context, id string, status string, actor string, note string) error {
+	o, ok := f.items[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if !stororders.CanTransition(o.Status, status) {
+		return stororders.ErrInvalidTransition
+	}
+	o.StatusHistory = append(o.StatusHistory, stororders.StatusChange{From: o.Status, To: status, Actor: actor, Note: note})
+	o.Status = status
+	f.items[id] = o
+	return nil
+}
+
+func (f *fakeOrdersStore) MarkOrderPaid(_ context.Context, id string, confirmedBy string) (stororders.Order, error) {
+	o, ok := f.items[id]
+	if !ok {
+		return stororders.Order{}, sql.ErrNoRows
+	}
+	if o.Status != "pending_payment" && o.Status != "awaiting_payment_offline" {
+		return stororders.Order{}, stororders.ErrInvalidTransition
+	}
+	now := time.Now()
+	o.Status = "paid"
+	o.PaidAt = &now
+	o.PaymentConfirmedBy = confirmedBy
+	f.items[id] = o
+	return o, nil
+}
+
+func (f *fakeOrdersStore) CreateRefund(_ context.Context, in stororders.CreateRefundInput, execute stororders.RefundExecutor) (stororders.Refund, error) {
+	o, ok := f.items[in.OrderID]
+	if !ok {
+		return stororders.Refund{}, sql.ErrNoRows
+	}
+	if o.Status != "paid" && o.Status != "partially_refunded" {
+		return stororders.Refund{}, stororders.ErrInvalidTransition
+	}
+	refunded := 0
+	for _, r := range f.refunds {
+		refunded += r.AmountCents
+	}
+	amount := in.AmountCents
+	for _, line := range in.Lines {
+		amount += line.AmountCents
+	}
+	if amount <= 0 || refunded+amount > o.TotalCents {
+		return stororders.Refund{}, fmt.Errorf("%w: amount exceeds refundable balance", stororders.ErrInvalidRefund)
+	}
+	id := fmt.Sprintf("r%d", len(f.refunds)+1)
+	provider, ref, err := execute(o, amount, id)
+	if err != nil {
+		return stororders.Refund{}, err
+	}
+	refund := stororders.Refund{ID: id, OrderID: o.ID, Status: stororders.RefundStatusSucceeded, AmountCents: amount, Provider: provider, ProviderRef: ref, CreatedBy: in.CreatedBy, Lines: in.Lines}
+	f.refunds = append(f.refunds, refund)
+	o.Status = "partially_refunded"
+	if refunded+amount == o.TotalCents {
+		o.Status = "refunded"
+	}
+	f.items[o.ID] = o
+	return refund, nil
+}
+
+func (f *fakeOrdersStore) ListRefunds(context.Context, string) ([]stororders.Refund, error) {
+	return f.refunds, nil
+}
+
+func (f *fakeOrdersStore) RetryRefund(_ context.Context, orderID, refundID string, execute stororders.RefundExecutor) (stororders.Refund, error) {
+	for i, refund := range f.refunds {
+		if refund.ID != refundID || refund.OrderID != orderID {
+			continue
+		}
+		if refund.Status != stororders.RefundStatusPending {
+			return stororders.Refund{}, fmt.Errorf("%w: only pending refunds can be retried", stororders.ErrInvalidRefund)
+		}
+		provider, ref, err := execute(f.items[orderID], refund.AmountCents, refund.ID)
+		if err != nil {
+			f.refunds[i].Status = stororders.RefundStatusFailed
+			return stororders.Refund{}, err
+		}
+		refund.Status, refund.Provider, refund.ProviderRef = stororders.RefundStatusSucceeded, provider, ref
+		f.refunds[i] = refund
+		return refund, nil
+	}
+	return stororders.Refund{}, sql.ErrNoRows
+}
+
+func (f *fakeOrdersStore) CreateShipment(_ context.Context, in stororders.CreateShipmentInput, book stororders.ShipmentBooker) (stororders.Shipment, error) {
+	o, ok := f.items[in.OrderID]
+	if !ok {
+		return stororders.Shipment{}, sql.ErrNoRows
+	}
+	if o.Status != "paid" && o.Status != "processing" && o.Status != "partially_shipped" {
+		return stororders.Shipment{}, stororders.ErrInvalidTransition
+	}
+	shipped := map[string]int{}
+	for _, sh := range f.shipments {
+		if sh.Status == stororders.ShipmentStatusCancelled {
+			continue
+		}
+		for _, line := range sh.Lines {
+			shipped[line.OrderItemID] += line.Quantity
+		}
+	}
+	for _, line := range in.Lines {
+		shipped[line.OrderItemID] += line.Quantity
+	}
+	o.Status = "shipped"
+	for _, it := range o.Items {
+		if shipped[it.ID] > it.Quantity {
+			return stororders.Shipment{}, fmt.Errorf("%w: quantity exceeds unshipped quantity", stororders.ErrInvalidShipment)
+		}
+		if shipped[it.ID] < it.Quantity {
+			o.Status = "partially_shipped"
+		}
+	}
+	sh := stororders.Shipment{ID: fmt.Sprintf("s%d", len(f.shipments)+1), OrderID: o.ID, ProviderKey: in.ProviderKey, TrackingNumber: in.TrackingNumber, Status: stororders.ShipmentStatusShipped, CreatedBy: in.CreatedBy, Lines: in.Lines}
+	if book != nil {
+		booking, err := book(sh)
+		if err != nil {
+			return stororders.Shipment{}, err
+		}
+		sh.CarrierRef, sh.TrackingNumber, sh.TrackingURL = booking.Ref, booking.TrackingNumber, booking.TrackingURL
+	}
+	f.items[o.ID] = o
+	f.shipments = append(f.shipments, sh)
+	return sh, nil
+}
+
+func (f *fakeOrdersStore) CancelShipment(_ context.Context, orderID, shipmentID, _ string, cancel stororders.ShipmentCanceller) (stororders.Shipment, error) {
+	for i, sh := range f.shipments {
+		if sh.ID != shipmentID || sh.OrderID != orderID {
+			continue
+		}
+		if sh.Status != stororders.ShipmentStatusShipped {
+			return stororders.Shipment{}, fmt.Errorf("%w: shipment cannot be cancelled", stororders.ErrInvalidShipment)
+		}
+		if cancel != nil && sh.CarrierRef != "" {
+			if err := cancel(sh); err != nil {
+				return stororders.Shipment{}, err
+			}
+		}
+		now := time.Now()
+		sh.Status, sh.CancelledAt = stororders.ShipmentStatusCancelled, &now
+		f.shipments[i] = sh
+		o := f.items[orderID]
+		o.Status = "processing"
+		for _, other := range f.shipments {
+			if other.OrderID == orderID && other.Status != stororders.ShipmentStatusCancelled {
+				o.Status = "partially_shipped"
+			}
+		}
+		f.items[orderID] = o
+		return sh, nil
+	}
+	return stororders.Shipment{}, sql.ErrNoRows
+}
+
+func (f *fakeOrdersStore) GetShipment(_ context.Context, orderID, shipmentID string) (stororders.Shipment, error) {
+	for _, sh := range f.shipments {
+		if sh.ID == shipmentID && sh.OrderID == orderID {
+			return sh, nil
+		}
+	}
+	return stororders.Shipment{}, sql.ErrNoRows
+}
+
+func (f *fakeOrdersStore) UpdateShipment(_ context.Context, in stororders.UpdateShipmentInput) (stororders.Shipment, error) {
+	for i, sh := range f.shipments {
+		if sh.ID != in.ShipmentID || sh.OrderID != in.OrderID {
+			continue
+		}
+		if in.TrackingNumber != nil {
+			sh.TrackingNumber = *in.TrackingNumber
+		}
+		if in.Delivered {
+			now := time.Now()
+			sh.Status, sh.DeliveredAt = stororders.ShipmentStatusDelivered, &now
+		}
+		f.shipments[i] = sh
+		return sh, nil
+	}
+	return stororders.Shipment{}, sql.ErrNoRows
+}
+
+func (f *fakeOrdersStore) ListShipments(_ context.Context, orderID string) ([]stororders.Shipment, error) {
+	out := []stororders.Shipment{}
+	for _, sh := range f.shipments {
+		if sh.OrderID == orderID {
+			out = append(out, sh)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeOrdersStore) ListReturns(_ context.Context, orderID string) ([]stororders.Return, error) {
+	out := []stororders.Return{}
+	for _, ret := range f.returns {
+		if ret.OrderID == orderID {
+			out = append(out, ret)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeOrdersStore) ListReturnsByStatus(_ context.Context, status string, _ int) ([]stororders.Return, error) {
+	out := []stororders.Return{}
+	for _, ret := range f.returns {
+		if ret.Status == status {
+			out = append(out, ret)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeOrdersStore) DecideReturn(_ context.Context, orderID, returnID string, approve bool, note, actor string) (stororders.Return, error) {
+	for i, ret := range f.returns {
+		if ret.ID != returnID || ret.OrderID != orderID {
+			continue
+		}
+		if ret.Status != stororders.ReturnStatusRequested {
+			return stororders.Return{}, fmt.Errorf("%w: only requested returns can be approved or rejected", stororders.ErrInvalidReturn)
+		}
+		ret.Status, ret.AdminNote, ret.DecidedBy = stororders.ReturnStatusRejected, note, actor
+		if approve {
+			ret.Status = stororders.ReturnStatusApproved
+		}
+		f.returns[i] = ret
+		return ret, nil
+	}
+	return stororders.Return{}, sql.ErrNoRows
+}
+
+func (f *fakeOrdersStore) ReceiveReturn(_ context.Context, in stororders.ReceiveReturnInput, execute stororders.RefundExecutor) (stororders.Return, error) {
+	for i, ret := range f.returns {
+		if ret.ID != in.ReturnID || ret.OrderID != in.OrderID {
+			continue
+		}
+		if ret.Status != stororders.ReturnStatusApproved {
+			return stororders.Return{}, fmt.Errorf("%w: only approved returns can be received", stororders.ErrInvalidReturn)
+		}
+		o := f.items[in.OrderID]
+		amount := 0
+		for _, line := range ret.Lines {
+			for _, it := range o.Items {
+				if it.ID == line.OrderItemID {
+					amount += it.UnitPriceCents * line.Quantity
+				}
+			}
+		}
+		provider, ref, err := execute(o, amount, "refund-1")
+		if err != nil {
+			return stororders.Return{}, err
+		}
+		refund := stororders.Refund{ID: fmt.Sprintf("r%d", len(f.refunds)+1), OrderID: o.ID, AmountCents: amount, Provider: provider, ProviderRef: ref, CreatedBy: in.Actor, Restocked: in.Restock}
+		f.refunds = append(f.refunds, refund)
+		ret.Status, ret.RefundID, ret.Restocked, ret.ReceivedBy = stororders.ReturnStatusReceived, refund.ID, in.Restock, in.Actor
+		f.returns[i] = ret
+		return ret, nil
+	}
+	return stororders.Return{}, sql.ErrNoRows
+}
+
+func (f *fakeOrdersStore) ListInvoices(_ context.Context, orderID string) ([]stororders.Invoice, error) {
+	out := []stororders.Invoice{}
+	for _, inv := range f.invoices {
+		if inv.OrderID == orderID {
+			out = append(out, inv)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeOrdersStore) InvoicePDF(_ context.Context, in stororders.InvoicePDFInput) (stororders.Invoice, []byte, error) {
+	for _, inv := range f.invoices {
+		if inv.ID == in.InvoiceID && inv.OrderID == in.OrderID {
+			return inv, []byte("%PDF-1.4 " + inv.Number + " " + in.Seller.Name), nil
+		}
+	}
+	return stororders.Invoice{}, nil, sql.ErrNoRows
+}
+
+// EditOrder re-prices the order's line quantities and prices; the total is
+// the lines plus shipping, as in the store.
+func (f *fakeOrdersStore) EditOrder(_ context.Context, in stororders.EditOrderInput, execute stororders.RefundExecutor) (stororders.OrderEdit, error) {
+	o, ok := f.items[in.OrderID]
+	if !ok {
+		return stororders.OrderEdit{}, sql.ErrNoRows
+	}
+	if o.Status != "pending_payment" && o.Status != "paid" {
+		return stororders.OrderEdit{}, fmt.Errorf("%w: %s orders cannot be edited", stororders.ErrInvalidOrderEdit, o.Status)
+	}
+	edit := stororders.OrderEdit{ID: fmt.Sprintf("e%d", len(f.edits)+1), OrderID: o.ID, Actor: in.Actor, Reason: in.Reason, PreviousTotalCents: o.TotalCents}
+	items := slices.Clone(o.Items)
+	for _, line := range in.Lines {
+		i := slices.IndexFunc(items, func(it stororders.OrderItem) bool { return it.ID == line.OrderItemID })
+		if i < 0 {
+			return stororders.OrderEdit{}, fmt.Errorf("%w: unknown order item", stororders.ErrInvalidOrderEdit)
+		}
+		change := stororders.OrderEditChange{Kind: stororders.EditLineChanged, OrderItemID: items[i].ID, FromQuantity: items[i].Quantity, FromUnitPriceCents: items[i].UnitPriceCents}
+		if line.Quantity != nil {
+			items[i].Quantity = *line.Quantity
+		}
+		if line.UnitPriceCents != nil && *line.UnitPriceCents != items[i].UnitPriceCents {
+			if line.PriceReason == "" {
+				return stororders.OrderEdit{}, fmt.Errorf("%w: a price override needs a reason", stororders.ErrInvalidOrderEdit)
+			}
+			items[i].UnitPriceCents = *line.UnitPriceCents
+			change.PriceReason = line.PriceReason
+		}
+		change.ToQuantity, change.ToUnitPriceCents = items[i].Quantity, items[i].UnitPriceCents
+		edit.Changes = append(edit.Changes, change)
+	}
+	if len(edit.Changes) == 0 {
+		return stororders.OrderEdit{}, fmt.Errorf("%w: nothing to change", stororders.ErrInvalidOrderEdit)
+	}
+	edit.TotalCents = o.ShippingCents
+	for _, it := range items {
+		edit.TotalCents += it.UnitPriceCents * it.Quantity
+	}
+	if o.Status == "paid" && edit.TotalCents > edit.PreviousTotalCents {
+		return stororders.OrderEdit{}, fmt.Errorf("%w: the total of a paid order cannot increase", stororders.ErrInvalidOrderEdit)
+	}
+	if o.Status == "paid" && edit.TotalCents < edit.PreviousTotalCents {
+		edit.RefundedCents = edit.PreviousTotalCents - edit.TotalCents
+		edit.RefundID = fmt.Sprintf("r%d", len(f.refunds)+1)
+		var err error
+		if edit.RefundProvider, edit.RefundProviderRef, err = execute(o, edit.RefundedCents, edit.RefundID); err != nil {
+			return stororders.OrderEdit{}, err
+		}
+		edit.RefundStatus = stororders.RefundStatusSucceeded
+		f.refunds = append(f.refunds, stororders.Refund{ID: edit.RefundID, OrderID: o.ID, OrderEditID: edit.ID, Status: edit.RefundStatus,
+			AmountCents: edit.RefundedCents, Provider: edit.RefundProvider, ProviderRef: edit.RefundProviderRef, CreatedBy: edit.Actor})
+	}
+	o.Items, o.TotalCents = items, edit.TotalCents
+	f.items[o.ID] = o
+	f.edits = append(f.edits, edit)
+	return edit, nil
+}
+
+func (f *fakeOrdersStore) ListOrderEdits(_ context.Context, orderID string) ([]stororders.OrderEdit, error) {
+	out := []stororders.OrderEdit{}
+	for _, e := range f.edits {
+		if e.OrderID == orderID {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeOrdersStore) AddOrderNote(_ context.Context, in stororders.AddOrderNoteInput) (stororders.OrderNote, error) {
+	if _, ok := f.items[in.OrderID]; !ok {
+		return stororders.OrderNote{}, sql.ErrNoRows
+	}
+	if in.Visibility == "" {
+		in.Visibility = stororders.NoteVisibilityInternal
+	}
+	if in.Body == "" || (in.Visibility != stororders.NoteVisibilityInternal && in.Visibility != stororders.NoteVisibilityCustomer) {
+		return stororders.OrderNote{}, fmt.Errorf("%w: bad note", stororders.ErrInvalidOrderNote)
+	}
+	note := stororders.OrderNote{ID: fmt.Sprintf("n%d", len(f.notes)+1), OrderID: in.OrderID, Visibility: in.Visibility, Body: in.Body, Author: in.Author}
+	f.notes = append(f.notes, note)
+	return note, nil
+}
+
+func (f *fakeOrdersStore) ListOrderNotes(_ context.Context, orderID string, customerOnly bool) ([]stororders.OrderNote, error) {
+	out := []stororders.OrderNote{}
+	for _, n := range f.notes {
+		if n.OrderID == orderID && (!customerOnly || n.Visibility == stororders.NoteVisibilityCustomer) {
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+func TestAdminMarkOrderPaidRecordsConfirmer(t *testing.T) {
+	store := &fakeOrdersStore{items: map[string]stororders.Order{
+		"o1": {ID: "o1", Number: "ORD-1", Status: "awaiting_payment_offline", PaymentMethod: "cash-on-delivery"},
+		"o2": {ID: "o2", Number: "ORD-2", Status: "completed"},
+	}}
+	m := &module{orders: store, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/mark-paid", nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	var out stororders.Order
+	if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if out.Status != "paid" || out.PaymentConfirmedBy != "admin" || out.PaidAt == nil {
+		t.Fatalf("unexpected order %#v", out)
+	}
+
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o2/mark-paid", nil)
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for completed order, got %d", res.Code)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/missing/mark-paid", nil)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", res.Code)
+	}
+}
+
+func TestAdminPartialRefundThenFullRefund(t *testing.T) {
+	store := &fakeOrdersStore{items: map[string]stororders.Order{
+		"o1": {ID: "o1", Number: "ORD-1", Status: "paid", TotalCents: 1000, PaymentMethod: "stripe", PaymentRef: "pi_1"},
+	}}
+	m := &module{orders: store, payments: stripeRefundProviders(t), user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/refunds", map[string]any{"amount_cents": 400, "reason": "damaged"})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d body=%s", res.Code, res.Body.String())
+	}
+	var refund stororders.Refund
+	if err := json.Unmarshal(res.Body.Bytes(), &refund); err != nil {
+		t.Fatalf("decode refund: %v", err)
+	}
+	if refund.ProviderRef == "" || refund.Provider != "stripe" || refund.CreatedBy != "admin" {
+		t.Fatalf("unexpected refund %#v", refund)
+	}
+	if store.items["o1"].Status != "partially_refunded" {
+		t.Fatalf("expected partially_refunded, got %s", store.items["o1"].Status)
+	}
+
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/refunds", map[string]any{"amount_cents": 700})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for over-refund, got %d", res.Code)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/refunds", map[string]any{"amount_cents": 600})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d body=%s", res.Code, res.Body.String())
+	}
+	if store.items["o1"].Status != "refunded" {
+		t.Fatalf("expected refunded, got %s", store.items["o1"].Status)
+	}
+}
+
+// stripeRefundProviders configures the stripe provider against a fake API
+// that accepts every refund.
+func stripeRefundProviders(t *testing.T) *fakePaymentProvidersStore {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"re_` + r.Header.Get("Idempotency-Key") + `","status":"succeeded"}`))
+	}))
+	t.Cleanup(srv.Close)
+	config, _ := json.Marshal(map[string]any{"secret_key": "sk_test_x", "base_url": srv.URL})
+	return &fakePaymentProvidersStore{items: map[string]storpayments.Provider{
+		"stripe": {Key: "stripe", Name: "Card", Enabled: true, Mode: "sandbox", ConfigJSON: config},
+	}}
+}
+
+func TestAdminRefundWithoutStripeCredentialsFails(t *testing.T) {
+	t.Setenv("STRIPE_SECRET_KEY", "")
+	store := &fakeOrdersStore{items: map[string]stororders.Order{
+		"o1": {ID: "o1", Number: "ORD-1", Status: "paid", TotalCents: 1000, PaymentMethod: "stripe", PaymentRef: "pi_1"},
+	}}
+	m := &module{orders: store, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/refunds", map[string]any{"amount_cents": 400})
+	if res.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502 without stripe credentials, got %d body=%s", res.Code, res.Body.String())
+	}
+	if len(store.refunds) != 0 || store.items["o1"].Status != "paid" {
+		t.Fatalf("expected no refund to be recorded, got %#v", store.refunds)
+	}
+}
+
+func TestAdminRetryPendingRefund(t *testing.T) {
+	store := &fakeOrdersStore{
+		items: map[string]stororders.Order{
+			"o1": {ID: "o1", Number: "ORD-1", Status: "paid", TotalCents: 1000, PaymentMethod: "stripe", PaymentRef: "pi_1"},
+		},
+		refunds: []stororders.Refund{{ID: "r1", OrderID: "o1", Status: stororders.RefundStatusPending, AmountCents: 400}},
+	}
+	m := &module{orders: store, payments: stripeRefundProviders(t), user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/refunds/r1/retry", nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	var refund stororders.Refund
+	if err := json.Unmarshal(res.Body.Bytes(), &refund); err != nil {
+		t.Fatalf("decode refund: %v", err)
+	}
+	// The retry reuses the refund id as idempotency key.
+	if refund.Status != stororders.RefundStatusSucceeded || refund.ProviderRef != "re_r1" {
+		t.Fatalf("unexpected refund %#v", refund)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/refunds/r1/retry", nil)
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 retrying a settled refund, got %d", res.Code)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/refunds/missing/retry", nil)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", res.Code)
+	}
+}
+
+func TestAdminRefundOfflineOrderIsRecordedWithoutProviderCall(t *testing.T) {
+	store := &fakeOrdersStore{items: map[string]stororders.Order{
+		"o1": {ID: "o1", Number: "ORD-1", Status: "paid", TotalCents: 1000, PaymentMethod: "cash-on-delivery"},
+	}}
+	providers := &fakePaymentProvidersStore{items: map[string]storpayments.Provider{
+		"cash-on-delivery": {Key: "cash-on-delivery", Name: "Cash on delivery", Enabled: true, Mode: "live", ConfigJSON: []byte(`{}`)},
+	}}
+	m := &module{orders: store, payments: providers, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/refunds", map[string]any{"amount_cents": 1000})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d body=%s", res.Code, res.Body.String())
+	}
+	if len(store.refunds) != 1 || store.refunds[0].ProviderRef != "" || store.refunds[0].Provider != "cash-on-delivery" {
+		t.Fatalf("unexpected refunds %#v", store.refunds)
+	}
+}
+
+func TestAdminUpdateOrderStatusEnforcesTransitions(t *testing.T) {
+	store := &fakeOrdersStore{items: map[string]stororders.Order{
+		"o1": {ID: "o1", Number: "ORD-1", Status: "paid"},
+		"o2": {ID: "o2", Number: "ORD-2", Status: "completed"},
+	}}
+	m := &module{orders: store, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/status", map[string]any{"order_id": "o1", "status": "processing", "note": "picked"})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	history := store.items["o1"].StatusHistory
+	if len(history) != 1 || history[0].From != "paid" || history[0].To != "processing" || history[0].Actor != "admin" || history[0].Note != "picked" {
+		t.Fatalf("unexpected history %#v", history)
+	}
+
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/status", map[string]any{"order_id": "o1", "status": "cancelled"})
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for cancelling a paid order, got %d", res.Code)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/status", map[string]any{"order_id": "o2", "status": "pending_payment"})
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for completed -> pending_payment, got %d", res.Code)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/status", map[string]any{"order_id": "o2", "status": "refunded"})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for refunded via status endpoint, got %d", res.Code)
+	}
+}
+
+func TestAdminCreatePartialShipmentAndConfirmDelivery(t *testing.T) {
+	store := &fakeOrdersStore{items: map[string]stororders.Order{
+		"o1": {ID: "o1", Number: "ORD-1", Status: "paid", Items: []stororders.OrderItem{{ID: "i1", Quantity: 2}}},
+		"o2": {ID: "o2", Number: "ORD-2", Status: "pending_payment"},
+	}}
+	m := &module{orders: store, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/shipments", map[string]any{
+		"provider_key":    "omniva",
+		"tracking_number": "CC123",
+		"lines":           []map[string]any{{"order_item_id": "i1", "quantity": 1}},
+	})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d body=%s", res.Code, res.Body.String())
+	}
+	var shipment stororders.Shipment
+	if err := json.Unmarshal(res.Body.Bytes(), &shipment); err != nil {
+		t.Fatalf("decode shipment: %v", err)
+	}
+	if shipment.TrackingNumber != "CC123" || shipment.CreatedBy != "admin" || store.items["o1"].Status != "partially_shipped" {
+		t.Fatalf("unexpected shipment %#v / status %s", shipment, store.items["o1"].Status)
+	}
+
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/shipments", map[string]any{
+		"lines": []map[string]any{{"order_item_id": "i1", "quantity": 2}},
+	})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for over-shipping, got %d", res.Code)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o2/shipments", map[string]any{})
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for unpaid order, got %d", res.Code)
+	}
+
+	res = performAdminJSONRequest(t, mux, http.MethodPatch, "/admin/orders/o1/shipments/"+shipment.ID, map[string]any{"status": "delivered"})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	if store.shipments[0].DeliveredAt == nil {
+		t.Fatalf("expected delivery to be recorded")
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPatch, "/admin/orders/o1/shipments/"+shipment.ID, map[string]any{"status": "lost"})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown shipment status, got %d", res.Code)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodGet, "/admin/orders/o1/shipments", nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.Code)
+	}
+
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/status", map[string]any{"order_id": "o1", "status": "shipped"})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for shipped via status endpoint, got %d", res.Code)
+	}
+}
+
+type fakeShippingProvidersStore struct {
+	items map[string]storshiping.Provider
+}
+
+func (f *fakeShippingProvidersStore) GetProvider(_ context.Context, key string) (*storshiping.Provider, error) {
+	p, ok := f.items[key]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &p, nil
+}
+
+func TestAdminShipmentLabelAgainstFakeCarrier(t *testing.T) {
+	var calls []string
+	carrier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/shipments":
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if body["reference"] != "ORD-1" || body["terminal_id"] != "omniva_lt_001" {
+				t.Fatalf("unexpected carrier request %v", body)
+			}
+			_, _ = w.Write([]byte(`{"id":"shp_1","barcode":"CE111EE"}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/shipments/shp_1/label":
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write([]byte("%PDF-1.4 label"))
+		case r.Method == http.MethodDelete && r.URL.Path == "/shipments/shp_1":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer carrier.Close()
+
+	store := &fakeOrdersStore{items: map[string]stororders.Order{
+		"o1": {
+			ID: "o1", Number: "ORD-1", Status: "paid", Email: "buyer@example.com",
+			Items:           []stororders.OrderItem{{ID: "i1", Quantity: 1}},
+			ShippingAddress: &stororders.Address{FullName: "Jonas Jonaitis", Phone: "+37060000000", Country: "LT"},
+			Shipping:        stororders.ShippingSelection{ProviderKey: "omniva", ServiceCode: "parcel-locker", TerminalID: "omniva_lt_001"},
+		},
+	}}
+	providers := &fakeShippingProvidersStore{items: map[string]storshiping.Provider{
+		"omniva": {Key: "omniva", Mode: "sandbox", ConfigJSON: []byte(`{"base_url":"` + carrier.URL + `"}`)},
+	}}
+	m := &module{orders: store, shipping: providers, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/shipments", map[string]any{
+		"provider_key": "omniva",
+		"create_label": true,
+	})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d body=%s", res.Code, res.Body.String())
+	}
+	var shipment stororders.Shipment
+	if err := json.Unmarshal(res.Body.Bytes(), &shipment); err != nil {
+		t.Fatalf("decode shipment: %v", err)
+	}
+	if shipment.CarrierRef != "shp_1" || shipment.TrackingNumber != "CE111EE" || shipment.TrackingURL == "" {
+		t.Fatalf("expected carrier tracking on shipment, got %#v", shipment)
+	}
+
+	res = performAdminJSONRequest(t, mux, http.MethodGet, "/admin/orders/o1/shipments/"+shipment.ID+"/label", nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	if res.Header().Get("Content-Type") != "application/pdf" || res.Body.String() != "%PDF-1.4 label" {
+		t.Fatalf("unexpected label %s %q", res.Header().Get("Content-Type"), res.Body.String())
+	}
+	if got := res.Header().Get("Content-Disposition"); got != `attachment; filename="label-CE111EE.pdf"` {
+		t.Fatalf("unexpected content disposition %q", got)
+	}
+
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/shipments/"+shipment.ID+"/cancel", nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	if store.shipments[0].Status != stororders.ShipmentStatusCancelled || store.items["o1"].Status != "processing" {
+		t.Fatalf("expected cancelled shipment and processing order, got %s / %s", store.shipments[0].Status, store.items["o1"].Status)
+	}
+	want := "POST /shipments,GET /shipments/shp_1/label,DELETE /shipments/shp_1"
+	if got := strings.Join(calls, ","); got != want {
+		t.Fatalf("unexpected carrier calls %s", got)
+	}
+
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/shipments", map[string]any{"tracking_number": "MANUAL1"})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d body=%s", res.Code, res.Body.String())
+	}
+	_ = json.Unmarshal(res.Body.Bytes(), &shipment)
+	res = performAdminJSONRequest(t, mux, http.MethodGet, "/admin/orders/o1/shipments/"+shipment.ID+"/label", nil)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for shipment without label, got %d", res.Code)
+	}
+}
+
+func TestAdminShipmentLabelCarrierFailure(t *testing.T) {
+	carrier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid credentials"}`))
+	}))
+	defer carrier.Close()
+
+	store := &fakeOrdersStore{items: map[string]stororders.Order{
+		"o1": {
+			ID: "o1", Number: "ORD-1", Status: "paid",
+			Items:           []stororders.OrderItem{{ID: "i1", Quantity: 1}},
+			ShippingAddress: &stororders.Address{FullName: "Jonas Jonaitis", Country: "LT"},
+			Shipping:        stororders.ShippingSelection{ProviderKey: "omniva", TerminalID: "omniva_lt_001"},
+		},
+	}}
+	providers := &fakeShippingProvidersStore{items: map[string]storshiping.Provider{
+		"omniva": {Key: "omniva", ConfigJSON: []byte(`{"base_url":"` + carrier.URL + `"}`)},
+		"manual": {Key: "manual"},
+	}}
+	m := &module{orders: store, shipping: providers, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/shipments", map[string]any{"provider_key": "omniva", "create_label": true})
+	if res.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502 for carrier failure, got %d body=%s", res.Code, res.Body.String())
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/shipments", map[string]any{"provider_key": "manual", "create_label": true})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for carrier without labels, got %d body=%s", res.Code, res.Body.String())
+	}
+	if len(store.shipments) != 0 || store.items["o1"].Status != "paid" {
+		t.Fatalf("failed bookings must not record shipments, got %+v", store.shipments)
+	}
+}
+
+func TestAdminReturnApproveAndReceiveRefunds(t *testing.T) {
+	store := &fakeOrdersStore{
+		items: map[string]stororders.Order{
+			"o1": {ID: "o1", Number: "ORD-1", Status: "shipped", TotalCents: 3000, PaymentMethod: "stripe", PaymentRef: "pi_1", Items: []stororders.OrderItem{
+				{ID: "i1", Quantity: 2, UnitPriceCents: 1000},
+			}},
+		},
+		returns: []stororders.Return{
+			{ID: "ret1", OrderID: "o1", Status: stororders.ReturnStatusRequested, Lines: []stororders.ReturnLine{{OrderItemID: "i1", Quantity: 1}}},
+			{ID: "ret2", OrderID: "o1", Status: stororders.ReturnStatusRequested, Lines: []stororders.ReturnLine{{OrderItemID: "i1", Quantity: 1}}},
+		},
+	}
+	m := &module{orders: store, payments: stripeRefundProviders(t), user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodGet, "/admin/returns", nil)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"ret2"`) {
+		t.Fatalf("expected requested returns queue, got %d body=%s", res.Code, res.Body.String())
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/returns/ret1/receive", map[string]any{"restock": true})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 receiving a requested return, got %d", res.Code)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/returns/ret1/approve", map[string]any{"note": "ok"})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/returns/ret2/reject", map[string]any{"note": "outside return window"})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/returns/ret2/approve", map[string]any{})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 approving a rejected return, got %d", res.Code)
+	}
+
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/returns/ret1/receive", map[string]any{"restock": true})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	var ret stororders.Return
+	if err := json.Unmarshal(res.Body.Bytes(), &ret); err != nil {
+		t.Fatalf("decode return: %v", err)
+	}
+	if ret.Status != stororders.ReturnStatusReceived || !ret.Restocked || ret.ReceivedBy != "admin" || ret.RefundID == "" {
+		t.Fatalf("unexpected return %#v", ret)
+	}
+	if len(store.refunds) != 1 || store.refunds[0].AmountCents != 1000 || store.refunds[0].ProviderRef == "" {
+		t.Fatalf("unexpected refunds %#v", store.refunds)
+	}
+
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/returns/missing/approve", map[string]any{})
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", res.Code)
+	}
+}
+
+func TestAdminOrderInvoicesListAndDownload(t *testing.T) {
+	store := &fakeOrdersStore{
+		items: map[string]stororders.Order{"o1": {ID: "o1", Number: "ORD-1", Status: "paid"}},
+		invoices: []stororders.Invoice{
+			{ID: "inv1", OrderID: "o1", Kind: "invoice", Number: "INV-2026-000001", TotalCents: 3000},
+			{ID: "cn1", OrderID: "o1", Kind: "credit_note", Number: "CN-2026-000001", TotalCents: -1000},
+		},
+	}
+	m := &module{orders: store, invoiceSeller: invoices.Party{Name: "Shop OU"}, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodGet, "/admin/orders/o1/invoices", nil)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), "CN-2026-000001") {
+		t.Fatalf("expected invoice list, got %d body=%s", res.Code, res.Body.String())
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodGet, "/admin/orders/o1/invoices/cn1/pdf", nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	if got := res.Header().Get("Content-Type"); got != "application/pdf" {
+		t.Fatalf("unexpected content type %q", got)
+	}
+	if got := res.Header().Get("Content-Disposition"); got != `attachment; filename="CN-2026-000001.pdf"` {
+		t.Fatalf("unexpected content disposition %q", got)
+	}
+	if !strings.Contains(res.Body.String(), "Shop OU") {
+		t.Fatalf("expected configured seller to be passed to the store, got %q", res.Body.String())
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodGet, "/admin/orders/o2/invoices/inv1/pdf", nil)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another order's invoice, got %d", res.Code)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/invoices", nil)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for POST, got %d", res.Code)
+	}
+}
+
+func TestAdminEditPaidOrderRefundsDifference(t *testing.T) {
+	store := &fakeOrdersStore{items: map[string]stororders.Order{
+		"o1": {ID: "o1", Number: "ORD-1", Status: "paid", TotalCents: 2500, ShippingCents: 500, PaymentMethod: "stripe", PaymentRef: "pi_1",
+			Items: []stororders.OrderItem{{ID: "i1", Quantity: 2, UnitPriceCents: 1000}}},
+		"o2": {ID: "o2", Number: "ORD-2", Status: "shipped"},
+	}}
+	m := &module{orders: store, payments: stripeRefundProviders(t), user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/edits", map[string]any{
+		"lines": []map[string]any{{"order_item_id": "i1", "unit_price_cents": 800}},
+	})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for price override without reason, got %d", res.Code)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/edits", map[string]any{
+		"reason": "customer asked",
+		"lines":  []map[string]any{{"order_item_id": "i1", "quantity": 1, "unit_price_cents": 800, "price_reason": "loyalty discount"}},
+	})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d body=%s", res.Code, res.Body.String())
+	}
+	var edit stororders.OrderEdit
+	if err := json.Unmarshal(res.Body.Bytes(), &edit); err != nil {
+		t.Fatalf("decode edit: %v", err)
+	}
+	if edit.TotalCents != 1300 || edit.RefundedCents != 1200 || edit.RefundID == "" || edit.RefundProvider != "stripe" || edit.RefundProviderRef == "" || edit.Actor != "admin" {
+		t.Fatalf("unexpected edit %#v", edit)
+	}
+	if len(edit.Changes) != 1 || edit.Changes[0].FromQuantity != 2 || edit.Changes[0].ToUnitPriceCents != 800 || edit.Changes[0].PriceReason != "loyalty discount" {
+		t.Fatalf("unexpected changes %#v", edit.Changes)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/edits", map[string]any{
+		"lines": []map[string]any{{"order_item_id": "i1", "quantity": 3}},
+	})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a higher total on a paid order, got %d", res.Code)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodGet, "/admin/orders/o1/edits", nil)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), "loyalty discount") {
+		t.Fatalf("expected edit history, got %d body=%s", res.Code, res.Body.String())
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o2/edits", map[string]any{
+		"lines": []map[string]any{{"order_item_id": "i1", "quantity": 1}},
+	})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a shipped order, got %d", res.Code)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/missing/edits", map[string]any{})
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", res.Code)
+	}
+}
+
+func TestAdminOrderNotes(t *testing.T) {
+	store := &fakeOrdersStore{items: map[string]stororders.Order{"o1": {ID: "o1", Number: "ORD-1", Status: "paid"}}}
+	m := &module{orders: store, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/notes", map[string]any{"body": "Called the customer"})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d body=%s", res.Code, res.Body.String())
+	}
+	var note stororders.OrderNote
+	if err := json.Unmarshal(res.Body.Bytes(), &note); err != nil {
+		t.Fatalf("decode note: %v", err)
+	}
+	if note.Visibility != stororders.NoteVisibilityInternal || note.Author != "admin" {
+		t.Fatalf("unexpected note %#v", note)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/notes", map[string]any{"body": "Ships Monday", "visibility": "customer"})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d body=%s", res.Code, res.Body.String())
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/o1/notes", map[string]any{"body": "x", "visibility": "public"})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown visibility, got %d", res.Code)
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodGet, "/admin/orders/o1/notes", nil)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), "Called the customer") || !strings.Contains(res.Body.String(), "Ships Monday") {
+		t.Fatalf("expected both notes, got %d body=%s", res.Code, res.Body.String())
+	}
+	res = performAdminJSONRequest(t, mux, http.MethodPost, "/admin/orders/missing/notes", map[string]any{"body": "x"})
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", res.Code)
+	}
+}
@@ -0,0 +1,236 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	platformhttp "goecommerce/internal/platform/http"
+	"goecommerce/internal/platform/payments"
+	_ "goecommerce/internal/platform/payments/providers/offline"
+	_ "goecommerce/internal/platform/payments/providers/stripe"
+	storpayments "goecommerce/internal/storage/payments"
+)
+
+const maskedSecret = "********"
+
+type upsertPaymentProviderRequest struct {
+	Key        string         `json:"key"`
+	Name       string         `json:"name"`
+	Mode       string         `json:"mode"`
+	Enabled    bool           `json:"enabled"`
+	ConfigJSON map[string]any `json:"config_json"`
+}
+
+type paymentProviderResponse struct {
+	ID         string         `json:"id"`
+	Key        string         `json:"key"`
+	Name       string         `json:"name"`
+	Enabled    bool           `json:"enabled"`
+	Mode       string         `json:"mode"`
+	ConfigJSON map[string]any `json:"config_json"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// isSecretConfigKey marks config entries that are never echoed back to the
+// admin UI; they are returned masked and kept as-is when the mask is sent back.
+func isSecretConfigKey(key string) bool {
+	k := strings.ToLower(key)
+	return strings.Contains(k, "secret") || strings.Contains(k, "password")
+}
+
+func decodeProviderConfig(raw []byte) map[string]any {
+	config := map[string]any{}
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &config)
+	}
+	if config == nil {
+		config = map[string]any{}
+	}
+	return config
+}
+
+func toPaymentProviderResponse(p storpayments.Provider) paymentProviderResponse {
+	config := decodeProviderConfig(p.ConfigJSON)
+	for k, v := range config {
+		if s, ok := v.(string); ok && s != "" && isSecretConfigKey(k) {
+			config[k] = maskedSecret
+		}
+	}
+	return paymentProviderResponse{
+		ID:         p.ID,
+		Key:        p.Key,
+		Name:       p.Name,
+		Enabled:    p.Enabled,
+		Mode:       p.Mode,
+		ConfigJSON: config,
+		CreatedAt:  p.CreatedAt,
+		UpdatedAt:  p.UpdatedAt,
+	}
+}
+
+func validatePaymentProviderRequest(req *upsertPaymentProviderRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Mode = strings.TrimSpace(strings.ToLower(req.Mode))
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if req.Mode == "" {
+		req.Mode = "sandbox"
+	}
+	if req.Mode != "sandbox" && req.Mode != "live" {
+		return errors.New("mode must be sandbox or live")
+	}
+	if req.ConfigJSON == nil {
+		req.ConfigJSON = map[string]any{}
+	}
+	return nil
+}
+
+func (m *module) handlePaymentProviders(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/admin/payments/providers" {
+		http.NotFound(w, r)
+		return
+	}
+	if m.payments == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		items, err := m.payments.ListProviders(r.Context())
+		if err != nil {
+			platformhttp.Error(w, http.StatusInternalServerError, "list providers error")
+			return
+		}
+		out := make([]paymentProviderResponse, 0, len(items))
+		for _, p := range items {
+			out = append(out, toPaymentProviderResponse(p))
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"items": out})
+	case http.MethodPost:
+		var req upsertPaymentProviderRequest
+		if err := decodeRequest(r, &req); err != nil {
+			platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Key = strings.TrimSpace(strings.ToLower(req.Key))
+		if !isValidSlug(req.Key) {
+			platformhttp.Error(w, http.StatusBadRequest, "invalid key")
+			return
+		}
+		if err := validatePaymentProviderRequest(&req); err != nil {
+			platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, err := payments.Get(req.Key); err != nil {
+			platformhttp.Error(w, http.StatusBadRequest, "unknown payment provider")
+			return
+		}
+		existing, err := m.payments.GetProvider(r.Context(), req.Key)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			platformhttp.Error(w, http.StatusInternalServerError, "get provider error")
+			return
+		}
+		if existing != nil {
+			platformhttp.Error(w, http.StatusConflict, "conflict")
+			return
+		}
+		configJSON, _ := json.Marshal(req.ConfigJSON)
+		if err := m.payments.CreateProvider(r.Context(), req.Key, req.Name, req.Mode, configJSON); err != nil {
+			platformhttp.Error(w, http.StatusInternalServerError, "create provider error")
+			return
+		}
+		if req.Enabled {
+			if err := m.payments.UpdateProvider(r.Context(), req.Key, req.Name, true, req.Mode, configJSON); err != nil {
+				platformhttp.Error(w, http.StatusInternalServerError, "update provider error")
+				return
+			}
+		}
+		m.writePaymentProvider(w, r, req.Key, http.StatusCreated)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *module) handlePaymentProviderDetail(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/admin/payments/providers/") {
+		http.NotFound(w, r)
+		return
+	}
+	if m.payments == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	key := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/admin/payments/providers/"))
+	if key == "" || strings.Contains(key, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		m.writePaymentProvider(w, r, key, http.StatusOK)
+	case http.MethodPut:
+		var req upsertPaymentProviderRequest
+		if err := decodeRequest(r, &req); err != nil {
+			platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := validatePaymentProviderRequest(&req); err != nil {
+			platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		existing, err := m.payments.GetProvider(r.Context(), key)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				platformhttp.Error(w, http.StatusNotFound, "not found")
+				return
+			}
+			platformhttp.Error(w, http.StatusInternalServerError, "get provider error")
+			return
+		}
+		previous := decodeProviderConfig(existing.ConfigJSON)
+		for k, v := range req.ConfigJSON {
+			if s, ok := v.(string); ok && s == maskedSecret && isSecretConfigKey(k) {
+				req.ConfigJSON[k] = previous[k]
+			}
+		}
+		configJSON, _ := json.Marshal(req.ConfigJSON)
+		if err := m.payments.UpdateProvider(r.Context(), key, req.Name, req.Enabled, req.Mode, configJSON); err != nil {
+			platformhttp.Error(w, http.StatusInternalServerError, "update provider error")
+			return
+		}
+		m.writePaymentProvider(w, r, key, http.StatusOK)
+	case http.MethodDelete:
+		if err := m.payments.DeleteProvider(r.Context(), key); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				platformhttp.Error(w, http.StatusNotFound, "not found")
+				return
+			}
+			platformhttp.Error(w, http.StatusInternalServerError, "delete provider error")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *module) writePaymentProvider(w http.ResponseWriter, r *http.Request, key string, status int) {
+	p, err := m.payments.GetProvider(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			platformhttp.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		platformhttp.Error(w, http.StatusInternalServerError, "get provider error")
+		return
+	}
+	_ = platformhttp.JSON(w, status, toPaymentProviderResponse(*p))
+}
@@ -0,0 +1,109 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	storpayments "goecommerce/internal/storage/payments"
+)
+
+type fakePaymentProvidersStore struct {
+	items map[string]storpayments.Provider
+}
+
+func (f *fakePaymentProvidersStore) CreateProvider(_ context.Context, key, name, mode string, configJSON []byte) error {
+	f.items[key] = storpayments.Provider{Key: key, Name: name, Mode: mode, ConfigJSON: configJSON}
+	return nil
+}
+
+func (f *fakePaymentProvidersStore) UpdateProvider(_ context.Context, key, name string, enabled bool, mode string, configJSON []byte) error {
+	if _, ok := f.items[key]; !ok {
+		return sql.ErrNoRows
+	}
+	f.items[key] = storpayments.Provider{Key: key, Name: name, Enabled: enabled, Mode: mode, ConfigJSON: configJSON}
+	return nil
+}
+
+func (f *fakePaymentProvidersStore) GetProvider(_ context.Context, key string) (*storpayments.Provider, error) {
+	p, ok := f.items[key]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &p, nil
+}
+
+func (f *fakePaymentProvidersStore) ListProviders(context.Context) ([]storpayments.Provider, error) {
+	out := make([]storpayments.Provider, 0, len(f.items))
+	for _, p := range f.items {
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func (f *fakePaymentProvidersStore) DeleteProvider(_ context.Context, key string) error {
+	if _, ok := f.items[key]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(f.items, key)
+	return nil
+}
+
+func TestPaymentProvidersCreateMasksSecrets(t *testing.T) {
+	store := &fakePaymentProvidersStore{items: map[string]storpayments.Provider{}}
+	m := &module{payments: store, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodPost, "/admin/payments/providers", map[string]any{
+		"key":         "stripe",
+		"name":        "Card",
+		"mode":        "live",
+		"enabled":     true,
+		"config_json": map[string]any{"secret_key": "sk_live_x", "success_url": "https://shop.example.com/ok"},
+	})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, res.Code)
+	}
+	var out paymentProviderResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !out.Enabled || out.Mode != "live" {
+		t.Fatalf("unexpected provider: %#v", out)
+	}
+	if out.ConfigJSON["secret_key"] != maskedSecret {
+		t.Fatalf("expected masked secret, got %v", out.ConfigJSON["secret_key"])
+	}
+
+	res = performAdminJSONRequest(t, mux, http.MethodPut, "/admin/payments/providers/stripe", map[string]any{
+		"name":        "Card payments",
+		"mode":        "live",
+		"enabled":     true,
+		"config_json": map[string]any{"secret_key": maskedSecret},
+	})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	var saved map[string]any
+	_ = json.Unmarshal(store.items["stripe"].ConfigJSON, &saved)
+	if saved["secret_key"] != "sk_live_x" {
+		t.Fatalf("expected secret to be preserved, got %v", saved["secret_key"])
+	}
+}
+
+func TestPaymentProvidersRejectUnknownKey(t *testing.T) {
+	m := &module{payments: &fakePaymentProvidersStore{items: map[string]storpayments.Provider{}}, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performAdminJSONRequest(t, mux, http.MethodPost, "/admin/payments/providers", map[string]any{
+		"key":  "bitcoin",
+		"name": "Bitcoin",
+	})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, res.Code)
+	}
+}
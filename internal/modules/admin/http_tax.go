@@ -0,0 +1,131 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	platformhttp "goecommerce/internal/platform/http"
+	stortax "goecommerce/internal/storage/tax"
+)
+
+type taxStore interface {
+	ListClasses(ctx context.Context) ([]stortax.Class, error)
+	ListRates(ctx context.Context, country string) ([]stortax.Rate, error)
+	UpsertRate(ctx context.Context, country, class string, rateBps int) (stortax.Rate, error)
+	DeleteRate(ctx context.Context, id string) error
+}
+
+type upsertTaxRateRequest struct {
+	Country  string `json:"country"`
+	TaxClass string `json:"tax_class"`
+	RateBps  *int   `json:"rate_bps"`
+}
+
+func (m *module) handleTaxClasses(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/admin/tax/classes" || r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	if m.tax == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	items, err := m.tax.ListClasses(r.Context())
+	if err != nil {
+		platformhttp.Error(w, http.StatusInternalServerError, "list tax classes error")
+		return
+	}
+	_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// handleTaxRates lists rates (optionally for ?country=) and creates or
+// replaces the rate of a country and tax class.
+func (m *module) handleTaxRates(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/admin/tax/rates" {
+		http.NotFound(w, r)
+		return
+	}
+	if m.tax == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		items, err := m.tax.ListRates(r.Context(), r.URL.Query().Get("country"))
+		if err != nil {
+			platformhttp.Error(w, http.StatusInternalServerError, "list tax rates error")
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"items": items})
+	case http.MethodPost:
+		var req upsertTaxRateRequest
+		if err := decodeRequest(r, &req); err != nil {
+			platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		country := strings.ToUpper(strings.TrimSpace(req.Country))
+		if len(country) != 2 {
+			platformhttp.Error(w, http.StatusBadRequest, "country must be a 2-letter code")
+			return
+		}
+		if req.RateBps == nil || *req.RateBps < 0 || *req.RateBps > 10000 {
+			platformhttp.Error(w, http.StatusBadRequest, "rate_bps must be between 0 and 10000")
+			return
+		}
+		class := strings.ToLower(strings.TrimSpace(req.TaxClass))
+		known, err := m.isTaxClass(r.Context(), class)
+		if err != nil {
+			platformhttp.Error(w, http.StatusInternalServerError, "list tax classes error")
+			return
+		}
+		if !known {
+			platformhttp.Error(w, http.StatusBadRequest, "invalid tax_class")
+			return
+		}
+		item, err := m.tax.UpsertRate(r.Context(), country, class, *req.RateBps)
+		if err != nil {
+			platformhttp.Error(w, http.StatusInternalServerError, "save tax rate error")
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, item)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *module) handleTaxRateDetail(w http.ResponseWriter, r *http.Request) {
+	if m.tax == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	id := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/admin/tax/rates/"))
+	if id == "" || strings.Contains(id, "/") || r.Method != http.MethodDelete {
+		http.NotFound(w, r)
+		return
+	}
+	if err := m.tax.DeleteRate(r.Context(), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			platformhttp.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		platformhttp.Error(w, http.StatusInternalServerError, "delete tax rate error")
+		return
+	}
+	_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"id": id})
+}
+
+func (m *module) isTaxClass(ctx context.Context, code string) (bool, error) {
+	classes, err := m.tax.ListClasses(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range classes {
+		if c.Code == code {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	stortax "goecommerce/internal/storage/tax"
+)
+
+type fakeTaxStore struct {
+	rates map[string]stortax.Rate
+}
+
+func (f *fakeTaxStore) ListClasses(context.Context) ([]stortax.Class, error) {
+	return []stortax.Class{{Code: "reduced"}, {Code: "standard"}, {Code: "zero"}}, nil
+}
+
+func (f *fakeTaxStore) ListRates(_ context.Context, country string) ([]stortax.Rate, error) {
+	out := []stortax.Rate{}
+	for _, r := range f.rates {
+		if country == "" || r.Country == country {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeTaxStore) UpsertRate(_ context.Context, country, class string, rateBps int) (stortax.Rate, error) {
+	r := stortax.Rate{ID: country + "-" + class, Country: country, TaxClass: class, RateBps: rateBps}
+	f.rates[r.ID] = r
+	return r, nil
+}
+
+func (f *fakeTaxStore) DeleteRate(_ context.Context, id string) error {
+	if _, ok := f.rates[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(f.rates, id)
+	return nil
+}
+
+func TestTaxRatesUpsertValidatesInput(t *testing.T) {
+	store := &fakeTaxStore{rates: map[string]stortax.Rate{}}
+	m := &module{tax: store, user: "admin", pass: "pass"}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	cases := []map[string]any{
+		{"country": "LTU", "tax_class": "standard", "rate_bps": 2100},
+		{"country": "LT", "tax_class": "luxury", "rate_bps": 2100},
+		{"country": "LT", "tax_class": "standard", "rate_bps": 10001},
+		{"country": "LT", "tax_class": "standard"},
+	}
+	for _, body := range cases {
+		if res := performAdminJSONRequest(t, mux, http.MethodPost, "/admin/tax/rates", body); res.Code != http.StatusBadRequest {
+			t.Fatalf("expected status %d for %v, got %d", http.StatusBadRequest, body, res.Code)
+		}
+	}
+
+	res := performAdminJSONRequest(t, mux, http.MethodPost, "/admin/tax/rates", map[string]any{"country": "lt", "tax_class": "Reduced", "rate_bps": 900})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	var out stortax.Rate
+	if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Country != "LT" || out.TaxClass != "reduced" || out.RateBps != 900 {
+		t.Fatalf("unexpected rate: %#v", out)
+	}
+
+	if res := performAdminJSONRequest(t, mux, http.MethodDelete, "/admin/tax/rates/"+out.ID, nil); res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	if res := performAdminJSONRequest(t, mux, http.MethodDelete, "/admin/tax/rates/"+out.ID, nil); res.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, res.Code)
+	}
+}
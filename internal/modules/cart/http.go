@@ -11,18 +11,23 @@ import (
 	"goecommerce/internal/app"
 	modcustomers "goecommerce/internal/modules/customers"
 	platformhttp "goecommerce/internal/platform/http"
+	"goecommerce/internal/platform/tax"
 	storcart "goecommerce/internal/storage/cart"
 	storcustomers "goecommerce/internal/storage/customers"
+	stortax "goecommerce/internal/storage/tax"
 )
 
 type module struct {
 	store         *storcart.Store
 	customerStore *storcustomers.Store
+	taxRates      stortax.RatesSource
+	taxConfig     tax.Config
 }
 
 func NewModule(deps app.Deps) app.Module {
 	var s *storcart.Store
 	var cs *storcustomers.Store
+	var ts stortax.RatesSource
 	if deps.DB != nil {
 		if st, err := storcart.NewStore(context.Background(), deps.DB); err == nil {
 			s = st
@@ -30,8 +35,11 @@ func NewModule(deps app.Deps) app.Module {
 		if st, err := storcustomers.NewStore(context.Background(), deps.DB); err == nil {
 			cs = st
 		}
+		if st, err := stortax.NewStore(context.Background(), deps.DB); err == nil {
+			ts = st
+		}
 	}
-	return &module{store: s, customerStore: cs}
+	return &module{store: s, customerStore: cs, taxRates: ts, taxConfig: tax.ConfigFromEnv()}
 }
 
 func (m *module) Close() error {
@@ -84,7 +92,7 @@ func (m *module) handleCartPost(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		setCartCookie(w, r, c.ID)
-		_ = platformhttp.JSON(w, http.StatusOK, c)
+		m.writeCart(w, r, c)
 		return
 	}
 
@@ -95,7 +103,7 @@ func (m *module) handleCartPost(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		setCartCookie(w, r, c.ID)
-		_ = platformhttp.JSON(w, http.StatusOK, c)
+		m.writeCart(w, r, c)
 		return
 	}
 	c, err := m.store.GetCart(ctx, cartID)
@@ -107,13 +115,13 @@ func (m *module) handleCartPost(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			setCartCookie(w, r, c2.ID)
-			_ = platformhttp.JSON(w, http.StatusOK, c2)
+			m.writeCart(w, r, c2)
 			return
 		}
 		platformhttp.Error(w, http.StatusInternalServerError, "get error")
 		return
 	}
-	_ = platformhttp.JSON(w, http.StatusOK, c)
+	m.writeCart(w, r, c)
 }
 
 func (m *module) handleCartGet(w http.ResponseWriter, r *http.Request) {
@@ -136,7 +144,7 @@ func (m *module) handleCartGet(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		setCartCookie(w, r, c.ID)
-		_ = platformhttp.JSON(w, http.StatusOK, c)
+		m.writeCart(w, r, c)
 		return
 	}
 
@@ -157,7 +165,7 @@ func (m *module) handleCartGet(w http.ResponseWriter, r *http.Request) {
 		platformhttp.Error(w, http.StatusInternalServerError, "get error")
 		return
 	}
-	_ = platformhttp.JSON(w, http.StatusOK, c)
+	m.writeCart(w, r, c)
 }
 
 func (m *module) handleCartItems(w http.ResponseWriter, r *http.Request) {
@@ -220,7 +228,7 @@ func (m *module) handleCartItems(w http.ResponseWriter, r *http.Request) {
 		platformhttp.Error(w, http.StatusInternalServerError, "add error")
 		return
 	}
-	_ = platformhttp.JSON(w, http.StatusOK, c)
+	m.writeCart(w, r, c)
 }
 
 func (m *module) handleCartItemByID(w http.ResponseWriter, r *http.Request) {
@@ -282,7 +290,7 @@ func (m *module) handleCartItemByID(w http.ResponseWriter, r *http.Request) {
 			platformhttp.Error(w, http.StatusInternalServerError, "update error")
 			return
 		}
-		_ = platformhttp.JSON(w, http.StatusOK, c)
+		m.writeCart(w, r, c)
 	case http.MethodDelete:
 		c, err := m.store.RemoveItem(r.Context(), cartID, itemID)
 		if err != nil {
@@ -293,7 +301,7 @@ func (m *module) handleCartItemByID(w http.ResponseWriter, r *http.Request) {
 			platformhttp.Error(w, http.StatusInternalServerError, "delete error")
 			return
 		}
-		_ = platformhttp.JSON(w, http.StatusOK, c)
+		m.writeCart(w, r, c)
 	default:
 		http.NotFound(w, r)
 	}
@@ -0,0 +1,44 @@
+package cart
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	platformhttp "goecommerce/internal/platform/http"
+	"goecommerce/internal/platform/tax"
+	storcart "goecommerce/internal/storage/cart"
+)
+
+// writeCart responds with the cart after filling in its tax totals.
+func (m *module) writeCart(w http.ResponseWriter, r *http.Request, c storcart.Cart) {
+	if err := m.applyTax(r, &c); err != nil {
+		log.Printf("cart: tax for cart %s: %v", c.ID, err)
+		platformhttp.Error(w, http.StatusInternalServerError, "tax error")
+		return
+	}
+	_ = platformhttp.JSON(w, http.StatusOK, c)
+}
+
+// applyTax computes the cart tax for the country in the ?country= query
+// parameter, defaulting to the shop country. Reverse charge depends on the
+// buyer's VAT number and billing country, so it is only applied at checkout.
+func (m *module) applyTax(r *http.Request, c *storcart.Cart) error {
+	c.Totals.PricesIncludeTax = m.taxConfig.PricesIncludeTax
+	if m.taxRates == nil {
+		return nil
+	}
+	country := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("country")))
+	if len(country) != 2 {
+		country = m.taxConfig.ShopCountry
+	}
+	rates, err := m.taxRates.GetRates(r.Context(), country)
+	if err != nil {
+		return err
+	}
+	res := tax.Calculate(tax.Request{Config: m.taxConfig, Country: country, Lines: c.TaxLines()}, rates)
+	c.Totals.TaxCountry = res.Country
+	c.Totals.TaxCents = res.TaxCents
+	c.Totals.TotalCents = res.TotalCents
+	return nil
+}
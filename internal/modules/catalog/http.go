@@ -3,7 +3,10 @@ package catalog
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -36,7 +39,9 @@ func (m *module) Name() string { return "catalog" }
 func (m *module) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/products", m.handleProductsList)
 	mux.HandleFunc("/products/", m.handleProductDetail)
+	mux.HandleFunc("/products/search", m.handleProductSearch)
 	mux.HandleFunc("/categories", m.handleCategories)
+	mux.HandleFunc("/categories/", m.handleCategoryDetail)
 }
 
 func (m *module) handleProductsList(w http.ResponseWriter, r *http.Request) {
@@ -53,16 +58,153 @@ func (m *module) handleProductsList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	ctx := r.Context()
+	in, err := parseProductFilters(r.URL.Query())
+	if err != nil {
+		platformhttp.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	res, err := m.store.ListProducts(ctx, in)
+	if err != nil {
+		switch {
+		case errors.Is(err, storcat.ErrInvalidSort), errors.Is(err, storcat.ErrInvalidCursor), errors.Is(err, storcat.ErrInvalidSearchQuery):
+			platformhttp.Error(w, http.StatusBadRequest, err.Error())
+		default:
+			platformhttp.Error(w, http.StatusInternalServerError, "list error")
+		}
+		return
+	}
+	out := map[string]any{
+		"items":      res.Items,
+		"total":      res.Total,
+		"limit":      res.Limit,
+		"nextCursor": res.NextCursor,
+	}
+	// Pages reached through a cursor have no page number.
+	if res.Page > 0 {
+		out["page"] = res.Page
+	}
+	if res.Facets != nil {
+		out["facets"] = res.Facets
+	}
+	_ = platformhttp.JSON(w, http.StatusOK, out)
+}
+
+// maxAttributeFilters bounds the attr.<name> parameters of /products.
+const maxAttributeFilters = 10
+
+// parseProductFilters reads the /products filters: category and tag (comma
+// separated or repeated, any may match), attr.<name> (e.g. attr.color=red,blue),
+// min_price/max_price (cents), in_stock, include_descendants (categories
+// also match their subcategories), q, facets (true by default), sort and
+// cursor (the nextCursor of the previous page, in place of page).
+func parseProductFilters(qp url.Values) (storcat.ListProductsParams, error) {
+	in := storcat.ListProductsParams{
+		Pagination:    storcat.Pagination{Page: atoiDefault(qp.Get("page"), 1), Limit: atoiDefault(qp.Get("limit"), 20)},
+		CategorySlugs: listParam(qp["category"]),
+		Tags:          listParam(qp["tag"]),
+		Facets:        true,
+		Query:         strings.TrimSpace(qp.Get("q")),
+		Sort:          strings.TrimSpace(qp.Get("sort")),
+		Cursor:        strings.TrimSpace(qp.Get("cursor")),
+	}
+	if len(in.Query) > maxSearchQueryLength {
+		return in, errors.New("q is too long")
+	}
+	for name, values := range qp {
+		attr, ok := strings.CutPrefix(name, "attr.")
+		if !ok {
+			continue
+		}
+		if attr = strings.TrimSpace(attr); attr == "" {
+			return in, errors.New("attribute name is required")
+		}
+		if in.Attributes == nil {
+			in.Attributes = map[string][]string{}
+		}
+		if len(in.Attributes) == maxAttributeFilters {
+			return in, fmt.Errorf("at most %d attribute filters are allowed", maxAttributeFilters)
+		}
+		in.Attributes[attr] = append(in.Attributes[attr], listParam(values)...)
+	}
+	for _, bound := range []struct {
+		name string
+		dst  **int
+	}{{"min_price", &in.MinPriceCents}, {"max_price", &in.MaxPriceCents}} {
+		raw := strings.TrimSpace(qp.Get(bound.name))
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return in, fmt.Errorf("invalid %s", bound.name)
+		}
+		*bound.dst = &n
+	}
+	if in.MinPriceCents != nil && in.MaxPriceCents != nil && *in.MinPriceCents > *in.MaxPriceCents {
+		return in, errors.New("min_price must not exceed max_price")
+	}
+	for _, flag := range []struct {
+		name string
+		dst  *bool
+	}{{"in_stock", &in.InStock}, {"facets", &in.Facets}, {"include_descendants", &in.IncludeDescendants}} {
+		raw := strings.TrimSpace(qp.Get(flag.name))
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return in, fmt.Errorf("invalid %s", flag.name)
+		}
+		*flag.dst = v
+	}
+	return in, nil
+}
+
+// listParam splits comma separated or repeated query values.
+func listParam(values []string) []string {
+	var out []string
+	for _, raw := range values {
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
+
+// maxSearchQueryLength bounds the q parameter of /products/search in bytes.
+const maxSearchQueryLength = 200
+
+func (m *module) handleProductSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
 	qp := r.URL.Query()
-	page := atoiDefault(qp.Get("page"), 1)
-	limit := atoiDefault(qp.Get("limit"), 20)
-	cat := strings.TrimSpace(qp.Get("category"))
-	res, err := m.store.ListProducts(ctx, storcat.ListProductsParams{
-		Pagination:   storcat.Pagination{Page: page, Limit: limit},
-		CategorySlug: cat,
+	q := strings.TrimSpace(qp.Get("q"))
+	if q == "" {
+		platformhttp.Error(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	if len(q) > maxSearchQueryLength {
+		platformhttp.Error(w, http.StatusBadRequest, "q is too long")
+		return
+	}
+	if m.store == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	res, err := m.store.SearchProducts(r.Context(), storcat.SearchProductsParams{
+		Pagination: storcat.Pagination{Page: atoiDefault(qp.Get("page"), 1), Limit: atoiDefault(qp.Get("limit"), 20)},
+		Query:      q,
 	})
 	if err != nil {
-		platformhttp.Error(w, http.StatusInternalServerError, "list error")
+		if errors.Is(err, storcat.ErrInvalidSearchQuery) {
+			platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		platformhttp.Error(w, http.StatusInternalServerError, "search error")
 		return
 	}
 	out := map[string]any{
@@ -97,7 +239,18 @@ func (m *module) handleProductDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	ctx := r.Context()
-	p, err := m.store.GetProductBySlug(ctx, slug)
+	var (
+		p   storcat.Product
+		err error
+	)
+	// ?preview= shows drafts and scheduled products to holders of the
+	// product's preview token.
+	if token := strings.TrimSpace(r.URL.Query().Get("preview")); token != "" {
+		w.Header().Set("Cache-Control", "no-store")
+		p, err = m.store.GetProductPreview(ctx, slug, token)
+	} else {
+		p, err = m.store.GetProductBySlug(ctx, slug)
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
 			platformhttp.Error(w, http.StatusNotFound, "not found")
@@ -132,6 +285,45 @@ func (m *module) handleCategories(w http.ResponseWriter, r *http.Request) {
 	_ = platformhttp.JSON(w, http.StatusOK, out)
 }
 
+// handleCategoryDetail serves /categories/tree, every category nested under
+// its parent, and /categories/{slug}, one category with its breadcrumbs and
+// children. Product counts include subcategories.
+func (m *module) handleCategoryDetail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	slug := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/categories/"))
+	if slug == "" || strings.Contains(slug, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if m.store == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	ctx := r.Context()
+	if slug == "tree" {
+		items, err := m.store.ListCategoryTree(ctx)
+		if err != nil {
+			platformhttp.Error(w, http.StatusInternalServerError, "list error")
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"items": items})
+		return
+	}
+	c, err := m.store.GetCategoryBySlug(ctx, slug)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			platformhttp.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		platformhttp.Error(w, http.StatusInternalServerError, "get error")
+		return
+	}
+	_ = platformhttp.JSON(w, http.StatusOK, c)
+}
+
 func atoiDefault(s string, def int) int {
 	n, err := strconv.Atoi(strings.TrimSpace(s))
 	if err != nil || n == 0 {
@@ -1,6 +1,13 @@
 package catalog
 
-import "testing"
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func TestAtoiDefault(t *testing.T) {
 	tests := []struct {
@@ -25,3 +32,76 @@ func TestAtoiDefault(t *testing.T) {
 		})
 	}
 }
+
+func TestProductSearchRequiresQuery(t *testing.T) {
+	mux := http.NewServeMux()
+	(&module{}).RegisterRoutes(mux)
+	for _, target := range []string{"/products/search", "/products/search?q=%20%20", "/products/search?q=" + strings.Repeat("a", maxSearchQueryLength+1)} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("GET %s: expected 400, got %d", target, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products/search?q=shirt", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without a store, got %d", rec.Code)
+	}
+}
+
+func TestParseProductFilters(t *testing.T) {
+	qp, _ := url.ParseQuery("category=shirts,hoodies&category=sale&tag=eco&attr.color=red,blue&attr.size=M&min_price=500&max_price=2500&in_stock=true&include_descendants=1&page=2")
+	in, err := parseProductFilters(qp)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !reflect.DeepEqual(in.CategorySlugs, []string{"shirts", "hoodies", "sale"}) || !reflect.DeepEqual(in.Tags, []string{"eco"}) {
+		t.Fatalf("unexpected categories/tags %+v", in)
+	}
+	if !reflect.DeepEqual(in.Attributes, map[string][]string{"color": {"red", "blue"}, "size": {"M"}}) {
+		t.Fatalf("unexpected attributes %+v", in.Attributes)
+	}
+	if *in.MinPriceCents != 500 || *in.MaxPriceCents != 2500 || !in.InStock || !in.IncludeDescendants || !in.Facets || in.Page != 2 {
+		t.Fatalf("unexpected filters %+v", in)
+	}
+
+	for _, raw := range []string{"min_price=-1", "max_price=abc", "min_price=10&max_price=5", "in_stock=maybe", "attr.=red"} {
+		qp, _ := url.ParseQuery(raw)
+		if _, err := parseProductFilters(qp); err == nil {
+			t.Fatalf("%s: expected an error", raw)
+		}
+	}
+}
+
+func TestParseProductFiltersSortAndCursor(t *testing.T) {
+	qp, _ := url.ParseQuery("q=wool+socks&sort=price_desc&cursor=abc")
+	in, err := parseProductFilters(qp)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if in.Query != "wool socks" || in.Sort != "price_desc" || in.Cursor != "abc" {
+		t.Fatalf("unexpected params %+v", in)
+	}
+	qp = url.Values{"q": {strings.Repeat("a", maxSearchQueryLength+1)}}
+	if _, err := parseProductFilters(qp); err == nil {
+		t.Fatal("expected a long q to be rejected")
+	}
+}
+
+func TestCategoryDetailRoutes(t *testing.T) {
+	mux := http.NewServeMux()
+	(&module{}).RegisterRoutes(mux)
+	for target, want := range map[string]int{
+		"/categories/tree":     http.StatusServiceUnavailable,
+		"/categories/shirts":   http.StatusServiceUnavailable,
+		"/categories/":         http.StatusNotFound,
+		"/categories/shirts/x": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != want {
+			t.Fatalf("GET %s: expected %d, got %d", target, want, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package customers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	platformhttp "goecommerce/internal/platform/http"
+	stororders "goecommerce/internal/storage/orders"
+)
+
+// customerOrdersStore is the part of the orders store behind the account
+// order routes.
+type customerOrdersStore interface {
+	CreateReturn(ctx context.Context, in stororders.CreateReturnInput) (stororders.Return, error)
+	ListCustomerReturns(ctx context.Context, orderID, customerID string) ([]stororders.Return, error)
+	ListCustomerInvoices(ctx context.Context, orderID, customerID string) ([]stororders.Invoice, error)
+	InvoicePDF(ctx context.Context, in stororders.InvoicePDFInput) (stororders.Invoice, []byte, error)
+	ListCustomerOrderNotes(ctx context.Context, orderID, customerID string) ([]stororders.OrderNote, error)
+}
+
+// handleAccountOrder serves the per-order account routes below
+// /account/orders/{id}/: returns, invoices and notes.
+func (m *module) handleAccountOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/account/orders/"), "/")
+	action, sub, _ := strings.Cut(rest, "/")
+	if orderID == "" || (action != "returns" && action != "invoices" && action != "notes") || (action != "invoices" && sub != "") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && (r.Method != http.MethodPost || action != "returns") {
+		http.NotFound(w, r)
+		return
+	}
+	if m.store == nil || m.orders == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	customer, _, err := ResolveAuthenticatedCustomer(r.Context(), r, m.store)
+	if err != nil {
+		if errors.Is(err, ErrUnauthenticated) {
+			platformhttp.Error(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		platformhttp.Error(w, http.StatusInternalServerError, "auth error")
+		return
+	}
+	if action == "invoices" {
+		m.handleOrderInvoices(w, r, customer.ID, orderID, sub)
+		return
+	}
+	if action == "notes" {
+		// Only notes the shop marked customer-visible are listed.
+		items, err := m.orders.ListCustomerOrderNotes(r.Context(), orderID, customer.ID)
+		if err != nil {
+			writeAccountOrderError(w, err)
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"items": items})
+		return
+	}
+	m.handleOrderReturns(w, r, customer, orderID)
+}
+
+// handleOrderInvoices lists the invoice and credit notes of one of the
+// customer's orders, or downloads one as PDF at {invoiceID}/pdf.
+func (m *module) handleOrderInvoices(w http.ResponseWriter, r *http.Request, customerID, orderID, rest string) {
+	if rest == "" {
+		items, err := m.orders.ListCustomerInvoices(r.Context(), orderID, customerID)
+		if err != nil {
+			writeAccountOrderError(w, err)
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"items": items})
+		return
+	}
+	invoiceID, action, _ := strings.Cut(rest, "/")
+	if invoiceID == "" || action != "pdf" {
+		http.NotFound(w, r)
+		return
+	}
+	inv, data, err := m.orders.InvoicePDF(r.Context(), stororders.InvoicePDFInput{
+		OrderID:    orderID,
+		InvoiceID:  invoiceID,
+		CustomerID: customerID,
+		Seller:     m.invoiceSeller,
+		UploadsDir: m.uploadsDir,
+	})
+	if err != nil {
+		writeAccountOrderError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(inv.Number+".pdf"))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func writeAccountOrderError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		platformhttp.Error(w, http.StatusNotFound, "not found")
+	case errors.Is(err, stororders.ErrInvalidReturn):
+		platformhttp.Error(w, http.StatusBadRequest, err.Error())
+	default:
+		platformhttp.Error(w, http.StatusInternalServerError, "order error")
+	}
+}
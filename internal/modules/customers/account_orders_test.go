@@ -0,0 +1,77 @@
+package customers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	storcustomers "goecommerce/internal/storage/customers"
+)
+
+func TestHandleOrderInvoicesDownloadsOwnInvoice(t *testing.T) {
+	store := &fakeAccountStore{
+		customerByToken: map[string]storcustomers.Customer{
+			hashSessionToken("token-1"): {ID: "cust_1", Email: "c1@example.com"},
+		},
+	}
+	orders := &fakeAccountOrdersStore{ownerByOrder: map[string]string{"ord-1": "cust_1", "ord-2": "cust_2"}}
+	m := &module{store: store, orders: orders, now: time.Now}
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: "token-1"})
+		rr := httptest.NewRecorder()
+		m.handleAccountOrder(rr, req)
+		return rr
+	}
+
+	if rr := do(http.MethodGet, "/account/orders/ord-1/invoices"); rr.Code != http.StatusOK || !bytes.Contains(rr.Body.Bytes(), []byte("INV-2026-000001")) {
+		t.Fatalf("expected invoice list, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr := do(http.MethodGet, "/account/orders/ord-1/invoices/inv-1/pdf")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/pdf" {
+		t.Fatalf("expected pdf download, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if got := rr.Header().Get("Content-Disposition"); got != `attachment; filename="INV-2026-000001.pdf"` {
+		t.Fatalf("unexpected content disposition %q", got)
+	}
+	if rr := do(http.MethodGet, "/account/orders/ord-2/invoices/inv-1/pdf"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another customer's invoice, got %d", rr.Code)
+	}
+	if rr := do(http.MethodPost, "/account/orders/ord-1/invoices"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for POST, got %d", rr.Code)
+	}
+}
+
+func TestHandleOrderNotesScopedToCustomer(t *testing.T) {
+	store := &fakeAccountStore{
+		customerByToken: map[string]storcustomers.Customer{
+			hashSessionToken("token-1"): {ID: "cust_1", Email: "c1@example.com"},
+		},
+	}
+	orders := &fakeAccountOrdersStore{ownerByOrder: map[string]string{"ord-1": "cust_1", "ord-2": "cust_2"}}
+	m := &module{store: store, orders: orders, now: time.Now}
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: "token-1"})
+		rr := httptest.NewRecorder()
+		m.handleAccountOrder(rr, req)
+		return rr
+	}
+
+	if rr := do(http.MethodGet, "/account/orders/ord-1/notes"); rr.Code != http.StatusOK || !bytes.Contains(rr.Body.Bytes(), []byte("Ships Monday")) {
+		t.Fatalf("expected notes, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodGet, "/account/orders/ord-2/notes"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another customer's order, got %d", rr.Code)
+	}
+	if rr := do(http.MethodPost, "/account/orders/ord-1/notes"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for POST, got %d", rr.Code)
+	}
+	if rr := do(http.MethodGet, "/account/orders/ord-1/notes/note-1"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a sub path, got %d", rr.Code)
+	}
+}
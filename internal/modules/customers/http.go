@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"log"
 	"net/http"
 	"net/mail"
 	"strconv"
@@ -13,8 +14,11 @@ import (
 
 	"goecommerce/internal/app"
 	platformhttp "goecommerce/internal/platform/http"
+	"goecommerce/internal/platform/invoices"
 	storcart "goecommerce/internal/storage/cart"
 	storcustomers "goecommerce/internal/storage/customers"
+	stormedia "goecommerce/internal/storage/media"
+	stororders "goecommerce/internal/storage/orders"
 )
 
 const (
@@ -39,13 +43,23 @@ type customerStore interface {
 type module struct {
 	store      customerStore
 	cartStore  customerCartStore
+	orders     customerOrdersStore
 	sessionTTL time.Duration
 	now        func() time.Time
+	// verifier delivers email verification links; verificationURL is the
+	// page the link points at (EMAIL_VERIFICATION_URL).
+	verifier        VerificationSender
+	verificationURL string
+	// invoiceSeller is printed on invoices rendered for download and
+	// uploadsDir is the media storage they are kept in.
+	invoiceSeller invoices.Party
+	uploadsDir    string
 }
 
 func NewModule(deps app.Deps) app.Module {
 	var store customerStore
 	var cartStore customerCartStore
+	var orders customerOrdersStore
 	if deps.DB != nil {
 		if st, err := storcustomers.NewStore(context.Background(), deps.DB); err == nil {
 			store = st
@@ -53,8 +67,21 @@ func NewModule(deps app.Deps) app.Module {
 		if st, err := storcart.NewStore(context.Background(), deps.DB); err == nil {
 			cartStore = st
 		}
+		if st, err := stororders.NewStore(context.Background(), deps.DB); err == nil {
+			orders = st
+		}
+	}
+	return &module{
+		store:           store,
+		cartStore:       cartStore,
+		orders:          orders,
+		sessionTTL:      defaultSessionTTL,
+		now:             time.Now,
+		verifier:        logVerificationSender{},
+		verificationURL: emailVerificationURLFromEnv(),
+		invoiceSeller:   invoices.SellerFromEnv(),
+		uploadsDir:      stormedia.UploadsDirFromEnv(),
 	}
-	return &module{store: store, cartStore: cartStore, sessionTTL: defaultSessionTTL, now: time.Now}
 }
 
 func (m *module) Name() string { return "customers" }
@@ -79,9 +106,12 @@ func (m *module) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/auth/login", m.handleLogin)
 	mux.HandleFunc("/auth/logout", m.handleLogout)
 	mux.HandleFunc("/auth/me", m.handleMe)
+	mux.HandleFunc("/auth/verify-email", m.handleVerifyEmail)
+	mux.HandleFunc("/auth/verify-email/resend", m.handleResendEmailVerification)
 	mux.HandleFunc("/account/favorites", m.handleFavorites)
 	mux.HandleFunc("/account/favorites/", m.handleFavorites)
 	mux.HandleFunc("/account/orders", m.handleOrders)
+	mux.HandleFunc("/account/orders/", m.handleAccountOrder)
 	mux.HandleFunc("/account/change-password", m.handleChangePassword)
 	mux.HandleFunc("/support/blocked-report", m.handleBlockedReport)
 }
@@ -92,9 +122,10 @@ type credentialsRequest struct {
 }
 
 type authCustomerResponse struct {
-	ID        string    `json:"id"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
+	ID            string    `json:"id"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
 type customerCartStore interface {
@@ -151,6 +182,9 @@ func (m *module) handleRegister(w http.ResponseWriter, r *http.Request) {
 	m.writeCustomerActionLog(r, customerActionCreated, &customer.ID, &infoSeverity, map[string]any{
 		"source": "auth.register",
 	})
+	if err := m.sendEmailVerification(r, customer); err != nil {
+		log.Printf("customers: send email verification for %s: %v", customer.ID, err)
+	}
 	_ = platformhttp.JSON(w, http.StatusCreated, toAuthResponse(customer))
 }
 
@@ -195,6 +229,11 @@ func (m *module) handleLogin(w http.ResponseWriter, r *http.Request) {
 		}
 		setCartCookie(w, r, canonicalCart.ID)
 	}
+	// Guest orders placed since the email was verified are picked up here; a
+	// failed claim is retried on the next login rather than failing this one.
+	if _, err := m.claimGuestOrders(r, customer, "auth.login"); err != nil {
+		log.Printf("customers: claim guest orders for %s: %v", customer.ID, err)
+	}
 	_ = platformhttp.JSON(w, http.StatusOK, toAuthResponse(customer))
 }
 
@@ -417,7 +456,7 @@ func setCartCookie(w http.ResponseWriter, r *http.Request, cartID string) {
 }
 
 func toAuthResponse(c storcustomers.Customer) authCustomerResponse {
-	return authCustomerResponse{ID: c.ID, Email: c.Email, CreatedAt: c.CreatedAt}
+	return authCustomerResponse{ID: c.ID, Email: c.Email, EmailVerified: c.EmailVerifiedAt != nil, CreatedAt: c.CreatedAt}
 }
 
 func (m *module) startSession(w http.ResponseWriter, r *http.Request, customerID string) error {
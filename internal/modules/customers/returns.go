@@ -0,0 +1,61 @@
+package customers
+
+import (
+	"net/http"
+
+	platformhttp "goecommerce/internal/platform/http"
+	storcustomers "goecommerce/internal/storage/customers"
+	stororders "goecommerce/internal/storage/orders"
+)
+
+const customerActionReturnRequested = "customer.return_requested"
+
+type returnRequest struct {
+	Reason string              `json:"reason"`
+	Lines  []returnLineRequest `json:"lines"`
+}
+
+type returnLineRequest struct {
+	OrderItemID string `json:"order_item_id"`
+	Quantity    int    `json:"quantity"`
+	Reason      string `json:"reason"`
+}
+
+// handleOrderReturns lists the returns of one of the customer's orders (GET)
+// and requests a new one for shipped lines (POST).
+func (m *module) handleOrderReturns(w http.ResponseWriter, r *http.Request, customer storcustomers.Customer, orderID string) {
+	if r.Method == http.MethodGet {
+		items, err := m.orders.ListCustomerReturns(r.Context(), orderID, customer.ID)
+		if err != nil {
+			writeAccountOrderError(w, err)
+			return
+		}
+		_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"items": items})
+		return
+	}
+
+	var body returnRequest
+	if err := decodeAuthRequest(r, &body); err != nil {
+		platformhttp.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	in := stororders.CreateReturnInput{
+		OrderID:    orderID,
+		CustomerID: customer.ID,
+		Reason:     body.Reason,
+	}
+	for _, line := range body.Lines {
+		in.Lines = append(in.Lines, stororders.ReturnLine{OrderItemID: line.OrderItemID, Quantity: line.Quantity, Reason: line.Reason})
+	}
+	ret, err := m.orders.CreateReturn(r.Context(), in)
+	if err != nil {
+		writeAccountOrderError(w, err)
+		return
+	}
+	infoSeverity := "info"
+	m.writeCustomerActionLog(r, customerActionReturnRequested, &customer.ID, &infoSeverity, map[string]any{
+		"order_id":  orderID,
+		"return_id": ret.ID,
+	})
+	_ = platformhttp.JSON(w, http.StatusCreated, ret)
+}
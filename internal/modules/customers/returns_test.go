@@ -0,0 +1,111 @@
+package customers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	storcustomers "goecommerce/internal/storage/customers"
+	stororders "goecommerce/internal/storage/orders"
+)
+
+type fakeAccountOrdersStore struct {
+	ownerByOrder map[string]string
+	created      []stororders.CreateReturnInput
+}
+
+func (f *fakeAccountOrdersStore) CreateReturn(_ context.Context, in stororders.CreateReturnInput) (stororders.Return, error) {
+	if f.ownerByOrder[in.OrderID] != in.CustomerID {
+		return stororders.Return{}, sql.ErrNoRows
+	}
+	if len(in.Lines) == 0 {
+		return stororders.Return{}, fmt.Errorf("%w: at least one line is required", stororders.ErrInvalidReturn)
+	}
+	f.created = append(f.created, in)
+	return stororders.Return{ID: "ret-1", OrderID: in.OrderID, CustomerID: in.CustomerID, Status: stororders.ReturnStatusRequested, Reason: in.Reason, Lines: in.Lines}, nil
+}
+
+func (f *fakeAccountOrdersStore) ListCustomerReturns(_ context.Context, orderID, customerID string) ([]stororders.Return, error) {
+	if f.ownerByOrder[orderID] != customerID {
+		return nil, sql.ErrNoRows
+	}
+	return []stororders.Return{}, nil
+}
+
+func (f *fakeAccountOrdersStore) ListCustomerInvoices(_ context.Context, orderID, customerID string) ([]stororders.Invoice, error) {
+	if f.ownerByOrder[orderID] != customerID {
+		return nil, sql.ErrNoRows
+	}
+	return []stororders.Invoice{{ID: "inv-1", OrderID: orderID, Kind: "invoice", Number: "INV-2026-000001"}}, nil
+}
+
+func (f *fakeAccountOrdersStore) InvoicePDF(_ context.Context, in stororders.InvoicePDFInput) (stororders.Invoice, []byte, error) {
+	if f.ownerByOrder[in.OrderID] != in.CustomerID || in.InvoiceID != "inv-1" {
+		return stororders.Invoice{}, nil, sql.ErrNoRows
+	}
+	return stororders.Invoice{ID: "inv-1", Number: "INV-2026-000001"}, []byte("%PDF-1.4"), nil
+}
+
+func (f *fakeAccountOrdersStore) ListCustomerOrderNotes(_ context.Context, orderID, customerID string) ([]stororders.OrderNote, error) {
+	if f.ownerByOrder[orderID] != customerID {
+		return nil, sql.ErrNoRows
+	}
+	return []stororders.OrderNote{{ID: "note-1", OrderID: orderID, Visibility: stororders.NoteVisibilityCustomer, Body: "Ships Monday"}}, nil
+}
+
+func TestHandleOrderReturnsScopedToCustomer(t *testing.T) {
+	store := &fakeAccountStore{
+		customerByToken: map[string]storcustomers.Customer{
+			hashSessionToken("token-1"): {ID: "cust_1", Email: "c1@example.com"},
+		},
+	}
+	returns := &fakeAccountOrdersStore{ownerByOrder: map[string]string{"ord-1": "cust_1", "ord-2": "cust_2"}}
+	m := &module{store: store, orders: returns, now: time.Now}
+
+	do := func(method, path string, body any) *httptest.ResponseRecorder {
+		var raw []byte
+		if body != nil {
+			raw, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: "token-1"})
+		rr := httptest.NewRecorder()
+		m.handleAccountOrder(rr, req)
+		return rr
+	}
+
+	unauth := httptest.NewRecorder()
+	m.handleAccountOrder(unauth, httptest.NewRequest(http.MethodGet, "/account/orders/ord-1/returns", nil))
+	if unauth.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without session, got %d", unauth.Code)
+	}
+
+	body := map[string]any{
+		"reason": "wrong size",
+		"lines":  []map[string]any{{"order_item_id": "item-1", "quantity": 1, "reason": "too small"}},
+	}
+	if rr := do(http.MethodPost, "/account/orders/ord-1/returns", body); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(returns.created) != 1 || returns.created[0].CustomerID != "cust_1" || returns.created[0].Lines[0].Quantity != 1 {
+		t.Fatalf("unexpected return input: %+v", returns.created)
+	}
+	if rr := do(http.MethodPost, "/account/orders/ord-2/returns", body); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another customer's order, got %d", rr.Code)
+	}
+	if rr := do(http.MethodPost, "/account/orders/ord-1/returns", map[string]any{"reason": "x", "lines": []any{}}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without lines, got %d", rr.Code)
+	}
+	if rr := do(http.MethodGet, "/account/orders/ord-1/returns", nil); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 listing returns, got %d", rr.Code)
+	}
+	if rr := do(http.MethodGet, "/account/orders/ord-1/messages", nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown action, got %d", rr.Code)
+	}
+}
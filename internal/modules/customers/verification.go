@@ -0,0 +1,197 @@
+package customers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	platformhttp "goecommerce/internal/platform/http"
+	storcustomers "goecommerce/internal/storage/customers"
+)
+
+const (
+	emailVerificationTTL             = 48 * time.Hour
+	defaultEmailVerificationURL      = "/auth/verify-email"
+	customerActionEmailVerified      = "customer.email_verified"
+	customerActionGuestOrdersClaimed = "customer.guest_orders_claimed"
+)
+
+type emailVerificationStore interface {
+	CreateEmailVerification(ctx context.Context, customerID, tokenHash string, expiresAt time.Time) error
+	VerifyEmail(ctx context.Context, tokenHash string) (storcustomers.Customer, error)
+	ClaimGuestOrders(ctx context.Context, customerID string) ([]storcustomers.ClaimedOrder, error)
+}
+
+// VerificationSender delivers the email verification link to the customer.
+type VerificationSender interface {
+	SendEmailVerification(ctx context.Context, email, link string) error
+}
+
+// logVerificationSender is used until an email provider is configured; it
+// writes the link to the server log.
+type logVerificationSender struct{}
+
+func (logVerificationSender) SendEmailVerification(_ context.Context, email, link string) error {
+	log.Printf("customers: email verification for %s: %s", email, link)
+	return nil
+}
+
+func emailVerificationURLFromEnv() string {
+	if v := strings.TrimSpace(os.Getenv("EMAIL_VERIFICATION_URL")); v != "" {
+		return v
+	}
+	return defaultEmailVerificationURL
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+func (m *module) verificationStore() (emailVerificationStore, bool) {
+	st, ok := m.store.(emailVerificationStore)
+	return st, ok
+}
+
+// sendEmailVerification issues a fresh token for the customer's email and
+// hands the link to the configured sender.
+func (m *module) sendEmailVerification(r *http.Request, customer storcustomers.Customer) error {
+	st, ok := m.verificationStore()
+	if !ok || m.verifier == nil {
+		return nil
+	}
+	token, err := generateSessionToken()
+	if err != nil {
+		return err
+	}
+	if err := st.CreateEmailVerification(r.Context(), customer.ID, hashSessionToken(token), m.now().Add(emailVerificationTTL)); err != nil {
+		return err
+	}
+	base := m.verificationURL
+	if base == "" {
+		base = defaultEmailVerificationURL
+	}
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return m.verifier.SendEmailVerification(r.Context(), customer.Email, base+sep+"token="+url.QueryEscape(token))
+}
+
+// claimGuestOrders links earlier guest orders to a verified customer and
+// records the claim in the customer's action log.
+func (m *module) claimGuestOrders(r *http.Request, customer storcustomers.Customer, source string) ([]storcustomers.ClaimedOrder, error) {
+	st, ok := m.verificationStore()
+	if !ok || customer.EmailVerifiedAt == nil {
+		return nil, nil
+	}
+	claimed, err := st.ClaimGuestOrders(r.Context(), customer.ID)
+	if err != nil || len(claimed) == 0 {
+		return nil, err
+	}
+	ids := make([]string, 0, len(claimed))
+	for _, o := range claimed {
+		ids = append(ids, o.ID)
+	}
+	infoSeverity := "info"
+	m.writeCustomerActionLog(r, customerActionGuestOrdersClaimed, &customer.ID, &infoSeverity, map[string]any{
+		"source":        source,
+		"order_ids":     ids,
+		"order_numbers": claimedOrderNumbers(claimed),
+	})
+	return claimed, nil
+}
+
+func (m *module) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/auth/verify-email" {
+		http.NotFound(w, r)
+		return
+	}
+	st, ok := m.verificationStore()
+	if !ok {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	var body verifyEmailRequest
+	switch r.Method {
+	case http.MethodGet:
+		body.Token = r.URL.Query().Get("token")
+	case http.MethodPost:
+		if err := decodeAuthRequest(r, &body); err != nil {
+			platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	token := strings.TrimSpace(body.Token)
+	if token == "" {
+		platformhttp.Error(w, http.StatusBadRequest, "token is required")
+		return
+	}
+	customer, err := st.VerifyEmail(r.Context(), hashSessionToken(token))
+	if err != nil {
+		if errors.Is(err, storcustomers.ErrNotFound) {
+			platformhttp.Error(w, http.StatusBadRequest, "invalid or expired token")
+			return
+		}
+		platformhttp.Error(w, http.StatusInternalServerError, "verification error")
+		return
+	}
+	infoSeverity := "info"
+	m.writeCustomerActionLog(r, customerActionEmailVerified, &customer.ID, &infoSeverity, map[string]any{
+		"source": "auth.verify_email",
+	})
+	claimed, err := m.claimGuestOrders(r, customer, "auth.verify_email")
+	if err != nil {
+		platformhttp.Error(w, http.StatusInternalServerError, "verification error")
+		return
+	}
+	_ = platformhttp.JSON(w, http.StatusOK, map[string]any{
+		"customer":              toAuthResponse(customer),
+		"claimed_orders_count":  len(claimed),
+		"claimed_order_numbers": claimedOrderNumbers(claimed),
+	})
+}
+
+func (m *module) handleResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/auth/verify-email/resend" {
+		http.NotFound(w, r)
+		return
+	}
+	if _, ok := m.verificationStore(); !ok {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	customer, _, err := ResolveAuthenticatedCustomer(r.Context(), r, m.store)
+	if err != nil {
+		if errors.Is(err, ErrUnauthenticated) {
+			platformhttp.Error(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		platformhttp.Error(w, http.StatusInternalServerError, "auth error")
+		return
+	}
+	if customer.EmailVerifiedAt != nil {
+		platformhttp.Error(w, http.StatusConflict, "email already verified")
+		return
+	}
+	if err := m.sendEmailVerification(r, customer); err != nil {
+		platformhttp.Error(w, http.StatusInternalServerError, "verification error")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func claimedOrderNumbers(claimed []storcustomers.ClaimedOrder) []string {
+	out := make([]string, 0, len(claimed))
+	for _, o := range claimed {
+		out = append(out, o.Number)
+	}
+	return out
+}
@@ -0,0 +1,158 @@
+package customers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	storcustomers "goecommerce/internal/storage/customers"
+)
+
+type fakeVerificationStore struct {
+	fakeLoginStore
+	tokens      map[string]string
+	guestOrders []storcustomers.ClaimedOrder
+	claimedBy   string
+	logs        []storcustomers.CreateCustomerActionLogInput
+}
+
+func (f *fakeVerificationStore) CreateCustomer(context.Context, string, string) (storcustomers.Customer, error) {
+	return f.customer, nil
+}
+
+func (f *fakeVerificationStore) CreateEmailVerification(_ context.Context, customerID, tokenHash string, _ time.Time) error {
+	f.tokens[tokenHash] = customerID
+	return nil
+}
+
+func (f *fakeVerificationStore) VerifyEmail(_ context.Context, tokenHash string) (storcustomers.Customer, error) {
+	if f.tokens[tokenHash] != f.customer.ID {
+		return storcustomers.Customer{}, storcustomers.ErrNotFound
+	}
+	delete(f.tokens, tokenHash)
+	verifiedAt := time.Unix(1700000000, 0).UTC()
+	f.customer.EmailVerifiedAt = &verifiedAt
+	return f.customer, nil
+}
+
+func (f *fakeVerificationStore) ClaimGuestOrders(_ context.Context, customerID string) ([]storcustomers.ClaimedOrder, error) {
+	f.claimedBy = customerID
+	claimed := f.guestOrders
+	f.guestOrders = nil
+	return claimed, nil
+}
+
+func (f *fakeVerificationStore) InsertCustomerActionLog(_ context.Context, in storcustomers.CreateCustomerActionLogInput) (storcustomers.CustomerActionLog, error) {
+	f.logs = append(f.logs, in)
+	return storcustomers.CustomerActionLog{}, nil
+}
+
+type fakeVerificationSender struct {
+	email string
+	link  string
+}
+
+func (f *fakeVerificationSender) SendEmailVerification(_ context.Context, email, link string) error {
+	f.email, f.link = email, link
+	return nil
+}
+
+func newVerificationTestModule(store *fakeVerificationStore, sender *fakeVerificationSender) *module {
+	return &module{store: store, sessionTTL: defaultSessionTTL, now: time.Now, verifier: sender, verificationURL: "https://shop.example/verify"}
+}
+
+func TestRegisterSendsVerificationAndVerifyClaimsGuestOrders(t *testing.T) {
+	store := &fakeVerificationStore{
+		fakeLoginStore: fakeLoginStore{customer: storcustomers.Customer{ID: "cust_1", Email: "guest@example.com", Status: "active"}},
+		tokens:         map[string]string{},
+		guestOrders:    []storcustomers.ClaimedOrder{{ID: "o1", Number: "ORD-1"}, {ID: "o2", Number: "ORD-2"}},
+	}
+	sender := &fakeVerificationSender{}
+	m := newVerificationTestModule(store, sender)
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	body, _ := json.Marshal(credentialsRequest{Email: "guest@example.com", Password: "supersecret"})
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/auth/register", bytes.NewReader(body)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if store.claimedBy != "" {
+		t.Fatalf("expected no orders to be claimed before the email is verified")
+	}
+	link, err := url.Parse(sender.link)
+	if err != nil || sender.email != "guest@example.com" || link.Host != "shop.example" || link.Query().Get("token") == "" {
+		t.Fatalf("unexpected verification link %q sent to %q", sender.link, sender.email)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/auth/verify-email?token="+url.QueryEscape(link.Query().Get("token")), nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var got struct {
+		Customer            authCustomerResponse `json:"customer"`
+		ClaimedOrdersCount  int                  `json:"claimed_orders_count"`
+		ClaimedOrderNumbers []string             `json:"claimed_order_numbers"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !got.Customer.EmailVerified || got.ClaimedOrdersCount != 2 || store.claimedBy != "cust_1" {
+		t.Fatalf("unexpected verify response %+v", got)
+	}
+	var claimLog *storcustomers.CreateCustomerActionLogInput
+	for i := range store.logs {
+		if store.logs[i].Action == customerActionGuestOrdersClaimed {
+			claimLog = &store.logs[i]
+		}
+	}
+	if claimLog == nil || claimLog.CustomerID == nil || *claimLog.CustomerID != "cust_1" || !bytes.Contains(claimLog.MetaJSON, []byte("ORD-2")) {
+		t.Fatalf("expected claim to be recorded in customer action logs, got %+v", store.logs)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/auth/verify-email?token="+url.QueryEscape(link.Query().Get("token")), nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected used token to be rejected, got %d", rr.Code)
+	}
+}
+
+func TestLoginClaimsGuestOrdersOnlyForVerifiedEmail(t *testing.T) {
+	passwordHash, err := hashPassword("supersecret")
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	store := &fakeVerificationStore{
+		fakeLoginStore: fakeLoginStore{customer: storcustomers.Customer{ID: "cust_1", Email: "guest@example.com", PasswordHash: passwordHash, Status: "active"}},
+		tokens:         map[string]string{},
+		guestOrders:    []storcustomers.ClaimedOrder{{ID: "o1", Number: "ORD-1"}},
+	}
+	m := newVerificationTestModule(store, &fakeVerificationSender{})
+	login := func() {
+		t.Helper()
+		body, _ := json.Marshal(credentialsRequest{Email: "guest@example.com", Password: "supersecret"})
+		rr := httptest.NewRecorder()
+		m.handleLogin(rr, httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rr.Code)
+		}
+	}
+
+	login()
+	if store.claimedBy != "" {
+		t.Fatalf("expected unverified login not to claim orders")
+	}
+	verifiedAt := time.Now()
+	store.customer.EmailVerifiedAt = &verifiedAt
+	login()
+	if store.claimedBy != "cust_1" || len(store.logs) != 1 || store.logs[0].Action != customerActionGuestOrdersClaimed {
+		t.Fatalf("expected verified login to claim guest orders, got claimedBy=%q logs=%+v", store.claimedBy, store.logs)
+	}
+}
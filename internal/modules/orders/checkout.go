@@ -0,0 +1,133 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"strings"
+
+	modshipping "goecommerce/internal/modules/shipping"
+	storcart "goecommerce/internal/storage/cart"
+	stororders "goecommerce/internal/storage/orders"
+)
+
+type checkoutAddress struct {
+	FullName string `json:"full_name"`
+	Phone    string `json:"phone"`
+	Address1 string `json:"address1"`
+	Address2 string `json:"address2"`
+	City     string `json:"city"`
+	State    string `json:"state"`
+	Postcode string `json:"postcode"`
+	Country  string `json:"country"`
+}
+
+func (a *checkoutAddress) toOrderAddress() *stororders.Address {
+	if a == nil {
+		return nil
+	}
+	out := &stororders.Address{
+		FullName: a.FullName,
+		Phone:    a.Phone,
+		Address1: a.Address1,
+		Address2: a.Address2,
+		City:     a.City,
+		State:    a.State,
+		Postcode: a.Postcode,
+		Country:  a.Country,
+	}
+	out.Normalize()
+	return out
+}
+
+// checkoutError is a validation failure whose message is returned to the
+// client as a 400.
+type checkoutError struct{ msg string }
+
+func (e *checkoutError) Error() string { return e.msg }
+
+func invalidCheckout(msg string) error { return &checkoutError{msg: msg} }
+
+func validateAddress(a *stororders.Address, field string, needsStreet bool) error {
+	if a.FullName == "" {
+		return invalidCheckout(field + ".full_name is required")
+	}
+	if len(a.Country) != 2 {
+		return invalidCheckout(field + ".country must be a 2-letter code")
+	}
+	if needsStreet && (a.Address1 == "" || a.City == "" || a.Postcode == "") {
+		return invalidCheckout(field + ".address1, city and postcode are required")
+	}
+	return nil
+}
+
+// applyCheckoutDetails validates the contact, address and shipping parts of
+// the checkout request and copies them onto in. An email is required, from
+// the request or the customer's account. Every catalog product is a physical
+// good, so a shipping method and address are always required; shipping is
+// priced here from the shipping method rules and any client-side price is
+// ignored.
+func (m *module) applyCheckoutDetails(ctx context.Context, req checkoutRequest, c storcart.Cart, customerEmail string, in *stororders.CreateOrderInput) error {
+	in.Email = strings.TrimSpace(req.Email)
+	if in.Email == "" {
+		in.Email = customerEmail
+	}
+	if in.Email == "" {
+		return invalidCheckout("email is required")
+	}
+	if _, err := mail.ParseAddress(in.Email); err != nil {
+		return invalidCheckout("invalid email")
+	}
+	in.Phone = strings.TrimSpace(req.Phone)
+	in.ShippingAddress = req.ShippingAddress.toOrderAddress()
+	in.BillingAddress = req.BillingAddress.toOrderAddress()
+
+	if in.ShippingAddress == nil {
+		return invalidCheckout("shipping_address is required")
+	}
+	if strings.TrimSpace(req.ShippingMethodID) == "" {
+		return invalidCheckout("shipping_method_id is required")
+	}
+	if m.shipping == nil {
+		return invalidCheckout("shipping_method_id is not available")
+	}
+	quote, err := modshipping.QuoteMethod(ctx, m.shipping, req.ShippingMethodID, in.ShippingAddress.Country, int64(c.Totals.SubtotalCents), req.ShippingTerminalID)
+	if err != nil {
+		switch {
+		case errors.Is(err, modshipping.ErrMethodUnavailable):
+			return invalidCheckout("shipping method not available for this address")
+		case errors.Is(err, modshipping.ErrTerminalRequired):
+			return invalidCheckout("shipping_terminal_id is required")
+		case errors.Is(err, modshipping.ErrUnknownTerminal):
+			return invalidCheckout("invalid shipping_terminal_id")
+		}
+		return err
+	}
+	// Shipping prices are in a single currency; an order cannot mix it with
+	// another cart currency.
+	if quote.Currency != c.Totals.Currency {
+		return invalidCheckout("shipping method not available in the cart currency")
+	}
+	in.Shipping = stororders.ShippingSelection{
+		MethodID:    quote.Method.ID,
+		MethodTitle: quote.Method.Title,
+		ProviderKey: quote.Method.ProviderKey,
+		ServiceCode: quote.Method.ServiceCode,
+		TerminalID:  quote.TerminalID,
+		PriceCents:  quote.PriceCents,
+	}
+	needsStreet := !modshipping.RequiresTerminal(&quote.Method)
+	if err := validateAddress(in.ShippingAddress, "shipping_address", needsStreet); err != nil {
+		return err
+	}
+	if in.BillingAddress == nil {
+		billing := *in.ShippingAddress
+		in.BillingAddress = &billing
+	}
+	if in.BillingAddress != nil {
+		if err := validateAddress(in.BillingAddress, "billing_address", true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	storcart "goecommerce/internal/storage/cart"
+	stororders "goecommerce/internal/storage/orders"
+	storshiping "goecommerce/internal/storage/shipping"
+)
+
+type fakeShippingStore struct {
+	methods map[string]*storshiping.Method
+}
+
+func (f *fakeShippingStore) GetZoneByCountry(_ context.Context, country string) (*storshiping.Zone, error) {
+	if country != "LT" {
+		return nil, sql.ErrNoRows
+	}
+	return &storshiping.Zone{ID: "zone-lt", Enabled: true}, nil
+}
+
+func (f *fakeShippingStore) GetMethod(_ context.Context, id string) (*storshiping.Method, error) {
+	m, ok := f.methods[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return m, nil
+}
+
+func (f *fakeShippingStore) GetCachedTerminals(context.Context, string, string) ([]byte, time.Time, error) {
+	return nil, time.Time{}, sql.ErrNoRows
+}
+
+func newCheckoutTestModule() *module {
+	return &module{shipping: &fakeShippingStore{methods: map[string]*storshiping.Method{
+		"courier": {ID: "courier", ZoneID: "zone-lt", ProviderKey: "omniva", ServiceCode: "home-delivery", Title: "Courier", Enabled: true, PricingMode: "fixed", PricingRulesJSON: []byte(`{"base_price_cents": 499}`)},
+		"locker":  {ID: "locker", ZoneID: "zone-lt", ProviderKey: "omniva", ServiceCode: "parcel-locker", Title: "Parcel locker", Enabled: true, PricingMode: "fixed", PricingRulesJSON: []byte(`{"base_price_cents": 299}`)},
+	}}}
+}
+
+func TestApplyCheckoutDetailsPricesShippingServerSide(t *testing.T) {
+	m := newCheckoutTestModule()
+	cart := storcart.Cart{Totals: storcart.Totals{SubtotalCents: 2000, Currency: "EUR"}}
+	req := checkoutRequest{
+		Email:            "buyer@example.com",
+		ShippingAddress:  &checkoutAddress{FullName: "Jonas", Address1: "Gedimino 1", City: "Vilnius", Postcode: "01103", Country: "lt"},
+		ShippingMethodID: "courier",
+	}
+	var in stororders.CreateOrderInput
+	if err := m.applyCheckoutDetails(context.Background(), req, cart, "", &in); err != nil {
+		t.Fatalf("applyCheckoutDetails error: %v", err)
+	}
+	if in.Shipping.PriceCents != 499 || in.Shipping.MethodTitle != "Courier" {
+		t.Fatalf("unexpected shipping %#v", in.Shipping)
+	}
+	if in.ShippingAddress.Country != "LT" {
+		t.Fatalf("expected normalized country, got %q", in.ShippingAddress.Country)
+	}
+	if in.BillingAddress == nil || in.BillingAddress.Address1 != "Gedimino 1" {
+		t.Fatalf("expected billing address to default to shipping, got %#v", in.BillingAddress)
+	}
+}
+
+func TestApplyCheckoutDetailsRejectsInvalidInput(t *testing.T) {
+	m := newCheckoutTestModule()
+	cart := storcart.Cart{Totals: storcart.Totals{SubtotalCents: 2000, Currency: "EUR"}}
+	lt := &checkoutAddress{FullName: "Jonas", Address1: "Gedimino 1", City: "Vilnius", Postcode: "01103", Country: "LT"}
+	cases := map[string]checkoutRequest{
+		"bad email":           {Email: "nope", ShippingAddress: lt, ShippingMethodID: "courier"},
+		"guest without email": {ShippingAddress: lt, ShippingMethodID: "courier"},
+		"no shipping":         {Email: "buyer@example.com"},
+		"addr without method": {Email: "buyer@example.com", ShippingAddress: lt},
+		"method without addr": {Email: "buyer@example.com", ShippingMethodID: "courier"},
+		"unknown method":      {Email: "buyer@example.com", ShippingAddress: lt, ShippingMethodID: "missing"},
+		"method wrong zone":   {Email: "buyer@example.com", ShippingAddress: &checkoutAddress{FullName: "Anna", Address1: "Brivibas 1", City: "Riga", Postcode: "1010", Country: "LV"}, ShippingMethodID: "courier"},
+		"locker no terminal":  {Email: "buyer@example.com", ShippingAddress: &checkoutAddress{FullName: "Jonas", Country: "LT"}, ShippingMethodID: "locker"},
+		"courier no street":   {Email: "buyer@example.com", ShippingAddress: &checkoutAddress{FullName: "Jonas", Country: "LT"}, ShippingMethodID: "courier"},
+	}
+	for name, req := range cases {
+		var in stororders.CreateOrderInput
+		err := m.applyCheckoutDetails(context.Background(), req, cart, "", &in)
+		var invalid *checkoutError
+		if !errors.As(err, &invalid) {
+			t.Fatalf("%s: expected checkout validation error, got %v", name, err)
+		}
+	}
+
+	usd := storcart.Cart{Totals: storcart.Totals{SubtotalCents: 2000, Currency: "USD"}}
+	var in stororders.CreateOrderInput
+	err := m.applyCheckoutDetails(context.Background(), checkoutRequest{Email: "buyer@example.com", ShippingAddress: lt, ShippingMethodID: "courier"}, usd, "", &in)
+	var invalid *checkoutError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a shipping quote in another currency to be rejected, got %v", err)
+	}
+}
+
+func TestApplyCheckoutDetailsParcelLockerNeedsNoStreet(t *testing.T) {
+	m := newCheckoutTestModule()
+	cart := storcart.Cart{Totals: storcart.Totals{SubtotalCents: 2000, Currency: "EUR"}}
+	req := checkoutRequest{
+		ShippingAddress:    &checkoutAddress{FullName: "Jonas", Phone: "+37060000000", Country: "LT"},
+		BillingAddress:     &checkoutAddress{FullName: "Jonas", Address1: "Gedimino 1", City: "Vilnius", Postcode: "01103", Country: "LT"},
+		ShippingMethodID:   "locker",
+		ShippingTerminalID: "T1",
+	}
+	var in stororders.CreateOrderInput
+	if err := m.applyCheckoutDetails(context.Background(), req, cart, "customer@example.com", &in); err != nil {
+		t.Fatalf("applyCheckoutDetails error: %v", err)
+	}
+	if in.Shipping.TerminalID != "T1" || in.Shipping.PriceCents != 299 {
+		t.Fatalf("unexpected shipping %#v", in.Shipping)
+	}
+	if in.Email != "customer@example.com" {
+		t.Fatalf("expected customer email fallback, got %q", in.Email)
+	}
+}
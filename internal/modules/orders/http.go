@@ -3,31 +3,71 @@ package orders
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"goecommerce/internal/app"
 	modcustomers "goecommerce/internal/modules/customers"
+	modshipping "goecommerce/internal/modules/shipping"
 	platformhttp "goecommerce/internal/platform/http"
 	"goecommerce/internal/platform/payments"
+	"goecommerce/internal/platform/tax"
 	storcart "goecommerce/internal/storage/cart"
 	storcustomers "goecommerce/internal/storage/customers"
 	stororders "goecommerce/internal/storage/orders"
+	storpayments "goecommerce/internal/storage/payments"
+	storshiping "goecommerce/internal/storage/shipping"
+	stortax "goecommerce/internal/storage/tax"
 )
 
 type module struct {
-	cart      *storcart.Store
-	customers *storcustomers.Store
-	orders    *stororders.Store
-	pay       payments.Provider
+	cart             *storcart.Store
+	customers        *storcustomers.Store
+	orders           ordersStore
+	paymentProviders storpayments.ProvidersStore
+	shipping         modshipping.QuoteStore
+	taxRates         stortax.RatesSource
+	taxConfig        tax.Config
+	numberFormat     stororders.NumberFormat
+	pay              payments.Provider
+	// accessTokenSecret signs the per-order tokens used by /orders/lookup.
+	accessTokenSecret []byte
+	lookupLimiter     *platformhttp.RateLimiter
+}
+
+type ordersStore interface {
+	CreateOrder(ctx context.Context, c storcart.Cart, in stororders.CreateOrderInput) (stororders.Order, error)
+	ApplyPaymentEvent(ctx context.Context, in stororders.PaymentEventInput) (stororders.PaymentEventResult, error)
+	SetPaymentRef(ctx context.Context, id string, ref string) error
+	UpdateOrderStatus(ctx context.Context, id string, status string, actor string, note string) error
+	GetOrderByID(ctx context.Context, id string) (stororders.Order, error)
+	GetOrderByNumber(ctx context.Context, number string) (stororders.Order, error)
+}
+
+type checkoutRequest struct {
+	PaymentMethod      string           `json:"payment_method"`
+	Email              string           `json:"email"`
+	Phone              string           `json:"phone"`
+	ShippingAddress    *checkoutAddress `json:"shipping_address"`
+	BillingAddress     *checkoutAddress `json:"billing_address"`
+	ShippingMethodID   string           `json:"shipping_method_id"`
+	ShippingTerminalID string           `json:"shipping_terminal_id"`
 }
 
 func NewModule(deps app.Deps) app.Module {
 	var cst *storcart.Store
 	var cust *storcustomers.Store
-	var ost *stororders.Store
+	var ost ordersStore
+	var pst storpayments.ProvidersStore
+	var sst modshipping.QuoteStore
+	var tst stortax.RatesSource
 	if deps.DB != nil {
 		if s, err := storcart.NewStore(context.Background(), deps.DB); err == nil {
 			cst = s
@@ -38,17 +78,31 @@ func NewModule(deps app.Deps) app.Module {
 		if s, err := stororders.NewStore(context.Background(), deps.DB); err == nil {
 			ost = s
 		}
+		if s, err := storpayments.NewStore(context.Background(), deps.DB); err == nil {
+			pst = s
+		}
+		if s, err := storshiping.NewStore(context.Background(), deps.DB); err == nil {
+			sst = s
+		}
+		if s, err := stortax.NewStore(context.Background(), deps.DB); err == nil {
+			tst = s
+		}
 	}
 	var p payments.Provider = payments.NewFromEnv()
-	return &module{cart: cst, customers: cust, orders: ost, pay: p}
+	return &module{
+		cart: cst, customers: cust, orders: ost, paymentProviders: pst, shipping: sst,
+		taxRates: tst, taxConfig: tax.ConfigFromEnv(), numberFormat: stororders.NumberFormatFromEnv(), pay: p,
+		accessTokenSecret: []byte(os.Getenv("ORDER_ACCESS_TOKEN_SECRET")),
+		lookupLimiter:     platformhttp.NewNamedRateLimiter(deps.Redis, "order-lookup", 10, time.Minute),
+	}
 }
 
 func (m *module) Close() error {
 	if m.cart != nil {
 		_ = m.cart.Close()
 	}
-	if m.orders != nil {
-		_ = m.orders.Close()
+	if closer, ok := m.orders.(interface{ Close() error }); ok && closer != nil {
+		_ = closer.Close()
 	}
 	if m.customers != nil {
 		_ = m.customers.Close()
@@ -60,6 +114,10 @@ func (m *module) Name() string { return "orders" }
 
 func (m *module) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/checkout", m.handleCheckout)
+	mux.HandleFunc("/payments/methods", m.handlePaymentMethods)
+	mux.HandleFunc("/payments/webhook", m.handlePaymentWebhook)
+	mux.HandleFunc("/payments/webhook/", m.handlePaymentWebhook)
+	mux.Handle("/orders/lookup", m.lookupLimiter.Middleware(http.HandlerFunc(m.handleOrderLookup)))
 }
 
 func (m *module) handleCheckout(w http.ResponseWriter, r *http.Request) {
@@ -75,8 +133,22 @@ func (m *module) handleCheckout(w http.ResponseWriter, r *http.Request) {
 		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
 		return
 	}
+	var req checkoutRequest
+	if err := decodeOptionalRequest(r, &req); err != nil {
+		platformhttp.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	methodKey, provider, err := m.resolvePaymentProvider(r.Context(), req.PaymentMethod, true)
+	if err != nil {
+		if errors.Is(err, errUnknownPaymentMethod) {
+			platformhttp.Error(w, http.StatusBadRequest, "invalid payment_method")
+			return
+		}
+		platformhttp.Error(w, http.StatusInternalServerError, "payment provider error")
+		return
+	}
 	cartID, ok := readCartID(r)
-	customerID, authenticated, err := m.resolveCustomerID(r)
+	customer, authenticated, err := m.resolveCustomer(r)
 	if err != nil {
 		platformhttp.Error(w, http.StatusInternalServerError, "auth error")
 		return
@@ -84,7 +156,7 @@ func (m *module) handleCheckout(w http.ResponseWriter, r *http.Request) {
 
 	var c storcart.Cart
 	if authenticated {
-		c, err = m.cart.ResolveCustomerCart(r.Context(), customerID, cartID)
+		c, err = m.cart.ResolveCustomerCart(r.Context(), customer.ID, cartID)
 		if err != nil {
 			platformhttp.Error(w, http.StatusInternalServerError, "get error")
 			return
@@ -109,37 +181,118 @@ func (m *module) handleCheckout(w http.ResponseWriter, r *http.Request) {
 		platformhttp.Error(w, http.StatusBadRequest, "empty cart")
 		return
 	}
+	in := stororders.CreateOrderInput{PaymentMethod: methodKey, NumberFormat: m.numberFormat}
 	if authenticated {
-		o, err := m.orders.CreateFromCartForCustomer(r.Context(), c, customerID)
-		if err != nil {
-			platformhttp.Error(w, http.StatusBadRequest, "checkout error")
+		in.CustomerID = customer.ID
+	}
+	if err := m.applyCheckoutDetails(r.Context(), req, c, customer.Email, &in); err != nil {
+		var invalid *checkoutError
+		if errors.As(err, &invalid) {
+			platformhttp.Error(w, http.StatusBadRequest, invalid.msg)
 			return
 		}
-		_ = os.Getenv
-		url, _ := m.pay.CreateCheckout(r.Context(), o.TotalCents, o.Currency, o.Number)
-		out := map[string]any{
-			"order_id":     o.ID,
-			"checkout_url": url,
-			"status":       o.Status,
+		platformhttp.Error(w, http.StatusInternalServerError, "shipping error")
+		return
+	}
+	// Only the VAT number saved on the customer's profile can make an order
+	// reverse charged; guests are always taxed.
+	var companyVAT string
+	if authenticated {
+		if companyVAT, err = m.customers.GetCompanyVAT(r.Context(), customer.ID); err != nil {
+			platformhttp.Error(w, http.StatusInternalServerError, "auth error")
+			return
 		}
-		_ = platformhttp.JSON(w, http.StatusOK, out)
+	}
+	if err := m.applyTax(r.Context(), c, companyVAT, &in); err != nil {
+		log.Printf("orders: tax for cart %s: %v", c.ID, err)
+		platformhttp.Error(w, http.StatusInternalServerError, "tax error")
 		return
 	}
-	o, err := m.orders.CreateFromCart(r.Context(), c)
+	offline, isOffline := provider.(payments.OfflineProvider)
+	if isOffline {
+		in.Status = offline.InitialStatus()
+	}
+	o, err := m.orders.CreateOrder(r.Context(), c, in)
 	if err != nil {
+		var stockErr *stororders.InsufficientStockError
+		if errors.As(err, &stockErr) {
+			_ = platformhttp.JSON(w, http.StatusConflict, map[string]any{
+				"error": "insufficient stock",
+				"lines": stockErr.Lines,
+			})
+			return
+		}
 		platformhttp.Error(w, http.StatusBadRequest, "checkout error")
 		return
 	}
-	_ = os.Getenv
-	url, _ := m.pay.CreateCheckout(r.Context(), o.TotalCents, o.Currency, o.Number)
-	out := map[string]any{
-		"order_id":     o.ID,
-		"checkout_url": url,
-		"status":       o.Status,
+	out, err := m.startPayment(r.Context(), o, methodKey, provider)
+	if err != nil {
+		log.Printf("orders: start payment for %s: %v", o.Number, err)
+		if errors.Is(err, errPaymentProvider) {
+			platformhttp.Error(w, http.StatusBadGateway, "payment provider error")
+			return
+		}
+		platformhttp.Error(w, http.StatusInternalServerError, "checkout error")
+		return
 	}
 	_ = platformhttp.JSON(w, http.StatusOK, out)
 }
 
+var errPaymentProvider = errors.New("payment provider error")
+
+// startPayment asks the provider for a checkout URL, or offline payment
+// instructions, for a newly created order and returns the checkout
+// response. When that fails the order is cancelled, which releases its
+// stock, so a retried checkout does not hold the cart's stock twice.
+func (m *module) startPayment(ctx context.Context, o stororders.Order, methodKey string, provider payments.Provider) (map[string]any, error) {
+	out := map[string]any{
+		"order_id":           o.ID,
+		"order_number":       o.Number,
+		"checkout_url":       "",
+		"status":             o.Status,
+		"payment_method":     methodKey,
+		"subtotal_cents":     o.SubtotalCents,
+		"shipping_cents":     o.ShippingCents,
+		"tax_cents":          o.TaxCents,
+		"tax_reverse_charge": o.TaxReverseCharge,
+		"total_cents":        o.TotalCents,
+		"currency":           o.Currency,
+		"access_token":       m.orderAccessToken(o.ID),
+	}
+	var err error
+	if offline, ok := provider.(payments.OfflineProvider); ok {
+		var instructions payments.Instructions
+		if instructions, err = offline.Instructions(ctx, o.TotalCents, o.Currency, o.Number); err != nil {
+			err = fmt.Errorf("%w: %v", errPaymentProvider, err)
+		} else if err = m.orders.SetPaymentRef(ctx, o.ID, instructions.Reference); err == nil {
+			out["payment_instructions"] = instructions
+		}
+	} else if sessions, ok := provider.(payments.SessionProvider); ok {
+		// The session reference marks the order's total as issued for
+		// payment, see EditOrder.
+		var session payments.CheckoutSession
+		if session, err = sessions.CreateCheckoutSession(ctx, o.TotalCents, o.Currency, o.Number); err != nil {
+			err = fmt.Errorf("%w: %v", errPaymentProvider, err)
+		} else if err = m.orders.SetPaymentRef(ctx, o.ID, session.Reference); err == nil {
+			out["checkout_url"] = session.URL
+		}
+	} else {
+		var url string
+		if url, err = provider.CreateCheckout(ctx, o.TotalCents, o.Currency, o.Number); err != nil {
+			err = fmt.Errorf("%w: %v", errPaymentProvider, err)
+		} else {
+			out["checkout_url"] = url
+		}
+	}
+	if err != nil {
+		if cerr := m.orders.UpdateOrderStatus(context.WithoutCancel(ctx), o.ID, "cancelled", "checkout", "payment could not be started"); cerr != nil {
+			return nil, errors.Join(err, cerr)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
 func readCartID(r *http.Request) (string, bool) {
 	c, err := r.Cookie("cart_id")
 	if err != nil {
@@ -170,16 +323,40 @@ func requestIsSecure(r *http.Request) bool {
 	return false
 }
 
-func (m *module) resolveCustomerID(r *http.Request) (string, bool, error) {
+func (m *module) resolveCustomer(r *http.Request) (storcustomers.Customer, bool, error) {
 	if m.customers == nil {
-		return "", false, nil
+		return storcustomers.Customer{}, false, nil
 	}
 	customer, _, err := modcustomers.ResolveAuthenticatedCustomer(r.Context(), r, m.customers)
 	if err != nil {
 		if errors.Is(err, modcustomers.ErrUnauthenticated) {
-			return "", false, nil
+			return storcustomers.Customer{}, false, nil
 		}
-		return "", false, err
+		return storcustomers.Customer{}, false, err
 	}
-	return customer.ID, true, nil
+	return customer, true, nil
+}
+
+func decodeOptionalRequest(r *http.Request, dst any) error {
+	defer r.Body.Close()
+	const maxBodyBytes = 1 << 20
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+	if err != nil {
+		return errors.New("invalid json body")
+	}
+	if len(body) > maxBodyBytes {
+		return errors.New("request body too large")
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(strings.NewReader(string(body)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return errors.New("invalid json body")
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return errors.New("invalid json body")
+	}
+	return nil
 }
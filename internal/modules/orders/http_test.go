@@ -0,0 +1,269 @@
+package orders
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"goecommerce/internal/platform/payments"
+	storcart "goecommerce/internal/storage/cart"
+	stororders "goecommerce/internal/storage/orders"
+	storpayments "goecommerce/internal/storage/payments"
+)
+
+type fakeOrdersStore struct {
+	seen   map[string]bool
+	status map[string]string
+	orders []stororders.Order
+}
+
+func (f *fakeOrdersStore) UpdateOrderStatus(_ context.Context, id string, status string, _ string, _ string) error {
+	for i := range f.orders {
+		if f.orders[i].ID == id {
+			f.orders[i].Status = status
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (f *fakeOrdersStore) CreateOrder(context.Context, storcart.Cart, stororders.CreateOrderInput) (stororders.Order, error) {
+	return stororders.Order{}, nil
+}
+
+func (f *fakeOrdersStore) SetPaymentRef(context.Context, string, string) error {
+	return nil
+}
+
+func (f *fakeOrdersStore) ApplyPaymentEvent(_ context.Context, in stororders.PaymentEventInput) (stororders.PaymentEventResult, error) {
+	if f.seen[in.EventID] {
+		return stororders.PaymentEventDuplicate, nil
+	}
+	f.seen[in.EventID] = true
+	switch {
+	case in.Status == "":
+	case f.status[in.OrderNumber] == "pending_payment":
+		f.status[in.OrderNumber] = in.Status
+	case in.Status == "paid":
+		return stororders.PaymentEventNeedsRefund, nil
+	default:
+		return stororders.PaymentEventIgnored, nil
+	}
+	return stororders.PaymentEventApplied, nil
+}
+
+func (f *fakeOrdersStore) GetOrderByID(_ context.Context, id string) (stororders.Order, error) {
+	for _, o := range f.orders {
+		if o.ID == id {
+			return o, nil
+		}
+	}
+	return stororders.Order{}, sql.ErrNoRows
+}
+
+func (f *fakeOrdersStore) GetOrderByNumber(_ context.Context, number string) (stororders.Order, error) {
+	for _, o := range f.orders {
+		if o.Number == number {
+			return o, nil
+		}
+	}
+	return stororders.Order{}, sql.ErrNoRows
+}
+
+type fakeWebhookProvider struct {
+	event       payments.WebhookEvent
+	err         error
+	checkoutErr error
+}
+
+func (p *fakeWebhookProvider) CreateCheckout(_ context.Context, _ int, _ string, orderNumber string) (string, error) {
+	if p.checkoutErr != nil {
+		return "", p.checkoutErr
+	}
+	return "https://pay.example/" + orderNumber, nil
+}
+
+func (p *fakeWebhookProvider) ParseWebhook([]byte, http.Header) (payments.WebhookEvent, error) {
+	return p.event, p.err
+}
+
+func TestPaymentWebhookMarksOrderPaidAndIgnoresReplay(t *testing.T) {
+	store := &fakeOrdersStore{seen: map[string]bool{}, status: map[string]string{"ORD-1": "pending_payment"}}
+	prov := &fakeWebhookProvider{event: payments.WebhookEvent{ID: "evt_1", Type: "checkout.session.completed", OrderNumber: "ORD-1", Status: "paid"}}
+	m := &module{orders: store, pay: prov}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/payments/webhook", bytes.NewBufferString(`{}`))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("attempt %d: expected 200, got %d", i, rec.Code)
+		}
+	}
+	if store.status["ORD-1"] != "paid" {
+		t.Fatalf("expected order paid, got %s", store.status["ORD-1"])
+	}
+}
+
+func TestPaymentWebhookReportsPaymentForCancelledOrder(t *testing.T) {
+	store := &fakeOrdersStore{seen: map[string]bool{}, status: map[string]string{"ORD-1": "cancelled"}}
+	prov := &fakeWebhookProvider{event: payments.WebhookEvent{ID: "evt_1", Type: "checkout.session.completed", OrderNumber: "ORD-1", Status: "paid"}}
+	m := &module{orders: store, pay: prov}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	req := httptest.NewRequest(http.MethodPost, "/payments/webhook", bytes.NewBufferString(`{}`))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out["result"] != string(stororders.PaymentEventNeedsRefund) || out["duplicate"] != false {
+		t.Fatalf("unexpected response %v", out)
+	}
+	if store.status["ORD-1"] != "cancelled" {
+		t.Fatalf("expected order to stay cancelled, got %s", store.status["ORD-1"])
+	}
+}
+
+func TestPaymentWebhookRejectsInvalidSignature(t *testing.T) {
+	store := &fakeOrdersStore{seen: map[string]bool{}, status: map[string]string{}}
+	prov := &fakeWebhookProvider{err: payments.ErrInvalidSignature}
+	m := &module{orders: store, pay: prov}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	req := httptest.NewRequest(http.MethodPost, "/payments/webhook", bytes.NewBufferString(`{}`))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+	if len(store.seen) != 0 {
+		t.Fatalf("expected no events recorded")
+	}
+}
+
+type fakeProvidersStore struct {
+	items []storpayments.Provider
+}
+
+func (f *fakeProvidersStore) CreateProvider(context.Context, string, string, string, []byte) error {
+	return nil
+}
+
+func (f *fakeProvidersStore) UpdateProvider(context.Context, string, string, bool, string, []byte) error {
+	return nil
+}
+
+func (f *fakeProvidersStore) GetProvider(_ context.Context, key string) (*storpayments.Provider, error) {
+	for _, p := range f.items {
+		if p.Key == key {
+			return &p, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (f *fakeProvidersStore) ListProviders(context.Context) ([]storpayments.Provider, error) {
+	return f.items, nil
+}
+
+func (f *fakeProvidersStore) DeleteProvider(context.Context, string) error {
+	return nil
+}
+
+func TestPaymentMethodsListsOnlyEnabledProviders(t *testing.T) {
+	providers := &fakeProvidersStore{items: []storpayments.Provider{
+		{Key: "stripe", Name: "Card", Enabled: true, Mode: "live", ConfigJSON: []byte(`{"secret_key":"sk"}`)},
+		{Key: "paypal", Name: "PayPal", Enabled: false, Mode: "sandbox"},
+	}}
+	m := &module{paymentProviders: providers}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/payments/methods", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var out struct {
+		Items []paymentMethodResponse `json:"items"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(out.Items) != 1 || out.Items[0].Key != "stripe" {
+		t.Fatalf("unexpected methods: %#v", out.Items)
+	}
+}
+
+func TestResolvePaymentProviderRejectsUnknownOrDisabledKey(t *testing.T) {
+	providers := &fakeProvidersStore{items: []storpayments.Provider{
+		{Key: "stripe", Name: "Card", Enabled: false, Mode: "sandbox", ConfigJSON: []byte(`{"secret_key":"sk"}`)},
+	}}
+	m := &module{paymentProviders: providers, pay: &fakeWebhookProvider{}}
+
+	if _, _, err := m.resolvePaymentProvider(context.Background(), "stripe", true); !errors.Is(err, errUnknownPaymentMethod) {
+		t.Fatalf("expected disabled provider to be rejected, got %v", err)
+	}
+	if _, _, err := m.resolvePaymentProvider(context.Background(), "bitcoin", false); !errors.Is(err, errUnknownPaymentMethod) {
+		t.Fatalf("expected unknown provider to be rejected, got %v", err)
+	}
+	key, prov, err := m.resolvePaymentProvider(context.Background(), "stripe", false)
+	if err != nil || key != "stripe" || prov == nil {
+		t.Fatalf("expected stripe for webhooks, got key=%q err=%v", key, err)
+	}
+}
+
+func TestCheckoutRejectsUnknownPaymentMethod(t *testing.T) {
+	m := &module{orders: &fakeOrdersStore{}, cart: &storcart.Store{}, pay: &fakeWebhookProvider{}}
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	req := httptest.NewRequest(http.MethodPost, "/checkout", bytes.NewBufferString(`{"payment_method":"bitcoin"}`))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestStartPaymentCancelsOrderWhenProviderFails(t *testing.T) {
+	store := &fakeOrdersStore{orders: []stororders.Order{
+		{ID: "order-1", Number: "ORD-1", Status: "pending_payment", TotalCents: 1000, Currency: "EUR"},
+		{ID: "order-2", Number: "ORD-2", Status: "pending_payment", TotalCents: 1000, Currency: "EUR"},
+	}}
+	m := &module{orders: store, accessTokenSecret: []byte("test-secret")}
+
+	out, err := m.startPayment(context.Background(), store.orders[0], "stripe", &fakeWebhookProvider{})
+	if err != nil {
+		t.Fatalf("start payment: %v", err)
+	}
+	if out["order_number"] != "ORD-1" || out["checkout_url"] != "https://pay.example/ORD-1" {
+		t.Fatalf("unexpected checkout response %#v", out)
+	}
+
+	_, err = m.startPayment(context.Background(), store.orders[1], "stripe", &fakeWebhookProvider{checkoutErr: errors.New("provider down")})
+	if !errors.Is(err, errPaymentProvider) {
+		t.Fatalf("expected errPaymentProvider, got %v", err)
+	}
+	if store.orders[1].Status != "cancelled" {
+		t.Fatalf("expected the order to be cancelled, got %s", store.orders[1].Status)
+	}
+	if store.orders[0].Status != "pending_payment" {
+		t.Fatalf("expected the paid-for order to be untouched, got %s", store.orders[0].Status)
+	}
+}
@@ -0,0 +1,216 @@
+package orders
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	platformhttp "goecommerce/internal/platform/http"
+	storcart "goecommerce/internal/storage/cart"
+	stororders "goecommerce/internal/storage/orders"
+)
+
+type orderLookupRequest struct {
+	OrderNumber string `json:"order_number"`
+	Email       string `json:"email"`
+	Token       string `json:"token"`
+}
+
+type orderLookupItem struct {
+	ProductTitle      string                          `json:"product_title"`
+	ProductSlug       string                          `json:"product_slug"`
+	SKU               string                          `json:"sku"`
+	VariantAttributes map[string]any                  `json:"variant_attributes"`
+	ImageURL          string                          `json:"image_url"`
+	CustomOptions     []storcart.CartItemCustomOption `json:"custom_options"`
+	Quantity          int                             `json:"quantity"`
+	UnitPriceCents    int                             `json:"unit_price_cents"`
+}
+
+type orderLookupShipping struct {
+	MethodTitle string              `json:"method_title"`
+	ServiceCode string              `json:"service_code"`
+	TerminalID  string              `json:"terminal_id"`
+	Address     *stororders.Address `json:"address"`
+}
+
+type orderLookupTracking struct {
+	Carrier        string                     `json:"carrier"`
+	TrackingNumber string                     `json:"tracking_number"`
+	TrackingURL    string                     `json:"tracking_url"`
+	Status         string                     `json:"status"`
+	TrackingStatus string                     `json:"tracking_status"`
+	ShippedAt      time.Time                  `json:"shipped_at"`
+	DeliveredAt    *time.Time                 `json:"delivered_at"`
+	Events         []stororders.TrackingEvent `json:"events"`
+}
+
+type orderLookupStatusChange struct {
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type orderLookupResponse struct {
+	OrderNumber   string                    `json:"order_number"`
+	Status        string                    `json:"status"`
+	Currency      string                    `json:"currency"`
+	SubtotalCents int                       `json:"subtotal_cents"`
+	ShippingCents int                       `json:"shipping_cents"`
+	TaxCents      int                       `json:"tax_cents"`
+	TotalCents    int                       `json:"total_cents"`
+	Items         []orderLookupItem         `json:"items"`
+	Shipping      orderLookupShipping       `json:"shipping"`
+	Tracking      []orderLookupTracking     `json:"tracking"`
+	StatusHistory []orderLookupStatusChange `json:"status_history"`
+	CreatedAt     time.Time                 `json:"created_at"`
+}
+
+// handleOrderLookup lets buyers without an account see their order, either
+// with the order number and checkout email (POST) or with the signed access
+// token returned at checkout (GET ?token= or POST). Every failure is the same
+// 404 so the endpoint cannot be used to probe order numbers or emails; it is
+// also rate-limited per IP in RegisterRoutes.
+func (m *module) handleOrderLookup(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/orders/lookup" {
+		http.NotFound(w, r)
+		return
+	}
+	if m.orders == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	var req orderLookupRequest
+	switch r.Method {
+	case http.MethodGet:
+		req.Token = r.URL.Query().Get("token")
+	case http.MethodPost:
+		if err := decodeOptionalRequest(r, &req); err != nil {
+			platformhttp.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	var o stororders.Order
+	var err error
+	switch {
+	case strings.TrimSpace(req.Token) != "":
+		orderID, ok := m.verifyOrderAccessToken(strings.TrimSpace(req.Token))
+		if !ok {
+			platformhttp.Error(w, http.StatusNotFound, "order not found")
+			return
+		}
+		o, err = m.orders.GetOrderByID(r.Context(), orderID)
+	case strings.TrimSpace(req.OrderNumber) != "" && strings.TrimSpace(req.Email) != "":
+		o, err = m.orders.GetOrderByNumber(r.Context(), req.OrderNumber)
+		if err == nil && (o.Email == "" || !strings.EqualFold(o.Email, strings.TrimSpace(req.Email))) {
+			err = sql.ErrNoRows
+		}
+	default:
+		platformhttp.Error(w, http.StatusBadRequest, "order_number and email, or token, are required")
+		return
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			platformhttp.Error(w, http.StatusNotFound, "order not found")
+			return
+		}
+		platformhttp.Error(w, http.StatusInternalServerError, "lookup error")
+		return
+	}
+	_ = platformhttp.JSON(w, http.StatusOK, toOrderLookupResponse(o))
+}
+
+func toOrderLookupResponse(o stororders.Order) orderLookupResponse {
+	out := orderLookupResponse{
+		OrderNumber:   o.Number,
+		Status:        o.Status,
+		Currency:      o.Currency,
+		SubtotalCents: o.SubtotalCents,
+		ShippingCents: o.ShippingCents,
+		TaxCents:      o.TaxCents,
+		TotalCents:    o.TotalCents,
+		Items:         make([]orderLookupItem, 0, len(o.Items)),
+		Shipping: orderLookupShipping{
+			MethodTitle: o.Shipping.MethodTitle,
+			ServiceCode: o.Shipping.ServiceCode,
+			TerminalID:  o.Shipping.TerminalID,
+			Address:     o.ShippingAddress,
+		},
+		Tracking:      make([]orderLookupTracking, 0, len(o.Shipments)),
+		StatusHistory: make([]orderLookupStatusChange, 0, len(o.StatusHistory)),
+		CreatedAt:     o.CreatedAt,
+	}
+	for _, it := range o.Items {
+		out.Items = append(out.Items, orderLookupItem{
+			ProductTitle:      it.ProductTitle,
+			ProductSlug:       it.ProductSlug,
+			SKU:               it.SKU,
+			VariantAttributes: it.VariantAttributes,
+			ImageURL:          it.ImageURL,
+			CustomOptions:     it.CustomOptions,
+			Quantity:          it.Quantity,
+			UnitPriceCents:    it.UnitPriceCents,
+		})
+	}
+	for _, sh := range o.Shipments {
+		if sh.Status == stororders.ShipmentStatusCancelled {
+			continue
+		}
+		out.Tracking = append(out.Tracking, orderLookupTracking{
+			Carrier:        sh.ProviderKey,
+			TrackingNumber: sh.TrackingNumber,
+			TrackingURL:    sh.TrackingURL,
+			Status:         sh.Status,
+			TrackingStatus: sh.TrackingStatus,
+			ShippedAt:      sh.ShippedAt,
+			DeliveredAt:    sh.DeliveredAt,
+			Events:         sh.Events,
+		})
+	}
+	for _, ch := range o.StatusHistory {
+		out.StatusHistory = append(out.StatusHistory, orderLookupStatusChange{Status: ch.To, CreatedAt: ch.CreatedAt})
+	}
+	return out
+}
+
+// orderAccessToken signs the order ID with ORDER_ACCESS_TOKEN_SECRET. It
+// returns "" when no secret is configured, which disables token lookups.
+func (m *module) orderAccessToken(orderID string) string {
+	if len(m.accessTokenSecret) == 0 || orderID == "" {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(orderID)) + "." + base64.RawURLEncoding.EncodeToString(m.signOrderID(orderID))
+}
+
+func (m *module) verifyOrderAccessToken(token string) (string, bool) {
+	if len(m.accessTokenSecret) == 0 {
+		return "", false
+	}
+	idPart, sigPart, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", false
+	}
+	id, err := base64.RawURLEncoding.DecodeString(idPart)
+	if err != nil || len(id) == 0 {
+		return "", false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigPart)
+	if err != nil || !hmac.Equal(sig, m.signOrderID(string(id))) {
+		return "", false
+	}
+	return string(id), true
+}
+
+func (m *module) signOrderID(orderID string) []byte {
+	mac := hmac.New(sha256.New, m.accessTokenSecret)
+	mac.Write([]byte("order:" + orderID))
+	return mac.Sum(nil)
+}
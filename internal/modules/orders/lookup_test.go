@@ -0,0 +1,131 @@
+package orders
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	platformhttp "goecommerce/internal/platform/http"
+	stororders "goecommerce/internal/storage/orders"
+)
+
+func newLookupTestModule() *module {
+	return &module{
+		orders: &fakeOrdersStore{orders: []stororders.Order{{
+			ID:       "order-1",
+			Number:   "ORD-1",
+			Status:   "shipped",
+			Currency: "EUR",
+			Email:    "Guest@Example.com",
+			Items:    []stororders.OrderItem{{ProductTitle: "Mug", SKU: "MUG-1", Quantity: 2, UnitPriceCents: 1000}},
+			Shipping: stororders.ShippingSelection{MethodTitle: "Courier"},
+			Shipments: []stororders.Shipment{{ProviderKey: "omniva", TrackingNumber: "CC123", Status: "shipped", TrackingStatus: "in_transit", Events: []stororders.TrackingEvent{
+				{Status: "registered", Description: "Shipment data received"},
+				{Status: "in_transit", Description: "Parcel accepted at sorting centre", Location: "Vilnius"},
+			}}},
+			StatusHistory: []stororders.StatusChange{
+				{To: "pending_payment", Actor: "system"},
+				{From: "pending_payment", To: "shipped", Actor: "admin:alice", Note: "internal"},
+			},
+		}}},
+		accessTokenSecret: []byte("test-secret"),
+		lookupLimiter:     platformhttp.NewRateLimiter(nil, 100, time.Minute),
+	}
+}
+
+func performLookup(t *testing.T, mux *http.ServeMux, method, path string, body map[string]any) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.RemoteAddr = "192.0.2.1:1234"
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, req)
+	return res
+}
+
+func TestOrderLookupByNumberAndEmail(t *testing.T) {
+	m := newLookupTestModule()
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	res := performLookup(t, mux, http.MethodPost, "/orders/lookup", map[string]any{"order_number": "ORD-1", "email": " guest@example.com "})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+	var got orderLookupResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.OrderNumber != "ORD-1" || got.Status != "shipped" || len(got.Items) != 1 || got.Items[0].SKU != "MUG-1" || got.Shipping.MethodTitle != "Courier" || len(got.Tracking) != 1 || got.Tracking[0].TrackingNumber != "CC123" || got.Tracking[0].TrackingStatus != "in_transit" || len(got.Tracking[0].Events) != 2 {
+		t.Fatalf("unexpected lookup response %#v", got)
+	}
+	if len(got.StatusHistory) != 2 || got.StatusHistory[1].Status != "shipped" || bytes.Contains(res.Body.Bytes(), []byte("admin:alice")) {
+		t.Fatalf("expected status history without actors or notes, got %s", res.Body.String())
+	}
+
+	for _, body := range []map[string]any{
+		{"order_number": "ORD-1", "email": "other@example.com"},
+		{"order_number": "ORD-2", "email": "guest@example.com"},
+	} {
+		if res := performLookup(t, mux, http.MethodPost, "/orders/lookup", body); res.Code != http.StatusNotFound {
+			t.Fatalf("expected status %d for %v, got %d", http.StatusNotFound, body, res.Code)
+		}
+	}
+	if res := performLookup(t, mux, http.MethodPost, "/orders/lookup", map[string]any{"order_number": "ORD-1"}); res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d without email, got %d", http.StatusBadRequest, res.Code)
+	}
+}
+
+func TestOrderLookupByAccessToken(t *testing.T) {
+	m := newLookupTestModule()
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	token := m.orderAccessToken("order-1")
+	if token == "" {
+		t.Fatalf("expected access token")
+	}
+	if res := performLookup(t, mux, http.MethodGet, "/orders/lookup?token="+token, nil); res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+	if res := performLookup(t, mux, http.MethodPost, "/orders/lookup", map[string]any{"token": token}); res.Code != http.StatusOK {
+		t.Fatalf("expected status %d for POST token, got %d", http.StatusOK, res.Code)
+	}
+
+	other := (&module{accessTokenSecret: []byte("other-secret")}).orderAccessToken("order-1")
+	for _, bad := range []string{other, token + "x", "garbage"} {
+		if res := performLookup(t, mux, http.MethodGet, "/orders/lookup?token="+bad, nil); res.Code != http.StatusNotFound {
+			t.Fatalf("expected status %d for token %q, got %d", http.StatusNotFound, bad, res.Code)
+		}
+	}
+
+	m.accessTokenSecret = nil
+	if res := performLookup(t, mux, http.MethodGet, "/orders/lookup?token="+token, nil); res.Code != http.StatusNotFound {
+		t.Fatalf("expected tokens to be rejected without a secret, got %d", res.Code)
+	}
+}
+
+func TestOrderLookupIsRateLimited(t *testing.T) {
+	m := newLookupTestModule()
+	m.lookupLimiter = platformhttp.NewNamedRateLimiter(nil, "order-lookup", 2, time.Minute)
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+
+	body := map[string]any{"order_number": "ORD-1", "email": "wrong@example.com"}
+	for i := 0; i < 2; i++ {
+		if res := performLookup(t, mux, http.MethodPost, "/orders/lookup", body); res.Code != http.StatusNotFound {
+			t.Fatalf("attempt %d: expected status %d, got %d", i+1, http.StatusNotFound, res.Code)
+		}
+	}
+	if res := performLookup(t, mux, http.MethodPost, "/orders/lookup", body); res.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, res.Code)
+	}
+}
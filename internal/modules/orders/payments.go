@@ -0,0 +1,175 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	platformhttp "goecommerce/internal/platform/http"
+	"goecommerce/internal/platform/payments"
+	_ "goecommerce/internal/platform/payments/providers/offline"
+	_ "goecommerce/internal/platform/payments/providers/stripe"
+	stororders "goecommerce/internal/storage/orders"
+	storpayments "goecommerce/internal/storage/payments"
+)
+
+// defaultPaymentMethod is used when no payment_providers rows exist, so the
+// env-configured Stripe provider keeps working without admin setup.
+const defaultPaymentMethod = "stripe"
+
+var errUnknownPaymentMethod = errors.New("unknown payment method")
+
+type paymentMethodResponse struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+	Mode string `json:"mode"`
+}
+
+// resolvePaymentProvider returns the provider for key, or the first enabled
+// one when key is empty. Webhooks pass requireEnabled=false so events for
+// orders placed before a provider was disabled are still processed.
+func (m *module) resolvePaymentProvider(ctx context.Context, key string, requireEnabled bool) (string, payments.Provider, error) {
+	key = strings.TrimSpace(strings.ToLower(key))
+	if m.paymentProviders != nil {
+		configured, err := m.paymentProviders.ListProviders(ctx)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(configured) > 0 {
+			for _, p := range configured {
+				if requireEnabled && !p.Enabled {
+					continue
+				}
+				if key != "" && p.Key != key {
+					continue
+				}
+				prov, err := buildPaymentProvider(p)
+				if err != nil {
+					return "", nil, err
+				}
+				return p.Key, prov, nil
+			}
+			return "", nil, errUnknownPaymentMethod
+		}
+	}
+	if m.pay == nil || (key != "" && key != defaultPaymentMethod) {
+		return "", nil, errUnknownPaymentMethod
+	}
+	return defaultPaymentMethod, m.pay, nil
+}
+
+func buildPaymentProvider(p storpayments.Provider) (payments.Provider, error) {
+	prov, err := payments.FromConfig(p.Key, p.Mode, p.ConfigJSON)
+	if errors.Is(err, payments.ErrNotRegistered) {
+		return nil, errUnknownPaymentMethod
+	}
+	return prov, err
+}
+
+func (m *module) handlePaymentMethods(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || r.URL.Path != "/payments/methods" {
+		http.NotFound(w, r)
+		return
+	}
+	items := []paymentMethodResponse{}
+	var configured []storpayments.Provider
+	if m.paymentProviders != nil {
+		var err error
+		configured, err = m.paymentProviders.ListProviders(r.Context())
+		if err != nil {
+			platformhttp.Error(w, http.StatusInternalServerError, "list error")
+			return
+		}
+	}
+	for _, p := range configured {
+		if p.Enabled {
+			items = append(items, paymentMethodResponse{Key: p.Key, Name: p.Name, Mode: p.Mode})
+		}
+	}
+	if len(configured) == 0 && m.pay != nil {
+		items = append(items, paymentMethodResponse{Key: defaultPaymentMethod, Name: "Card", Mode: "sandbox"})
+	}
+	_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (m *module) handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	key := defaultPaymentMethod
+	if r.URL.Path != "/payments/webhook" {
+		key = strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/payments/webhook/"))
+		if key == "" || strings.Contains(key, "/") {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	if m.orders == nil {
+		platformhttp.Error(w, http.StatusServiceUnavailable, "db unavailable")
+		return
+	}
+	key, provider, err := m.resolvePaymentProvider(r.Context(), key, false)
+	if err != nil {
+		if errors.Is(err, errUnknownPaymentMethod) {
+			http.NotFound(w, r)
+			return
+		}
+		platformhttp.Error(w, http.StatusInternalServerError, "payment provider error")
+		return
+	}
+	parser, ok := provider.(payments.WebhookParser)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	const maxBodyBytes = 1 << 20
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+	if err != nil || len(payload) > maxBodyBytes {
+		platformhttp.Error(w, http.StatusBadRequest, "invalid body")
+		return
+	}
+	ev, err := parser.ParseWebhook(payload, r.Header)
+	if err != nil {
+		if errors.Is(err, payments.ErrInvalidSignature) {
+			platformhttp.Error(w, http.StatusBadRequest, "invalid signature")
+			return
+		}
+		platformhttp.Error(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	if ev.OrderNumber == "" {
+		_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"received": true})
+		return
+	}
+	result, err := m.orders.ApplyPaymentEvent(r.Context(), stororders.PaymentEventInput{
+		Provider:    key,
+		EventID:     ev.ID,
+		EventType:   ev.Type,
+		OrderNumber: ev.OrderNumber,
+		PaymentRef:  ev.PaymentRef,
+		Status:      ev.Status,
+		AmountCents: ev.AmountCents,
+		Currency:    ev.Currency,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Printf("orders: payment webhook %s for unknown order %s", ev.ID, ev.OrderNumber)
+			_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"received": true})
+			return
+		}
+		platformhttp.Error(w, http.StatusInternalServerError, "webhook error")
+		return
+	}
+	switch result {
+	case stororders.PaymentEventNeedsRefund:
+		log.Printf("orders: payment webhook %s for order %s collected a payment the order cannot take; flagged for refund", ev.ID, ev.OrderNumber)
+	case stororders.PaymentEventIgnored:
+		log.Printf("orders: payment webhook %s for order %s ignored, order is no longer awaiting this payment", ev.ID, ev.OrderNumber)
+	}
+	_ = platformhttp.JSON(w, http.StatusOK, map[string]any{"received": true, "duplicate": result == stororders.PaymentEventDuplicate, "result": result})
+}
@@ -0,0 +1,41 @@
+package orders
+
+import (
+	"context"
+
+	"goecommerce/internal/platform/tax"
+	storcart "goecommerce/internal/storage/cart"
+	stororders "goecommerce/internal/storage/orders"
+)
+
+// applyTax calculates tax for the cart and the already priced shipping and
+// stores the result on in. Rates are those of the shipping country, falling
+// back to the billing country and then the shop country. Reverse charge
+// applies when companyVAT, the VAT number saved on the customer's profile,
+// is a well-formed number of another EU member state the goods go to.
+func (m *module) applyTax(ctx context.Context, c storcart.Cart, companyVAT string, in *stororders.CreateOrderInput) error {
+	in.CustomerVAT = tax.NormalizeVATNumber(companyVAT)
+	if m.taxRates == nil {
+		return nil
+	}
+	country := m.taxConfig.ShopCountry
+	switch {
+	case in.ShippingAddress != nil:
+		country = in.ShippingAddress.Country
+	case in.BillingAddress != nil:
+		country = in.BillingAddress.Country
+	}
+	rates, err := m.taxRates.GetRates(ctx, country)
+	if err != nil {
+		return err
+	}
+	res := tax.Calculate(tax.Request{
+		Config:        m.taxConfig,
+		Country:       country,
+		CustomerVAT:   in.CustomerVAT,
+		Lines:         c.TaxLines(),
+		ShippingCents: in.Shipping.PriceCents,
+	}, rates)
+	in.Tax = &res
+	return nil
+}
@@ -0,0 +1,74 @@
+package orders
+
+import (
+	"context"
+	"testing"
+
+	"goecommerce/internal/platform/tax"
+	storcart "goecommerce/internal/storage/cart"
+	stororders "goecommerce/internal/storage/orders"
+)
+
+type fakeTaxRates map[string]tax.Rates
+
+func (f fakeTaxRates) GetRates(_ context.Context, country string) (tax.Rates, error) {
+	return f[country], nil
+}
+
+func newTaxTestModule() *module {
+	return &module{
+		taxRates: fakeTaxRates{
+			"LT": {tax.ClassStandard: 2100, tax.ClassReduced: 900},
+			"DE": {tax.ClassStandard: 1900, tax.ClassReduced: 700},
+		},
+		taxConfig: tax.Config{ShopCountry: "LT", PricesIncludeTax: true},
+	}
+}
+
+func taxTestCart() storcart.Cart {
+	return storcart.Cart{
+		Items: []storcart.CartItem{
+			{UnitPriceCents: 605, Quantity: 2, TaxClass: tax.ClassStandard},
+			{UnitPriceCents: 1090, Quantity: 1, TaxClass: tax.ClassReduced},
+		},
+		Totals: storcart.Totals{SubtotalCents: 2300, Currency: "EUR"},
+	}
+}
+
+func TestApplyTaxUsesShippingCountryRates(t *testing.T) {
+	m := newTaxTestModule()
+	in := stororders.CreateOrderInput{
+		ShippingAddress: &stororders.Address{Country: "DE"},
+		Shipping:        stororders.ShippingSelection{PriceCents: 595},
+	}
+	if err := m.applyTax(context.Background(), taxTestCart(), "", &in); err != nil {
+		t.Fatalf("applyTax error: %v", err)
+	}
+	if in.Tax == nil || in.Tax.Country != "DE" || in.Tax.ReverseCharge {
+		t.Fatalf("unexpected tax result: %#v", in.Tax)
+	}
+	// 1210 @ 19% -> 193, 1090 @ 7% -> 71, shipping 595 @ 19% -> 95.
+	if in.Tax.TaxCents != 193+71+95 || in.Tax.TotalCents != 2895 {
+		t.Fatalf("unexpected totals: %#v", in.Tax)
+	}
+}
+
+func TestApplyTaxReverseChargesEUBusinesses(t *testing.T) {
+	m := newTaxTestModule()
+	in := stororders.CreateOrderInput{ShippingAddress: &stororders.Address{Country: "DE"}}
+	if err := m.applyTax(context.Background(), taxTestCart(), " DE123456789 ", &in); err != nil {
+		t.Fatalf("applyTax error: %v", err)
+	}
+	if !in.Tax.ReverseCharge || in.Tax.TaxCents != 0 || in.CustomerVAT != "DE123456789" {
+		t.Fatalf("expected reverse charge, got %#v", in.Tax)
+	}
+
+	// Domestic B2B sales are taxed normally.
+	in = stororders.CreateOrderInput{ShippingAddress: &stororders.Address{Country: "LT"}}
+	if err := m.applyTax(context.Background(), taxTestCart(), "LT100000000", &in); err != nil {
+		t.Fatalf("applyTax error: %v", err)
+	}
+	if in.Tax.ReverseCharge || in.Tax.TaxCents != 210+90 {
+		t.Fatalf("expected domestic tax, got %#v", in.Tax)
+	}
+}
@@ -9,12 +9,14 @@ import (
 	"goecommerce/internal/app"
 	"goecommerce/internal/platform/shipping"
 	_ "goecommerce/internal/platform/shipping/providers/omniva"
+	stororders "goecommerce/internal/storage/orders"
 	storshiping "goecommerce/internal/storage/shipping"
 )
 
 type module struct {
 	store     shippingStore
 	providers map[string]shipping.Provider
+	tracking  *trackingPoller
 }
 
 type shippingStore interface {
@@ -37,9 +39,18 @@ func NewModule(deps app.Deps) app.Module {
 		initializeProviders(context.Background(), store, providers)
 	}
 
+	var tracking *trackingPoller
+	if interval := trackingIntervalFromEnv(); deps.DB != nil && interval > 0 {
+		if ost, err := stororders.NewStore(context.Background(), deps.DB); err == nil {
+			tracking = newTrackingPoller(ost, providers, interval)
+			tracking.start()
+		}
+	}
+
 	return &module{
 		store:     store,
 		providers: providers,
+		tracking:  tracking,
 	}
 }
 
@@ -82,6 +93,13 @@ func initializeProviders(ctx context.Context, store storshiping.ProvidersStore,
 	}
 }
 
+func (m *module) Close() error {
+	if m.tracking != nil {
+		return m.tracking.Close()
+	}
+	return nil
+}
+
 func (m *module) Name() string {
 	return "shipping"
 }
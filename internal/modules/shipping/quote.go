@@ -0,0 +1,96 @@
+package shipping
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	shipping "goecommerce/internal/platform/shipping"
+	storshiping "goecommerce/internal/storage/shipping"
+)
+
+var (
+	ErrMethodUnavailable = errors.New("shipping method not available")
+	ErrTerminalRequired  = errors.New("shipping terminal required")
+	ErrUnknownTerminal   = errors.New("unknown shipping terminal")
+)
+
+// QuoteStore is the part of the shipping storage checkout needs to re-price
+// a method server-side.
+type QuoteStore interface {
+	GetZoneByCountry(ctx context.Context, country string) (*storshiping.Zone, error)
+	GetMethod(ctx context.Context, id string) (*storshiping.Method, error)
+	GetCachedTerminals(ctx context.Context, providerKey, country string) ([]byte, time.Time, error)
+}
+
+// Quote is a shipping method priced for one destination and cart value.
+type Quote struct {
+	Method     storshiping.Method
+	PriceCents int
+	Currency   string
+	TerminalID string
+}
+
+// QuoteMethod prices methodID for delivery to country the same way
+// /shipping/options does, and rejects methods that are disabled or do not
+// serve that country. Parcel locker methods require a terminal ID, which is
+// checked against the cached terminal list when one exists.
+func QuoteMethod(ctx context.Context, store QuoteStore, methodID, country string, cartValueCents int64, terminalID string) (Quote, error) {
+	methodID = strings.TrimSpace(methodID)
+	country = strings.ToUpper(strings.TrimSpace(country))
+	terminalID = strings.TrimSpace(terminalID)
+	if methodID == "" || country == "" {
+		return Quote{}, ErrMethodUnavailable
+	}
+	method, err := store.GetMethod(ctx, methodID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Quote{}, ErrMethodUnavailable
+		}
+		return Quote{}, err
+	}
+	zone, err := store.GetZoneByCountry(ctx, country)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Quote{}, ErrMethodUnavailable
+		}
+		return Quote{}, err
+	}
+	if !method.Enabled || method.ZoneID != zone.ID {
+		return Quote{}, ErrMethodUnavailable
+	}
+
+	q := Quote{Method: *method, PriceCents: calculateMethodPrice(method, cartValueCents), Currency: "EUR"}
+	if !RequiresTerminal(method) {
+		return q, nil
+	}
+	if terminalID == "" {
+		return Quote{}, ErrTerminalRequired
+	}
+	cached, _, err := store.GetCachedTerminals(ctx, method.ProviderKey, country)
+	if err == nil && len(cached) > 0 {
+		var terminals []shipping.Terminal
+		if json.Unmarshal(cached, &terminals) == nil && len(terminals) > 0 {
+			found := false
+			for _, t := range terminals {
+				if t.ID == terminalID {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return Quote{}, ErrUnknownTerminal
+			}
+		}
+	}
+	q.TerminalID = terminalID
+	return q, nil
+}
+
+// RequiresTerminal reports whether a method delivers to a parcel locker.
+func RequiresTerminal(method *storshiping.Method) bool {
+	return method.ServiceCode == "parcel-locker"
+}
@@ -0,0 +1,100 @@
+package shipping
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"goecommerce/internal/storage/shipping"
+)
+
+type fakeQuoteStore struct {
+	zones     map[string]*shipping.Zone
+	methods   map[string]*shipping.Method
+	terminals []byte
+}
+
+func (f *fakeQuoteStore) GetZoneByCountry(_ context.Context, country string) (*shipping.Zone, error) {
+	z, ok := f.zones[country]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return z, nil
+}
+
+func (f *fakeQuoteStore) GetMethod(_ context.Context, id string) (*shipping.Method, error) {
+	m, ok := f.methods[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return m, nil
+}
+
+func (f *fakeQuoteStore) GetCachedTerminals(context.Context, string, string) ([]byte, time.Time, error) {
+	if f.terminals == nil {
+		return nil, time.Time{}, sql.ErrNoRows
+	}
+	return f.terminals, time.Now(), nil
+}
+
+func newFakeQuoteStore() *fakeQuoteStore {
+	return &fakeQuoteStore{
+		zones: map[string]*shipping.Zone{"LT": {ID: "zone-lt", Enabled: true}},
+		methods: map[string]*shipping.Method{
+			"courier": {ID: "courier", ZoneID: "zone-lt", ProviderKey: "omniva", ServiceCode: "home-delivery", Enabled: true, PricingMode: "fixed", PricingRulesJSON: []byte(`{"base_price_cents": 499, "free_shipping_order_min_cents": 5000}`)},
+			"locker":  {ID: "locker", ZoneID: "zone-lt", ProviderKey: "omniva", ServiceCode: "parcel-locker", Enabled: true, PricingMode: "fixed", PricingRulesJSON: []byte(`{"base_price_cents": 299}`)},
+			"off":     {ID: "off", ZoneID: "zone-lt", ProviderKey: "omniva", ServiceCode: "express", Enabled: false},
+		},
+	}
+}
+
+func TestQuoteMethodPricesForCountryAndCartValue(t *testing.T) {
+	store := newFakeQuoteStore()
+	q, err := QuoteMethod(context.Background(), store, "courier", "lt", 1000, "")
+	if err != nil {
+		t.Fatalf("QuoteMethod error: %v", err)
+	}
+	if q.PriceCents != 499 {
+		t.Fatalf("expected 499, got %d", q.PriceCents)
+	}
+	q, err = QuoteMethod(context.Background(), store, "courier", "LT", 6000, "")
+	if err != nil {
+		t.Fatalf("QuoteMethod error: %v", err)
+	}
+	if q.PriceCents != 0 {
+		t.Fatalf("expected free shipping, got %d", q.PriceCents)
+	}
+}
+
+func TestQuoteMethodRejectsUnavailableMethods(t *testing.T) {
+	store := newFakeQuoteStore()
+	for _, tc := range []struct{ method, country string }{
+		{"off", "LT"},
+		{"missing", "LT"},
+		{"courier", "LV"},
+	} {
+		if _, err := QuoteMethod(context.Background(), store, tc.method, tc.country, 0, ""); !errors.Is(err, ErrMethodUnavailable) {
+			t.Fatalf("%s/%s: expected ErrMethodUnavailable, got %v", tc.method, tc.country, err)
+		}
+	}
+}
+
+func TestQuoteMethodParcelLockerRequiresKnownTerminal(t *testing.T) {
+	store := newFakeQuoteStore()
+	if _, err := QuoteMethod(context.Background(), store, "locker", "LT", 0, ""); !errors.Is(err, ErrTerminalRequired) {
+		t.Fatalf("expected ErrTerminalRequired, got %v", err)
+	}
+	store.terminals = []byte(`[{"ID":"T1","Name":"Locker 1"}]`)
+	if _, err := QuoteMethod(context.Background(), store, "locker", "LT", 0, "T2"); !errors.Is(err, ErrUnknownTerminal) {
+		t.Fatalf("expected ErrUnknownTerminal, got %v", err)
+	}
+	q, err := QuoteMethod(context.Background(), store, "locker", "LT", 0, "T1")
+	if err != nil {
+		t.Fatalf("QuoteMethod error: %v", err)
+	}
+	if q.TerminalID != "T1" || q.PriceCents != 299 {
+		t.Fatalf("unexpected quote %#v", q)
+	}
+}
@@ -0,0 +1,147 @@
+package shipping
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"goecommerce/internal/platform/shipping"
+	stororders "goecommerce/internal/storage/orders"
+)
+
+const (
+	trackingBatchSize = 50
+	trackingActor     = "tracking"
+)
+
+type trackingStore interface {
+	ClaimShipmentsForTracking(ctx context.Context, limit int, recheckAfter time.Duration) ([]stororders.Shipment, error)
+	RecordTrackingEvents(ctx context.Context, in stororders.RecordTrackingInput) (stororders.Shipment, error)
+}
+
+// trackingPoller periodically fetches the carrier timeline of shipments that
+// are on their way. Deliveries it sees complete the order through the orders
+// store, exactly like an admin confirming delivery.
+type trackingPoller struct {
+	store     trackingStore
+	providers map[string]shipping.Provider
+	interval  time.Duration
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newTrackingPoller(store trackingStore, providers map[string]shipping.Provider, interval time.Duration) *trackingPoller {
+	return &trackingPoller{
+		store:     store,
+		providers: providers,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// trackingIntervalFromEnv reads SHIPMENT_TRACKING_INTERVAL as a Go duration.
+// Polling is off unless it is set; "0" or "off" also disable it.
+func trackingIntervalFromEnv() time.Duration {
+	v := strings.TrimSpace(os.Getenv("SHIPMENT_TRACKING_INTERVAL"))
+	switch v {
+	case "", "0", "off":
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Printf("shipping: invalid SHIPMENT_TRACKING_INTERVAL %q, tracking disabled", v)
+		return 0
+	}
+	return d
+}
+
+func (p *trackingPoller) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-p.stop
+		cancel()
+	}()
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			p.pollOnce(ctx)
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (p *trackingPoller) Close() error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+		<-p.done
+	})
+	return nil
+}
+
+// pollOnce refreshes every shipment due for a check and returns how many
+// were updated. Shipments checked less than half an interval ago are left
+// for the next run.
+func (p *trackingPoller) pollOnce(ctx context.Context) int {
+	updated := 0
+	for ctx.Err() == nil {
+		batch, err := p.store.ClaimShipmentsForTracking(ctx, trackingBatchSize, p.interval/2)
+		if err != nil {
+			log.Printf("shipping: claim shipments for tracking: %v", err)
+			return updated
+		}
+		for _, sh := range batch {
+			if p.refresh(ctx, sh) {
+				updated++
+			}
+		}
+		if len(batch) < trackingBatchSize {
+			break
+		}
+	}
+	return updated
+}
+
+func (p *trackingPoller) refresh(ctx context.Context, sh stororders.Shipment) bool {
+	tracker, ok := p.providers[sh.ProviderKey].(shipping.Tracker)
+	if !ok {
+		return false
+	}
+	events, err := tracker.TrackShipment(ctx, shipping.TrackingRequest{TrackingNumber: sh.TrackingNumber, ShippedAt: sh.ShippedAt})
+	if errors.Is(err, shipping.ErrTrackingUnsupported) {
+		return false
+	}
+	if err != nil {
+		log.Printf("shipping: track shipment %s (%s): %v", sh.ID, sh.ProviderKey, err)
+		return false
+	}
+	if len(events) == 0 {
+		return false
+	}
+	in := stororders.RecordTrackingInput{OrderID: sh.OrderID, ShipmentID: sh.ID, Actor: trackingActor}
+	for _, ev := range events {
+		in.Events = append(in.Events, stororders.TrackingEvent{
+			Status:      ev.Status,
+			Description: ev.Description,
+			Location:    ev.Location,
+			OccurredAt:  ev.OccurredAt,
+		})
+	}
+	if _, err := p.store.RecordTrackingEvents(ctx, in); err != nil {
+		log.Printf("shipping: record tracking for shipment %s: %v", sh.ID, err)
+		return false
+	}
+	return true
+}
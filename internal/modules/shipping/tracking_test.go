@@ -0,0 +1,143 @@
+package shipping
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"goecommerce/internal/platform/shipping"
+	stororders "goecommerce/internal/storage/orders"
+)
+
+type fakeTrackingStore struct {
+	mu       sync.Mutex
+	due      []stororders.Shipment
+	claims   int
+	recorded []stororders.RecordTrackingInput
+}
+
+func (f *fakeTrackingStore) ClaimShipmentsForTracking(_ context.Context, limit int, _ time.Duration) ([]stororders.Shipment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.claims++
+	n := min(limit, len(f.due))
+	batch := f.due[:n]
+	f.due = f.due[n:]
+	return batch, nil
+}
+
+func (f *fakeTrackingStore) RecordTrackingEvents(_ context.Context, in stororders.RecordTrackingInput) (stororders.Shipment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.recorded = append(f.recorded, in)
+	return stororders.Shipment{ID: in.ShipmentID}, nil
+}
+
+type fakeTracker struct {
+	shipping.Provider
+	events map[string][]shipping.TrackingEvent
+}
+
+func (f *fakeTracker) TrackShipment(_ context.Context, req shipping.TrackingRequest) ([]shipping.TrackingEvent, error) {
+	events, ok := f.events[req.TrackingNumber]
+	if !ok {
+		return nil, errors.New("unknown tracking number")
+	}
+	return events, nil
+}
+
+type quoteOnlyProvider struct {
+	shipping.Provider
+}
+
+func TestTrackingPollerRecordsCarrierTimeline(t *testing.T) {
+	shippedAt := time.Now().Add(-30 * time.Hour)
+	tracker := &fakeTracker{events: map[string][]shipping.TrackingEvent{
+		"CE1": {
+			{Status: shipping.TrackingStatusRegistered, Description: "Shipment data received", OccurredAt: shippedAt},
+			{Status: shipping.TrackingStatusDelivered, Description: "Parcel delivered", Location: "Parcel terminal", OccurredAt: shippedAt.Add(26 * time.Hour)},
+		},
+	}}
+	store := &fakeTrackingStore{due: []stororders.Shipment{
+		{ID: "s1", OrderID: "o1", ProviderKey: "omniva", TrackingNumber: "CE1", ShippedAt: shippedAt},
+		{ID: "s2", OrderID: "o2", ProviderKey: "omniva", TrackingNumber: "UNKNOWN", ShippedAt: shippedAt},
+		{ID: "s3", OrderID: "o3", ProviderKey: "manual", TrackingNumber: "M1", ShippedAt: shippedAt},
+		{ID: "s4", OrderID: "o4", ProviderKey: "gone", TrackingNumber: "G1", ShippedAt: shippedAt},
+	}}
+	p := newTrackingPoller(store, map[string]shipping.Provider{"omniva": tracker, "manual": &quoteOnlyProvider{}}, time.Hour)
+
+	if n := p.pollOnce(context.Background()); n != 1 {
+		t.Fatalf("expected 1 shipment updated, got %d", n)
+	}
+	if len(store.recorded) != 1 {
+		t.Fatalf("expected one recorded timeline, got %+v", store.recorded)
+	}
+	got := store.recorded[0]
+	if got.OrderID != "o1" || got.ShipmentID != "s1" || got.Actor != trackingActor || len(got.Events) != 2 {
+		t.Fatalf("unexpected tracking input %+v", got)
+	}
+	if ev := got.Events[1]; ev.Status != stororders.ShipmentStatusDelivered || ev.Location != "Parcel terminal" || !ev.OccurredAt.Equal(shippedAt.Add(26*time.Hour)) {
+		t.Fatalf("unexpected delivery event %+v", ev)
+	}
+}
+
+func TestTrackingPollerDrainsFullBatches(t *testing.T) {
+	tracker := &fakeTracker{events: map[string][]shipping.TrackingEvent{
+		"CE": {{Status: shipping.TrackingStatusInTransit, OccurredAt: time.Now()}},
+	}}
+	store := &fakeTrackingStore{}
+	for i := 0; i < trackingBatchSize+1; i++ {
+		store.due = append(store.due, stororders.Shipment{ID: "s", OrderID: "o", ProviderKey: "omniva", TrackingNumber: "CE"})
+	}
+	p := newTrackingPoller(store, map[string]shipping.Provider{"omniva": tracker}, time.Hour)
+
+	if n := p.pollOnce(context.Background()); n != trackingBatchSize+1 {
+		t.Fatalf("expected all due shipments updated, got %d", n)
+	}
+	if store.claims != 2 {
+		t.Fatalf("expected a second claim after a full batch, got %d", store.claims)
+	}
+}
+
+func TestTrackingPollerStartAndClose(t *testing.T) {
+	store := &fakeTrackingStore{}
+	p := newTrackingPoller(store, map[string]shipping.Provider{}, time.Hour)
+	p.start()
+	deadline := time.Now().Add(time.Second)
+	for {
+		store.mu.Lock()
+		claims := store.claims
+		store.mu.Unlock()
+		if claims > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the poller to run on start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+}
+
+func TestTrackingIntervalFromEnv(t *testing.T) {
+	cases := map[string]time.Duration{
+		"":      0,
+		"off":   0,
+		"0":     0,
+		"5m":    5 * time.Minute,
+		"bogus": 0,
+	}
+	for v, want := range cases {
+		t.Setenv("SHIPMENT_TRACKING_INTERVAL", v)
+		if got := trackingIntervalFromEnv(); got != want {
+			t.Fatalf("%q: expected %s, got %s", v, want, got)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	idempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = 1 << 20
+)
+
+// IdempotencyRecord is what is kept for an idempotency key: the hash of the
+// request that first used it and, once the handler finished, its response.
+type IdempotencyRecord struct {
+	RequestHash string              `json:"request_hash"`
+	Completed   bool                `json:"completed"`
+	StatusCode  int                 `json:"status_code"`
+	Header      map[string][]string `json:"header"`
+	Body        []byte              `json:"body"`
+}
+
+type IdempotencyStore interface {
+	// Reserve claims key for a request with requestHash. When the key is
+	// already taken it returns the existing record and false.
+	Reserve(ctx context.Context, key, requestHash string) (*IdempotencyRecord, bool, error)
+	// Complete stores the response for a reserved key.
+	Complete(ctx context.Context, key string, rec IdempotencyRecord) error
+	// Release drops a reservation so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyCaller identifies who sent a request, e.g. from its session
+// cookie or admin user. Keys are scoped to the caller so a response is only
+// ever replayed to the caller it was made for; "" means the request is not
+// deduplicated.
+type IdempotencyCaller func(r *http.Request) string
+
+// CallerFromCredentials identifies callers by their Authorization header and
+// the named cookies.
+func CallerFromCredentials(cookieNames ...string) IdempotencyCaller {
+	return func(r *http.Request) string {
+		parts := []string{}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			parts = append(parts, "authorization="+auth)
+		}
+		for _, name := range cookieNames {
+			if c, err := r.Cookie(name); err == nil && c.Value != "" {
+				parts = append(parts, name+"="+c.Value)
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+}
+
+// IdempotencyMiddleware makes POST requests that carry an Idempotency-Key
+// header safe to retry: the first successful response for a caller's key is
+// stored and replayed for their later requests with the same key and body.
+// Reusing a key with a different body is rejected with 422, and a retry that
+// arrives while the first request is still running gets 409. Only 2xx
+// responses are stored; errors can be retried. Apply it after
+// authentication so rejected requests never reach it.
+func IdempotencyMiddleware(next http.Handler, store IdempotencyStore, caller IdempotencyCaller) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if store == nil || caller == nil || r == nil || r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := strings.TrimSpace(r.Header.Get(IdempotencyKeyHeader))
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		identity := caller(r)
+		if identity == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			Error(w, http.StatusBadRequest, "idempotency key too long")
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentRequestBytes+1))
+		_ = r.Body.Close()
+		if err != nil {
+			Error(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if len(body) > maxIdempotentRequestBytes {
+			Error(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Keys are scoped to the endpoint and the caller so the same client
+		// key cannot replay a response from another route or to someone else.
+		callerHash := sha256.Sum256([]byte(identity))
+		scopedKey := r.URL.Path + ":" + hex.EncodeToString(callerHash[:16]) + ":" + key
+		requestHash := hashIdempotentRequest(r, body)
+		existing, reserved, err := store.Reserve(r.Context(), scopedKey, requestHash)
+		if err != nil {
+			log.Printf("idempotency: reserve %q: %v", scopedKey, err)
+			Error(w, http.StatusInternalServerError, "idempotency check failed")
+			return
+		}
+		if !reserved {
+			switch {
+			case existing == nil:
+				Error(w, http.StatusInternalServerError, "idempotency check failed")
+			case existing.RequestHash != requestHash:
+				Error(w, http.StatusUnprocessableEntity, "idempotency key reused with a different request")
+			case !existing.Completed:
+				Error(w, http.StatusConflict, "request with this idempotency key is in progress")
+			default:
+				replayIdempotentResponse(w, *existing)
+			}
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			// Use a fresh context: the request context may already be
+			// cancelled once the client got its response.
+			ctx := context.WithoutCancel(r.Context())
+			if p := recover(); p != nil || rec.status < http.StatusOK || rec.status >= http.StatusMultipleChoices {
+				if err := store.Release(ctx, scopedKey); err != nil {
+					log.Printf("idempotency: release %q: %v", scopedKey, err)
+				}
+				if p != nil {
+					panic(p)
+				}
+				return
+			}
+			if err := store.Complete(ctx, scopedKey, IdempotencyRecord{
+				RequestHash: requestHash,
+				Completed:   true,
+				StatusCode:  rec.status,
+				Header:      storedHeaders(w.Header()),
+				Body:        rec.body.Bytes(),
+			}); err != nil {
+				log.Printf("idempotency: complete %q: %v", scopedKey, err)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+func hashIdempotentRequest(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// storedHeaders keeps the response headers worth replaying. Cookies are not
+// replayed to a different client, and CORS headers are set again by the CORS
+// middleware on every request.
+func storedHeaders(h http.Header) map[string][]string {
+	out := map[string][]string{}
+	for _, name := range []string{"Content-Type", "Location"} {
+		if v := h.Values(name); len(v) > 0 {
+			out[name] = append([]string(nil), v...)
+		}
+	}
+	return out
+}
+
+func replayIdempotentResponse(w http.ResponseWriter, rec IdempotencyRecord) {
+	for name, values := range rec.Header {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(rec.StatusCode)
+	_, _ = w.Write(rec.Body)
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
@@ -0,0 +1,175 @@
+package httpx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]IdempotencyRecord
+}
+
+func (s *memoryIdempotencyStore) Reserve(_ context.Context, key, requestHash string) (*IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec, ok := s.records[key]; ok {
+		return &rec, false, nil
+	}
+	s.records[key] = IdempotencyRecord{RequestHash: requestHash}
+	return nil, true, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(_ context.Context, key string, rec IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = rec
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+var testCaller = CallerFromCredentials("session")
+
+func postWithKey(h http.Handler, path, key, body string) *httptest.ResponseRecorder {
+	return postAs(h, "s1", path, key, body)
+}
+
+// postAs sends a request for the caller with the session cookie session;
+// "" sends it without credentials.
+func postAs(h http.Handler, session, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	if session != "" {
+		req.AddCookie(&http.Cookie{Name: "session", Value: session})
+	}
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	return res
+}
+
+// testScopedKey is the store key the middleware uses for session s1.
+func testScopedKey(path, key string) string {
+	callerHash := sha256.Sum256([]byte("session=s1"))
+	return path + ":" + hex.EncodeToString(callerHash[:16]) + ":" + key
+}
+
+func TestIdempotencyMiddlewareReplaysFirstResponse(t *testing.T) {
+	calls := 0
+	handler := IdempotencyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		_ = JSON(w, http.StatusCreated, map[string]any{"call": calls, "body": string(body)})
+	}), &memoryIdempotencyStore{records: map[string]IdempotencyRecord{}}, testCaller)
+
+	first := postWithKey(handler, "/checkout", "k1", `{"a":1}`)
+	second := postWithKey(handler, "/checkout", "k1", `{"a":1}`)
+	if calls != 1 {
+		t.Fatalf("expected handler to run once, ran %d times", calls)
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Fatalf("expected replayed response %d %q, got %d %q", first.Code, first.Body.String(), second.Code, second.Body.String())
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" || second.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected replay headers: %v", second.Header())
+	}
+
+	// The same key on another endpoint is a different key.
+	if res := postWithKey(handler, "/cart/items", "k1", `{"a":1}`); res.Header().Get("Idempotent-Replayed") != "" || calls != 2 {
+		t.Fatalf("expected key to be scoped per endpoint")
+	}
+	// Requests without a key are never deduplicated.
+	postWithKey(handler, "/checkout", "", `{"a":1}`)
+	postWithKey(handler, "/checkout", "", `{"a":1}`)
+	if calls != 4 {
+		t.Fatalf("expected requests without key to run, got %d calls", calls)
+	}
+}
+
+func TestIdempotencyMiddlewareRejectsDifferentBody(t *testing.T) {
+	handler := IdempotencyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), &memoryIdempotencyStore{records: map[string]IdempotencyRecord{}}, testCaller)
+
+	postWithKey(handler, "/checkout", "k1", `{"a":1}`)
+	res := postWithKey(handler, "/checkout", "k1", `{"a":2}`)
+	if res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status %d, got %d", http.StatusUnprocessableEntity, res.Code)
+	}
+}
+
+func TestIdempotencyMiddlewareInProgressAndServerErrors(t *testing.T) {
+	store := &memoryIdempotencyStore{records: map[string]IdempotencyRecord{}}
+	status := http.StatusInternalServerError
+	handler := IdempotencyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}), store, testCaller)
+
+	if res := postWithKey(handler, "/checkout", "k1", `{}`); res.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, res.Code)
+	}
+	if _, ok := store.records[testScopedKey("/checkout", "k1")]; ok {
+		t.Fatalf("expected server error to release the key")
+	}
+	status = http.StatusOK
+	if res := postWithKey(handler, "/checkout", "k1", `{}`); res.Code != http.StatusOK || res.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("expected retry after server error to run the handler, got %d", res.Code)
+	}
+
+	store.records[testScopedKey("/checkout", "k2")] = IdempotencyRecord{RequestHash: hashIdempotentRequest(httptest.NewRequest(http.MethodPost, "/checkout", nil), []byte(`{}`))}
+	if res := postWithKey(handler, "/checkout", "k2", `{}`); res.Code != http.StatusConflict {
+		t.Fatalf("expected status %d for in-flight key, got %d", http.StatusConflict, res.Code)
+	}
+}
+
+func TestIdempotencyMiddlewareScopesKeysToCaller(t *testing.T) {
+	calls := 0
+	handler := IdempotencyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_ = JSON(w, http.StatusCreated, map[string]any{"call": calls})
+	}), &memoryIdempotencyStore{records: map[string]IdempotencyRecord{}}, testCaller)
+
+	postAs(handler, "s1", "/checkout", "k1", `{}`)
+	if res := postAs(handler, "s2", "/checkout", "k1", `{}`); res.Header().Get("Idempotent-Replayed") != "" || calls != 2 {
+		t.Fatalf("expected another caller's key not to replay the response")
+	}
+	// Requests without credentials are never deduplicated.
+	postAs(handler, "", "/checkout", "k1", `{}`)
+	postAs(handler, "", "/checkout", "k1", `{}`)
+	if calls != 4 {
+		t.Fatalf("expected anonymous requests to run, got %d calls", calls)
+	}
+}
+
+func TestIdempotencyMiddlewareDoesNotStoreClientErrors(t *testing.T) {
+	store := &memoryIdempotencyStore{records: map[string]IdempotencyRecord{}}
+	status := http.StatusUnauthorized
+	handler := IdempotencyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}), store, testCaller)
+
+	if res := postWithKey(handler, "/checkout", "k1", `{}`); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, res.Code)
+	}
+	if _, ok := store.records[testScopedKey("/checkout", "k1")]; ok {
+		t.Fatalf("expected client error to release the key")
+	}
+	status = http.StatusCreated
+	if res := postWithKey(handler, "/checkout", "k1", `{}`); res.Code != http.StatusCreated || res.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("expected retry after client error to run the handler, got %d", res.Code)
+	}
+}
@@ -19,6 +19,7 @@ type rateLimitEntry struct {
 type RateLimiter struct {
 	redis         *redis.Client
 	fallbackStore sync.Map
+	name          string
 	limit         int
 	window        time.Duration
 }
@@ -31,6 +32,21 @@ func NewRateLimiter(redis *redis.Client, limit int, window time.Duration) *RateL
 	}
 }
 
+// NewNamedRateLimiter returns a limiter whose counters are kept apart from
+// other limiters, for endpoints that need a tighter limit of their own.
+func NewNamedRateLimiter(redis *redis.Client, name string, limit int, window time.Duration) *RateLimiter {
+	rl := NewRateLimiter(redis, limit, window)
+	rl.name = name
+	return rl
+}
+
+func (rl *RateLimiter) counterKey(ip string) string {
+	if rl.name == "" {
+		return ip
+	}
+	return rl.name + ":" + ip
+}
+
 func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ip := extractIP(r)
@@ -62,7 +78,7 @@ func (rl *RateLimiter) checkLimit(ctx context.Context, ip string) (bool, error)
 }
 
 func (rl *RateLimiter) checkRedis(ctx context.Context, ip string) (bool, error) {
-	key := "ratelimit:" + ip
+	key := "ratelimit:" + rl.counterKey(ip)
 	pipe := rl.redis.Pipeline()
 	incr := pipe.Incr(ctx, key)
 	pipe.Expire(ctx, key, rl.window)
@@ -76,7 +92,7 @@ func (rl *RateLimiter) checkRedis(ctx context.Context, ip string) (bool, error)
 
 func (rl *RateLimiter) checkFallback(ip string) bool {
 	now := time.Now()
-	key := "fallback:" + ip
+	key := "fallback:" + rl.counterKey(ip)
 
 	val, loaded := rl.fallbackStore.LoadOrStore(key, &rateLimitEntry{count: 1, expiry: now.Add(rl.window)})
 	entry := val.(*rateLimitEntry)
@@ -0,0 +1,227 @@
+// Package invoices lays out invoices and credit notes as PDF. Like tax it is
+// pure: the caller snapshots the order, buyer and seller into a Document and
+// stores the rendered bytes.
+package invoices
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"goecommerce/internal/platform/pdf"
+)
+
+// Document kinds. Credit notes carry negative amounts and reference the
+// invoice they correct.
+const (
+	KindInvoice    = "invoice"
+	KindCreditNote = "credit_note"
+)
+
+// Party is the seller or buyer block of a document.
+type Party struct {
+	Name               string
+	CompanyName        string
+	VAT                string
+	RegistrationNumber string
+	Email              string
+	AddressLines       []string
+}
+
+// Line is one row of the document. TotalCents includes tax. The JSON form is
+// what callers snapshot when the document is issued.
+type Line struct {
+	Description string `json:"description"`
+	Quantity    int    `json:"quantity"`
+	UnitCents   int    `json:"unit_cents"`
+	TaxRateBps  int    `json:"tax_rate_bps"`
+	TotalCents  int    `json:"total_cents"`
+}
+
+type Document struct {
+	Kind           string
+	Number         string
+	IssuedAt       time.Time
+	OrderNumber    string
+	CreditedNumber string
+	Currency       string
+	Seller         Party
+	Buyer          Party
+	Lines          []Line
+	NetCents       int
+	TaxCents       int
+	TotalCents     int
+	ReverseCharge  bool
+	Note           string
+}
+
+// SellerFromEnv reads the shop's legal details printed on every document:
+// INVOICE_SELLER_NAME, INVOICE_SELLER_ADDRESS (lines separated by ";"),
+// INVOICE_SELLER_VAT, INVOICE_SELLER_REG_NO and INVOICE_SELLER_EMAIL.
+func SellerFromEnv() Party {
+	p := Party{
+		Name:               strings.TrimSpace(os.Getenv("INVOICE_SELLER_NAME")),
+		VAT:                strings.TrimSpace(os.Getenv("INVOICE_SELLER_VAT")),
+		RegistrationNumber: strings.TrimSpace(os.Getenv("INVOICE_SELLER_REG_NO")),
+		Email:              strings.TrimSpace(os.Getenv("INVOICE_SELLER_EMAIL")),
+	}
+	for _, line := range strings.Split(os.Getenv("INVOICE_SELLER_ADDRESS"), ";") {
+		if line = strings.TrimSpace(line); line != "" {
+			p.AddressLines = append(p.AddressLines, line)
+		}
+	}
+	return p
+}
+
+const (
+	marginLeft   = 50.0
+	marginRight  = pdf.PageWidth - 50
+	marginBottom = pdf.PageHeight - 60
+	lineHeight   = 14.0
+
+	colQuantity = 330.0
+	colUnit     = 410.0
+	colTaxRate  = 470.0
+)
+
+// Render returns doc as a PDF. Line rows continue on further pages when they
+// do not fit on the first one.
+func Render(doc Document) []byte {
+	d := pdf.New()
+	page := d.AddPage()
+
+	title := "INVOICE"
+	if doc.Kind == KindCreditNote {
+		title = "CREDIT NOTE"
+	}
+	page.Text(marginLeft, 70, pdf.Bold, 20, title)
+	y := 70.0
+	for _, row := range [][2]string{
+		{"Number", doc.Number},
+		{"Date", doc.IssuedAt.UTC().Format("2006-01-02")},
+		{"Order", doc.OrderNumber},
+		{"Credits invoice", doc.CreditedNumber},
+	} {
+		if row[1] == "" {
+			continue
+		}
+		page.TextRight(colTaxRate, y, pdf.Regular, 10, row[0]+":")
+		page.TextRight(marginRight, y, pdf.Bold, 10, row[1])
+		y += lineHeight
+	}
+
+	top := 140.0
+	sellerEnd := drawParty(page, marginLeft, top, "Seller", doc.Seller)
+	buyerEnd := drawParty(page, 310, top, "Bill to", doc.Buyer)
+	y = max(sellerEnd, buyerEnd) + 20
+
+	header := func(p *pdf.Page, y float64) float64 {
+		p.Text(marginLeft, y, pdf.Bold, 9, "Description")
+		p.TextRight(colQuantity, y, pdf.Bold, 9, "Qty")
+		p.TextRight(colUnit, y, pdf.Bold, 9, "Unit price")
+		p.TextRight(colTaxRate, y, pdf.Bold, 9, "VAT")
+		p.TextRight(marginRight, y, pdf.Bold, 9, "Total")
+		p.Line(marginLeft, y+5, marginRight, y+5)
+		return y + lineHeight + 4
+	}
+	y = header(page, y)
+	for _, line := range doc.Lines {
+		if y > marginBottom {
+			page = d.AddPage()
+			y = header(page, 70)
+		}
+		page.Text(marginLeft, y, pdf.Regular, 9, truncate(line.Description, colQuantity-marginLeft-40, 9))
+		page.TextRight(colQuantity, y, pdf.Regular, 9, fmt.Sprintf("%d", line.Quantity))
+		page.TextRight(colUnit, y, pdf.Regular, 9, formatCents(line.UnitCents))
+		page.TextRight(colTaxRate, y, pdf.Regular, 9, formatRate(line.TaxRateBps))
+		page.TextRight(marginRight, y, pdf.Regular, 9, formatCents(line.TotalCents))
+		y += lineHeight
+	}
+
+	if y+5*lineHeight > marginBottom {
+		page = d.AddPage()
+		y = 70
+	}
+	page.Line(colUnit-60, y-6, marginRight, y-6)
+	y += 6
+	for _, row := range []struct {
+		label string
+		cents int
+		font  pdf.Font
+	}{
+		{"Net", doc.NetCents, pdf.Regular},
+		{"VAT", doc.TaxCents, pdf.Regular},
+		{"Total " + doc.Currency, doc.TotalCents, pdf.Bold},
+	} {
+		page.TextRight(colTaxRate, y, row.font, 10, row.label)
+		page.TextRight(marginRight, y, row.font, 10, formatCents(row.cents))
+		y += lineHeight
+	}
+
+	y += lineHeight
+	if doc.ReverseCharge {
+		page.Text(marginLeft, y, pdf.Regular, 9, "VAT reverse charge: the recipient accounts for VAT (Article 196, Council Directive 2006/112/EC).")
+		y += lineHeight
+	}
+	if doc.Note != "" {
+		page.Text(marginLeft, y, pdf.Regular, 9, truncate(doc.Note, marginRight-marginLeft, 9))
+	}
+	return d.Bytes()
+}
+
+func drawParty(page *pdf.Page, x, y float64, label string, p Party) float64 {
+	page.Text(x, y, pdf.Bold, 9, strings.ToUpper(label))
+	y += lineHeight
+	lines := []string{}
+	if p.CompanyName != "" {
+		lines = append(lines, p.CompanyName)
+	}
+	if p.Name != "" && p.Name != p.CompanyName {
+		lines = append(lines, p.Name)
+	}
+	lines = append(lines, p.AddressLines...)
+	if p.RegistrationNumber != "" {
+		lines = append(lines, "Reg. no. "+p.RegistrationNumber)
+	}
+	if p.VAT != "" {
+		lines = append(lines, "VAT "+p.VAT)
+	}
+	if p.Email != "" {
+		lines = append(lines, p.Email)
+	}
+	for i, line := range lines {
+		font := pdf.Regular
+		if i == 0 {
+			font = pdf.Bold
+		}
+		page.Text(x, y, font, 10, truncate(line, 230, 10))
+		y += lineHeight
+	}
+	return y
+}
+
+func formatCents(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func formatRate(bps int) string {
+	s := fmt.Sprintf("%d.%02d", bps/100, bps%100)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".") + "%"
+}
+
+// truncate shortens s with an ellipsis so it fits into width points.
+func truncate(s string, width, size float64) string {
+	if pdf.TextWidth(pdf.Regular, size, s) <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 && pdf.TextWidth(pdf.Regular, size, string(r)+"...") > width {
+		r = r[:len(r)-1]
+	}
+	return string(r) + "..."
+}
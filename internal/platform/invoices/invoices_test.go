@@ -0,0 +1,53 @@
+package invoices
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRenderInvoice(t *testing.T) {
+	doc := Document{
+		Kind:        KindInvoice,
+		Number:      "INV-2026-000042",
+		IssuedAt:    time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC),
+		OrderNumber: "ORD-1",
+		Currency:    "EUR",
+		Seller:      Party{Name: "Shop UAB", VAT: "LT100000000000", AddressLines: []string{"Gedimino pr. 1", "Vilnius"}},
+		Buyer:       Party{Name: "Jane Doe", CompanyName: "Acme GmbH", VAT: "DE123456789"},
+		Lines:       []Line{{Description: "T-shirt (M)", Quantity: 2, UnitCents: 1210, TaxRateBps: 2100, TotalCents: 2420}},
+		NetCents:    2000,
+		TaxCents:    420,
+		TotalCents:  2420,
+	}
+	out := Render(doc)
+	for _, want := range []string{"INVOICE", "INV-2026-000042", "2026-03-01", "Acme GmbH", "VAT DE123456789", `T-shirt \(M\)`, "24.20", "21%", "Total EUR"} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Fatalf("rendered invoice is missing %q", want)
+		}
+	}
+}
+
+func TestRenderCreditNoteSpillsOntoNextPage(t *testing.T) {
+	doc := Document{Kind: KindCreditNote, Number: "CN-2026-000001", CreditedNumber: "INV-2026-000042", TotalCents: -2420, ReverseCharge: true}
+	for i := 0; i < 80; i++ {
+		doc.Lines = append(doc.Lines, Line{Description: "Returned item", Quantity: 1, UnitCents: -100, TotalCents: -100})
+	}
+	out := Render(doc)
+	for _, want := range []string{"CREDIT NOTE", "Credits invoice:", "-24.20", "reverse charge", "/Count 2"} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Fatalf("rendered credit note is missing %q", want)
+		}
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	if got := formatCents(-5); got != "-0.05" {
+		t.Fatalf("formatCents(-5) = %q", got)
+	}
+	for bps, want := range map[int]string{0: "0%", 950: "9.5%", 2100: "21%"} {
+		if got := formatRate(bps); got != want {
+			t.Fatalf("formatRate(%d) = %q, want %q", bps, got, want)
+		}
+	}
+}
@@ -2,14 +2,81 @@ package payments
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrNotConfigured is returned by the offline Stripe stub for calls that
+	// need real credentials.
+	ErrNotConfigured = errors.New("payment provider not configured")
 )
 
 type Provider interface {
 	CreateCheckout(ctx context.Context, amountCents int, currency string, orderNumber string) (string, error)
 }
 
+// WebhookEvent is the provider-neutral view of an incoming payment webhook.
+// Status is the order status the event implies ("paid", "cancelled") or
+// empty when the event does not affect the order. AmountCents and Currency
+// are what the provider collected, when it reports them.
+type WebhookEvent struct {
+	ID          string
+	Type        string
+	OrderNumber string
+	PaymentRef  string
+	Status      string
+	AmountCents int
+	Currency    string
+}
+
+// CheckoutSession is a payment the provider opened for an order: URL is
+// where the customer pays and Reference identifies the session.
+type CheckoutSession struct {
+	URL       string
+	Reference string
+}
+
+// SessionProvider is implemented by providers whose checkout opens a session
+// the order should reference, so the shop knows a payment for the order's
+// total has been issued.
+type SessionProvider interface {
+	CreateCheckoutSession(ctx context.Context, amountCents int, currency string, orderNumber string) (CheckoutSession, error)
+}
+
+type WebhookParser interface {
+	ParseWebhook(payload []byte, header http.Header) (WebhookEvent, error)
+}
+
+// Refunder is implemented by providers that can return money through their
+// API. orderRef is the payment reference stored on the order (for Stripe the
+// PaymentIntent id); the returned string is the provider's refund id.
+// idempotencyKey identifies the refund, so a retried call returns the same
+// refund instead of paying out twice.
+type Refunder interface {
+	Refund(ctx context.Context, orderRef string, amountCents int, idempotencyKey string) (string, error)
+}
+
+// Instructions tell the customer how to settle an offline payment.
+type Instructions struct {
+	Reference string            `json:"reference"`
+	Message   string            `json:"message"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// OfflineProvider is implemented by methods settled outside the shop, such as
+// bank transfer or cash on delivery. Checkout returns Instructions instead of
+// a redirect URL and creates the order in InitialStatus; an admin confirms
+// the payment later.
+type OfflineProvider interface {
+	InitialStatus() string
+	Instructions(ctx context.Context, amountCents int, currency string, orderNumber string) (Instructions, error)
+}
+
 type stripeStub struct {
 	pub string
 	sec string
@@ -21,8 +88,35 @@ func (s *stripeStub) CreateCheckout(_ context.Context, amountCents int, currency
 	return fmt.Sprintf("https://checkout.stripe.com/test/%s", orderNumber), nil
 }
 
+// Refund fails: without Stripe credentials no money can be returned, and a
+// made-up refund id would record the refund as paid out.
+func (s *stripeStub) Refund(context.Context, string, int, string) (string, error) {
+	return "", ErrNotConfigured
+}
+
+// NewFromEnv builds the registered "stripe" provider from STRIPE_* env vars.
+// It falls back to the offline stub when no secret key is configured, so
+// local setups work without credentials.
 func NewFromEnv() Provider {
 	pub := os.Getenv("STRIPE_PUBLIC_KEY")
-	sec := os.Getenv("STRIPE_SECRET_KEY")
-	return &stripeStub{pub: pub, sec: sec}
+	sec := strings.TrimSpace(os.Getenv("STRIPE_SECRET_KEY"))
+	stub := &stripeStub{pub: pub, sec: sec}
+	if sec == "" || sec == "sk_test_your_key" {
+		return stub
+	}
+	factory, err := Get("stripe")
+	if err != nil {
+		return stub
+	}
+	prov, err := factory(map[string]any{
+		"secret_key":     sec,
+		"webhook_secret": strings.TrimSpace(os.Getenv("STRIPE_WEBHOOK_SECRET")),
+		"base_url":       strings.TrimSpace(os.Getenv("STRIPE_API_BASE")),
+		"success_url":    strings.TrimSpace(os.Getenv("STRIPE_SUCCESS_URL")),
+		"cancel_url":     strings.TrimSpace(os.Getenv("STRIPE_CANCEL_URL")),
+	})
+	if err != nil {
+		return stub
+	}
+	return prov
 }
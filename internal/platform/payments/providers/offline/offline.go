@@ -0,0 +1,142 @@
+package offline
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"goecommerce/internal/platform/payments"
+)
+
+const (
+	statusPendingPayment         = "pending_payment"
+	statusAwaitingPaymentOffline = "awaiting_payment_offline"
+)
+
+type bankTransferProvider struct {
+	beneficiary string
+	iban        string
+	bic         string
+	bankName    string
+}
+
+type cashOnDeliveryProvider struct {
+	message string
+}
+
+func NewBankTransfer(config map[string]any) (payments.Provider, error) {
+	beneficiary, _ := config["beneficiary_name"].(string)
+	iban, _ := config["iban"].(string)
+	bic, _ := config["bic"].(string)
+	bankName, _ := config["bank_name"].(string)
+	iban = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(iban), " ", ""))
+	if iban == "" {
+		return nil, fmt.Errorf("bank-transfer: iban is required")
+	}
+	return &bankTransferProvider{
+		beneficiary: strings.TrimSpace(beneficiary),
+		iban:        iban,
+		bic:         strings.ToUpper(strings.TrimSpace(bic)),
+		bankName:    strings.TrimSpace(bankName),
+	}, nil
+}
+
+func NewCashOnDelivery(config map[string]any) (payments.Provider, error) {
+	message, _ := config["message"].(string)
+	message = strings.TrimSpace(message)
+	if message == "" {
+		message = "Pay the courier in cash or by card when your parcel is delivered."
+	}
+	return &cashOnDeliveryProvider{message: message}, nil
+}
+
+func init() {
+	payments.Register("bank-transfer", NewBankTransfer)
+	payments.Register("cash-on-delivery", NewCashOnDelivery)
+}
+
+func (p *bankTransferProvider) CreateCheckout(context.Context, int, string, string) (string, error) {
+	return "", nil
+}
+
+func (p *bankTransferProvider) InitialStatus() string { return statusPendingPayment }
+
+func (p *bankTransferProvider) Instructions(_ context.Context, amountCents int, currency string, orderNumber string) (payments.Instructions, error) {
+	ref, err := CreditorReference(orderNumber)
+	if err != nil {
+		return payments.Instructions{}, err
+	}
+	details := map[string]string{
+		"iban":   p.iban,
+		"amount": formatAmount(amountCents, currency),
+	}
+	if p.beneficiary != "" {
+		details["beneficiary_name"] = p.beneficiary
+	}
+	if p.bic != "" {
+		details["bic"] = p.bic
+	}
+	if p.bankName != "" {
+		details["bank_name"] = p.bankName
+	}
+	return payments.Instructions{
+		Reference: ref,
+		Message:   fmt.Sprintf("Transfer %s to %s and use %s as the payment reference.", details["amount"], p.iban, ref),
+		Details:   details,
+	}, nil
+}
+
+func (p *cashOnDeliveryProvider) CreateCheckout(context.Context, int, string, string) (string, error) {
+	return "", nil
+}
+
+func (p *cashOnDeliveryProvider) InitialStatus() string { return statusAwaitingPaymentOffline }
+
+func (p *cashOnDeliveryProvider) Instructions(_ context.Context, amountCents int, currency string, orderNumber string) (payments.Instructions, error) {
+	return payments.Instructions{
+		Reference: orderNumber,
+		Message:   p.message,
+		Details:   map[string]string{"amount": formatAmount(amountCents, currency)},
+	}, nil
+}
+
+// CreditorReference derives an ISO 11649 ("RF") structured reference from an
+// order number, which Baltic banks accept and validate on transfer.
+func CreditorReference(orderNumber string) (string, error) {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(orderNumber) {
+		if (r >= '0' && r <= '9') || (r >= 'A' && r <= 'Z') {
+			b.WriteRune(r)
+		}
+	}
+	body := b.String()
+	if body == "" {
+		return "", fmt.Errorf("bank-transfer: empty order number")
+	}
+	if len(body) > 21 {
+		body = body[len(body)-21:]
+	}
+	n, ok := new(big.Int).SetString(referenceDigits(body+"RF00"), 10)
+	if !ok {
+		return "", fmt.Errorf("bank-transfer: invalid reference")
+	}
+	check := 98 - new(big.Int).Mod(n, big.NewInt(97)).Int64()
+	return fmt.Sprintf("RF%02d%s", check, body), nil
+}
+
+func referenceDigits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			fmt.Fprintf(&b, "%d", r-'A'+10)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func formatAmount(amountCents int, currency string) string {
+	return fmt.Sprintf("%d.%02d %s", amountCents/100, amountCents%100, strings.ToUpper(currency))
+}
@@ -0,0 +1,64 @@
+package offline
+
+import (
+	"context"
+	"testing"
+
+	"goecommerce/internal/platform/payments"
+)
+
+func TestCreditorReference(t *testing.T) {
+	// RF18539007547034 is the reference example from ISO 11649.
+	ref, err := CreditorReference("539007547034")
+	if err != nil {
+		t.Fatalf("CreditorReference error: %v", err)
+	}
+	if ref != "RF18539007547034" {
+		t.Fatalf("unexpected reference %q", ref)
+	}
+	ref, err = CreditorReference("ORD-20260101-123456")
+	if err != nil {
+		t.Fatalf("CreditorReference error: %v", err)
+	}
+	if ref[:2] != "RF" || ref[4:] != "ORD20260101123456" {
+		t.Fatalf("unexpected reference %q", ref)
+	}
+}
+
+func TestBankTransferInstructions(t *testing.T) {
+	if _, err := NewBankTransfer(map[string]any{}); err == nil {
+		t.Fatalf("expected error without iban")
+	}
+	prov, err := NewBankTransfer(map[string]any{"iban": "lt12 1000 0111 0100 1000", "beneficiary_name": "Shop UAB"})
+	if err != nil {
+		t.Fatalf("NewBankTransfer error: %v", err)
+	}
+	offline, ok := prov.(payments.OfflineProvider)
+	if !ok {
+		t.Fatalf("bank transfer must be an offline provider")
+	}
+	if offline.InitialStatus() != "pending_payment" {
+		t.Fatalf("unexpected initial status %q", offline.InitialStatus())
+	}
+	instr, err := offline.Instructions(context.Background(), 12345, "eur", "ORD-1")
+	if err != nil {
+		t.Fatalf("Instructions error: %v", err)
+	}
+	if instr.Details["iban"] != "LT121000011101001000" || instr.Details["amount"] != "123.45 EUR" {
+		t.Fatalf("unexpected details %#v", instr.Details)
+	}
+	if instr.Reference == "" {
+		t.Fatalf("missing reference")
+	}
+}
+
+func TestCashOnDeliveryStartsAwaitingOfflinePayment(t *testing.T) {
+	prov, err := NewCashOnDelivery(map[string]any{})
+	if err != nil {
+		t.Fatalf("NewCashOnDelivery error: %v", err)
+	}
+	offline := prov.(payments.OfflineProvider)
+	if offline.InitialStatus() != "awaiting_payment_offline" {
+		t.Fatalf("unexpected initial status %q", offline.InitialStatus())
+	}
+}
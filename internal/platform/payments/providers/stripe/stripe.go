@@ -0,0 +1,306 @@
+package stripe
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"goecommerce/internal/platform/payments"
+)
+
+const (
+	defaultBaseURL     = "https://api.stripe.com"
+	defaultSuccessURL  = "http://localhost:3000/checkout/success"
+	defaultCancelURL   = "http://localhost:3000/checkout/cancel"
+	signatureHeader    = "Stripe-Signature"
+	signatureTolerance = 5 * time.Minute
+)
+
+type Config struct {
+	SecretKey     string
+	WebhookSecret string
+	BaseURL       string
+	SuccessURL    string
+	CancelURL     string
+	HTTPClient    *http.Client
+	Now           func() time.Time
+}
+
+type provider struct {
+	secretKey     string
+	webhookSecret string
+	baseURL       string
+	successURL    string
+	cancelURL     string
+	client        *http.Client
+	now           func() time.Time
+}
+
+func NewProvider(config map[string]any) (payments.Provider, error) {
+	cfg := Config{}
+	cfg.SecretKey, _ = config["secret_key"].(string)
+	cfg.WebhookSecret, _ = config["webhook_secret"].(string)
+	cfg.BaseURL, _ = config["base_url"].(string)
+	cfg.SuccessURL, _ = config["success_url"].(string)
+	cfg.CancelURL, _ = config["cancel_url"].(string)
+	if strings.TrimSpace(cfg.SecretKey) == "" {
+		return nil, errors.New("stripe: secret_key is required")
+	}
+	return New(cfg), nil
+}
+
+func init() {
+	payments.Register("stripe", NewProvider)
+}
+
+func New(cfg Config) payments.Provider {
+	p := &provider{
+		secretKey:     cfg.SecretKey,
+		webhookSecret: cfg.WebhookSecret,
+		baseURL:       strings.TrimRight(cfg.BaseURL, "/"),
+		successURL:    cfg.SuccessURL,
+		cancelURL:     cfg.CancelURL,
+		client:        cfg.HTTPClient,
+		now:           cfg.Now,
+	}
+	if p.baseURL == "" {
+		p.baseURL = defaultBaseURL
+	}
+	if p.successURL == "" {
+		p.successURL = defaultSuccessURL
+	}
+	if p.cancelURL == "" {
+		p.cancelURL = defaultCancelURL
+	}
+	if p.client == nil {
+		p.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if p.now == nil {
+		p.now = time.Now
+	}
+	return p
+}
+
+type checkoutSession struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *provider) CreateCheckout(ctx context.Context, amountCents int, currency string, orderNumber string) (string, error) {
+	session, err := p.CreateCheckoutSession(ctx, amountCents, currency, orderNumber)
+	if err != nil {
+		return "", err
+	}
+	return session.URL, nil
+}
+
+// CreateCheckoutSession opens a Checkout Session; its id is the reference.
+func (p *provider) CreateCheckoutSession(ctx context.Context, amountCents int, currency string, orderNumber string) (payments.CheckoutSession, error) {
+	if amountCents <= 0 {
+		return payments.CheckoutSession{}, errors.New("amount must be positive")
+	}
+	if strings.TrimSpace(orderNumber) == "" {
+		return payments.CheckoutSession{}, errors.New("order number is required")
+	}
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("success_url", p.successURL)
+	form.Set("cancel_url", p.cancelURL)
+	form.Set("client_reference_id", orderNumber)
+	form.Set("metadata[order_number]", orderNumber)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", strings.ToLower(currency))
+	form.Set("line_items[0][price_data][unit_amount]", strconv.Itoa(amountCents))
+	form.Set("line_items[0][price_data][product_data][name]", "Order "+orderNumber)
+
+	var session checkoutSession
+	if err := p.post(ctx, "/v1/checkout/sessions", form, "checkout-"+orderNumber, &session); err != nil {
+		return payments.CheckoutSession{}, err
+	}
+	if session.URL == "" || session.ID == "" {
+		return payments.CheckoutSession{}, errors.New("stripe: checkout session without id or url")
+	}
+	return payments.CheckoutSession{URL: session.URL, Reference: session.ID}, nil
+}
+
+type refundObject struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+func (p *provider) Refund(ctx context.Context, orderRef string, amountCents int, idempotencyKey string) (string, error) {
+	if amountCents <= 0 {
+		return "", errors.New("amount must be positive")
+	}
+	orderRef = strings.TrimSpace(orderRef)
+	if orderRef == "" {
+		return "", errors.New("stripe: order has no payment reference")
+	}
+	form := url.Values{}
+	if strings.HasPrefix(orderRef, "ch_") {
+		form.Set("charge", orderRef)
+	} else {
+		form.Set("payment_intent", orderRef)
+	}
+	form.Set("amount", strconv.Itoa(amountCents))
+
+	var refund refundObject
+	if err := p.post(ctx, "/v1/refunds", form, idempotencyKey, &refund); err != nil {
+		return "", err
+	}
+	if refund.ID == "" {
+		return "", errors.New("stripe: refund without id")
+	}
+	return refund.ID, nil
+}
+
+func (p *provider) post(ctx context.Context, path string, form url.Values, idempotencyKey string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.secretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("stripe: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("stripe: %w", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		var apiErr errorResponse
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("stripe: %s", apiErr.Error.Message)
+		}
+		return fmt.Errorf("stripe: unexpected status %d", res.StatusCode)
+	}
+	if err := json.Unmarshal(body, dst); err != nil {
+		return fmt.Errorf("stripe: invalid response: %w", err)
+	}
+	return nil
+}
+
+type event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object struct {
+			ID                string            `json:"id"`
+			ClientReferenceID string            `json:"client_reference_id"`
+			PaymentIntent     string            `json:"payment_intent"`
+			PaymentStatus     string            `json:"payment_status"`
+			AmountTotal       int               `json:"amount_total"`
+			Currency          string            `json:"currency"`
+			Metadata          map[string]string `json:"metadata"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+func (p *provider) ParseWebhook(payload []byte, header http.Header) (payments.WebhookEvent, error) {
+	if err := verifySignature(payload, header.Get(signatureHeader), p.webhookSecret, p.now()); err != nil {
+		return payments.WebhookEvent{}, err
+	}
+	var ev event
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return payments.WebhookEvent{}, errors.New("invalid webhook payload")
+	}
+	if ev.ID == "" || ev.Type == "" {
+		return payments.WebhookEvent{}, errors.New("invalid webhook payload")
+	}
+	obj := ev.Data.Object
+	out := payments.WebhookEvent{
+		ID:          ev.ID,
+		Type:        ev.Type,
+		OrderNumber: obj.Metadata["order_number"],
+		PaymentRef:  obj.PaymentIntent,
+		AmountCents: obj.AmountTotal,
+		Currency:    strings.ToUpper(obj.Currency),
+	}
+	if out.OrderNumber == "" {
+		out.OrderNumber = obj.ClientReferenceID
+	}
+	if out.PaymentRef == "" {
+		out.PaymentRef = obj.ID
+	}
+	switch ev.Type {
+	case "checkout.session.completed":
+		if obj.PaymentStatus == "paid" || obj.PaymentStatus == "no_payment_required" {
+			out.Status = "paid"
+		}
+	case "checkout.session.async_payment_succeeded":
+		out.Status = "paid"
+	case "checkout.session.expired", "checkout.session.async_payment_failed":
+		out.Status = "cancelled"
+	}
+	return out, nil
+}
+
+// verifySignature checks a "t=<unix>,v1=<hex>" header against an
+// HMAC-SHA256 of "<t>.<payload>" and rejects stale timestamps.
+func verifySignature(payload []byte, header, secret string, now time.Time) error {
+	if secret == "" || header == "" {
+		return payments.ErrInvalidSignature
+	}
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			timestamp = v
+		case "v1":
+			signatures = append(signatures, v)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return payments.ErrInvalidSignature
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return payments.ErrInvalidSignature
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	if age > signatureTolerance || age < -signatureTolerance {
+		return payments.ErrInvalidSignature
+	}
+	expected := signPayload(payload, timestamp, secret)
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return payments.ErrInvalidSignature
+}
+
+func signPayload(payload []byte, timestamp, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,194 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"goecommerce/internal/platform/payments"
+)
+
+func TestStripeCreateCheckoutAgainstFakeServer(t *testing.T) {
+	var gotAuth, gotIdempotency string
+	var gotForm map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/checkout/sessions" {
+			t.Fatalf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		gotAuth = r.Header.Get("Authorization")
+		gotIdempotency = r.Header.Get("Idempotency-Key")
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("parse form: %v", err)
+		}
+		gotForm = map[string]string{}
+		for k := range r.PostForm {
+			gotForm[k] = r.PostForm.Get(k)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"cs_test_1","url":"https://pay.example.com/cs_test_1"}`))
+	}))
+	defer srv.Close()
+
+	p := New(Config{SecretKey: "sk_test_x", BaseURL: srv.URL})
+	session, err := p.(payments.SessionProvider).CreateCheckoutSession(context.Background(), 2599, "EUR", "ORD-1")
+	if err != nil {
+		t.Fatalf("CreateCheckoutSession error: %v", err)
+	}
+	if session.URL != "https://pay.example.com/cs_test_1" || session.Reference != "cs_test_1" {
+		t.Fatalf("unexpected session %+v", session)
+	}
+	if gotAuth != "Bearer sk_test_x" {
+		t.Fatalf("unexpected auth header %q", gotAuth)
+	}
+	if gotIdempotency != "checkout-ORD-1" {
+		t.Fatalf("unexpected idempotency key %q", gotIdempotency)
+	}
+	if gotForm["line_items[0][price_data][unit_amount]"] != "2599" || gotForm["line_items[0][price_data][currency]"] != "eur" {
+		t.Fatalf("unexpected line item form: %#v", gotForm)
+	}
+	if gotForm["metadata[order_number]"] != "ORD-1" || gotForm["client_reference_id"] != "ORD-1" {
+		t.Fatalf("missing order reference: %#v", gotForm)
+	}
+}
+
+func TestStripeCreateCheckoutSurfacesAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"message":"Invalid API Key"}}`))
+	}))
+	defer srv.Close()
+
+	p := New(Config{SecretKey: "sk_bad", BaseURL: srv.URL})
+	_, err := p.CreateCheckout(context.Background(), 100, "EUR", "ORD-2")
+	if err == nil || !strings.Contains(err.Error(), "Invalid API Key") {
+		t.Fatalf("expected api error, got %v", err)
+	}
+}
+
+func TestStripeRefundAgainstFakeServer(t *testing.T) {
+	var gotForm map[string]string
+	var gotKey string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/refunds" {
+			t.Fatalf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		gotKey = r.Header.Get("Idempotency-Key")
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("parse form: %v", err)
+		}
+		gotForm = map[string]string{}
+		for k := range r.PostForm {
+			gotForm[k] = r.PostForm.Get(k)
+		}
+		_, _ = w.Write([]byte(`{"id":"re_1","status":"succeeded"}`))
+	}))
+	defer srv.Close()
+
+	p := New(Config{SecretKey: "sk_test_x", BaseURL: srv.URL})
+	refunder, ok := p.(payments.Refunder)
+	if !ok {
+		t.Fatalf("stripe provider must implement payments.Refunder")
+	}
+	id, err := refunder.Refund(context.Background(), "pi_123", 500, "refund-1")
+	if err != nil {
+		t.Fatalf("Refund error: %v", err)
+	}
+	if id != "re_1" {
+		t.Fatalf("unexpected refund id %q", id)
+	}
+	if gotForm["payment_intent"] != "pi_123" || gotForm["amount"] != "500" {
+		t.Fatalf("unexpected refund form: %#v", gotForm)
+	}
+	if gotKey != "refund-1" {
+		t.Fatalf("expected idempotency key refund-1, got %q", gotKey)
+	}
+	if _, err := refunder.Refund(context.Background(), "", 500, "refund-2"); err == nil {
+		t.Fatalf("expected error without payment reference")
+	}
+}
+
+func signedHeader(payload []byte, secret string, ts time.Time) http.Header {
+	t := fmt.Sprintf("%d", ts.Unix())
+	h := http.Header{}
+	h.Set(signatureHeader, "t="+t+",v1="+signPayload(payload, t, secret))
+	return h
+}
+
+func TestStripeParseWebhook(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	p := New(Config{SecretKey: "sk", WebhookSecret: "whsec_1", Now: func() time.Time { return now }}).(payments.WebhookParser)
+
+	tests := []struct {
+		name       string
+		payload    string
+		wantStatus string
+		wantAmount int
+	}{
+		{
+			name:       "completed paid",
+			payload:    `{"id":"evt_1","type":"checkout.session.completed","data":{"object":{"id":"cs_1","payment_intent":"pi_1","payment_status":"paid","amount_total":1250,"currency":"eur","metadata":{"order_number":"ORD-1"}}}}`,
+			wantStatus: "paid",
+			wantAmount: 1250,
+		},
+		{
+			name:       "completed unpaid async",
+			payload:    `{"id":"evt_2","type":"checkout.session.completed","data":{"object":{"id":"cs_1","payment_status":"unpaid","client_reference_id":"ORD-1"}}}`,
+			wantStatus: "",
+		},
+		{
+			name:       "expired",
+			payload:    `{"id":"evt_3","type":"checkout.session.expired","data":{"object":{"id":"cs_1","client_reference_id":"ORD-1"}}}`,
+			wantStatus: "cancelled",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := []byte(tt.payload)
+			ev, err := p.ParseWebhook(payload, signedHeader(payload, "whsec_1", now))
+			if err != nil {
+				t.Fatalf("ParseWebhook error: %v", err)
+			}
+			if ev.OrderNumber != "ORD-1" {
+				t.Fatalf("unexpected order number %q", ev.OrderNumber)
+			}
+			if ev.Status != tt.wantStatus {
+				t.Fatalf("expected status %q, got %q", tt.wantStatus, ev.Status)
+			}
+			if ev.AmountCents != tt.wantAmount || (tt.wantAmount > 0 && ev.Currency != "EUR") {
+				t.Fatalf("unexpected amount %d %q", ev.AmountCents, ev.Currency)
+			}
+		})
+	}
+}
+
+func TestStripeParseWebhookRejectsBadSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	p := New(Config{WebhookSecret: "whsec_1", Now: func() time.Time { return now }}).(payments.WebhookParser)
+	payload := []byte(`{"id":"evt_1","type":"checkout.session.completed"}`)
+
+	cases := map[string]http.Header{
+		"wrong secret": signedHeader(payload, "whsec_other", now),
+		"stale":        signedHeader(payload, "whsec_1", now.Add(-10*time.Minute)),
+		"missing":      {},
+	}
+	for name, header := range cases {
+		if _, err := p.ParseWebhook(payload, header); !errors.Is(err, payments.ErrInvalidSignature) {
+			t.Fatalf("%s: expected ErrInvalidSignature, got %v", name, err)
+		}
+	}
+}
+
+func TestNewProviderRequiresSecretKey(t *testing.T) {
+	if _, err := NewProvider(map[string]any{}); err == nil {
+		t.Fatalf("expected error for missing secret_key")
+	}
+	prov, err := NewProvider(map[string]any{"secret_key": "sk_test_x", "mode": "sandbox"})
+	if err != nil || prov == nil {
+		t.Fatalf("NewProvider error = %v", err)
+	}
+}
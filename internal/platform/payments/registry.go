@@ -0,0 +1,64 @@
+package payments
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type ProviderFactory func(config map[string]any) (Provider, error)
+
+// ErrNotRegistered is returned for a provider key no package registered.
+var ErrNotRegistered = errors.New("payment provider not registered")
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]ProviderFactory)
+)
+
+func Register(key string, factory ProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if key == "" {
+		panic("payments.Register: empty key")
+	}
+	if factory == nil {
+		panic("payments.Register: nil factory")
+	}
+	if _, exists := providers[key]; exists {
+		panic(fmt.Sprintf("payments.Register: provider '%s' already registered", key))
+	}
+	providers[key] = factory
+}
+
+func Get(key string) (ProviderFactory, error) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	factory, exists := providers[key]
+	if !exists {
+		return nil, fmt.Errorf("%w: '%s'", ErrNotRegistered, key)
+	}
+	return factory, nil
+}
+
+// FromConfig builds the registered provider key from its stored JSON
+// config, as kept in payment_providers. mode ("sandbox" or "live") is passed
+// to the factory as config["mode"].
+func FromConfig(key, mode string, configJSON []byte) (Provider, error) {
+	factory, err := Get(key)
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]any{}
+	if len(configJSON) > 0 {
+		if err := json.Unmarshal(configJSON, &config); err != nil {
+			return nil, fmt.Errorf("provider '%s' config: %w", key, err)
+		}
+	}
+	if config == nil {
+		config = map[string]any{}
+	}
+	config["mode"] = mode
+	return factory(config)
+}
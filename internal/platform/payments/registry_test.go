@@ -0,0 +1,34 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type configProvider struct{ config map[string]any }
+
+func (p *configProvider) CreateCheckout(context.Context, int, string, string) (string, error) {
+	return "", nil
+}
+
+func TestFromConfigPassesStoredConfigAndMode(t *testing.T) {
+	Register("config-test", func(config map[string]any) (Provider, error) {
+		return &configProvider{config: config}, nil
+	})
+
+	prov, err := FromConfig("config-test", "live", []byte(`{"secret_key":"sk","mode":"sandbox"}`))
+	if err != nil {
+		t.Fatalf("FromConfig error: %v", err)
+	}
+	config := prov.(*configProvider).config
+	if config["secret_key"] != "sk" || config["mode"] != "live" {
+		t.Fatalf("unexpected config %#v", config)
+	}
+	if _, err := FromConfig("config-test", "live", []byte(`not json`)); err == nil {
+		t.Fatalf("expected invalid config to fail")
+	}
+	if _, err := FromConfig("missing", "live", nil); !errors.Is(err, ErrNotRegistered) {
+		t.Fatalf("expected ErrNotRegistered, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestBytesWritesValidCrossReferenceTable(t *testing.T) {
+	d := New()
+	d.AddPage().Text(50, 50, Bold, 12, "Invoice (copy) €5")
+	d.AddPage().Line(50, 60, 200, 60)
+	out := d.Bytes()
+
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatalf("missing PDF header or trailer")
+	}
+	if !bytes.Contains(out, []byte("/Count 2")) {
+		t.Fatalf("expected two pages")
+	}
+	if !bytes.Contains(out, []byte(`(Invoice \(copy\) `+"\x80"+`5) Tj`)) {
+		t.Fatalf("text not escaped and WinAnsi-encoded: %q", out)
+	}
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(out)
+	if m == nil {
+		t.Fatalf("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(out[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref does not point at the xref table")
+	}
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n`).FindAllSubmatch(out[xref:], -1)
+	if len(offsets) != 8 {
+		t.Fatalf("expected 8 objects, got %d", len(offsets))
+	}
+	for i, o := range offsets {
+		off, _ := strconv.Atoi(string(o[1]))
+		if want := fmt.Sprintf("%d 0 obj", i+1); !bytes.HasPrefix(out[off:], []byte(want)) {
+			t.Fatalf("offset of object %d points at %q", i+1, out[off:off+10])
+		}
+	}
+}
+
+func TestTextWidthUsesFontMetrics(t *testing.T) {
+	if got := TextWidth(Regular, 10, "0"); got != 5.56 {
+		t.Fatalf("expected 5.56, got %v", got)
+	}
+	if TextWidth(Bold, 10, "abc") <= TextWidth(Regular, 10, "abc") {
+		t.Fatalf("bold text should be wider")
+	}
+}
@@ -1,6 +1,10 @@
 package shipping
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
 type Provider interface {
 	ListTerminals(ctx context.Context, country string) ([]Terminal, error)
@@ -41,3 +45,79 @@ type ShippingOption struct {
 }
 
 type ProviderFactory func(config map[string]any) (Provider, error)
+
+// LabelProvider is implemented by carriers that can register a parcel, print
+// its label and void it before pickup. Callers type-assert a Provider to find
+// out whether labels are supported.
+type LabelProvider interface {
+	CreateShipment(ctx context.Context, req ShipmentRequest) (CreatedShipment, error)
+	GetLabel(ctx context.Context, shipmentRef string) (Label, error)
+	CancelShipment(ctx context.Context, shipmentRef string) error
+}
+
+// ShipmentRequest describes a parcel to register with the carrier. Reference
+// is the shop's own reference, usually the order number.
+type ShipmentRequest struct {
+	Reference   string
+	ServiceCode string
+	TerminalID  string
+	Recipient   Address
+	Parcels     int
+	WeightKg    float64
+}
+
+type Address struct {
+	Name     string
+	Phone    string
+	Email    string
+	Street   string
+	City     string
+	Postcode string
+	Country  string
+}
+
+// CreatedShipment is the carrier's view of a registered parcel. Ref is what
+// GetLabel and CancelShipment expect.
+type CreatedShipment struct {
+	Ref            string
+	TrackingNumber string
+	TrackingURL    string
+}
+
+type Label struct {
+	ContentType string
+	Data        []byte
+}
+
+// ErrTrackingUnsupported is returned by a Tracker that cannot track parcels
+// in its current configuration.
+var ErrTrackingUnsupported = errors.New("shipping: tracking not supported")
+
+// Tracker is implemented by carriers that report parcel progress.
+type Tracker interface {
+	TrackShipment(ctx context.Context, req TrackingRequest) ([]TrackingEvent, error)
+}
+
+// TrackingRequest identifies a parcel by its tracking number. ShippedAt
+// narrows the search for carriers that need a date range.
+type TrackingRequest struct {
+	TrackingNumber string
+	ShippedAt      time.Time
+}
+
+const (
+	TrackingStatusRegistered     = "registered"
+	TrackingStatusInTransit      = "in_transit"
+	TrackingStatusOutForDelivery = "out_for_delivery"
+	TrackingStatusDelivered      = "delivered"
+	TrackingStatusException      = "exception"
+)
+
+// TrackingEvent is one scan in the carrier's timeline, oldest first. Status
+// is one of the TrackingStatus constants; Description is the carrier's text.
+type TrackingEvent struct {
+	Status      string
+	Description string
+	Location    string
+	OccurredAt  time.Time
+}
@@ -0,0 +1,156 @@
+package omniva
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"goecommerce/internal/platform/shipping"
+)
+
+const trackingURLPrefix = "https://www.omniva.lt/track?barcode="
+
+type shipmentRequest struct {
+	Reference  string          `json:"reference"`
+	Service    string          `json:"service"`
+	TerminalID string          `json:"terminal_id,omitempty"`
+	Parcels    int             `json:"parcels"`
+	WeightKg   float64         `json:"weight_kg,omitempty"`
+	Receiver   receiverRequest `json:"receiver"`
+}
+
+type receiverRequest struct {
+	Name     string `json:"name"`
+	Phone    string `json:"phone,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Street   string `json:"street,omitempty"`
+	City     string `json:"city,omitempty"`
+	Postcode string `json:"postcode,omitempty"`
+	Country  string `json:"country"`
+}
+
+type shipmentResponse struct {
+	ID      string `json:"id"`
+	Barcode string `json:"barcode"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// CreateShipment registers a parcel with the Omniva API at base_url and
+// returns its barcode as the tracking number. Parcel lockers need a terminal,
+// every other service a street address.
+func (p *omnivaProvider) CreateShipment(ctx context.Context, req shipping.ShipmentRequest) (shipping.CreatedShipment, error) {
+	if strings.TrimSpace(req.Reference) == "" {
+		return shipping.CreatedShipment{}, errors.New("omniva: reference is required")
+	}
+	if strings.TrimSpace(req.Recipient.Name) == "" || strings.TrimSpace(req.Recipient.Country) == "" {
+		return shipping.CreatedShipment{}, errors.New("omniva: recipient name and country are required")
+	}
+	service := req.ServiceCode
+	if service == "" {
+		service = "parcel-locker"
+	}
+	if service == "parcel-locker" && req.TerminalID == "" {
+		return shipping.CreatedShipment{}, errors.New("omniva: terminal is required for parcel-locker")
+	}
+	if service != "parcel-locker" && req.Recipient.Street == "" {
+		return shipping.CreatedShipment{}, errors.New("omniva: recipient street is required")
+	}
+	parcels := req.Parcels
+	if parcels <= 0 {
+		parcels = 1
+	}
+	payload, err := json.Marshal(shipmentRequest{
+		Reference:  req.Reference,
+		Service:    service,
+		TerminalID: req.TerminalID,
+		Parcels:    parcels,
+		WeightKg:   req.WeightKg,
+		Receiver: receiverRequest{
+			Name:     req.Recipient.Name,
+			Phone:    req.Recipient.Phone,
+			Email:    req.Recipient.Email,
+			Street:   req.Recipient.Street,
+			City:     req.Recipient.City,
+			Postcode: req.Recipient.Postcode,
+			Country:  req.Recipient.Country,
+		},
+	})
+	if err != nil {
+		return shipping.CreatedShipment{}, err
+	}
+	res, err := p.do(ctx, http.MethodPost, "/shipments", bytes.NewReader(payload))
+	if err != nil {
+		return shipping.CreatedShipment{}, err
+	}
+	var created shipmentResponse
+	if err := json.Unmarshal(res, &created); err != nil {
+		return shipping.CreatedShipment{}, fmt.Errorf("omniva: invalid response: %w", err)
+	}
+	if created.ID == "" || created.Barcode == "" {
+		return shipping.CreatedShipment{}, errors.New("omniva: response missing shipment id or barcode")
+	}
+	return shipping.CreatedShipment{
+		Ref:            created.ID,
+		TrackingNumber: created.Barcode,
+		TrackingURL:    trackingURLPrefix + url.QueryEscape(created.Barcode),
+	}, nil
+}
+
+func (p *omnivaProvider) GetLabel(ctx context.Context, shipmentRef string) (shipping.Label, error) {
+	if shipmentRef == "" {
+		return shipping.Label{}, errors.New("omniva: shipment reference is required")
+	}
+	data, err := p.do(ctx, http.MethodGet, "/shipments/"+url.PathEscape(shipmentRef)+"/label", nil)
+	if err != nil {
+		return shipping.Label{}, err
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		return shipping.Label{}, errors.New("omniva: label is not a PDF")
+	}
+	return shipping.Label{ContentType: "application/pdf", Data: data}, nil
+}
+
+func (p *omnivaProvider) CancelShipment(ctx context.Context, shipmentRef string) error {
+	if shipmentRef == "" {
+		return errors.New("omniva: shipment reference is required")
+	}
+	_, err := p.do(ctx, http.MethodDelete, "/shipments/"+url.PathEscape(shipmentRef), nil)
+	return err
+}
+
+func (p *omnivaProvider) do(ctx context.Context, method, path string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(p.username, p.password)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("omniva: %w", err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(res.Body, 10<<20))
+	if err != nil {
+		return nil, fmt.Errorf("omniva: %w", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		var apiErr errorResponse
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("omniva: %s", apiErr.Error)
+		}
+		return nil, fmt.Errorf("omniva: unexpected status %d", res.StatusCode)
+	}
+	return data, nil
+}
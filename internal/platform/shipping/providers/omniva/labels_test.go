@@ -0,0 +1,149 @@
+package omniva
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"goecommerce/internal/platform/shipping"
+)
+
+func newFakeCarrier(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if user, pass, ok := r.BasicAuth(); !ok || user != "shop" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid credentials"}`))
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/shipments":
+			var body shipmentRequest
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if body.Reference != "ORD-1" || body.Service != "parcel-locker" || body.TerminalID != "omniva_lt_001" || body.Parcels != 1 {
+				t.Fatalf("unexpected shipment request %+v", body)
+			}
+			if body.Receiver.Name != "Jonas Jonaitis" || body.Receiver.Country != "LT" {
+				t.Fatalf("unexpected receiver %+v", body.Receiver)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":"shp_1","barcode":"CE123456789EE"}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/api/shipments/shp_1/label":
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write([]byte("%PDF-1.4 fake label"))
+		case r.Method == http.MethodDelete && r.URL.Path == "/api/shipments/shp_1":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodDelete && r.URL.Path == "/api/shipments/shp_picked":
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`{"error":"shipment already picked up"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"not found"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func newLabelProvider(t *testing.T, baseURL, password string) shipping.LabelProvider {
+	t.Helper()
+	prov, err := NewProvider(map[string]any{"username": "shop", "password": password, "base_url": baseURL + "/api/"})
+	if err != nil {
+		t.Fatalf("NewProvider error: %v", err)
+	}
+	lp, ok := prov.(shipping.LabelProvider)
+	if !ok {
+		t.Fatalf("omniva provider does not implement LabelProvider")
+	}
+	return lp
+}
+
+func TestCreateShipmentLabelAndCancelAgainstFakeCarrier(t *testing.T) {
+	srv, calls := newFakeCarrier(t)
+	lp := newLabelProvider(t, srv.URL, "secret")
+	ctx := context.Background()
+
+	created, err := lp.CreateShipment(ctx, shipping.ShipmentRequest{
+		Reference:   "ORD-1",
+		ServiceCode: "parcel-locker",
+		TerminalID:  "omniva_lt_001",
+		Recipient:   shipping.Address{Name: "Jonas Jonaitis", Phone: "+37060000000", Country: "LT"},
+	})
+	if err != nil {
+		t.Fatalf("CreateShipment error: %v", err)
+	}
+	if created.Ref != "shp_1" || created.TrackingNumber != "CE123456789EE" {
+		t.Fatalf("unexpected shipment %+v", created)
+	}
+	if !strings.HasSuffix(created.TrackingURL, "CE123456789EE") {
+		t.Fatalf("unexpected tracking url %s", created.TrackingURL)
+	}
+
+	label, err := lp.GetLabel(ctx, created.Ref)
+	if err != nil {
+		t.Fatalf("GetLabel error: %v", err)
+	}
+	if label.ContentType != "application/pdf" || !strings.HasPrefix(string(label.Data), "%PDF") {
+		t.Fatalf("unexpected label %s %q", label.ContentType, label.Data)
+	}
+
+	if err := lp.CancelShipment(ctx, created.Ref); err != nil {
+		t.Fatalf("CancelShipment error: %v", err)
+	}
+	want := []string{"POST /api/shipments", "GET /api/shipments/shp_1/label", "DELETE /api/shipments/shp_1"}
+	if strings.Join(*calls, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected calls %v", *calls)
+	}
+}
+
+func TestCarrierErrorsAreReported(t *testing.T) {
+	srv, _ := newFakeCarrier(t)
+	ctx := context.Background()
+
+	_, err := newLabelProvider(t, srv.URL, "wrong").CreateShipment(ctx, shipping.ShipmentRequest{
+		Reference:  "ORD-1",
+		TerminalID: "omniva_lt_001",
+		Recipient:  shipping.Address{Name: "Jonas Jonaitis", Country: "LT"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid credentials") {
+		t.Fatalf("expected auth error, got %v", err)
+	}
+
+	lp := newLabelProvider(t, srv.URL, "secret")
+	if err := lp.CancelShipment(ctx, "shp_picked"); err == nil || !strings.Contains(err.Error(), "already picked up") {
+		t.Fatalf("expected cancel error, got %v", err)
+	}
+	if _, err := lp.GetLabel(ctx, "shp_missing"); err == nil {
+		t.Fatalf("expected error for unknown label")
+	}
+}
+
+func TestCreateShipmentValidatesBeforeCallingCarrier(t *testing.T) {
+	srv, calls := newFakeCarrier(t)
+	lp := newLabelProvider(t, srv.URL, "secret")
+	ctx := context.Background()
+
+	if _, err := lp.CreateShipment(ctx, shipping.ShipmentRequest{
+		Reference: "ORD-1",
+		Recipient: shipping.Address{Name: "Jonas Jonaitis", Country: "LT"},
+	}); err == nil {
+		t.Fatalf("expected error for parcel locker without terminal")
+	}
+	if _, err := lp.CreateShipment(ctx, shipping.ShipmentRequest{
+		Reference:   "ORD-1",
+		ServiceCode: "home-delivery",
+		Recipient:   shipping.Address{Name: "Jonas Jonaitis", Country: "LT"},
+	}); err == nil {
+		t.Fatalf("expected error for home delivery without street")
+	}
+	if len(*calls) != 0 {
+		t.Fatalf("carrier should not be called, got %v", *calls)
+	}
+}
@@ -3,6 +3,9 @@ package omniva
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	"goecommerce/internal/platform/shipping"
 )
@@ -12,6 +15,7 @@ type omnivaProvider struct {
 	password string
 	baseURL  string
 	mode     string
+	client   *http.Client
 }
 
 func NewProvider(config map[string]any) (shipping.Provider, error) {
@@ -35,8 +39,9 @@ func NewProvider(config map[string]any) (shipping.Provider, error) {
 	prov := &omnivaProvider{
 		username: username,
 		password: password,
-		baseURL:  baseURL,
+		baseURL:  strings.TrimRight(baseURL, "/"),
 		mode:     mode,
+		client:   &http.Client{Timeout: 15 * time.Second},
 	}
 
 	return prov, nil
@@ -0,0 +1,56 @@
+package omniva
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"goecommerce/internal/platform/shipping"
+)
+
+// mockTimeline is the simulated journey of a sandbox parcel: each step is
+// reported once its offset from the shipping time has passed.
+var mockTimeline = []struct {
+	after       time.Duration
+	status      string
+	description string
+	location    string
+}{
+	{0, shipping.TrackingStatusRegistered, "Shipment data received", "Omniva"},
+	{6 * time.Hour, shipping.TrackingStatusInTransit, "Parcel accepted at sorting centre", "Vilnius sorting centre"},
+	{20 * time.Hour, shipping.TrackingStatusOutForDelivery, "Parcel on its way to the parcel terminal", "Vilnius"},
+	{26 * time.Hour, shipping.TrackingStatusDelivered, "Parcel delivered", "Parcel terminal"},
+}
+
+// TrackShipment returns a simulated timeline in sandbox mode, where parcels
+// are delivered 26 hours after they were shipped. There is no tracking API
+// client yet, so other modes report shipping.ErrTrackingUnsupported rather
+// than completing orders that were never delivered.
+func (p *omnivaProvider) TrackShipment(ctx context.Context, req shipping.TrackingRequest) ([]shipping.TrackingEvent, error) {
+	if p.mode != "sandbox" {
+		return nil, fmt.Errorf("omniva: %w in %s mode", shipping.ErrTrackingUnsupported, p.mode)
+	}
+	if strings.TrimSpace(req.TrackingNumber) == "" {
+		return nil, errors.New("omniva: tracking number is required")
+	}
+	if req.ShippedAt.IsZero() {
+		return nil, errors.New("omniva: shipped time is required")
+	}
+	now := time.Now()
+	var events []shipping.TrackingEvent
+	for _, step := range mockTimeline {
+		at := req.ShippedAt.Add(step.after)
+		if at.After(now) {
+			break
+		}
+		events = append(events, shipping.TrackingEvent{
+			Status:      step.status,
+			Description: step.description,
+			Location:    step.location,
+			OccurredAt:  at,
+		})
+	}
+	return events, nil
+}
@@ -0,0 +1,64 @@
+package omniva
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"goecommerce/internal/platform/shipping"
+)
+
+func TestTrackShipmentMockTimeline(t *testing.T) {
+	prov, err := NewProvider(map[string]any{})
+	if err != nil {
+		t.Fatalf("NewProvider error: %v", err)
+	}
+	tracker, ok := prov.(shipping.Tracker)
+	if !ok {
+		t.Fatalf("omniva provider does not implement Tracker")
+	}
+	ctx := context.Background()
+
+	events, err := tracker.TrackShipment(ctx, shipping.TrackingRequest{TrackingNumber: "CE1EE", ShippedAt: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("TrackShipment error: %v", err)
+	}
+	if len(events) != 1 || events[0].Status != shipping.TrackingStatusRegistered {
+		t.Fatalf("expected only the registration event, got %+v", events)
+	}
+
+	shippedAt := time.Now().Add(-48 * time.Hour)
+	events, err = tracker.TrackShipment(ctx, shipping.TrackingRequest{TrackingNumber: "CE1EE", ShippedAt: shippedAt})
+	if err != nil {
+		t.Fatalf("TrackShipment error: %v", err)
+	}
+	if len(events) != 4 || events[3].Status != shipping.TrackingStatusDelivered {
+		t.Fatalf("expected delivered timeline, got %+v", events)
+	}
+	for i := 1; i < len(events); i++ {
+		if !events[i].OccurredAt.After(events[i-1].OccurredAt) {
+			t.Fatalf("events are not in order: %+v", events)
+		}
+	}
+	if !events[0].OccurredAt.Equal(shippedAt) {
+		t.Fatalf("timeline should start at the shipping time, got %s", events[0].OccurredAt)
+	}
+
+	if _, err := tracker.TrackShipment(ctx, shipping.TrackingRequest{ShippedAt: shippedAt}); err == nil {
+		t.Fatalf("expected error for missing tracking number")
+	}
+}
+
+func TestTrackShipmentUnsupportedOutsideSandbox(t *testing.T) {
+	prov, err := NewProvider(map[string]any{"mode": "live"})
+	if err != nil {
+		t.Fatalf("NewProvider error: %v", err)
+	}
+	events, err := prov.(shipping.Tracker).TrackShipment(context.Background(), shipping.TrackingRequest{
+		TrackingNumber: "CE1EE", ShippedAt: time.Now().Add(-48 * time.Hour),
+	})
+	if !errors.Is(err, shipping.ErrTrackingUnsupported) || len(events) != 0 {
+		t.Fatalf("expected ErrTrackingUnsupported in live mode, got %+v, %v", events, err)
+	}
+}
@@ -0,0 +1,254 @@
+// Package tax calculates VAT for carts and orders. It is pure: rates are
+// loaded by the caller and passed in, so the same calculation runs for cart
+// totals and at checkout.
+package tax
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Tax classes seeded by the migrations. Products default to ClassStandard and
+// variants may override the product class.
+const (
+	ClassStandard = "standard"
+	ClassReduced  = "reduced"
+	ClassZero     = "zero"
+)
+
+// Rates maps a tax class to its rate in basis points (2100 = 21%) for one
+// country.
+type Rates map[string]int
+
+// Rate returns the rate for class. Classes without a configured rate fall
+// back to the standard rate, except ClassZero which is always 0.
+func (r Rates) Rate(class string) int {
+	if class == ClassZero {
+		return 0
+	}
+	if bps, ok := r[class]; ok {
+		return bps
+	}
+	return r[ClassStandard]
+}
+
+// Config is the shop-wide tax setup.
+type Config struct {
+	// ShopCountry is the ISO 3166-1 alpha-2 country the shop is registered in.
+	ShopCountry string
+	// PricesIncludeTax means catalog prices are gross and tax is extracted
+	// from them; otherwise tax is added on top of catalog prices.
+	PricesIncludeTax bool
+}
+
+// ConfigFromEnv reads TAX_SHOP_COUNTRY (default LT) and
+// TAX_PRICES_INCLUDE_TAX (default true).
+func ConfigFromEnv() Config {
+	cfg := Config{ShopCountry: "LT", PricesIncludeTax: true}
+	if v := strings.ToUpper(strings.TrimSpace(os.Getenv("TAX_SHOP_COUNTRY"))); v != "" {
+		cfg.ShopCountry = v
+	}
+	if v := strings.TrimSpace(os.Getenv("TAX_PRICES_INCLUDE_TAX")); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.PricesIncludeTax = b
+		}
+	}
+	return cfg
+}
+
+var euCountries = map[string]bool{
+	"AT": true, "BE": true, "BG": true, "CY": true, "CZ": true, "DE": true, "DK": true,
+	"EE": true, "ES": true, "FI": true, "FR": true, "GR": true, "HR": true, "HU": true,
+	"IE": true, "IT": true, "LT": true, "LU": true, "LV": true, "MT": true, "NL": true,
+	"PL": true, "PT": true, "RO": true, "SE": true, "SI": true, "SK": true,
+}
+
+// IsEU reports whether country is an EU member state.
+func IsEU(country string) bool {
+	return euCountries[strings.ToUpper(strings.TrimSpace(country))]
+}
+
+// vatNumberFormats are the VIES formats of EU VAT numbers after the country
+// prefix. Greece uses the prefix EL.
+var vatNumberFormats = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^U[0-9]{8}$`),
+	"BE": regexp.MustCompile(`^[01][0-9]{9}$`),
+	"BG": regexp.MustCompile(`^[0-9]{9,10}$`),
+	"CY": regexp.MustCompile(`^[0-9]{8}[A-Z]$`),
+	"CZ": regexp.MustCompile(`^[0-9]{8,10}$`),
+	"DE": regexp.MustCompile(`^[0-9]{9}$`),
+	"DK": regexp.MustCompile(`^[0-9]{8}$`),
+	"EE": regexp.MustCompile(`^[0-9]{9}$`),
+	"EL": regexp.MustCompile(`^[0-9]{9}$`),
+	"ES": regexp.MustCompile(`^[0-9A-Z][0-9]{7}[0-9A-Z]$`),
+	"FI": regexp.MustCompile(`^[0-9]{8}$`),
+	"FR": regexp.MustCompile(`^[0-9A-HJ-NP-Z]{2}[0-9]{9}$`),
+	"HR": regexp.MustCompile(`^[0-9]{11}$`),
+	"HU": regexp.MustCompile(`^[0-9]{8}$`),
+	"IE": regexp.MustCompile(`^([0-9]{7}[A-W][A-I]?|[0-9][A-Z+*][0-9]{5}[A-W])$`),
+	"IT": regexp.MustCompile(`^[0-9]{11}$`),
+	"LT": regexp.MustCompile(`^([0-9]{9}|[0-9]{12})$`),
+	"LU": regexp.MustCompile(`^[0-9]{8}$`),
+	"LV": regexp.MustCompile(`^[0-9]{11}$`),
+	"MT": regexp.MustCompile(`^[0-9]{8}$`),
+	"NL": regexp.MustCompile(`^[0-9]{9}B[0-9]{2}$`),
+	"PL": regexp.MustCompile(`^[0-9]{10}$`),
+	"PT": regexp.MustCompile(`^[0-9]{9}$`),
+	"RO": regexp.MustCompile(`^[0-9]{2,10}$`),
+	"SE": regexp.MustCompile(`^[0-9]{12}$`),
+	"SI": regexp.MustCompile(`^[0-9]{8}$`),
+	"SK": regexp.MustCompile(`^[0-9]{10}$`),
+}
+
+// NormalizeVATNumber uppercases a VAT number and drops the spaces, dots and
+// dashes it is often written with.
+func NormalizeVATNumber(vat string) string {
+	return strings.NewReplacer(" ", "", ".", "", "-", "").Replace(strings.ToUpper(strings.TrimSpace(vat)))
+}
+
+// VATNumberCountry returns the EU country a VAT number is registered in, or
+// "" when the number does not have the format of that country's numbers.
+// It does not check that the number is actually registered.
+func VATNumberCountry(vat string) string {
+	vat = NormalizeVATNumber(vat)
+	if len(vat) < 3 {
+		return ""
+	}
+	prefix, number := vat[:2], vat[2:]
+	format, ok := vatNumberFormats[prefix]
+	if !ok || !format.MatchString(number) {
+		return ""
+	}
+	if prefix == "EL" {
+		return "GR"
+	}
+	return prefix
+}
+
+// ReverseChargeApplies reports whether a B2B sale to country is reverse
+// charged: the buyer has a well-formed VAT number of that country, which is
+// an EU member state other than the shop's.
+func ReverseChargeApplies(shopCountry, country, customerVAT string) bool {
+	shopCountry = strings.ToUpper(strings.TrimSpace(shopCountry))
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if country == "" || country == shopCountry || VATNumberCountry(customerVAT) != country {
+		return false
+	}
+	return IsEU(shopCountry) && IsEU(country)
+}
+
+// Line is one priced cart or order line. AmountCents is unit price times
+// quantity as stored in the catalog, so it is gross when prices include tax.
+type Line struct {
+	TaxClass    string
+	AmountCents int
+}
+
+type Request struct {
+	Config Config
+	// Country is the destination country; empty means the shop country.
+	Country       string
+	CustomerVAT   string
+	Lines         []Line
+	ShippingCents int
+}
+
+// LineResult is the tax breakdown of one line. GrossCents is what the
+// customer pays for the line.
+type LineResult struct {
+	TaxClass   string `json:"tax_class"`
+	RateBps    int    `json:"tax_rate_bps"`
+	NetCents   int    `json:"net_cents"`
+	TaxCents   int    `json:"tax_cents"`
+	GrossCents int    `json:"gross_cents"`
+}
+
+// Result is the outcome of Calculate. SubtotalCents and ShippingCents are the
+// amounts charged for goods and shipping; they include tax when
+// PricesIncludeTax is set and exclude it otherwise. TotalCents is always what
+// the customer pays.
+type Result struct {
+	Country          string       `json:"country"`
+	PricesIncludeTax bool         `json:"prices_include_tax"`
+	ReverseCharge    bool         `json:"reverse_charge"`
+	Lines            []LineResult `json:"lines"`
+	Shipping         LineResult   `json:"shipping"`
+	SubtotalCents    int          `json:"subtotal_cents"`
+	ShippingCents    int          `json:"shipping_cents"`
+	TaxCents         int          `json:"tax_cents"`
+	TotalCents       int          `json:"total_cents"`
+}
+
+// Calculate applies rates (the destination country's rates) to the request.
+// Tax is rounded half up per line. Shipping is taxed at the standard rate.
+// Under reverse charge no tax is charged and tax-inclusive prices are reduced
+// to their net amount.
+func Calculate(req Request, rates Rates) Result {
+	country := strings.ToUpper(strings.TrimSpace(req.Country))
+	if country == "" {
+		country = strings.ToUpper(strings.TrimSpace(req.Config.ShopCountry))
+	}
+	out := Result{
+		Country:          country,
+		PricesIncludeTax: req.Config.PricesIncludeTax,
+		ReverseCharge:    ReverseChargeApplies(req.Config.ShopCountry, country, req.CustomerVAT),
+		Lines:            make([]LineResult, 0, len(req.Lines)),
+	}
+	for _, l := range req.Lines {
+		class := strings.TrimSpace(l.TaxClass)
+		if class == "" {
+			class = ClassStandard
+		}
+		lr := calculateLine(class, l.AmountCents, rates.Rate(class), req.Config.PricesIncludeTax, out.ReverseCharge)
+		out.Lines = append(out.Lines, lr)
+		out.TaxCents += lr.TaxCents
+		out.TotalCents += lr.GrossCents
+		if req.Config.PricesIncludeTax && !out.ReverseCharge {
+			out.SubtotalCents += lr.GrossCents
+		} else {
+			out.SubtotalCents += lr.NetCents
+		}
+	}
+	out.Shipping = calculateLine(ClassStandard, req.ShippingCents, rates.Rate(ClassStandard), req.Config.PricesIncludeTax, out.ReverseCharge)
+	out.TaxCents += out.Shipping.TaxCents
+	out.TotalCents += out.Shipping.GrossCents
+	if req.Config.PricesIncludeTax && !out.ReverseCharge {
+		out.ShippingCents = out.Shipping.GrossCents
+	} else {
+		out.ShippingCents = out.Shipping.NetCents
+	}
+	return out
+}
+
+// CalculateLine taxes a single line at a known rate, as Calculate does for
+// each of its lines. It is used to re-price lines of an existing order.
+func CalculateLine(class string, amountCents, rateBps int, pricesIncludeTax, reverseCharge bool) LineResult {
+	return calculateLine(class, amountCents, rateBps, pricesIncludeTax, reverseCharge)
+}
+
+func calculateLine(class string, amount, rate int, inclusive, reverseCharge bool) LineResult {
+	lr := LineResult{TaxClass: class, RateBps: rate}
+	if inclusive {
+		lr.NetCents = divRound(amount*10000, 10000+rate)
+		lr.TaxCents = amount - lr.NetCents
+	} else {
+		lr.NetCents = amount
+		lr.TaxCents = divRound(amount*rate, 10000)
+	}
+	if reverseCharge {
+		lr.RateBps = 0
+		lr.TaxCents = 0
+	}
+	lr.GrossCents = lr.NetCents + lr.TaxCents
+	return lr
+}
+
+// divRound divides non-negative a by positive b, rounding half up.
+func divRound(a, b int) int {
+	if a <= 0 {
+		return 0
+	}
+	return (2*a + b) / (2 * b)
+}
@@ -0,0 +1,117 @@
+package tax
+
+import "testing"
+
+var ltRates = Rates{ClassStandard: 2100, ClassReduced: 900}
+
+func TestCalculateInclusive(t *testing.T) {
+	res := Calculate(Request{
+		Config:        Config{ShopCountry: "LT", PricesIncludeTax: true},
+		Lines:         []Line{{TaxClass: ClassStandard, AmountCents: 1210}, {TaxClass: ClassReduced, AmountCents: 1090}, {TaxClass: ClassZero, AmountCents: 500}},
+		ShippingCents: 363,
+	}, ltRates)
+
+	if res.Country != "LT" || res.ReverseCharge {
+		t.Fatalf("unexpected country/reverse charge: %+v", res)
+	}
+	want := []LineResult{
+		{TaxClass: ClassStandard, RateBps: 2100, NetCents: 1000, TaxCents: 210, GrossCents: 1210},
+		{TaxClass: ClassReduced, RateBps: 900, NetCents: 1000, TaxCents: 90, GrossCents: 1090},
+		{TaxClass: ClassZero, RateBps: 0, NetCents: 500, TaxCents: 0, GrossCents: 500},
+	}
+	for i, w := range want {
+		if res.Lines[i] != w {
+			t.Fatalf("line %d = %+v, want %+v", i, res.Lines[i], w)
+		}
+	}
+	if res.Shipping.TaxCents != 63 {
+		t.Fatalf("shipping tax = %d, want 63", res.Shipping.TaxCents)
+	}
+	if res.SubtotalCents != 2800 || res.ShippingCents != 363 || res.TaxCents != 363 || res.TotalCents != 3163 {
+		t.Fatalf("unexpected totals: %+v", res)
+	}
+}
+
+func TestCalculateExclusive(t *testing.T) {
+	res := Calculate(Request{
+		Config:        Config{ShopCountry: "LT", PricesIncludeTax: false},
+		Lines:         []Line{{TaxClass: "", AmountCents: 999}},
+		ShippingCents: 100,
+	}, ltRates)
+
+	// 999 * 21% = 209.79 rounds to 210.
+	if res.Lines[0].TaxClass != ClassStandard || res.Lines[0].TaxCents != 210 {
+		t.Fatalf("unexpected line: %+v", res.Lines[0])
+	}
+	if res.SubtotalCents != 999 || res.ShippingCents != 100 || res.TaxCents != 231 || res.TotalCents != 1330 {
+		t.Fatalf("unexpected totals: %+v", res)
+	}
+}
+
+func TestCalculateUnknownClassUsesStandardRate(t *testing.T) {
+	res := Calculate(Request{
+		Config: Config{ShopCountry: "LT"},
+		Lines:  []Line{{TaxClass: "books", AmountCents: 1000}},
+	}, ltRates)
+	if res.Lines[0].RateBps != 2100 || res.Lines[0].TaxCents != 210 {
+		t.Fatalf("unexpected line: %+v", res.Lines[0])
+	}
+}
+
+func TestCalculateReverseCharge(t *testing.T) {
+	deRates := Rates{ClassStandard: 1900, ClassReduced: 700}
+	req := Request{
+		Config:        Config{ShopCountry: "LT", PricesIncludeTax: true},
+		Country:       "de",
+		CustomerVAT:   "DE123456789",
+		Lines:         []Line{{TaxClass: ClassStandard, AmountCents: 1190}},
+		ShippingCents: 595,
+	}
+	res := Calculate(req, deRates)
+	if !res.ReverseCharge || res.Country != "DE" {
+		t.Fatalf("expected reverse charge to DE: %+v", res)
+	}
+	if res.TaxCents != 0 || res.SubtotalCents != 1000 || res.ShippingCents != 500 || res.TotalCents != 1500 {
+		t.Fatalf("unexpected totals: %+v", res)
+	}
+	if res.Lines[0].RateBps != 0 || res.Lines[0].GrossCents != 1000 {
+		t.Fatalf("unexpected line: %+v", res.Lines[0])
+	}
+
+	req.Config.PricesIncludeTax = false
+	res = Calculate(req, deRates)
+	if res.TaxCents != 0 || res.TotalCents != 1785 {
+		t.Fatalf("unexpected exclusive reverse charge totals: %+v", res)
+	}
+}
+
+func TestReverseChargeApplies(t *testing.T) {
+	cases := []struct {
+		shop, country, vat string
+		want               bool
+	}{
+		{"LT", "DE", "DE123456789", true},
+		{"LT", "GR", "el 123.456.789", true},
+		{"LT", "LT", "LT123456789", false},
+		{"LT", "DE", "", false},
+		{"LT", "DE", "x", false},
+		{"LT", "DE", "DE123", false},
+		{"LT", "DE", "FR12345678901", false},
+		{"LT", "US", "123", false},
+		{"LT", "", "DE123456789", false},
+	}
+	for _, c := range cases {
+		if got := ReverseChargeApplies(c.shop, c.country, c.vat); got != c.want {
+			t.Fatalf("ReverseChargeApplies(%q, %q, %q) = %v, want %v", c.shop, c.country, c.vat, got, c.want)
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("TAX_SHOP_COUNTRY", "lv")
+	t.Setenv("TAX_PRICES_INCLUDE_TAX", "false")
+	cfg := ConfigFromEnv()
+	if cfg.ShopCountry != "LV" || cfg.PricesIncludeTax {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+}
@@ -0,0 +1,72 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriterProducesReadableWorkbook(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "Orders & co")
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	if err := w.WriteRow("Number", "Total"); err != nil {
+		t.Fatalf("write row: %v", err)
+	}
+	if err := w.WriteRow("ORD-<1>", 12.5, nil, 3, "bell\x07"); err != nil {
+		t.Fatalf("write row: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	parts := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		body, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		if err := xml.Unmarshal(body, new(struct{})); err != nil {
+			t.Fatalf("%s is not well-formed XML: %v", f.Name, err)
+		}
+		parts[f.Name] = string(body)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Fatalf("missing part %s", name)
+		}
+	}
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<c r="A2" t="inlineStr"><is><t xml:space="preserve">ORD-&lt;1&gt;</t></is></c>`,
+		`<c r="B2"><v>12.5</v></c>`,
+		`<c r="D2"><v>3</v></c>`,
+		`<t xml:space="preserve">bell</t>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Fatalf("sheet missing %s:\n%s", want, sheet)
+		}
+	}
+	if !strings.Contains(parts["xl/workbook.xml"], `name="Orders &amp; co"`) {
+		t.Fatalf("sheet name not escaped: %s", parts["xl/workbook.xml"])
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(i); got != want {
+			t.Fatalf("column %d: expected %s, got %s", i, want, got)
+		}
+	}
+}
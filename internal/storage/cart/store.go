@@ -12,6 +12,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"goecommerce/internal/platform/tax"
 )
 
 var ErrInvalidCustomOptions = errors.New("invalid custom options")
@@ -35,6 +37,7 @@ type CartItem struct {
 	ProductTitle     string
 	ImageURL         string
 	CustomOptions    []CartItemCustomOption
+	TaxClass         string
 	CreatedAt        time.Time
 	UpdatedAt        time.Time
 }
@@ -59,10 +62,25 @@ type AddItemCustomOptionInput struct {
 	ValueText string   `json:"value_text"`
 }
 
+// Totals are the cart amounts. TaxCents and TotalCents are filled in by the
+// cart module from the tax engine; the store sets TotalCents to the subtotal.
 type Totals struct {
-	SubtotalCents int
-	Currency      string
-	ItemCount     int
+	SubtotalCents    int
+	TaxCents         int
+	TotalCents       int
+	TaxCountry       string
+	PricesIncludeTax bool
+	Currency         string
+	ItemCount        int
+}
+
+// TaxLines returns the cart lines in the form the tax engine expects.
+func (c Cart) TaxLines() []tax.Line {
+	lines := make([]tax.Line, 0, len(c.Items))
+	for _, it := range c.Items {
+		lines = append(lines, tax.Line{TaxClass: it.TaxClass, AmountCents: it.UnitPriceCents * it.Quantity})
+	}
+	return lines
 }
 
 type Store struct {
@@ -102,6 +120,7 @@ func NewStore(ctx context.Context, db *sql.DB) (*Store, error) {
 			p.title,
 			COALESCE(img.url, '/images/noImage.png'),
 			ci.custom_options_json,
+			COALESCE(pv.tax_class, p.tax_class),
 			ci.created_at, ci.updated_at
 		FROM cart_items ci
 		JOIN product_variants pv ON ci.product_variant_id = pv.id
@@ -118,8 +137,15 @@ func NewStore(ctx context.Context, db *sql.DB) (*Store, error) {
 		return nil, err
 	}
 
+	// Only variants of products the storefront shows can be added.
 	stmtGetVariant, err := db.PrepareContext(ctx, `
-		SELECT product_id, price_cents, currency FROM product_variants WHERE id = $1`)
+		SELECT pv.product_id, pv.price_cents, pv.currency
+		FROM product_variants pv
+		JOIN products p ON p.id = pv.product_id
+		WHERE pv.id = $1
+		  AND p.status = 'published'
+		  AND (p.publish_at IS NULL OR p.publish_at <= now())
+		  AND (p.unpublish_at IS NULL OR p.unpublish_at > now())`)
 	if err != nil {
 		return nil, err
 	}
@@ -208,7 +234,7 @@ func (s *Store) GetCart(ctx context.Context, cartID string) (Cart, error) {
 	for rows.Next() {
 		var it CartItem
 		var customOptionsRaw []byte
-		if err := rows.Scan(&it.ID, &it.CartID, &it.ProductVariantID, &it.UnitPriceCents, &it.Currency, &it.Quantity, &it.ProductTitle, &it.ImageURL, &customOptionsRaw, &it.CreatedAt, &it.UpdatedAt); err != nil {
+		if err := rows.Scan(&it.ID, &it.CartID, &it.ProductVariantID, &it.UnitPriceCents, &it.Currency, &it.Quantity, &it.ProductTitle, &it.ImageURL, &customOptionsRaw, &it.TaxClass, &it.CreatedAt, &it.UpdatedAt); err != nil {
 			return Cart{}, err
 		}
 		if len(customOptionsRaw) > 0 {
@@ -230,7 +256,7 @@ func (s *Store) GetCart(ctx context.Context, cartID string) (Cart, error) {
 		return Cart{}, err
 	}
 	c.Items = items
-	c.Totals = Totals{SubtotalCents: subtotal, Currency: currency, ItemCount: itemCount}
+	c.Totals = Totals{SubtotalCents: subtotal, TotalCents: subtotal, Currency: currency, ItemCount: itemCount}
 	return c, nil
 }
 
@@ -3,10 +3,10 @@ package catalog
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
 )
@@ -14,6 +14,12 @@ import (
 var (
 	ErrNotFound = errors.New("catalog not found")
 	ErrConflict = errors.New("catalog conflict")
+	// ErrInvalidTaxClass is returned when a product or variant references a
+	// tax class that does not exist.
+	ErrInvalidTaxClass = errors.New("invalid tax class")
+	// ErrInvalidPublishWindow is returned when a product's unpublish_at
+	// would not be after its publish_at.
+	ErrInvalidPublishWindow = errors.New("unpublish_at must be after publish_at")
 )
 
 type CategoryUpsertInput struct {
@@ -34,6 +40,16 @@ type ProductUpsertInput struct {
 	Tags           []string
 	SEOTitle       *string
 	SEODescription *string
+	// TaxClass defaults to "standard" on create; on update "" keeps the
+	// current class.
+	TaxClass string
+	// PublishAt and UnpublishAt schedule storefront visibility of a
+	// published product. nil leaves that side open on create and unchanged
+	// on update; ClearPublishAt and ClearUnpublishAt remove it on update.
+	PublishAt        *time.Time
+	UnpublishAt      *time.Time
+	ClearPublishAt   bool
+	ClearUnpublishAt bool
 }
 
 type ProductVariantCreateInput struct {
@@ -41,6 +57,8 @@ type ProductVariantCreateInput struct {
 	PriceCents int
 	Currency   string
 	Stock      int
+	// TaxClass overrides the product's tax class when set.
+	TaxClass *string
 }
 
 type DiscountMode string
@@ -95,9 +113,26 @@ func (s *Store) CreateCategory(ctx context.Context, in CategoryUpsertInput) (Cat
 	return c, nil
 }
 
+// UpdateCategory updates a category. Setting a parent that is the category
+// itself or one of its descendants fails with ErrCategoryCycle.
 func (s *Store) UpdateCategory(ctx context.Context, id string, in CategoryUpsertInput) (Category, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Category{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if parentID := toNullString(in.ParentID); parentID.Valid {
+		// Serialises parent changes so two updates cannot form a cycle
+		// together; reads are not blocked.
+		if _, err := tx.ExecContext(ctx, "LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+			return Category{}, err
+		}
+		if err := checkCategoryParent(ctx, tx, id, parentID.String); err != nil {
+			return Category{}, err
+		}
+	}
 	var c Category
-	row := s.db.QueryRowContext(ctx, `
+	row := tx.QueryRowContext(ctx, `
 		UPDATE categories
 		SET slug = $2,
 			name = $3,
@@ -127,6 +162,9 @@ func (s *Store) UpdateCategory(ctx context.Context, id string, in CategoryUpsert
 		}
 		return Category{}, err
 	}
+	if err := tx.Commit(); err != nil {
+		return Category{}, err
+	}
 	return c, nil
 }
 
@@ -257,20 +295,18 @@ func (s *Store) DeleteCategory(ctx context.Context, id string) (DeleteCategoryRe
 
 func (s *Store) CreateProduct(ctx context.Context, in ProductUpsertInput) (Product, error) {
 	if in.Status == "" {
-		in.Status = "published"
+		in.Status = ProductStatusPublished
 	}
 	if in.Tags == nil {
 		in.Tags = []string{}
 	}
-	var (
-		p              Product
-		seoTitle       sql.NullString
-		seoDescription sql.NullString
-	)
+	if in.TaxClass == "" {
+		in.TaxClass = "standard"
+	}
 	row := s.db.QueryRowContext(ctx, `
-		INSERT INTO products (slug, title, description, status, tags, seo_title, seo_description)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id, slug, title, description, status, COALESCE(to_json(tags), '[]'::json), seo_title, seo_description, created_at, updated_at
+		INSERT INTO products AS p (slug, title, description, status, tags, seo_title, seo_description, tax_class, publish_at, unpublish_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING `+productColumns+`, COALESCE(p.preview_token, '')
 	`,
 		in.Slug,
 		in.Title,
@@ -279,27 +315,25 @@ func (s *Store) CreateProduct(ctx context.Context, in ProductUpsertInput) (Produ
 		in.Tags,
 		toNullString(in.SEOTitle),
 		toNullString(in.SEODescription),
+		in.TaxClass,
+		in.PublishAt,
+		in.UnpublishAt,
 	)
-	var tagsRaw []byte
-	if err := row.Scan(&p.ID, &p.Slug, &p.Title, &p.Description, &p.Status, &tagsRaw, &seoTitle, &seoDescription, &p.CreatedAt, &p.UpdatedAt); err != nil {
+	var previewToken string
+	p, err := scanProduct(row, &previewToken)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return Product{}, ErrInvalidTaxClass
+		}
+		if isPGErrorCode(err, "23514") {
+			return Product{}, ErrInvalidPublishWindow
+		}
 		if isUniqueViolation(err) {
 			return Product{}, ErrConflict
 		}
 		return Product{}, err
 	}
-	if len(tagsRaw) > 0 {
-		if err := json.Unmarshal(tagsRaw, &p.Tags); err != nil {
-			return Product{}, err
-		}
-	} else {
-		p.Tags = []string{}
-	}
-	if seoTitle.Valid {
-		p.SEOTitle = &seoTitle.String
-	}
-	if seoDescription.Valid {
-		p.SEODescription = &seoDescription.String
-	}
+	p.PreviewToken = previewToken
 	p.Variants = []Variant{}
 	p.Images = []Image{}
 	return p, nil
@@ -307,18 +341,13 @@ func (s *Store) CreateProduct(ctx context.Context, in ProductUpsertInput) (Produ
 
 func (s *Store) UpdateProduct(ctx context.Context, id string, in ProductUpsertInput) (Product, error) {
 	if in.Status == "" {
-		in.Status = "published"
+		in.Status = ProductStatusPublished
 	}
 	if in.Tags == nil {
 		in.Tags = []string{}
 	}
-	var (
-		p              Product
-		seoTitle       sql.NullString
-		seoDescription sql.NullString
-	)
 	row := s.db.QueryRowContext(ctx, `
-		UPDATE products
+		UPDATE products p
 		SET slug = $2,
 			title = $3,
 			description = $4,
@@ -326,9 +355,12 @@ func (s *Store) UpdateProduct(ctx context.Context, id string, in ProductUpsertIn
 			tags = $6,
 			seo_title = $7,
 			seo_description = $8,
+			tax_class = COALESCE(NULLIF($9, ''), tax_class),
+			publish_at = CASE WHEN $12 THEN NULL ELSE COALESCE($10, publish_at) END,
+			unpublish_at = CASE WHEN $13 THEN NULL ELSE COALESCE($11, unpublish_at) END,
 			updated_at = now()
-		WHERE id = $1
-		RETURNING id, slug, title, description, status, COALESCE(to_json(tags), '[]'::json), seo_title, seo_description, created_at, updated_at
+		WHERE p.id = $1
+		RETURNING `+productColumns+`, COALESCE(p.preview_token, '')
 	`,
 		id,
 		in.Slug,
@@ -338,30 +370,30 @@ func (s *Store) UpdateProduct(ctx context.Context, id string, in ProductUpsertIn
 		in.Tags,
 		toNullString(in.SEOTitle),
 		toNullString(in.SEODescription),
+		in.TaxClass,
+		in.PublishAt,
+		in.UnpublishAt,
+		in.ClearPublishAt,
+		in.ClearUnpublishAt,
 	)
-	var tagsRaw []byte
-	if err := row.Scan(&p.ID, &p.Slug, &p.Title, &p.Description, &p.Status, &tagsRaw, &seoTitle, &seoDescription, &p.CreatedAt, &p.UpdatedAt); err != nil {
+	var previewToken string
+	p, err := scanProduct(row, &previewToken)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Product{}, ErrNotFound
 		}
+		if isForeignKeyViolation(err) {
+			return Product{}, ErrInvalidTaxClass
+		}
+		if isPGErrorCode(err, "23514") {
+			return Product{}, ErrInvalidPublishWindow
+		}
 		if isUniqueViolation(err) {
 			return Product{}, ErrConflict
 		}
 		return Product{}, err
 	}
-	if len(tagsRaw) > 0 {
-		if err := json.Unmarshal(tagsRaw, &p.Tags); err != nil {
-			return Product{}, err
-		}
-	} else {
-		p.Tags = []string{}
-	}
-	if seoTitle.Valid {
-		p.SEOTitle = &seoTitle.String
-	}
-	if seoDescription.Valid {
-		p.SEODescription = &seoDescription.String
-	}
+	p.PreviewToken = previewToken
 	p.Variants = []Variant{}
 	p.Images = []Image{}
 	return p, nil
@@ -394,13 +426,17 @@ func (s *Store) CreateProductVariant(ctx context.Context, productID string, in P
 		variant       Variant
 		compareAtNull sql.NullInt64
 		attrsRaw      []byte
+		taxClass      sql.NullString
 	)
 	row := s.db.QueryRowContext(ctx, `
-		INSERT INTO product_variants (product_id, sku, price_cents, currency, stock, attributes_json)
-		VALUES ($1::uuid, $2, $3, $4, $5, '{}'::jsonb)
-		RETURNING id, sku, price_cents, compare_at_price_cents, currency, stock, attributes_json
-	`, productID, in.SKU, in.PriceCents, in.Currency, in.Stock)
-	if err := row.Scan(&variant.ID, &variant.SKU, &variant.PriceCents, &compareAtNull, &variant.Currency, &variant.Stock, &attrsRaw); err != nil {
+		INSERT INTO product_variants (product_id, sku, price_cents, currency, stock, attributes_json, tax_class)
+		VALUES ($1::uuid, $2, $3, $4, $5, '{}'::jsonb, $6)
+		RETURNING id, sku, price_cents, compare_at_price_cents, currency, stock, attributes_json, tax_class
+	`, productID, in.SKU, in.PriceCents, in.Currency, in.Stock, toNullString(in.TaxClass))
+	if err := row.Scan(&variant.ID, &variant.SKU, &variant.PriceCents, &compareAtNull, &variant.Currency, &variant.Stock, &attrsRaw, &taxClass); err != nil {
+		if isForeignKeyViolation(err) {
+			return Variant{}, ErrInvalidTaxClass
+		}
 		if isUniqueViolation(err) {
 			return Variant{}, ErrConflict
 		}
@@ -410,6 +446,9 @@ func (s *Store) CreateProductVariant(ctx context.Context, productID string, in P
 		value := int(compareAtNull.Int64)
 		variant.CompareAtPriceCents = &value
 	}
+	if taxClass.Valid {
+		variant.TaxClass = &taxClass.String
+	}
 	variant.Attributes = map[string]interface{}{}
 	return variant, nil
 }
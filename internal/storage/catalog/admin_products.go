@@ -0,0 +1,107 @@
+package catalog
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// AdminProductsParams filters the admin product list. Unlike the storefront
+// it includes drafts, inactive and scheduled products.
+type AdminProductsParams struct {
+	Pagination
+	Status string
+	// Query matches title, slug or SKU, case-insensitively.
+	Query string
+}
+
+// ListAdminProducts lists products of every status, newest first, with their
+// variants, images and preview tokens.
+func (s *Store) ListAdminProducts(ctx context.Context, in AdminProductsParams) (ProductListResult, error) {
+	page, limit, offset := sanitizePagination(in.Pagination)
+	where := `($1 = '' OR p.status = $1)
+		AND ($2 = '' OR p.title ILIKE '%' || $2 || '%' OR p.slug ILIKE '%' || $2 || '%'
+			OR EXISTS (SELECT 1 FROM product_variants pv WHERE pv.product_id = p.id AND pv.sku ILIKE '%' || $2 || '%'))`
+	status := strings.TrimSpace(in.Status)
+	query := escapeLike(strings.TrimSpace(in.Query))
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM products p WHERE "+where, status, query).Scan(&total); err != nil {
+		return ProductListResult{}, err
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+productColumns+`, COALESCE(p.preview_token, '')
+		FROM products p
+		WHERE `+where+`
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $3 OFFSET $4`, status, query, limit, offset)
+	if err != nil {
+		return ProductListResult{}, err
+	}
+	defer rows.Close()
+
+	items := make([]Product, 0, limit)
+	for rows.Next() {
+		var previewToken string
+		p, err := scanProduct(rows, &previewToken)
+		if err != nil {
+			return ProductListResult{}, err
+		}
+		p.PreviewToken = previewToken
+		items = append(items, p)
+	}
+	if err := rows.Err(); err != nil {
+		return ProductListResult{}, err
+	}
+	rows.Close()
+	for i := range items {
+		if items[i].Variants, err = s.listProductVariants(ctx, items[i].ID); err != nil {
+			return ProductListResult{}, err
+		}
+		if items[i].Images, err = s.listProductImages(ctx, items[i].ID); err != nil {
+			return ProductListResult{}, err
+		}
+	}
+	return ProductListResult{Items: items, Total: total, Page: page, Limit: limit}, nil
+}
+
+// GetAdminProduct returns a product by id whatever its status, with its
+// variants, images, custom options and preview token.
+func (s *Store) GetAdminProduct(ctx context.Context, id string) (Product, error) {
+	var previewToken string
+	p, err := scanProduct(s.db.QueryRowContext(ctx,
+		"SELECT "+productColumns+", COALESCE(p.preview_token, '') FROM products p WHERE p.id::text = $1", id,
+	), &previewToken)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Product{}, ErrNotFound
+		}
+		return Product{}, err
+	}
+	p.PreviewToken = previewToken
+	return s.loadProductDetail(ctx, p)
+}
+
+// RotateProductPreviewToken gives a product a new preview token, which
+// invalidates links shared with the previous one.
+func (s *Store) RotateProductPreviewToken(ctx context.Context, id string) (Product, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return Product{}, err
+	}
+	res, err := s.db.ExecContext(ctx, "UPDATE products SET preview_token = $2 WHERE id::text = $1", id, hex.EncodeToString(buf))
+	if err != nil {
+		return Product{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Product{}, ErrNotFound
+	}
+	return s.GetAdminProduct(ctx, id)
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
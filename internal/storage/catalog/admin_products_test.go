@@ -0,0 +1,137 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStorefrontHidesDraftAndUnscheduledProducts(t *testing.T) {
+	store, cleanup := openCatalogStoreForCustomOptionTests(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	var column *string
+	if err := store.db.QueryRowContext(ctx,
+		"SELECT column_name::text FROM information_schema.columns WHERE table_name = 'products' AND column_name = 'preview_token'",
+	).Scan(&column); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("check column: %v", err)
+	}
+	if column == nil {
+		t.Skip("products.preview_token not present; apply migrations to run this test")
+	}
+
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	suffix := now.UnixNano()
+	cases := []struct {
+		name    string
+		in      ProductUpsertInput
+		visible bool
+	}{
+		{"live", ProductUpsertInput{Status: ProductStatusPublished, PublishAt: &past}, true},
+		{"draft", ProductUpsertInput{Status: ProductStatusDraft}, false},
+		{"inactive", ProductUpsertInput{Status: ProductStatusInactive}, false},
+		{"scheduled", ProductUpsertInput{Status: ProductStatusPublished, PublishAt: &future}, false},
+		{"expired", ProductUpsertInput{Status: ProductStatusPublished, UnpublishAt: &past}, false},
+	}
+	for _, tc := range cases {
+		tc.in.Slug = fmt.Sprintf("publishing-%s-%d", tc.name, suffix)
+		tc.in.Title = "Publishing " + tc.name
+		p, err := store.CreateProduct(ctx, tc.in)
+		if err != nil {
+			t.Fatalf("%s: create product: %v", tc.name, err)
+		}
+		defer deleteProductByID(t, store.db, p.ID)
+
+		_, err = store.GetProductBySlug(ctx, p.Slug)
+		if tc.visible && err != nil {
+			t.Fatalf("%s: expected product on the storefront, got %v", tc.name, err)
+		}
+		if !tc.visible && !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("%s: expected product to be hidden, got %v", tc.name, err)
+		}
+		if _, err := store.GetProductPreview(ctx, p.Slug, "wrong"); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("%s: expected wrong preview token to be rejected, got %v", tc.name, err)
+		}
+		withToken, err := store.RotateProductPreviewToken(ctx, p.ID)
+		if err != nil || withToken.PreviewToken == "" {
+			t.Fatalf("%s: rotate preview token: %v", tc.name, err)
+		}
+		if _, err := store.GetProductPreview(ctx, p.Slug, withToken.PreviewToken); err != nil {
+			t.Fatalf("%s: expected preview to show the product, got %v", tc.name, err)
+		}
+		admin, err := store.ListAdminProducts(ctx, AdminProductsParams{Query: p.Slug})
+		if err != nil || admin.Total != 1 || admin.Items[0].PreviewToken != withToken.PreviewToken {
+			t.Fatalf("%s: expected admin list to include the product, got %+v err=%v", tc.name, admin, err)
+		}
+	}
+}
+
+func TestUpdateProductKeepsOmittedTaxClassAndSchedule(t *testing.T) {
+	store, cleanup := openCatalogStoreForCustomOptionTests(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	var column *string
+	if err := store.db.QueryRowContext(ctx,
+		"SELECT column_name::text FROM information_schema.columns WHERE table_name = 'products' AND column_name = 'publish_at'",
+	).Scan(&column); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("check column: %v", err)
+	}
+	if column == nil {
+		t.Skip("products.publish_at not present; apply migrations to run this test")
+	}
+	var taxClass string
+	if err := store.db.QueryRowContext(ctx, "SELECT code FROM tax_classes WHERE code <> 'standard' LIMIT 1").Scan(&taxClass); err != nil {
+		t.Skip("no non-standard tax class seeded; skipping")
+	}
+
+	publishAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	unpublishAt := publishAt.Add(24 * time.Hour)
+	slug := fmt.Sprintf("keep-schedule-%d", time.Now().UnixNano())
+	p, err := store.CreateProduct(ctx, ProductUpsertInput{
+		Slug: slug, Title: "Scheduled", Status: ProductStatusPublished,
+		TaxClass: taxClass, PublishAt: &publishAt, UnpublishAt: &unpublishAt,
+	})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	defer deleteProductByID(t, store.db, p.ID)
+
+	if _, err := store.UpdateProduct(ctx, p.ID, ProductUpsertInput{Slug: slug, Title: "Renamed", Status: ProductStatusPublished}); err != nil {
+		t.Fatalf("update product: %v", err)
+	}
+	var (
+		gotClass   string
+		gotPublish sql.NullTime
+		gotEnd     sql.NullTime
+	)
+	readBack := func() {
+		t.Helper()
+		if err := store.db.QueryRowContext(ctx, "SELECT tax_class, publish_at, unpublish_at FROM products WHERE id = $1", p.ID).Scan(&gotClass, &gotPublish, &gotEnd); err != nil {
+			t.Fatalf("read product: %v", err)
+		}
+	}
+	readBack()
+	if gotClass != taxClass || !gotPublish.Valid || !gotPublish.Time.Equal(publishAt) || !gotEnd.Valid || !gotEnd.Time.Equal(unpublishAt) {
+		t.Fatalf("expected tax class and schedule to be kept, got %q %v %v", gotClass, gotPublish, gotEnd)
+	}
+
+	if _, err := store.UpdateProduct(ctx, p.ID, ProductUpsertInput{Slug: slug, Title: "Renamed", Status: ProductStatusPublished, ClearPublishAt: true}); err != nil {
+		t.Fatalf("clear publish_at: %v", err)
+	}
+	readBack()
+	if gotPublish.Valid || !gotEnd.Valid {
+		t.Fatalf("expected only publish_at to be cleared, got %v %v", gotPublish, gotEnd)
+	}
+
+	early := unpublishAt.Add(-48 * time.Hour)
+	_, err = store.UpdateProduct(ctx, p.ID, ProductUpsertInput{Slug: slug, Title: "Renamed", Status: ProductStatusPublished, PublishAt: &unpublishAt, UnpublishAt: &early})
+	if !errors.Is(err, ErrInvalidPublishWindow) {
+		t.Fatalf("expected ErrInvalidPublishWindow, got %v", err)
+	}
+}
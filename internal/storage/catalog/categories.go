@@ -0,0 +1,223 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+// ErrCategoryCycle is returned when a category would become its own
+// ancestor.
+var ErrCategoryCycle = errors.New("category parent would create a cycle")
+
+// maxCategoryDepth bounds breadcrumb walks in case a cycle predates the
+// check in UpdateCategory.
+const maxCategoryDepth = 32
+
+// CategoryNode is a category in the storefront tree. ProductCount counts
+// the storefront products in the category or any of its descendants.
+type CategoryNode struct {
+	Category
+	ProductCount int            `json:"productCount"`
+	Children     []CategoryNode `json:"children"`
+}
+
+func (n CategoryNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		categoryJSON
+		ProductCount int            `json:"productCount"`
+		Children     []CategoryNode `json:"children"`
+	}{n.jsonFields(), n.ProductCount, n.Children})
+}
+
+// CategoryCrumb is an ancestor shown in breadcrumbs.
+type CategoryCrumb struct {
+	ID   string `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// CategoryDetail is a category page: the category, its ancestors from the
+// root down to its parent, and its direct children.
+type CategoryDetail struct {
+	Category
+	ProductCount int             `json:"productCount"`
+	Breadcrumbs  []CategoryCrumb `json:"breadcrumbs"`
+	Children     []CategoryNode  `json:"children"`
+}
+
+func (d CategoryDetail) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		categoryJSON
+		ProductCount int             `json:"productCount"`
+		Breadcrumbs  []CategoryCrumb `json:"breadcrumbs"`
+		Children     []CategoryNode  `json:"children"`
+	}{d.jsonFields(), d.ProductCount, d.Breadcrumbs, d.Children})
+}
+
+// categoryProductCounts counts storefront products per category including
+// its descendants. UNION keeps the walk finite should the tree hold a cycle.
+const categoryProductCounts = `
+	WITH RECURSIVE tree(root_id, id) AS (
+		SELECT id, id FROM categories
+		UNION
+		SELECT t.root_id, c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+	)
+	SELECT t.root_id, COUNT(DISTINCT p.id)
+	FROM tree t
+	JOIN product_categories pc ON pc.category_id = t.id
+	JOIN products p ON p.id = pc.product_id
+	WHERE ` + storefrontVisible + `
+	GROUP BY t.root_id`
+
+// descendantCategoryIDs selects the ids of the categories with the slugs in
+// placeholder and of all their descendants.
+func descendantCategoryIDs(placeholder string) string {
+	return `WITH RECURSIVE sub(id) AS (
+		SELECT id FROM categories WHERE slug = ANY(` + placeholder + `::text[])
+		UNION
+		SELECT c.id FROM categories c JOIN sub ON c.parent_id = sub.id
+	) SELECT id FROM sub`
+}
+
+// ListCategoryTree returns the categories as a tree of roots, children
+// ordered by name.
+func (s *Store) ListCategoryTree(ctx context.Context) ([]CategoryNode, error) {
+	categories, err := s.ListCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := s.categoryProductCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return buildCategoryTree(categories, counts), nil
+}
+
+// buildCategoryTree nests categories under their parents, keeping their
+// order. Categories whose parent is missing become roots.
+func buildCategoryTree(categories []Category, counts map[string]int) []CategoryNode {
+	known := make(map[string]bool, len(categories))
+	for _, c := range categories {
+		known[c.ID] = true
+	}
+	children := map[string][]Category{}
+	roots := []Category{}
+	for _, c := range categories {
+		if c.ParentID.Valid && known[c.ParentID.String] {
+			children[c.ParentID.String] = append(children[c.ParentID.String], c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+	var build func(items []Category, depth int) []CategoryNode
+	build = func(items []Category, depth int) []CategoryNode {
+		nodes := make([]CategoryNode, 0, len(items))
+		for _, c := range items {
+			node := CategoryNode{Category: c, ProductCount: counts[c.ID], Children: []CategoryNode{}}
+			if depth < maxCategoryDepth {
+				node.Children = build(children[c.ID], depth+1)
+			}
+			nodes = append(nodes, node)
+		}
+		return nodes
+	}
+	return build(roots, 0)
+}
+
+func (s *Store) categoryProductCounts(ctx context.Context) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, categoryProductCounts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := map[string]int{}
+	for rows.Next() {
+		var (
+			id    string
+			count int
+		)
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, err
+		}
+		counts[id] = count
+	}
+	return counts, rows.Err()
+}
+
+// GetCategoryBySlug returns a category with its breadcrumbs, children and
+// descendant-inclusive product counts.
+func (s *Store) GetCategoryBySlug(ctx context.Context, slug string) (CategoryDetail, error) {
+	var d CategoryDetail
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT id, slug, name, description, parent_id, default_image_url, seo_title, seo_description
+		FROM categories WHERE slug = $1`, slug,
+	).Scan(&d.ID, &d.Slug, &d.Name, &d.Description, &d.ParentID, &d.DefaultImageURL, &d.SEOTitle, &d.SEODescription); err != nil {
+		return CategoryDetail{}, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		WITH RECURSIVE ancestors(id, slug, name, parent_id, depth) AS (
+			SELECT id, slug, name, parent_id, 1 FROM categories WHERE id = $1
+			UNION ALL
+			SELECT c.id, c.slug, c.name, c.parent_id, a.depth + 1
+			FROM categories c JOIN ancestors a ON c.id = a.parent_id
+			WHERE a.depth < $2
+		)
+		SELECT id, slug, name FROM ancestors ORDER BY depth DESC`, d.ParentID, maxCategoryDepth)
+	if err != nil {
+		return CategoryDetail{}, err
+	}
+	defer rows.Close()
+	d.Breadcrumbs = []CategoryCrumb{}
+	for rows.Next() {
+		var c CategoryCrumb
+		if err := rows.Scan(&c.ID, &c.Slug, &c.Name); err != nil {
+			return CategoryDetail{}, err
+		}
+		d.Breadcrumbs = append(d.Breadcrumbs, c)
+	}
+	if err := rows.Err(); err != nil {
+		return CategoryDetail{}, err
+	}
+	rows.Close()
+
+	categories, err := s.ListCategories(ctx)
+	if err != nil {
+		return CategoryDetail{}, err
+	}
+	counts, err := s.categoryProductCounts(ctx)
+	if err != nil {
+		return CategoryDetail{}, err
+	}
+	d.ProductCount = counts[d.ID]
+	d.Children = []CategoryNode{}
+	for _, c := range categories {
+		if c.ParentID.Valid && c.ParentID.String == d.ID && c.ID != d.ID {
+			d.Children = append(d.Children, CategoryNode{Category: c, ProductCount: counts[c.ID], Children: []CategoryNode{}})
+		}
+	}
+	return d, nil
+}
+
+// checkCategoryParent returns ErrCategoryCycle when parentID is id or one
+// of its descendants. The caller holds a lock on categories so the tree
+// cannot change before the update.
+func checkCategoryParent(ctx context.Context, tx *sql.Tx, id, parentID string) error {
+	var cycle bool
+	if err := tx.QueryRowContext(ctx, `
+		WITH RECURSIVE ancestors(id, parent_id) AS (
+			SELECT id, parent_id FROM categories WHERE id = $1
+			UNION
+			SELECT c.id, c.parent_id FROM categories c JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)`, parentID, id,
+	).Scan(&cycle); err != nil {
+		return err
+	}
+	if cycle {
+		return ErrCategoryCycle
+	}
+	return nil
+}
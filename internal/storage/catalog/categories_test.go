@@ -0,0 +1,105 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildCategoryTree(t *testing.T) {
+	parent := func(id string) sql.NullString { return sql.NullString{String: id, Valid: true} }
+	categories := []Category{
+		{ID: "a", Slug: "apparel", Name: "Apparel"},
+		{ID: "b", Slug: "shirts", Name: "Shirts", ParentID: parent("a")},
+		{ID: "c", Slug: "orphan", Name: "Orphan", ParentID: parent("missing")},
+		{ID: "d", Slug: "tees", Name: "Tees", ParentID: parent("b")},
+	}
+	tree := buildCategoryTree(categories, map[string]int{"a": 3, "b": 2, "d": 1})
+	if len(tree) != 2 || tree[0].ID != "a" || tree[1].ID != "c" {
+		t.Fatalf("unexpected roots %+v", tree)
+	}
+	if len(tree[0].Children) != 1 || tree[0].Children[0].ID != "b" || tree[0].Children[0].Children[0].ID != "d" {
+		t.Fatalf("unexpected children %+v", tree[0].Children)
+	}
+	if tree[0].ProductCount != 3 || tree[1].ProductCount != 0 {
+		t.Fatalf("unexpected counts %+v", tree)
+	}
+
+	raw, err := json.Marshal(tree[0].Children[0])
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	for _, want := range []string{`"parentId":"a"`, `"productCount":2`, `"children":[{"id":"d"`} {
+		if !strings.Contains(string(raw), want) {
+			t.Fatalf("expected %s in %s", want, raw)
+		}
+	}
+}
+
+func TestCategoryHierarchyBreadcrumbsDescendantsAndCycles(t *testing.T) {
+	store, cleanup := openCatalogStoreForCustomOptionTests(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	suffix := time.Now().UnixNano()
+	var ids []string
+	defer func() {
+		for i := len(ids) - 1; i >= 0; i-- {
+			if _, err := store.db.ExecContext(ctx, "DELETE FROM categories WHERE id = $1", ids[i]); err != nil {
+				t.Errorf("delete category: %v", err)
+			}
+		}
+	}()
+	var parentID *string
+	for _, name := range []string{"root", "middle", "leaf"} {
+		c, err := store.CreateCategory(ctx, CategoryUpsertInput{Slug: fmt.Sprintf("%s-%d", name, suffix), Name: name, ParentID: parentID})
+		if err != nil {
+			t.Fatalf("create category: %v", err)
+		}
+		ids = append(ids, c.ID)
+		parentID = &ids[len(ids)-1]
+	}
+	root, leaf := ids[0], ids[2]
+
+	for _, p := range []string{root, leaf} {
+		_, err := store.UpdateCategory(ctx, root, CategoryUpsertInput{Slug: fmt.Sprintf("root-%d", suffix), Name: "root", ParentID: &p})
+		if !errors.Is(err, ErrCategoryCycle) {
+			t.Fatalf("expected parent %s to be rejected, got %v", p, err)
+		}
+	}
+
+	p, err := store.CreateProduct(ctx, ProductUpsertInput{Slug: fmt.Sprintf("leaf-product-%d", suffix), Title: "Leaf", Status: ProductStatusPublished})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	defer deleteProductByID(t, store.db, p.ID)
+	if err := store.ReplaceProductCategories(ctx, p.ID, []string{leaf}); err != nil {
+		t.Fatalf("assign category: %v", err)
+	}
+
+	d, err := store.GetCategoryBySlug(ctx, fmt.Sprintf("leaf-%d", suffix))
+	if err != nil {
+		t.Fatalf("get category: %v", err)
+	}
+	if len(d.Breadcrumbs) != 2 || d.Breadcrumbs[0].ID != root || d.Breadcrumbs[1].ID != ids[1] || d.ProductCount != 1 {
+		t.Fatalf("unexpected detail %+v", d)
+	}
+	d, err = store.GetCategoryBySlug(ctx, fmt.Sprintf("root-%d", suffix))
+	if err != nil || len(d.Breadcrumbs) != 0 || d.ProductCount != 1 || len(d.Children) != 1 {
+		t.Fatalf("expected root to count the leaf product, got %+v err=%v", d, err)
+	}
+
+	in := ListProductsParams{CategorySlug: fmt.Sprintf("root-%d", suffix)}
+	if res, err := store.ListProducts(ctx, in); err != nil || res.Total != 0 {
+		t.Fatalf("expected no direct products in root, got %+v err=%v", res, err)
+	}
+	in.IncludeDescendants = true
+	if res, err := store.ListProducts(ctx, in); err != nil || res.Total != 1 || res.Items[0].ID != p.ID {
+		t.Fatalf("expected the leaf product under root, got %+v err=%v", res, err)
+	}
+}
@@ -0,0 +1,233 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FacetValue is one value of a facet and the number of products having it.
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// PriceRange is the lowest and highest variant price among matching
+// products; both are nil when nothing matches.
+type PriceRange struct {
+	MinCents *int `json:"minCents"`
+	MaxCents *int `json:"maxCents"`
+}
+
+// ProductFacets counts the values products could be narrowed down to. Each
+// facet is counted with every filter except its own, so the counts say how
+// many products a value would show on its own or added to the values
+// already picked in that facet.
+type ProductFacets struct {
+	Categories []FacetValue            `json:"categories"`
+	Tags       []FacetValue            `json:"tags"`
+	Attributes map[string][]FacetValue `json:"attributes"`
+	Price      PriceRange              `json:"price"`
+	// InStock counts matching products with a variant in stock.
+	InStock int `json:"inStock"`
+}
+
+// filterSkip leaves a facet's own filter out of productFilter. When
+// attributeKey is set, the attribute filter named by that SQL expression is
+// skipped per row, which lets one query count every attribute.
+type filterSkip struct {
+	categories   bool
+	tags         bool
+	price        bool
+	stock        bool
+	attributeKey string
+}
+
+// productFilter returns the WHERE clause selecting storefront products
+// p matching in, and its arguments. Variant filters apply to a single
+// variant: with joinedVariant they read product_variants pv joined by the
+// caller, otherwise such a variant must exist.
+func productFilter(in ListProductsParams, skip filterSkip, joinedVariant bool) (string, []any) {
+	conditions := []string{storefrontVisible}
+	args := make([]any, 0, 8)
+	appendArg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if slugs := in.categorySlugs(); len(slugs) > 0 && !skip.categories {
+		if in.IncludeDescendants {
+			conditions = append(conditions, `EXISTS (
+				SELECT 1 FROM product_categories fpc
+				WHERE fpc.product_id = p.id AND fpc.category_id IN (`+descendantCategoryIDs(appendArg(slugs))+`))`)
+		} else {
+			conditions = append(conditions, `EXISTS (
+				SELECT 1 FROM product_categories fpc JOIN categories fc ON fc.id = fpc.category_id
+				WHERE fpc.product_id = p.id AND fc.slug = ANY(`+appendArg(slugs)+`::text[]))`)
+		}
+	}
+	if tags := cleanStrings(in.Tags); len(tags) > 0 && !skip.tags {
+		conditions = append(conditions, "p.tags && "+appendArg(tags)+"::text[]")
+	}
+	if terms := searchTerms(in.Query); len(terms) > 0 {
+		conditions = append(conditions, "p.search_vector @@ "+matchQuery(appendArg(prefixTSQuery(terms))))
+	}
+
+	variant := []string{}
+	if !skip.price {
+		if in.MinPriceCents != nil {
+			variant = append(variant, "pv.price_cents >= "+appendArg(*in.MinPriceCents))
+		}
+		if in.MaxPriceCents != nil {
+			variant = append(variant, "pv.price_cents <= "+appendArg(*in.MaxPriceCents))
+		}
+	}
+	if in.InStock && !skip.stock {
+		variant = append(variant, "pv.stock > 0")
+	}
+	attrs := in.attributes()
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		k := appendArg(key) + "::text"
+		cond := "pv.attributes_json ->> " + k + " = ANY(" + appendArg(attrs[key]) + "::text[])"
+		if skip.attributeKey != "" {
+			cond = "(" + skip.attributeKey + " = " + k + " OR " + cond + ")"
+		}
+		variant = append(variant, cond)
+	}
+	if joinedVariant {
+		conditions = append(conditions, variant...)
+	} else if len(variant) > 0 {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM product_variants pv WHERE pv.product_id = p.id AND "+
+			strings.Join(variant, " AND ")+")")
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// categorySlugs merges CategorySlug into CategorySlugs.
+func (in ListProductsParams) categorySlugs() []string {
+	return cleanStrings(append([]string{in.CategorySlug}, in.CategorySlugs...))
+}
+
+// attributes drops empty attribute names and values.
+func (in ListProductsParams) attributes() map[string][]string {
+	out := make(map[string][]string, len(in.Attributes))
+	for key, values := range in.Attributes {
+		key = strings.TrimSpace(key)
+		if values = cleanStrings(values); key != "" && len(values) > 0 {
+			out[key] = values
+		}
+	}
+	return out
+}
+
+// cleanStrings trims values and drops empty and repeated ones.
+func cleanStrings(in []string) []string {
+	out := make([]string, 0, len(in))
+	for _, v := range in {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return uniqueStrings(out)
+}
+
+// listProductFacets counts the facets of the products matching in.
+func (s *Store) listProductFacets(ctx context.Context, in ListProductsParams) (ProductFacets, error) {
+	facets := ProductFacets{
+		Categories: []FacetValue{},
+		Tags:       []FacetValue{},
+		Attributes: map[string][]FacetValue{},
+	}
+
+	where, args := productFilter(in, filterSkip{categories: true}, false)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.slug, COUNT(*)
+		FROM products p
+		JOIN product_categories pc ON pc.product_id = p.id
+		JOIN categories c ON c.id = pc.category_id`+where+`
+		GROUP BY c.slug
+		ORDER BY COUNT(*) DESC, c.slug`, args...)
+	if err != nil {
+		return ProductFacets{}, err
+	}
+	if facets.Categories, err = scanFacetValues(rows, facets.Categories); err != nil {
+		return ProductFacets{}, err
+	}
+
+	where, args = productFilter(in, filterSkip{tags: true}, false)
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT t.tag, COUNT(*)
+		FROM products p
+		CROSS JOIN LATERAL unnest(p.tags) AS t(tag)`+where+`
+		GROUP BY t.tag
+		ORDER BY COUNT(*) DESC, t.tag`, args...)
+	if err != nil {
+		return ProductFacets{}, err
+	}
+	if facets.Tags, err = scanFacetValues(rows, facets.Tags); err != nil {
+		return ProductFacets{}, err
+	}
+
+	where, args = productFilter(in, filterSkip{attributeKey: "a.key"}, true)
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT a.key, a.value, COUNT(DISTINCT p.id)
+		FROM products p
+		JOIN product_variants pv ON pv.product_id = p.id
+		CROSS JOIN LATERAL jsonb_each_text(pv.attributes_json) AS a(key, value)`+where+`
+		GROUP BY a.key, a.value
+		ORDER BY a.key, COUNT(DISTINCT p.id) DESC, a.value`, args...)
+	if err != nil {
+		return ProductFacets{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var v FacetValue
+		if err := rows.Scan(&key, &v.Value, &v.Count); err != nil {
+			return ProductFacets{}, err
+		}
+		facets.Attributes[key] = append(facets.Attributes[key], v)
+	}
+	if err := rows.Err(); err != nil {
+		return ProductFacets{}, err
+	}
+	rows.Close()
+
+	where, args = productFilter(in, filterSkip{price: true}, true)
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT MIN(pv.price_cents), MAX(pv.price_cents)
+		FROM products p
+		JOIN product_variants pv ON pv.product_id = p.id`+where, args...,
+	).Scan(&facets.Price.MinCents, &facets.Price.MaxCents); err != nil {
+		return ProductFacets{}, err
+	}
+
+	where, args = productFilter(in, filterSkip{stock: true}, true)
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT p.id)
+		FROM products p
+		JOIN product_variants pv ON pv.product_id = p.id`+where+` AND pv.stock > 0`, args...,
+	).Scan(&facets.InStock); err != nil {
+		return ProductFacets{}, err
+	}
+	return facets, nil
+}
+
+func scanFacetValues(rows *sql.Rows, out []FacetValue) ([]FacetValue, error) {
+	defer rows.Close()
+	for rows.Next() {
+		var v FacetValue
+		if err := rows.Scan(&v.Value, &v.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
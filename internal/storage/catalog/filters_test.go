@@ -0,0 +1,117 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProductFilterSkipsOwnFacet(t *testing.T) {
+	in := ListProductsParams{
+		CategorySlug:  "shirts",
+		CategorySlugs: []string{" sale ", "shirts"},
+		Tags:          []string{"eco", ""},
+		Attributes:    map[string][]string{"size": {"M"}, "color": {"red", "blue"}, "empty": {" "}},
+		MinPriceCents: intPtr(500),
+		InStock:       true,
+	}
+
+	where, args := productFilter(in, filterSkip{}, false)
+	wantArgs := []any{[]string{"shirts", "sale"}, []string{"eco"}, 500, "color", []string{"red", "blue"}, "size", []string{"M"}}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("unexpected args %#v", args)
+	}
+	for _, want := range []string{"fc.slug = ANY($1::text[])", "p.tags && $2::text[]", "EXISTS (SELECT 1 FROM product_variants pv",
+		"pv.price_cents >= $3", "pv.stock > 0", "pv.attributes_json ->> $4::text = ANY($5::text[])"} {
+		if !strings.Contains(where, want) {
+			t.Fatalf("expected %q in %s", want, where)
+		}
+	}
+
+	where, args = productFilter(in, filterSkip{categories: true, stock: true, attributeKey: "a.key"}, true)
+	if strings.Contains(where, "fc.slug") || strings.Contains(where, "pv.stock") || strings.Contains(where, "EXISTS (SELECT 1 FROM product_variants") {
+		t.Fatalf("expected skipped filters to be left out: %s", where)
+	}
+	if !strings.Contains(where, "(a.key = $3::text OR pv.attributes_json ->> $3::text = ANY($4::text[]))") || len(args) != 6 {
+		t.Fatalf("expected attribute filters to be skipped per key: %s %#v", where, args)
+	}
+}
+
+func TestListProductsFiltersAndCountsFacets(t *testing.T) {
+	store, cleanup := openCatalogStoreForCustomOptionTests(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	suffix := time.Now().UnixNano()
+	tag := fmt.Sprintf("facet-%d", suffix)
+	products := []struct {
+		variants [][3]any // color, price, stock
+	}{
+		{variants: [][3]any{{"red", 1000, 5}, {"blue", 3000, 0}}},
+		{variants: [][3]any{{"red", 2000, 0}}},
+		{variants: [][3]any{{"green", 4000, 1}}},
+	}
+	for i, tc := range products {
+		p, err := store.CreateProduct(ctx, ProductUpsertInput{
+			Slug:   fmt.Sprintf("%s-%d", tag, i),
+			Title:  fmt.Sprintf("Facet %d", i),
+			Status: ProductStatusPublished,
+			Tags:   []string{tag},
+		})
+		if err != nil {
+			t.Fatalf("create product: %v", err)
+		}
+		defer deleteProductByID(t, store.db, p.ID)
+		for j, v := range tc.variants {
+			if _, err := store.db.ExecContext(ctx, `
+				INSERT INTO product_variants (product_id, sku, price_cents, currency, stock, attributes_json)
+				VALUES ($1, $2, $3, 'EUR', $4, jsonb_build_object('color', $5::text))`,
+				p.ID, fmt.Sprintf("%s-%d-%d", tag, i, j), v[1], v[2], v[0]); err != nil {
+				t.Fatalf("create variant: %v", err)
+			}
+		}
+	}
+
+	res, err := store.ListProducts(ctx, ListProductsParams{
+		Tags:       []string{tag},
+		Attributes: map[string][]string{"color": {"red"}},
+		InStock:    true,
+		Facets:     true,
+	})
+	if err != nil {
+		t.Fatalf("list products: %v", err)
+	}
+	if res.Total != 1 || res.Items[0].Slug != tag+"-0" {
+		t.Fatalf("expected only the product with a red variant in stock, got %+v", res.Items)
+	}
+	colors := map[string]int{}
+	for _, v := range res.Facets.Attributes["color"] {
+		colors[v.Value] = v.Count
+	}
+	// Colors are counted without the color filter but with the stock filter.
+	if !reflect.DeepEqual(colors, map[string]int{"red": 1, "green": 1}) {
+		t.Fatalf("unexpected color facet %+v", res.Facets.Attributes["color"])
+	}
+	// Of the two red products only one is in stock.
+	if res.Facets.InStock != 1 || *res.Facets.Price.MinCents != 1000 || *res.Facets.Price.MaxCents != 1000 {
+		t.Fatalf("unexpected stock and price facets %+v", res.Facets)
+	}
+	tagCount := 0
+	for _, v := range res.Facets.Tags {
+		if v.Value == tag {
+			tagCount = v.Count
+		}
+	}
+	if tagCount != 1 {
+		t.Fatalf("unexpected tag facet %+v", res.Facets.Tags)
+	}
+
+	low, high := 1500, 3500
+	res, err = store.ListProducts(ctx, ListProductsParams{Tags: []string{tag}, MinPriceCents: &low, MaxPriceCents: &high})
+	if err != nil || res.Total != 2 || res.Facets != nil {
+		t.Fatalf("expected two products priced 15-35 without facets, got %+v err=%v", res, err)
+	}
+}
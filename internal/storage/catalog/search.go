@@ -0,0 +1,159 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidSearchQuery is returned when a search query has no searchable
+// words.
+var ErrInvalidSearchQuery = errors.New("search query has no searchable words")
+
+const (
+	maxSearchTerms      = 8
+	maxSearchTermLength = 64
+	// searchTypoThreshold is the pg_trgm word similarity a title needs to
+	// match a query that has no full-text hit, e.g. a misspelled word.
+	searchTypoThreshold = "0.4"
+	// Highlighted words are wrapped in private-use runes by ts_headline and
+	// turned into <mark> after the snippet is HTML-escaped.
+	highlightStart   = "\ue000"
+	highlightStop    = "\ue001"
+	headlineOptions  = `StartSel="` + highlightStart + `", StopSel="` + highlightStop + `", MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=" … "`
+	searchMatchWhere = storefrontVisible + `
+		AND (p.search_vector @@ q.query OR $2 <% p.title)`
+)
+
+// SearchProductsParams input for searching products.
+type SearchProductsParams struct {
+	Pagination
+	Query string
+}
+
+// SearchHit is a product matching a search with its relevance and a
+// highlighted snippet of its title and description. Highlight is HTML with
+// matches wrapped in <mark>.
+type SearchHit struct {
+	Product
+	Rank      float64 `json:"rank"`
+	Highlight string  `json:"highlight"`
+}
+
+// SearchProductsResult is the paginated result for a product search.
+type SearchProductsResult struct {
+	Items []SearchHit
+	Total int
+	Page  int
+	Limit int
+}
+
+// searchTerms splits a query into lowercase words of letters and digits.
+func searchTerms(query string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if len(terms) == maxSearchTerms {
+			break
+		}
+		if r := []rune(f); len(r) > maxSearchTermLength {
+			f = string(r[:maxSearchTermLength])
+		}
+		terms = append(terms, f)
+	}
+	return uniqueStrings(terms)
+}
+
+// prefixTSQuery builds a to_tsquery expression requiring every term, each
+// as a prefix so partially typed words match.
+func prefixTSQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = t + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// SearchProducts returns storefront products matching a free-text query,
+// most relevant first. Words are matched stemmed (English) and unstemmed
+// without diacritics, by prefix, against titles, descriptions, tags and
+// variant SKUs; titles similar to the query also match to tolerate typos.
+func (s *Store) SearchProducts(ctx context.Context, in SearchProductsParams) (SearchProductsResult, error) {
+	terms := searchTerms(in.Query)
+	if len(terms) == 0 {
+		return SearchProductsResult{}, ErrInvalidSearchQuery
+	}
+	page, limit, offset := sanitizePagination(in.Pagination)
+	tsquery := prefixTSQuery(terms)
+	raw := strings.Join(terms, " ")
+	withQuery := "WITH q AS (SELECT " + matchQuery("$1") + " AS query) "
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return SearchProductsResult{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, "SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)", searchTypoThreshold); err != nil {
+		return SearchProductsResult{}, err
+	}
+
+	var total int
+	if err := tx.QueryRowContext(ctx, withQuery+`
+		SELECT COUNT(*) FROM products p, q WHERE `+searchMatchWhere, tsquery, raw,
+	).Scan(&total); err != nil {
+		return SearchProductsResult{}, err
+	}
+	rows, err := tx.QueryContext(ctx, withQuery+`
+		SELECT `+productColumns+`,
+			ts_rank_cd(p.search_vector, q.query, 32) + 0.5 * word_similarity($2, p.title) AS rank,
+			ts_headline('english', p.title || '. ' || p.description, q.query, $3)
+		FROM products p, q
+		WHERE `+searchMatchWhere+`
+		ORDER BY rank DESC, p.id
+		LIMIT $4 OFFSET $5`, tsquery, raw, headlineOptions, limit, offset)
+	if err != nil {
+		return SearchProductsResult{}, err
+	}
+	defer rows.Close()
+
+	items := make([]SearchHit, 0, limit)
+	for rows.Next() {
+		var (
+			hit      SearchHit
+			headline string
+		)
+		hit.Product, err = scanProduct(rows, &hit.Rank, &headline)
+		if err != nil {
+			return SearchProductsResult{}, err
+		}
+		hit.Highlight = highlightSnippet(headline)
+		items = append(items, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return SearchProductsResult{}, err
+	}
+	rows.Close()
+	if err := tx.Commit(); err != nil {
+		return SearchProductsResult{}, err
+	}
+
+	for i := range items {
+		if items[i].Variants, err = s.listProductVariants(ctx, items[i].ID); err != nil {
+			return SearchProductsResult{}, err
+		}
+		if items[i].Images, err = s.listProductImages(ctx, items[i].ID); err != nil {
+			return SearchProductsResult{}, err
+		}
+	}
+	return SearchProductsResult{Items: items, Total: total, Page: page, Limit: limit}, nil
+}
+
+// highlightSnippet escapes a ts_headline result and marks its matches.
+func highlightSnippet(headline string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(html.EscapeString(headline))
+}
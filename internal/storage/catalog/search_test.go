@@ -0,0 +1,94 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: "Red T-Shirt", want: []string{"red", "t", "shirt"}},
+		{in: "  šaltas  ŽIEMOS  ", want: []string{"šaltas", "žiemos"}},
+		{in: "mug & (cup) | !bowl:*", want: []string{"mug", "cup", "bowl"}},
+		{in: "sku-123 sku-123", want: []string{"sku", "123"}},
+		{in: "a b c d e f g h i j", want: []string{"a", "b", "c", "d", "e", "f", "g", "h"}},
+		{in: " &|!: ", want: []string{}},
+	}
+	for _, tt := range tests {
+		if got := searchTerms(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("searchTerms(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if got := prefixTSQuery([]string{"red", "shi"}); got != "red:* & shi:*" {
+		t.Fatalf("unexpected tsquery %q", got)
+	}
+}
+
+func TestHighlightSnippetEscapesAndMarks(t *testing.T) {
+	got := highlightSnippet("<b>Red</b> " + highlightStart + "shirt" + highlightStop + " & more")
+	want := "&lt;b&gt;Red&lt;/b&gt; <mark>shirt</mark> &amp; more"
+	if got != want {
+		t.Fatalf("highlightSnippet = %q, want %q", got, want)
+	}
+}
+
+func TestSearchProductsMatchesPrefixSKUAndTypos(t *testing.T) {
+	store, cleanup := openCatalogStoreForCustomOptionTests(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	var column *string
+	if err := store.db.QueryRowContext(ctx,
+		"SELECT column_name::text FROM information_schema.columns WHERE table_name = 'products' AND column_name = 'search_vector'",
+	).Scan(&column); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("check column: %v", err)
+	}
+	if column == nil {
+		t.Skip("products.search_vector not present; apply migrations to run this test")
+	}
+
+	suffix := time.Now().UnixNano()
+	word := fmt.Sprintf("zorblax%d", suffix)
+	p, err := store.CreateProduct(ctx, ProductUpsertInput{
+		Slug:        fmt.Sprintf("search-%d", suffix),
+		Title:       "Woolen " + word + " Sweater",
+		Description: "Warm knitted sweaters for cold winters.",
+		Status:      ProductStatusPublished,
+		Tags:        []string{"knitwear"},
+	})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	defer deleteProductByID(t, store.db, p.ID)
+	sku := fmt.Sprintf("QX%d", suffix)
+	if _, err := store.CreateProductVariant(ctx, p.ID, ProductVariantCreateInput{SKU: sku, PriceCents: 1000, Currency: "EUR"}); err != nil {
+		t.Fatalf("create variant: %v", err)
+	}
+
+	for _, q := range []string{word[:len(word)-3], word + " sweaters", sku, "Woolen " + word[:4] + "x" + word[5:]} {
+		res, err := store.SearchProducts(ctx, SearchProductsParams{Query: q})
+		if err != nil {
+			t.Fatalf("search %q: %v", q, err)
+		}
+		found := false
+		for _, hit := range res.Items {
+			if hit.ID == p.ID {
+				found = hit.Rank > 0 && len(hit.Variants) == 1
+			}
+		}
+		if !found {
+			t.Fatalf("search %q: expected product %s in %+v", q, p.ID, res.Items)
+		}
+	}
+	if _, err := store.SearchProducts(ctx, SearchProductsParams{Query: " !! "}); !errors.Is(err, ErrInvalidSearchQuery) {
+		t.Fatalf("expected ErrInvalidSearchQuery, got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package catalog
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Product list sort orders. Every order ends with the product id, so equal
+// sort values still page in a stable order.
+const (
+	ProductSortTitle       = "title"
+	ProductSortPriceAsc    = "price_asc"
+	ProductSortPriceDesc   = "price_desc"
+	ProductSortNewest      = "newest"
+	ProductSortBestSelling = "best_selling"
+	// ProductSortRelevance needs a search query and is its default.
+	ProductSortRelevance = "relevance"
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// productSort is an ORDER BY over products p: expr is never NULL and is
+// compared as sqlType when resuming from a cursor.
+type productSort struct {
+	expr    string
+	sqlType string
+	desc    bool
+}
+
+// soldStatuses are the order statuses whose items count as sold.
+const soldStatuses = `'paid', 'processing', 'partially_shipped', 'shipped', 'completed', 'partially_refunded'`
+
+// fromPrice is the lowest variant price, the one shown as "from" in lists.
+const fromPrice = `(SELECT MIN(spv.price_cents) FROM product_variants spv WHERE spv.product_id = p.id)`
+
+var productSorts = map[string]productSort{
+	ProductSortTitle:     {expr: "p.title", sqlType: "text"},
+	ProductSortPriceAsc:  {expr: "COALESCE(" + fromPrice + ", 2147483647)", sqlType: "integer"},
+	ProductSortPriceDesc: {expr: "COALESCE(" + fromPrice + ", -1)", sqlType: "integer", desc: true},
+	ProductSortNewest:    {expr: "p.created_at", sqlType: "timestamptz", desc: true},
+	ProductSortBestSelling: {expr: `(SELECT COALESCE(SUM(oi.quantity), 0)
+		FROM order_items oi
+		JOIN product_variants spv ON spv.id = oi.product_variant_id
+		JOIN orders o ON o.id = oi.order_id
+		WHERE spv.product_id = p.id AND o.status IN (` + soldStatuses + `))`, sqlType: "bigint", desc: true},
+	// The relevance expression is built per query, see relevanceExpr.
+	ProductSortRelevance: {sqlType: "real", desc: true},
+}
+
+// relevanceExpr ranks products p against the tsquery text in placeholder.
+func relevanceExpr(placeholder string) string {
+	return "ts_rank_cd(p.search_vector, " + matchQuery(placeholder) + ", 32)"
+}
+
+// matchQuery is the tsquery searchTerms are matched with: stemmed English
+// or unstemmed without diacritics.
+func matchQuery(placeholder string) string {
+	return "(to_tsquery('english', " + placeholder + ") || to_tsquery('simple', unaccent(" + placeholder + ")))"
+}
+
+// sortName returns the requested sort order, defaulting to relevance for
+// searches and to title otherwise.
+func (in ListProductsParams) sortName() (string, error) {
+	name := strings.TrimSpace(in.Sort)
+	hasQuery := len(searchTerms(in.Query)) > 0
+	if name == "" {
+		if hasQuery {
+			return ProductSortRelevance, nil
+		}
+		return ProductSortTitle, nil
+	}
+	if _, ok := productSorts[name]; !ok || (name == ProductSortRelevance && !hasQuery) {
+		return "", ErrInvalidSort
+	}
+	return name, nil
+}
+
+// productCursor is the position after the last product of a page: the sort
+// value as text and the product id. Relevance cursors also carry the search
+// query, since the sort value is only meaningful for the query it ranked.
+type productCursor struct {
+	Sort  string `json:"s"`
+	Query string `json:"q,omitempty"`
+	Key   string `json:"k"`
+	ID    string `json:"id"`
+}
+
+func encodeProductCursor(c productCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeProductCursor reads a cursor made for the sort order name and, for
+// relevance, the search query. The key and id are checked and rewritten in a
+// form Postgres accepts, so a tampered cursor fails here rather than in the
+// query.
+func decodeProductCursor(s, name, query string) (productCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return productCursor{}, ErrInvalidCursor
+	}
+	var c productCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Sort != name || c.Query != query {
+		return productCursor{}, ErrInvalidCursor
+	}
+	id, err := uuid.Parse(c.ID)
+	if err != nil {
+		return productCursor{}, ErrInvalidCursor
+	}
+	c.ID = id.String()
+	if c.Key, err = cursorKey(productSorts[name].sqlType, c.Key); err != nil {
+		return productCursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// timestamptzLayouts parse timestamptz values as Postgres prints them;
+// offsets have minutes, or seconds for historic zones, only when needed.
+var timestamptzLayouts = []string{
+	"2006-01-02 15:04:05Z07",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05Z07:00:00",
+}
+
+// cursorKey parses a cursor sort value as sqlType and formats it again.
+func cursorKey(sqlType, key string) (string, error) {
+	switch sqlType {
+	case "integer", "bigint":
+		bits := 64
+		if sqlType == "integer" {
+			bits = 32
+		}
+		n, err := strconv.ParseInt(key, 10, bits)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(n, 10), nil
+	case "real":
+		f, err := strconv.ParseFloat(key, 32)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(f, 'g', -1, 32), nil
+	case "timestamptz":
+		for _, layout := range timestamptzLayouts {
+			if t, err := time.Parse(layout, key); err == nil {
+				return t.Format(time.RFC3339Nano), nil
+			}
+		}
+		return "", ErrInvalidCursor
+	case "text":
+		if strings.ContainsRune(key, 0) {
+			return "", ErrInvalidCursor
+		}
+		return key, nil
+	}
+	return "", ErrInvalidCursor
+}
@@ -0,0 +1,136 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestListProductsSortName(t *testing.T) {
+	tests := []struct {
+		in   ListProductsParams
+		want string
+		err  error
+	}{
+		{in: ListProductsParams{}, want: ProductSortTitle},
+		{in: ListProductsParams{Query: "shirt"}, want: ProductSortRelevance},
+		{in: ListProductsParams{Query: "shirt", Sort: ProductSortNewest}, want: ProductSortNewest},
+		{in: ListProductsParams{Sort: " price_desc "}, want: ProductSortPriceDesc},
+		{in: ListProductsParams{Sort: ProductSortRelevance}, err: ErrInvalidSort},
+		{in: ListProductsParams{Sort: "cheapest"}, err: ErrInvalidSort},
+	}
+	for _, tt := range tests {
+		got, err := tt.in.sortName()
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Fatalf("sortName(%+v) = %q, %v; want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestProductCursorRoundTrip(t *testing.T) {
+	const id = "6f1c2b8e-0000-4000-8000-000000000001"
+	c := productCursor{Sort: ProductSortNewest, Key: "2026-01-02 03:04:05.123456+00", ID: id}
+	s := encodeProductCursor(c)
+	got, err := decodeProductCursor(s, ProductSortNewest, "")
+	want := productCursor{Sort: ProductSortNewest, Key: "2026-01-02T03:04:05.123456Z", ID: id}
+	if err != nil || got != want {
+		t.Fatalf("decodeProductCursor = %+v, %v; want %+v", got, err, want)
+	}
+	for _, tt := range []struct {
+		in   productCursor
+		want string
+	}{
+		{productCursor{Sort: ProductSortNewest, Key: "2026-01-02 08:34:05+05:30"}, "2026-01-02T08:34:05+05:30"},
+		{productCursor{Sort: ProductSortPriceAsc, Key: "2147483647"}, "2147483647"},
+		{productCursor{Sort: ProductSortBestSelling, Key: "12"}, "12"},
+		{productCursor{Sort: ProductSortRelevance, Query: "shirt:*", Key: "0.0607927"}, "0.0607927"},
+		{productCursor{Sort: ProductSortTitle, Key: "Shirt"}, "Shirt"},
+	} {
+		tt.in.ID = id
+		got, err := decodeProductCursor(encodeProductCursor(tt.in), tt.in.Sort, tt.in.Query)
+		if err != nil || got.Key != tt.want {
+			t.Fatalf("decodeProductCursor(%+v) key = %q, %v; want %q", tt.in, got.Key, err, tt.want)
+		}
+	}
+	for _, tt := range []struct{ cursor, sort string }{
+		{s, ProductSortTitle},
+		{encodeProductCursor(productCursor{Sort: ProductSortRelevance, Query: "shirt:*", Key: "0.5", ID: id}), ProductSortRelevance},
+		{"not a cursor", ProductSortNewest},
+		{encodeProductCursor(productCursor{Sort: ProductSortNewest}), ProductSortNewest},
+		{encodeProductCursor(productCursor{Sort: ProductSortNewest, Key: c.Key, ID: "1; DROP"}), ProductSortNewest},
+		{encodeProductCursor(productCursor{Sort: ProductSortNewest, Key: "yesterday", ID: id}), ProductSortNewest},
+		{encodeProductCursor(productCursor{Sort: ProductSortPriceAsc, Key: "2147483648", ID: id}), ProductSortPriceAsc},
+		{encodeProductCursor(productCursor{Sort: ProductSortBestSelling, Key: "1.5", ID: id}), ProductSortBestSelling},
+		{encodeProductCursor(productCursor{Sort: ProductSortRelevance, Key: "high", ID: id}), ProductSortRelevance},
+		{encodeProductCursor(productCursor{Sort: ProductSortTitle, Key: "a\x00b", ID: id}), ProductSortTitle},
+	} {
+		if _, err := decodeProductCursor(tt.cursor, tt.sort, "shoe:*"); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("decodeProductCursor(%q, %q): expected ErrInvalidCursor, got %v", tt.cursor, tt.sort, err)
+		}
+	}
+}
+
+func TestListProductsCursorPagesWithTies(t *testing.T) {
+	store, cleanup := openCatalogStoreForCustomOptionTests(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	tag := fmt.Sprintf("sort-%d", time.Now().UnixNano())
+	prices := []int{500, 500, 500, 900, 100}
+	for i, price := range prices {
+		p, err := store.CreateProduct(ctx, ProductUpsertInput{
+			Slug:   fmt.Sprintf("%s-%d", tag, i),
+			Title:  "Sorted",
+			Status: ProductStatusPublished,
+			Tags:   []string{tag},
+		})
+		if err != nil {
+			t.Fatalf("create product: %v", err)
+		}
+		defer deleteProductByID(t, store.db, p.ID)
+		if _, err := store.CreateProductVariant(ctx, p.ID, ProductVariantCreateInput{
+			SKU: fmt.Sprintf("%s-%d", tag, i), PriceCents: price, Currency: "EUR",
+		}); err != nil {
+			t.Fatalf("create variant: %v", err)
+		}
+	}
+
+	for _, sort := range []string{ProductSortPriceAsc, ProductSortPriceDesc, ProductSortNewest, ProductSortTitle, ProductSortBestSelling} {
+		seen := map[string]bool{}
+		last := -1
+		in := ListProductsParams{Pagination: Pagination{Limit: 2}, Tags: []string{tag}, Sort: sort}
+		for pages := 0; ; pages++ {
+			if pages > len(prices) {
+				t.Fatalf("%s: cursor did not reach the end", sort)
+			}
+			res, err := store.ListProducts(ctx, in)
+			if err != nil {
+				t.Fatalf("%s: list products: %v", sort, err)
+			}
+			for _, p := range res.Items {
+				if seen[p.ID] {
+					t.Fatalf("%s: product %s listed twice", sort, p.Slug)
+				}
+				seen[p.ID] = true
+				price := p.Variants[0].PriceCents
+				if (sort == ProductSortPriceAsc && price < last) || (sort == ProductSortPriceDesc && last >= 0 && price > last) {
+					t.Fatalf("%s: %d listed after %d", sort, price, last)
+				}
+				last = price
+			}
+			if res.NextCursor == "" {
+				break
+			}
+			in.Cursor = res.NextCursor
+		}
+		if len(seen) != len(prices) {
+			t.Fatalf("%s: expected %d products, got %d", sort, len(prices), len(seen))
+		}
+	}
+
+	if _, err := store.ListProducts(ctx, ListProductsParams{Sort: ProductSortNewest, Cursor: encodeProductCursor(productCursor{Sort: ProductSortTitle, ID: "x"})}); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected a cursor of another sort to be rejected, got %v", err)
+	}
+}
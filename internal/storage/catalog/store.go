@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,11 +20,18 @@ type Product struct {
 	Tags           []string              `json:"tags"`
 	SEOTitle       *string               `json:"seoTitle"`
 	SEODescription *string               `json:"seoDescription"`
+	TaxClass       string                `json:"taxClass"`
 	Variants       []Variant             `json:"variants"`
 	Images         []Image               `json:"images"`
 	CustomOptions  []ProductCustomOption `json:"customOptions"`
 	CreatedAt      time.Time             `json:"createdAt"`
 	UpdatedAt      time.Time             `json:"updatedAt"`
+	// PublishAt and UnpublishAt bound when a published product is shown on
+	// the storefront; nil means no bound.
+	PublishAt   *time.Time `json:"publishAt"`
+	UnpublishAt *time.Time `json:"unpublishAt"`
+	// PreviewToken is only loaded for admins.
+	PreviewToken string `json:"previewToken,omitempty"`
 }
 
 type Variant struct {
@@ -33,6 +42,8 @@ type Variant struct {
 	Currency            string                 `json:"currency"`
 	Stock               int                    `json:"stock"`
 	Attributes          map[string]interface{} `json:"attributes"`
+	// TaxClass overrides the product's tax class when set.
+	TaxClass *string `json:"taxClass"`
 }
 
 type Image struct {
@@ -56,36 +67,89 @@ type Category struct {
 }
 
 func (c Category) MarshalJSON() ([]byte, error) {
-	type Alias Category
-	var pid *string
-	var defaultImageURL *string
-	var seoTitle *string
-	var seoDescription *string
+	return json.Marshal(c.jsonFields())
+}
+
+// categoryJSON is the JSON form of a Category, for embedding in types that
+// add fields to it.
+type categoryJSON struct {
+	categoryAlias
+	ParentID        *string `json:"parentId"`
+	DefaultImageURL *string `json:"defaultImageUrl"`
+	SEOTitle        *string `json:"seoTitle"`
+	SEODescription  *string `json:"seoDescription"`
+}
+
+type categoryAlias Category
+
+func (c Category) jsonFields() categoryJSON {
+	out := categoryJSON{categoryAlias: categoryAlias(c)}
 	if c.ParentID.Valid {
-		pid = &c.ParentID.String
+		out.ParentID = &c.ParentID.String
 	}
 	if c.DefaultImageURL.Valid {
-		defaultImageURL = &c.DefaultImageURL.String
+		out.DefaultImageURL = &c.DefaultImageURL.String
 	}
 	if c.SEOTitle.Valid {
-		seoTitle = &c.SEOTitle.String
+		out.SEOTitle = &c.SEOTitle.String
 	}
 	if c.SEODescription.Valid {
-		seoDescription = &c.SEODescription.String
-	}
-	return json.Marshal(&struct {
-		Alias
-		ParentID        *string `json:"parentId"`
-		DefaultImageURL *string `json:"defaultImageUrl"`
-		SEOTitle        *string `json:"seoTitle"`
-		SEODescription  *string `json:"seoDescription"`
-	}{
-		Alias:           Alias(c),
-		ParentID:        pid,
-		DefaultImageURL: defaultImageURL,
-		SEOTitle:        seoTitle,
-		SEODescription:  seoDescription,
-	})
+		out.SEODescription = &c.SEODescription.String
+	}
+	return out
+}
+
+// Product statuses. Only published products are served by the storefront.
+const (
+	ProductStatusDraft     = "draft"
+	ProductStatusPublished = "published"
+	ProductStatusInactive  = "inactive"
+)
+
+// storefrontVisible is the condition on products p for the storefront:
+// published and inside the optional publishing window. It is evaluated per
+// query, so scheduled products go live and expire without a job.
+const storefrontVisible = `p.status = 'published'
+	AND (p.publish_at IS NULL OR p.publish_at <= now())
+	AND (p.unpublish_at IS NULL OR p.unpublish_at > now())`
+
+const productColumns = `p.id, p.slug, p.title, p.description, p.status, COALESCE(to_json(p.tags), '[]'::json), p.seo_title, p.seo_description, p.tax_class,
+	p.publish_at, p.unpublish_at, p.created_at, p.updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanProduct scans productColumns followed by extra.
+func scanProduct(row rowScanner, extra ...any) (Product, error) {
+	var (
+		p              Product
+		seoTitle       sql.NullString
+		seoDescription sql.NullString
+		tagsRaw        []byte
+	)
+	dest := append([]any{
+		&p.ID, &p.Slug, &p.Title, &p.Description, &p.Status, &tagsRaw, &seoTitle, &seoDescription, &p.TaxClass,
+		&p.PublishAt, &p.UnpublishAt, &p.CreatedAt, &p.UpdatedAt,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return Product{}, err
+	}
+	if len(tagsRaw) > 0 {
+		if err := json.Unmarshal(tagsRaw, &p.Tags); err != nil {
+			return Product{}, err
+		}
+	}
+	if p.Tags == nil {
+		p.Tags = []string{}
+	}
+	if seoTitle.Valid {
+		p.SEOTitle = &seoTitle.String
+	}
+	if seoDescription.Valid {
+		p.SEODescription = &seoDescription.String
+	}
+	return p, nil
 }
 
 // Pagination parameters for list queries.
@@ -94,31 +158,57 @@ type Pagination struct {
 	Limit int
 }
 
-// ListProductsParams input for listing products.
+// ListProductsParams input for listing products. Empty filters do not
+// filter. Values within a filter are alternatives; different filters must
+// all match.
 type ListProductsParams struct {
 	Pagination
 	CategorySlug string
+	// CategorySlugs adds categories to CategorySlug.
+	CategorySlugs []string
+	// IncludeDescendants also matches products in subcategories of the
+	// requested categories.
+	IncludeDescendants bool
+	Tags               []string
+	// Attributes maps a variant attribute name to accepted values. The
+	// attribute, price and stock filters must all hold for one variant.
+	Attributes    map[string][]string
+	MinPriceCents *int
+	MaxPriceCents *int
+	InStock       bool
+	// Facets also counts the facets of the matching products.
+	Facets bool
+	// Query keeps products matching every word, as SearchProducts does but
+	// without typo tolerance.
+	Query string
+	// Sort is one of the ProductSort orders; empty sorts by relevance when
+	// searching and by title otherwise.
+	Sort string
+	// Cursor continues after the page it was returned with, in place of
+	// Page. It must come from a list with the same sort and, when sorted by
+	// relevance, the same query.
+	Cursor string
 }
 
 // ProductListResult is the paginated result for products.
 type ProductListResult struct {
-	Items []Product
-	Total int
-	Page  int
-	Limit int
+	Items  []Product
+	Total  int
+	Page   int
+	Limit  int
+	Facets *ProductFacets
+	// NextCursor continues after the last item; it is empty on the last
+	// page.
+	NextCursor string
 }
 
 type Store struct {
 	db *sql.DB
 
-	stmtListProducts           *sql.Stmt
-	stmtListProductsByCategory *sql.Stmt
-	stmtCountProducts          *sql.Stmt
-	stmtCountProductsByCat     *sql.Stmt
-	stmtGetProductBySlug       *sql.Stmt
-	stmtListProductVariants    *sql.Stmt
-	stmtListProductImages      *sql.Stmt
-	stmtListCategories         *sql.Stmt
+	stmtGetProductBySlug    *sql.Stmt
+	stmtListProductVariants *sql.Stmt
+	stmtListProductImages   *sql.Stmt
+	stmtListCategories      *sql.Stmt
 }
 
 func NewStore(ctx context.Context, db *sql.DB) (*Store, error) {
@@ -126,51 +216,15 @@ func NewStore(ctx context.Context, db *sql.DB) (*Store, error) {
 		return nil, errors.New("nil db")
 	}
 	// Prepare statements
-	stmtList, err := db.PrepareContext(ctx, `
-		SELECT p.id, p.slug, p.title, p.description, p.status, COALESCE(to_json(p.tags), '[]'::json), p.seo_title, p.seo_description, p.created_at, p.updated_at
-		FROM products p
-		ORDER BY p.title ASC
-		LIMIT $1 OFFSET $2`)
-	if err != nil {
-		return nil, err
-	}
-
-	stmtListByCat, err := db.PrepareContext(ctx, `
-		SELECT p.id, p.slug, p.title, p.description, p.status, COALESCE(to_json(p.tags), '[]'::json), p.seo_title, p.seo_description, p.created_at, p.updated_at
-		FROM products p
-		JOIN product_categories pc ON pc.product_id = p.id
-		JOIN categories c ON c.id = pc.category_id
-		WHERE c.slug = $1
-		ORDER BY p.title ASC
-		LIMIT $2 OFFSET $3`)
-	if err != nil {
-		return nil, err
-	}
-
-	stmtCount, err := db.PrepareContext(ctx, `SELECT COUNT(*) FROM products`)
-	if err != nil {
-		return nil, err
-	}
-
-	stmtCountByCat, err := db.PrepareContext(ctx, `
-		SELECT COUNT(*)
-		FROM products p
-		JOIN product_categories pc ON pc.product_id = p.id
-		JOIN categories c ON c.id = pc.category_id
-		WHERE c.slug = $1`)
-	if err != nil {
-		return nil, err
-	}
-
 	stmtGetBySlug, err := db.PrepareContext(ctx, `
-		SELECT id, slug, title, description, status, COALESCE(to_json(tags), '[]'::json), seo_title, seo_description, created_at, updated_at
-		FROM products WHERE slug = $1`)
+		SELECT `+productColumns+`
+		FROM products p WHERE p.slug = $1 AND `+storefrontVisible)
 	if err != nil {
 		return nil, err
 	}
 
 	stmtListVariants, err := db.PrepareContext(ctx, `
-		SELECT id, sku, price_cents, compare_at_price_cents, currency, stock, attributes_json
+		SELECT id, sku, price_cents, compare_at_price_cents, currency, stock, attributes_json, tax_class
 		FROM product_variants
 		WHERE product_id = $1
 		ORDER BY sku ASC`)
@@ -194,25 +248,17 @@ func NewStore(ctx context.Context, db *sql.DB) (*Store, error) {
 	}
 
 	return &Store{
-		db:                         db,
-		stmtListProducts:           stmtList,
-		stmtListProductsByCategory: stmtListByCat,
-		stmtCountProducts:          stmtCount,
-		stmtCountProductsByCat:     stmtCountByCat,
-		stmtGetProductBySlug:       stmtGetBySlug,
-		stmtListProductVariants:    stmtListVariants,
-		stmtListProductImages:      stmtListImages,
-		stmtListCategories:         stmtListCats,
+		db:                      db,
+		stmtGetProductBySlug:    stmtGetBySlug,
+		stmtListProductVariants: stmtListVariants,
+		stmtListProductImages:   stmtListImages,
+		stmtListCategories:      stmtListCats,
 	}, nil
 }
 
 func (s *Store) Close() error {
 	var firstErr error
 	closers := []*sql.Stmt{
-		s.stmtListProducts,
-		s.stmtListProductsByCategory,
-		s.stmtCountProducts,
-		s.stmtCountProductsByCat,
 		s.stmtGetProductBySlug,
 		s.stmtListProductVariants,
 		s.stmtListProductImages,
@@ -244,49 +290,64 @@ func sanitizePagination(p Pagination) (page int, limit int, offset int) {
 
 func (s *Store) ListProducts(ctx context.Context, in ListProductsParams) (ProductListResult, error) {
 	page, limit, offset := sanitizePagination(in.Pagination)
-	var (
-		rows  *sql.Rows
-		err   error
-		total int
-	)
-	if in.CategorySlug != "" {
-		// Count with category
-		if err = s.stmtCountProductsByCat.QueryRowContext(ctx, in.CategorySlug).Scan(&total); err != nil {
-			return ProductListResult{}, err
-		}
-		rows, err = s.stmtListProductsByCategory.QueryContext(ctx, in.CategorySlug, limit, offset)
-	} else {
-		if err = s.stmtCountProducts.QueryRowContext(ctx).Scan(&total); err != nil {
+	sortName, err := in.sortName()
+	if err != nil {
+		return ProductListResult{}, err
+	}
+	if strings.TrimSpace(in.Query) != "" && len(searchTerms(in.Query)) == 0 {
+		return ProductListResult{}, ErrInvalidSearchQuery
+	}
+	where, args := productFilter(in, filterSkip{}, false)
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM products p"+where, args...).Scan(&total); err != nil {
+		return ProductListResult{}, err
+	}
+
+	appendArg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+	order := productSorts[sortName]
+	var cursorQuery string
+	if sortName == ProductSortRelevance {
+		cursorQuery = prefixTSQuery(searchTerms(in.Query))
+		order.expr = relevanceExpr(appendArg(cursorQuery))
+	}
+	direction, after := "ASC", ">"
+	if order.desc {
+		direction, after = "DESC", "<"
+	}
+	if in.Cursor != "" {
+		cursor, err := decodeProductCursor(in.Cursor, sortName, cursorQuery)
+		if err != nil {
 			return ProductListResult{}, err
 		}
-		rows, err = s.stmtListProducts.QueryContext(ctx, limit, offset)
+		where += " AND (" + order.expr + ", p.id) " + after +
+			" (" + appendArg(cursor.Key) + "::" + order.sqlType + ", " + appendArg(cursor.ID) + "::uuid)"
+		page, offset = 0, 0
 	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+productColumns+`, (`+order.expr+`)::text
+		FROM products p`+where+`
+		ORDER BY `+order.expr+` `+direction+`, p.id `+direction+`
+		LIMIT `+appendArg(limit+1)+` OFFSET `+appendArg(offset), args...)
 	if err != nil {
 		return ProductListResult{}, err
 	}
 	defer rows.Close()
 
+	// One row more than the page tells whether another page follows.
 	items := make([]Product, 0, limit)
+	var lastKey string
+	more := false
 	for rows.Next() {
-		var p Product
-		var seoTitle sql.NullString
-		var seoDescription sql.NullString
-		var tagsRaw []byte
-		if err := rows.Scan(&p.ID, &p.Slug, &p.Title, &p.Description, &p.Status, &tagsRaw, &seoTitle, &seoDescription, &p.CreatedAt, &p.UpdatedAt); err != nil {
-			return ProductListResult{}, err
-		}
-		if len(tagsRaw) > 0 {
-			if err := json.Unmarshal(tagsRaw, &p.Tags); err != nil {
-				return ProductListResult{}, err
-			}
-		} else {
-			p.Tags = []string{}
-		}
-		if seoTitle.Valid {
-			p.SEOTitle = &seoTitle.String
+		if len(items) == limit {
+			more = true
+			break
 		}
-		if seoDescription.Valid {
-			p.SEODescription = &seoDescription.String
+		p, err := scanProduct(rows, &lastKey)
+		if err != nil {
+			return ProductListResult{}, err
 		}
 
 		variants, err := s.listProductVariants(ctx, p.ID)
@@ -307,34 +368,46 @@ func (s *Store) ListProducts(ctx context.Context, in ListProductsParams) (Produc
 		return ProductListResult{}, err
 	}
 
-	return ProductListResult{Items: items, Total: total, Page: page, Limit: limit}, nil
+	res := ProductListResult{Items: items, Total: total, Page: page, Limit: limit}
+	if more {
+		res.NextCursor = encodeProductCursor(productCursor{Sort: sortName, Query: cursorQuery, Key: lastKey, ID: items[len(items)-1].ID})
+	}
+	if in.Facets {
+		facets, err := s.listProductFacets(ctx, in)
+		if err != nil {
+			return ProductListResult{}, err
+		}
+		res.Facets = &facets
+	}
+	return res, nil
 }
 
+// GetProductBySlug returns a product the storefront may show, with its
+// variants, images and active custom options.
 func (s *Store) GetProductBySlug(ctx context.Context, slug string) (Product, error) {
-	var p Product
-	var seoTitle sql.NullString
-	var seoDescription sql.NullString
-	var tagsRaw []byte
-	err := s.stmtGetProductBySlug.QueryRowContext(ctx, slug).Scan(
-		&p.ID, &p.Slug, &p.Title, &p.Description, &p.Status, &tagsRaw, &seoTitle, &seoDescription, &p.CreatedAt, &p.UpdatedAt,
-	)
+	p, err := scanProduct(s.stmtGetProductBySlug.QueryRowContext(ctx, slug))
 	if err != nil {
 		return Product{}, err
 	}
-	if len(tagsRaw) > 0 {
-		if err := json.Unmarshal(tagsRaw, &p.Tags); err != nil {
-			return Product{}, err
-		}
-	} else {
-		p.Tags = []string{}
-	}
-	if seoTitle.Valid {
-		p.SEOTitle = &seoTitle.String
+	return s.loadProductDetail(ctx, p)
+}
+
+// GetProductPreview returns a product by slug whatever its status or
+// schedule, provided token is the product's preview token.
+func (s *Store) GetProductPreview(ctx context.Context, slug, token string) (Product, error) {
+	if token == "" {
+		return Product{}, sql.ErrNoRows
 	}
-	if seoDescription.Valid {
-		p.SEODescription = &seoDescription.String
+	p, err := scanProduct(s.db.QueryRowContext(ctx,
+		"SELECT "+productColumns+" FROM products p WHERE p.slug = $1 AND p.preview_token = $2", slug, token,
+	))
+	if err != nil {
+		return Product{}, err
 	}
+	return s.loadProductDetail(ctx, p)
+}
 
+func (s *Store) loadProductDetail(ctx context.Context, p Product) (Product, error) {
 	variants, err := s.listProductVariants(ctx, p.ID)
 	if err != nil {
 		return Product{}, err
@@ -405,12 +478,16 @@ func (s *Store) listProductVariants(ctx context.Context, productID string) ([]Va
 			v             Variant
 			compareAtRaw  sql.NullInt64
 			attributesRaw []byte
+			taxClass      sql.NullString
 		)
 		if err := rows.Scan(
-			&v.ID, &v.SKU, &v.PriceCents, &compareAtRaw, &v.Currency, &v.Stock, &attributesRaw,
+			&v.ID, &v.SKU, &v.PriceCents, &compareAtRaw, &v.Currency, &v.Stock, &attributesRaw, &taxClass,
 		); err != nil {
 			return nil, err
 		}
+		if taxClass.Valid {
+			v.TaxClass = &taxClass.String
+		}
 		if compareAtRaw.Valid {
 			compareAt := int(compareAtRaw.Int64)
 			v.CompareAtPriceCents = &compareAt
@@ -27,7 +27,10 @@ type Customer struct {
 	Email        string
 	PasswordHash string
 	Status       string
-	CreatedAt    time.Time
+	// EmailVerifiedAt is set once the customer confirms their email; only
+	// then are guest orders placed with that email attached to the account.
+	EmailVerifiedAt *time.Time
+	CreatedAt       time.Time
 }
 
 type Session struct {
@@ -56,23 +59,67 @@ type FavoritesPage struct {
 	Limit int
 }
 
+// OrderHistoryItem is read from the order line snapshot, so it keeps showing
+// what was bought after the product is edited or deleted.
 type OrderHistoryItem struct {
+	ID             string
 	ProductID      string
 	Slug           string
 	Title          string
+	SKU            string
+	ImageURL       string
+	CustomOptions  []OrderHistoryItemOption
 	Quantity       int
 	UnitPriceCents int
 	Currency       string
 }
 
+type OrderHistoryItemOption struct {
+	OptionID        string
+	Title           string
+	Type            string
+	ValueText       string
+	ValueTitle      string
+	ValueTitles     []string
+	PriceDeltaCents int
+}
+
+// OrderHistoryStatusChange is a status change shown to the customer; the
+// acting admin and internal notes are intentionally left out.
+type OrderHistoryStatusChange struct {
+	From      string
+	To        string
+	CreatedAt time.Time
+}
+
+// OrderHistoryShipment is a parcel sent for the order with the carrier's
+// tracking details and the titles of the items it contains.
+type OrderHistoryShipment struct {
+	Carrier        string
+	TrackingNumber string
+	TrackingURL    string
+	Status         string
+	ShippedAt      time.Time
+	DeliveredAt    *time.Time
+	Items          []OrderHistoryShipmentItem
+}
+
+type OrderHistoryShipmentItem struct {
+	Title    string
+	SKU      string
+	Quantity int
+}
+
 type OrderHistoryOrder struct {
-	ID         string
-	Number     string
-	Status     string
-	TotalCents int
-	Currency   string
-	CreatedAt  time.Time
-	Items      []OrderHistoryItem
+	ID            string
+	Number        string
+	Status        string
+	TotalCents    int
+	Currency      string
+	CreatedAt     time.Time
+	Items         []OrderHistoryItem
+	StatusHistory []OrderHistoryStatusChange
+	Shipments     []OrderHistoryShipment
 }
 
 type OrdersPage struct {
@@ -280,10 +327,10 @@ func (s *Store) GetCustomerByEmail(ctx context.Context, email string) (Customer,
 	normalizedEmail := normalizeEmail(email)
 	var c Customer
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, email, password_hash, status, created_at
+		SELECT id, email, password_hash, status, email_verified_at, created_at
 		FROM customers
 		WHERE email = $1`, normalizedEmail).
-		Scan(&c.ID, &c.Email, &c.PasswordHash, &c.Status, &c.CreatedAt)
+		Scan(&c.ID, &c.Email, &c.PasswordHash, &c.Status, &c.EmailVerifiedAt, &c.CreatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Customer{}, ErrNotFound
@@ -293,6 +340,20 @@ func (s *Store) GetCustomerByEmail(ctx context.Context, email string) (Customer,
 	return c, nil
 }
 
+// GetCompanyVAT returns the VAT number saved on the customer's profile, used
+// to decide on reverse charge at checkout.
+func (s *Store) GetCompanyVAT(ctx context.Context, customerID string) (string, error) {
+	var vat string
+	err := s.db.QueryRowContext(ctx, `SELECT company_vat FROM customers WHERE id = $1`, customerID).Scan(&vat)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return strings.TrimSpace(vat), nil
+}
+
 func (s *Store) CreateSession(ctx context.Context, customerID, tokenHash string, expiresAt time.Time) (Session, error) {
 	var sess Session
 	err := s.db.QueryRowContext(ctx, `
@@ -309,14 +370,14 @@ func (s *Store) CreateSession(ctx context.Context, customerID, tokenHash string,
 func (s *Store) GetCustomerBySessionTokenHash(ctx context.Context, tokenHash string) (Customer, error) {
 	var c Customer
 	err := s.db.QueryRowContext(ctx, `
-		SELECT c.id, c.email, c.password_hash, c.status, c.created_at
+		SELECT c.id, c.email, c.password_hash, c.status, c.email_verified_at, c.created_at
 		FROM customer_sessions cs
 		JOIN customers c ON c.id = cs.customer_id
 		WHERE cs.token_hash = $1
 		AND cs.revoked_at IS NULL
 		AND cs.expires_at > now()
 		AND c.status = 'active'`, tokenHash).
-		Scan(&c.ID, &c.Email, &c.PasswordHash, &c.Status, &c.CreatedAt)
+		Scan(&c.ID, &c.Email, &c.PasswordHash, &c.Status, &c.EmailVerifiedAt, &c.CreatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Customer{}, ErrNotFound
@@ -484,6 +545,16 @@ func (s *Store) ListOrdersByCustomer(ctx context.Context, customerID string, pag
 			return OrdersPage{}, err
 		}
 		ord.Items = items
+		history, err := s.listOrderStatusHistory(ctx, ord.ID)
+		if err != nil {
+			return OrdersPage{}, err
+		}
+		ord.StatusHistory = history
+		shipments, err := s.listOrderShipmentsForHistory(ctx, ord.ID)
+		if err != nil {
+			return OrdersPage{}, err
+		}
+		ord.Shipments = shipments
 		out.Items = append(out.Items, ord)
 	}
 	if err := rows.Err(); err != nil {
@@ -495,15 +566,17 @@ func (s *Store) ListOrdersByCustomer(ctx context.Context, customerID string, pag
 func (s *Store) listOrderItemsForHistory(ctx context.Context, orderID string) ([]OrderHistoryItem, error) {
 	rows, err := s.db.QueryContext(ctx, `
 		SELECT
-			p.id,
-			p.slug,
-			p.title,
+			oi.id,
+			COALESCE(oi.product_id::text, ''),
+			oi.product_slug,
+			oi.product_title,
+			oi.sku,
+			oi.image_url,
+			oi.custom_options_json,
 			oi.quantity,
 			oi.unit_price_cents,
 			oi.currency
 		FROM order_items oi
-		JOIN product_variants pv ON pv.id = oi.product_variant_id
-		JOIN products p ON p.id = pv.product_id
 		WHERE oi.order_id = $1
 		ORDER BY oi.created_at ASC, oi.id ASC
 	`, orderID)
@@ -515,9 +588,18 @@ func (s *Store) listOrderItemsForHistory(ctx context.Context, orderID string) ([
 	out := make([]OrderHistoryItem, 0, 8)
 	for rows.Next() {
 		var item OrderHistoryItem
-		if err := rows.Scan(&item.ProductID, &item.Slug, &item.Title, &item.Quantity, &item.UnitPriceCents, &item.Currency); err != nil {
+		var optionsRaw []byte
+		if err := rows.Scan(&item.ID, &item.ProductID, &item.Slug, &item.Title, &item.SKU, &item.ImageURL, &optionsRaw, &item.Quantity, &item.UnitPriceCents, &item.Currency); err != nil {
 			return nil, err
 		}
+		if len(optionsRaw) > 0 {
+			if err := json.Unmarshal(optionsRaw, &item.CustomOptions); err != nil {
+				return nil, err
+			}
+		}
+		if item.CustomOptions == nil {
+			item.CustomOptions = []OrderHistoryItemOption{}
+		}
 		out = append(out, item)
 	}
 	if err := rows.Err(); err != nil {
@@ -526,6 +608,100 @@ func (s *Store) listOrderItemsForHistory(ctx context.Context, orderID string) ([
 	return out, nil
 }
 
+func (s *Store) listOrderShipmentsForHistory(ctx context.Context, orderID string) ([]OrderHistoryShipment, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			sh.id,
+			COALESCE(sp.name, sh.provider_key),
+			sh.tracking_number,
+			sh.tracking_url,
+			sh.status,
+			sh.shipped_at,
+			sh.delivered_at
+		FROM order_shipments sh
+		LEFT JOIN shipping_providers sp ON sp.key = sh.provider_key
+		WHERE sh.order_id = $1 AND sh.status <> 'cancelled'
+		ORDER BY sh.shipped_at ASC, sh.created_at ASC
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]OrderHistoryShipment, 0, 2)
+	byID := map[string]int{}
+	for rows.Next() {
+		var id string
+		var shipment OrderHistoryShipment
+		if err := rows.Scan(&id, &shipment.Carrier, &shipment.TrackingNumber, &shipment.TrackingURL, &shipment.Status, &shipment.ShippedAt, &shipment.DeliveredAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		shipment.Items = []OrderHistoryShipmentItem{}
+		byID[id] = len(out)
+		out = append(out, shipment)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+	if len(out) == 0 {
+		return out, nil
+	}
+
+	lineRows, err := s.db.QueryContext(ctx, `
+		SELECT sl.shipment_id, oi.product_title, oi.sku, sl.quantity
+		FROM order_shipment_lines sl
+		JOIN order_shipments sh ON sh.id = sl.shipment_id
+		JOIN order_items oi ON oi.id = sl.order_item_id
+		WHERE sh.order_id = $1
+		ORDER BY oi.created_at ASC, oi.id ASC
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer lineRows.Close()
+	for lineRows.Next() {
+		var shipmentID string
+		var item OrderHistoryShipmentItem
+		if err := lineRows.Scan(&shipmentID, &item.Title, &item.SKU, &item.Quantity); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[shipmentID]; ok {
+			out[i].Items = append(out[i].Items, item)
+		}
+	}
+	if err := lineRows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *Store) listOrderStatusHistory(ctx context.Context, orderID string) ([]OrderHistoryStatusChange, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT COALESCE(from_status, ''), to_status, created_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY created_at ASC
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]OrderHistoryStatusChange, 0, 4)
+	for rows.Next() {
+		var change OrderHistoryStatusChange
+		if err := rows.Scan(&change.From, &change.To, &change.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (s *Store) UpdatePasswordAndRevokeSessions(ctx context.Context, customerID, passwordHash string) error {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -0,0 +1,97 @@
+package customers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ClaimedOrder is a former guest order attached to a customer account.
+type ClaimedOrder struct {
+	ID     string
+	Number string
+}
+
+// CreateEmailVerification stores a hashed verification token for the
+// customer's current email. Older unused tokens stay valid until they expire.
+func (s *Store) CreateEmailVerification(ctx context.Context, customerID, tokenHash string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO customer_email_verifications (customer_id, email, token_hash, expires_at)
+		SELECT id, email, $2, $3
+		FROM customers
+		WHERE id = $1`, customerID, tokenHash, expiresAt)
+	return err
+}
+
+// VerifyEmail consumes a verification token and marks the customer's email
+// as verified. Unknown, used or expired tokens, and tokens issued for an email
+// the customer no longer has, return ErrNotFound.
+func (s *Store) VerifyEmail(ctx context.Context, tokenHash string) (Customer, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Customer{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var c Customer
+	err = tx.QueryRowContext(ctx, `
+		UPDATE customer_email_verifications v
+		SET used_at = now()
+		FROM customers c
+		WHERE v.token_hash = $1
+		AND v.used_at IS NULL
+		AND v.expires_at > now()
+		AND c.id = v.customer_id
+		AND c.email = v.email
+		AND c.status = 'active'
+		RETURNING c.id`, tokenHash).Scan(&c.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Customer{}, ErrNotFound
+		}
+		return Customer{}, err
+	}
+	err = tx.QueryRowContext(ctx, `
+		UPDATE customers
+		SET email_verified_at = COALESCE(email_verified_at, now()), updated_at = now()
+		WHERE id = $1
+		RETURNING email, password_hash, status, email_verified_at, created_at`, c.ID).
+		Scan(&c.Email, &c.PasswordHash, &c.Status, &c.EmailVerifiedAt, &c.CreatedAt)
+	if err != nil {
+		return Customer{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Customer{}, err
+	}
+	return c, nil
+}
+
+// ClaimGuestOrders attaches orders placed without an account under the
+// customer's email to the customer. Nothing is claimed until the email is
+// verified, so registering with someone else's address exposes no orders.
+func (s *Store) ClaimGuestOrders(ctx context.Context, customerID string) ([]ClaimedOrder, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE orders o
+		SET customer_id = c.id, updated_at = now()
+		FROM customers c
+		WHERE c.id = $1
+		AND c.email_verified_at IS NOT NULL
+		AND c.email <> ''
+		AND o.customer_id IS NULL
+		AND lower(o.email) = c.email
+		RETURNING o.id, o.number`, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ClaimedOrder
+	for rows.Next() {
+		var o ClaimedOrder
+		if err := rows.Scan(&o.ID, &o.Number); err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
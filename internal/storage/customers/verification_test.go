@@ -0,0 +1,85 @@
+package customers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	platformdb "goecommerce/internal/platform/db"
+)
+
+func TestVerifyEmailAndClaimGuestOrders(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set; skipping customers integration test")
+	}
+	ctx := context.Background()
+	db, err := platformdb.Open(ctx, dsn)
+	if err != nil {
+		t.Fatalf("db open error: %v", err)
+	}
+	defer db.Close()
+
+	assertTableExists(t, ctx, db, "customers")
+	assertTableExists(t, ctx, db, "orders")
+	assertTableExists(t, ctx, db, "customer_email_verifications")
+
+	store, err := NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("customers store init: %v", err)
+	}
+	email := fmt.Sprintf("claim-%d@example.com", time.Now().UnixNano())
+	c, err := store.CreateCustomer(ctx, email, "hash")
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	insertGuestOrder := func(orderEmail string) string {
+		t.Helper()
+		var id string
+		if err := db.QueryRowContext(ctx, `
+			INSERT INTO orders (number, status, currency, subtotal_cents, shipping_cents, tax_cents, total_cents, email)
+			VALUES ($1, 'pending_payment', 'USD', 1000, 0, 0, 1000, $2)
+			RETURNING id`, fmt.Sprintf("ORD-G-%d", time.Now().UnixNano()), orderEmail).Scan(&id); err != nil {
+			t.Fatalf("insert guest order: %v", err)
+		}
+		return id
+	}
+	guestOrder := insertGuestOrder(strings.ToUpper(email))
+	otherOrder := insertGuestOrder("other-" + email)
+
+	claimed, err := store.ClaimGuestOrders(ctx, c.ID)
+	if err != nil || len(claimed) != 0 {
+		t.Fatalf("expected nothing claimed before verification, got %v err=%v", claimed, err)
+	}
+
+	if err := store.CreateEmailVerification(ctx, c.ID, "verify-hash-"+c.ID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("create verification: %v", err)
+	}
+	if _, err := store.VerifyEmail(ctx, "missing-hash"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for unknown token, got %v", err)
+	}
+	verified, err := store.VerifyEmail(ctx, "verify-hash-"+c.ID)
+	if err != nil || verified.EmailVerifiedAt == nil || verified.ID != c.ID {
+		t.Fatalf("expected verified customer, got %+v err=%v", verified, err)
+	}
+	if _, err := store.VerifyEmail(ctx, "verify-hash-"+c.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected used token to be rejected, got %v", err)
+	}
+
+	claimed, err = store.ClaimGuestOrders(ctx, c.ID)
+	if err != nil || len(claimed) != 1 || claimed[0].ID != guestOrder {
+		t.Fatalf("expected guest order %s to be claimed, got %v err=%v", guestOrder, claimed, err)
+	}
+	var otherCustomer *string
+	if err := db.QueryRowContext(ctx, "SELECT customer_id::text FROM orders WHERE id = $1", otherOrder).Scan(&otherCustomer); err != nil || otherCustomer != nil {
+		t.Fatalf("expected order with another email to stay a guest order, got %v err=%v", otherCustomer, err)
+	}
+	page, err := store.ListOrdersByCustomer(ctx, c.ID, 1, 20)
+	if err != nil || page.Total != 1 {
+		t.Fatalf("expected claimed order in account history, got %+v err=%v", page, err)
+	}
+}
@@ -0,0 +1,152 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	platformhttp "goecommerce/internal/platform/http"
+)
+
+const (
+	// lockTTL bounds how long a reservation without a response survives, so
+	// a crashed request does not block its key for a whole day.
+	lockTTL = time.Minute
+	// recordTTL is how long completed responses are replayed.
+	recordTTL = 24 * time.Hour
+)
+
+// Store keeps idempotency keys in Redis and falls back to Postgres when Redis
+// is not configured or not reachable.
+type Store struct {
+	redis *redis.Client
+	db    *sql.DB
+}
+
+func NewStore(redisClient *redis.Client, db *sql.DB) (*Store, error) {
+	if redisClient == nil && db == nil {
+		return nil, errors.New("no redis or db")
+	}
+	return &Store{redis: redisClient, db: db}, nil
+}
+
+func (s *Store) Close() error { return nil }
+
+func (s *Store) Reserve(ctx context.Context, key, requestHash string) (*platformhttp.IdempotencyRecord, bool, error) {
+	if s.redis != nil {
+		rec, reserved, err := s.reserveRedis(ctx, key, requestHash)
+		if err == nil || s.db == nil {
+			return rec, reserved, err
+		}
+	}
+	return s.reserveDB(ctx, key, requestHash)
+}
+
+func (s *Store) Complete(ctx context.Context, key string, rec platformhttp.IdempotencyRecord) error {
+	if s.redis != nil {
+		raw, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		err = s.redis.Set(ctx, redisKey(key), raw, recordTTL).Err()
+		if err == nil || s.db == nil {
+			return err
+		}
+	}
+	headers, err := json.Marshal(rec.Header)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET completed = true, status_code = $2, response_headers_json = $3::jsonb, response_body = $4, expires_at = $5
+		WHERE key = $1`,
+		key, rec.StatusCode, string(headers), rec.Body, time.Now().Add(recordTTL),
+	)
+	return err
+}
+
+func (s *Store) Release(ctx context.Context, key string) error {
+	if s.redis != nil {
+		err := s.redis.Del(ctx, redisKey(key)).Err()
+		if err == nil || s.db == nil {
+			return err
+		}
+	}
+	_, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key = $1", key)
+	return err
+}
+
+func redisKey(key string) string { return "idempotency:" + key }
+
+func (s *Store) reserveRedis(ctx context.Context, key, requestHash string) (*platformhttp.IdempotencyRecord, bool, error) {
+	raw, err := json.Marshal(platformhttp.IdempotencyRecord{RequestHash: requestHash})
+	if err != nil {
+		return nil, false, err
+	}
+	ok, err := s.redis.SetNX(ctx, redisKey(key), raw, lockTTL).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if ok {
+		return nil, true, nil
+	}
+	existing, err := s.redis.Get(ctx, redisKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// Expired between SETNX and GET; try once more.
+		ok, err = s.redis.SetNX(ctx, redisKey(key), raw, lockTTL).Result()
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			return nil, true, nil
+		}
+		existing, err = s.redis.Get(ctx, redisKey(key)).Bytes()
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var rec platformhttp.IdempotencyRecord
+	if err := json.Unmarshal(existing, &rec); err != nil {
+		return nil, false, err
+	}
+	return &rec, false, nil
+}
+
+// reserveDB inserts the key, taking over rows whose reservation or stored
+// response has expired.
+func (s *Store) reserveDB(ctx context.Context, key, requestHash string) (*platformhttp.IdempotencyRecord, bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (key, request_hash, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, completed = false, status_code = 0,
+			response_headers_json = '{}'::jsonb, response_body = NULL, created_at = now(), expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at < now()`,
+		key, requestHash, time.Now().Add(lockTTL),
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return nil, true, nil
+	}
+	var rec platformhttp.IdempotencyRecord
+	var headers []byte
+	if err := s.db.QueryRowContext(ctx,
+		"SELECT request_hash, completed, status_code, response_headers_json, COALESCE(response_body, ''::bytea) FROM idempotency_keys WHERE key = $1",
+		key,
+	).Scan(&rec.RequestHash, &rec.Completed, &rec.StatusCode, &headers, &rec.Body); err != nil {
+		return nil, false, err
+	}
+	if len(headers) > 0 {
+		if err := json.Unmarshal(headers, &rec.Header); err != nil {
+			return nil, false, err
+		}
+	}
+	return &rec, false, nil
+}
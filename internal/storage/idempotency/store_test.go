@@ -0,0 +1,68 @@
+package idempotency
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	platformdb "goecommerce/internal/platform/db"
+	platformhttp "goecommerce/internal/platform/http"
+)
+
+func TestStorePostgresReserveCompleteRelease(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set; skipping integration test")
+	}
+	ctx := context.Background()
+	db, err := platformdb.Open(ctx, dsn)
+	if err != nil {
+		t.Fatalf("db open error: %v", err)
+	}
+	defer db.Close()
+
+	var regclass *string
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('public.idempotency_keys')").Scan(&regclass); err != nil || regclass == nil || *regclass == "" {
+		t.Skip("idempotency_keys table not present; apply migrations to run this test")
+	}
+
+	store, err := NewStore(nil, db)
+	if err != nil {
+		t.Fatalf("new store error: %v", err)
+	}
+	const key = "/checkout:test-idempotency-key"
+	_, _ = db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key = $1", key)
+	defer func() { _, _ = db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key = $1", key) }()
+
+	if _, reserved, err := store.Reserve(ctx, key, "hash-1"); err != nil || !reserved {
+		t.Fatalf("expected first reserve to succeed, got reserved=%v err=%v", reserved, err)
+	}
+	rec, reserved, err := store.Reserve(ctx, key, "hash-1")
+	if err != nil || reserved || rec == nil || rec.Completed {
+		t.Fatalf("expected in-progress record, got %#v reserved=%v err=%v", rec, reserved, err)
+	}
+
+	if err := store.Complete(ctx, key, platformhttp.IdempotencyRecord{
+		RequestHash: "hash-1",
+		Completed:   true,
+		StatusCode:  200,
+		Header:      map[string][]string{"Content-Type": {"application/json"}},
+		Body:        []byte(`{"order_id":"o1"}`),
+	}); err != nil {
+		t.Fatalf("complete error: %v", err)
+	}
+	rec, reserved, err = store.Reserve(ctx, key, "hash-2")
+	if err != nil || reserved {
+		t.Fatalf("expected existing record, got reserved=%v err=%v", reserved, err)
+	}
+	if !rec.Completed || rec.RequestHash != "hash-1" || rec.StatusCode != 200 || string(rec.Body) != `{"order_id":"o1"}` || rec.Header["Content-Type"][0] != "application/json" {
+		t.Fatalf("unexpected stored record %#v", rec)
+	}
+
+	if err := store.Release(ctx, key); err != nil {
+		t.Fatalf("release error: %v", err)
+	}
+	if _, reserved, err := store.Reserve(ctx, key, "hash-2"); err != nil || !reserved {
+		t.Fatalf("expected reserve after release to succeed, got reserved=%v err=%v", reserved, err)
+	}
+}
@@ -0,0 +1,58 @@
+package media
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SourceTypeInvoice marks generated invoice and credit note PDFs. They are
+// written below PrivateDir and never listed in the media library.
+const SourceTypeInvoice = "invoice"
+
+// PrivateDir is the folder of the uploads directory that /uploads/ does not
+// serve; its files are only handed out by authenticated endpoints.
+const PrivateDir = "private"
+
+// UploadsDirFromEnv returns UPLOADS_DIR, defaulting to ./tmp/uploads like the
+// router's /uploads/ file server.
+func UploadsDirFromEnv() string {
+	if dir := strings.TrimSpace(os.Getenv("UPLOADS_DIR")); dir != "" {
+		return dir
+	}
+	return "./tmp/uploads"
+}
+
+// WriteFile stores content at prefix/YYYY/MM/<random><ext> below dir and
+// returns the slash-separated storage path relative to dir.
+func WriteFile(dir, prefix, ext string, content []byte) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	storagePath := path.Join(prefix, fmt.Sprintf("%04d/%02d", now.Year(), int(now.Month())), hex.EncodeToString(buf)+ext)
+	absolutePath := filepath.Join(dir, filepath.FromSlash(storagePath))
+	if err := os.MkdirAll(filepath.Dir(absolutePath), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(absolutePath, content, 0o644); err != nil {
+		return "", err
+	}
+	return storagePath, nil
+}
+
+// ReadFile reads a file written by WriteFile.
+func ReadFile(dir, storagePath string) ([]byte, error) {
+	clean := path.Clean("/" + storagePath)[1:]
+	if clean == "" || clean != storagePath {
+		return nil, errors.New("invalid storage path")
+	}
+	return os.ReadFile(filepath.Join(dir, filepath.FromSlash(clean)))
+}
@@ -62,6 +62,7 @@ func NewStore(ctx context.Context, db *sql.DB) (*Store, error) {
 	stmtListAssets, err := db.PrepareContext(ctx, `
 		SELECT id, url, storage_path, mime_type, size_bytes, alt, source_type, source_url, created_at
 		FROM media_assets
+		WHERE source_type <> 'invoice'
 		ORDER BY created_at DESC, id DESC
 		LIMIT $1 OFFSET $2`)
 	if err != nil {
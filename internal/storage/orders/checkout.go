@@ -0,0 +1,68 @@
+package orders
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Address is a shipping or billing address captured at checkout. Field names
+// follow the saved customer address columns.
+type Address struct {
+	FullName string `json:"full_name"`
+	Phone    string `json:"phone"`
+	Address1 string `json:"address1"`
+	Address2 string `json:"address2"`
+	City     string `json:"city"`
+	State    string `json:"state"`
+	Postcode string `json:"postcode"`
+	Country  string `json:"country"`
+}
+
+// Normalize trims all fields and upper-cases the country code.
+func (a *Address) Normalize() {
+	a.FullName = strings.TrimSpace(a.FullName)
+	a.Phone = strings.TrimSpace(a.Phone)
+	a.Address1 = strings.TrimSpace(a.Address1)
+	a.Address2 = strings.TrimSpace(a.Address2)
+	a.City = strings.TrimSpace(a.City)
+	a.State = strings.TrimSpace(a.State)
+	a.Postcode = strings.TrimSpace(a.Postcode)
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+}
+
+// ShippingSelection is the shipping method chosen at checkout, priced by the
+// server. The method title and provider are copied so the order stays
+// readable if the method is later changed or deleted.
+type ShippingSelection struct {
+	MethodID    string
+	MethodTitle string
+	ProviderKey string
+	ServiceCode string
+	TerminalID  string
+	PriceCents  int
+}
+
+func marshalAddress(a *Address) ([]byte, error) {
+	if a == nil {
+		return nil, nil
+	}
+	return json.Marshal(a)
+}
+
+func unmarshalAddress(raw []byte) (*Address, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var a Address
+	if err := json.Unmarshal(raw, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func nullableJSON(raw []byte) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
@@ -0,0 +1,469 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"goecommerce/internal/platform/tax"
+	storcart "goecommerce/internal/storage/cart"
+)
+
+// ErrInvalidOrderEdit is returned when an edit is malformed or the order can
+// no longer be edited. The wrapped message is safe to show to admins.
+var ErrInvalidOrderEdit = errors.New("invalid order edit")
+
+// Kinds of OrderEditChange.
+const (
+	EditLineAdded          = "line_added"
+	EditLineRemoved        = "line_removed"
+	EditLineChanged        = "line_changed"
+	EditShippingAddressSet = "shipping_address"
+	EditBillingAddressSet  = "billing_address"
+)
+
+// OrderEdit records one admin edit of an order. When the edit lowered a paid
+// order's total, the difference is refunded as order refund RefundID and
+// the Refund* fields show its latest attempt; RefundStatus is a
+// RefundStatus* value, or empty when nothing was refunded.
+type OrderEdit struct {
+	ID                 string            `json:"id"`
+	OrderID            string            `json:"order_id"`
+	Actor              string            `json:"actor"`
+	Reason             string            `json:"reason"`
+	Changes            []OrderEditChange `json:"changes"`
+	PreviousTotalCents int               `json:"previous_total_cents"`
+	TotalCents         int               `json:"total_cents"`
+	RefundID           string            `json:"refund_id"`
+	RefundedCents      int               `json:"refunded_cents"`
+	RefundProvider     string            `json:"refund_provider"`
+	RefundProviderRef  string            `json:"refund_provider_ref"`
+	RefundStatus       string            `json:"refund_status"`
+	CreatedAt          time.Time         `json:"created_at"`
+}
+
+// OrderEditChange is one entry of the edit diff. Line changes carry the
+// quantity and unit price before and after; removed lines end at zero and
+// added lines start at zero. Address changes carry both addresses.
+type OrderEditChange struct {
+	Kind               string   `json:"kind"`
+	OrderItemID        string   `json:"order_item_id,omitempty"`
+	ProductVariantID   string   `json:"product_variant_id,omitempty"`
+	SKU                string   `json:"sku,omitempty"`
+	ProductTitle       string   `json:"product_title,omitempty"`
+	FromQuantity       int      `json:"from_quantity"`
+	ToQuantity         int      `json:"to_quantity"`
+	FromUnitPriceCents int      `json:"from_unit_price_cents"`
+	ToUnitPriceCents   int      `json:"to_unit_price_cents"`
+	PriceReason        string   `json:"price_reason,omitempty"`
+	FromAddress        *Address `json:"from_address,omitempty"`
+	ToAddress          *Address `json:"to_address,omitempty"`
+}
+
+// EditOrderLine changes an existing line. A nil Quantity or UnitPriceCents
+// keeps the current value and a zero Quantity removes the line. Overriding
+// the price requires PriceReason.
+type EditOrderLine struct {
+	OrderItemID    string
+	Quantity       *int
+	UnitPriceCents *int
+	PriceReason    string
+}
+
+// AddOrderLine adds a catalog variant at its current price unless
+// UnitPriceCents overrides it, which requires PriceReason.
+type AddOrderLine struct {
+	ProductVariantID string
+	Quantity         int
+	UnitPriceCents   *int
+	PriceReason      string
+}
+
+type EditOrderInput struct {
+	OrderID         string
+	Actor           string
+	Reason          string
+	Lines           []EditOrderLine
+	Add             []AddOrderLine
+	ShippingAddress *Address
+	BillingAddress  *Address
+}
+
+// EditOrder changes the lines and addresses of an order that has not been
+// fulfilled: it must be pending_payment, awaiting_payment_offline, paid or
+// processing with nothing shipped, refunded or returned. Stock follows the
+// quantity changes, changed lines are taxed again at the order's tax
+// country and treatment, and totals are recomputed; shipping is unchanged.
+//
+// An unpaid order that has been issued a payment (a checkout session or
+// offline payment instructions, recorded as its payment_ref) cannot change
+// its total, and a paid order's total cannot grow. When an edit lowers a paid
+// order's total, the edit is committed with a pending order refund of the
+// difference, which execute then settles like any refund. A failed refund
+// is returned as the error and can be retried with RetryRefund; the edit
+// stays applied.
+// An invoiced order has its invoice reissued: a credit note cancels the old
+// one and a new invoice is issued for the edited order.
+func (s *Store) EditOrder(ctx context.Context, in EditOrderInput, execute RefundExecutor) (OrderEdit, error) {
+	in.Actor = strings.TrimSpace(in.Actor)
+	in.Reason = strings.TrimSpace(in.Reason)
+	if in.Actor == "" {
+		return OrderEdit{}, errors.New("actor is required")
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return OrderEdit{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var o Order
+	var shippingAddressJSON, billingAddressJSON []byte
+	if err := tx.QueryRowContext(ctx, `
+		SELECT id, number, status, currency, total_cents, COALESCE(payment_method,''), COALESCE(payment_ref,''),
+			prices_include_tax, tax_reverse_charge, tax_country, shipping_cents, shipping_tax_cents,
+			shipping_address_json, billing_address_json
+		FROM orders WHERE id = $1 FOR UPDATE`, in.OrderID,
+	).Scan(&o.ID, &o.Number, &o.Status, &o.Currency, &o.TotalCents, &o.PaymentMethod, &o.PaymentRef,
+		&o.PricesIncludeTax, &o.TaxReverseCharge, &o.TaxCountry, &o.ShippingCents, &o.ShippingTaxCents,
+		&shippingAddressJSON, &billingAddressJSON); err != nil {
+		return OrderEdit{}, err
+	}
+	if o.ShippingAddress, err = unmarshalAddress(shippingAddressJSON); err != nil {
+		return OrderEdit{}, err
+	}
+	if o.BillingAddress, err = unmarshalAddress(billingAddressJSON); err != nil {
+		return OrderEdit{}, err
+	}
+	switch o.Status {
+	case "pending_payment", "awaiting_payment_offline", "paid", "processing":
+	default:
+		return OrderEdit{}, fmt.Errorf("%w: %s orders cannot be edited", ErrInvalidOrderEdit, o.Status)
+	}
+	var fulfilled bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM order_shipments WHERE order_id = $1 AND status <> 'cancelled')
+			OR EXISTS (SELECT 1 FROM order_refunds WHERE order_id = $1
+				AND (status = 'pending' OR (status = 'succeeded' AND order_edit_id IS NULL)))
+			OR EXISTS (SELECT 1 FROM order_returns WHERE order_id = $1 AND status <> 'rejected')`, o.ID,
+	).Scan(&fulfilled); err != nil {
+		return OrderEdit{}, err
+	}
+	if fulfilled {
+		return OrderEdit{}, fmt.Errorf("%w: orders with shipments, refunds or returns cannot be edited", ErrInvalidOrderEdit)
+	}
+	if err := snapshotInvoiceLines(ctx, tx, o.ID); err != nil {
+		return OrderEdit{}, err
+	}
+
+	items := map[string]OrderItem{}
+	rows, err := tx.QueryContext(ctx, "SELECT "+orderItemColumns+" FROM order_items WHERE order_id = $1", o.ID)
+	if err != nil {
+		return OrderEdit{}, err
+	}
+	for rows.Next() {
+		it, err := scanOrderItem(rows)
+		if err != nil {
+			rows.Close()
+			return OrderEdit{}, err
+		}
+		items[it.ID] = it
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return OrderEdit{}, err
+	}
+	// Reverse-charged lines were stored at a zero rate, so re-pricing them
+	// needs the country's actual rate to extract tax from gross prices.
+	rates := tax.Rates{}
+	trows, err := tx.QueryContext(ctx, "SELECT tax_class, rate_bps FROM tax_rates WHERE country = $1", o.TaxCountry)
+	if err != nil {
+		return OrderEdit{}, err
+	}
+	for trows.Next() {
+		var class string
+		var bps int
+		if err := trows.Scan(&class, &bps); err != nil {
+			trows.Close()
+			return OrderEdit{}, err
+		}
+		rates[class] = bps
+	}
+	trows.Close()
+	if err := trows.Err(); err != nil {
+		return OrderEdit{}, err
+	}
+	price := func(class string, amount, storedRate int, known bool) tax.LineResult {
+		rate := storedRate
+		if !known || o.TaxReverseCharge {
+			rate = rates.Rate(class)
+		}
+		return tax.CalculateLine(class, amount, rate, o.PricesIncludeTax, o.TaxReverseCharge)
+	}
+
+	var changes []OrderEditChange
+	stockDeltas := map[string]int{}
+	seen := map[string]bool{}
+	for _, line := range in.Lines {
+		it, ok := items[line.OrderItemID]
+		if !ok || seen[line.OrderItemID] {
+			return OrderEdit{}, fmt.Errorf("%w: unknown or repeated order item %q", ErrInvalidOrderEdit, line.OrderItemID)
+		}
+		seen[line.OrderItemID] = true
+		quantity, unitPrice := it.Quantity, it.UnitPriceCents
+		if line.Quantity != nil {
+			quantity = *line.Quantity
+		}
+		if line.UnitPriceCents != nil {
+			unitPrice = *line.UnitPriceCents
+		}
+		if quantity < 0 || unitPrice < 0 {
+			return OrderEdit{}, fmt.Errorf("%w: quantity and price cannot be negative", ErrInvalidOrderEdit)
+		}
+		if unitPrice != it.UnitPriceCents && strings.TrimSpace(line.PriceReason) == "" {
+			return OrderEdit{}, fmt.Errorf("%w: a price override needs a reason", ErrInvalidOrderEdit)
+		}
+		if quantity == it.Quantity && unitPrice == it.UnitPriceCents {
+			continue
+		}
+		if quantity > it.Quantity && it.ProductVariantID == "" {
+			return OrderEdit{}, fmt.Errorf("%w: %s is no longer in the catalog", ErrInvalidOrderEdit, it.ProductTitle)
+		}
+		change := OrderEditChange{
+			Kind: EditLineChanged, OrderItemID: it.ID, ProductVariantID: it.ProductVariantID, SKU: it.SKU, ProductTitle: it.ProductTitle,
+			FromQuantity: it.Quantity, ToQuantity: quantity, FromUnitPriceCents: it.UnitPriceCents, ToUnitPriceCents: unitPrice,
+		}
+		if unitPrice != it.UnitPriceCents {
+			change.PriceReason = strings.TrimSpace(line.PriceReason)
+		}
+		if it.ProductVariantID != "" {
+			stockDeltas[it.ProductVariantID] += quantity - it.Quantity
+		}
+		if quantity == 0 {
+			change.Kind = EditLineRemoved
+			if _, err := tx.ExecContext(ctx, "DELETE FROM order_items WHERE id = $1", it.ID); err != nil {
+				return OrderEdit{}, err
+			}
+			delete(items, it.ID)
+		} else {
+			lr := price(it.TaxClass, unitPrice*quantity, it.TaxRateBps, true)
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE order_items SET quantity = $2, unit_price_cents = $3, tax_rate_bps = $4, net_cents = $5, tax_cents = $6, updated_at = now()
+				WHERE id = $1`, it.ID, quantity, unitPrice, lr.RateBps, lr.NetCents, lr.TaxCents,
+			); err != nil {
+				return OrderEdit{}, err
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	for _, add := range in.Add {
+		if add.Quantity <= 0 {
+			return OrderEdit{}, fmt.Errorf("%w: added lines need a positive quantity", ErrInvalidOrderEdit)
+		}
+		var catalogPrice int
+		var currency, class string
+		if err := tx.QueryRowContext(ctx, `
+			SELECT pv.price_cents, pv.currency, COALESCE(pv.tax_class, p.tax_class)
+			FROM product_variants pv JOIN products p ON p.id = pv.product_id
+			WHERE pv.id = $1`, add.ProductVariantID,
+		).Scan(&catalogPrice, &currency, &class); err != nil {
+			if err == sql.ErrNoRows {
+				return OrderEdit{}, fmt.Errorf("%w: unknown product variant %q", ErrInvalidOrderEdit, add.ProductVariantID)
+			}
+			return OrderEdit{}, err
+		}
+		if currency != o.Currency {
+			return OrderEdit{}, fmt.Errorf("%w: product variant is priced in %s, the order in %s", ErrInvalidOrderEdit, currency, o.Currency)
+		}
+		unitPrice := catalogPrice
+		if add.UnitPriceCents != nil {
+			unitPrice = *add.UnitPriceCents
+			if unitPrice < 0 {
+				return OrderEdit{}, fmt.Errorf("%w: quantity and price cannot be negative", ErrInvalidOrderEdit)
+			}
+			if unitPrice != catalogPrice && strings.TrimSpace(add.PriceReason) == "" {
+				return OrderEdit{}, fmt.Errorf("%w: a price override needs a reason", ErrInvalidOrderEdit)
+			}
+		}
+		lr := price(class, unitPrice*add.Quantity, 0, false)
+		it, err := insertOrderItemSnapshot(ctx, tx, o.ID, storcart.CartItem{
+			ProductVariantID: add.ProductVariantID,
+			UnitPriceCents:   unitPrice,
+			Currency:         o.Currency,
+			Quantity:         add.Quantity,
+		}, lr)
+		if err != nil {
+			return OrderEdit{}, err
+		}
+		items[it.ID] = it
+		stockDeltas[it.ProductVariantID] += it.Quantity
+		change := OrderEditChange{
+			Kind: EditLineAdded, OrderItemID: it.ID, ProductVariantID: it.ProductVariantID, SKU: it.SKU, ProductTitle: it.ProductTitle,
+			ToQuantity: it.Quantity, ToUnitPriceCents: unitPrice,
+		}
+		if unitPrice != catalogPrice {
+			change.PriceReason = strings.TrimSpace(add.PriceReason)
+		}
+		changes = append(changes, change)
+	}
+	linesChanged := len(changes) > 0
+	if linesChanged && len(items) == 0 {
+		return OrderEdit{}, fmt.Errorf("%w: an order needs at least one line; cancel it instead", ErrInvalidOrderEdit)
+	}
+	if err := adjustStock(ctx, tx, stockDeltas); err != nil {
+		return OrderEdit{}, err
+	}
+
+	billingChanged := false
+	for _, a := range []struct {
+		kind, column string
+		to           *Address
+		from         *Address
+	}{
+		{EditShippingAddressSet, "shipping_address_json", in.ShippingAddress, o.ShippingAddress},
+		{EditBillingAddressSet, "billing_address_json", in.BillingAddress, o.BillingAddress},
+	} {
+		if a.to == nil {
+			continue
+		}
+		a.to.Normalize()
+		if a.from != nil && *a.from == *a.to {
+			continue
+		}
+		if a.to.FullName == "" || len(a.to.Country) != 2 {
+			return OrderEdit{}, fmt.Errorf("%w: %s needs full_name and a 2-letter country", ErrInvalidOrderEdit, a.kind)
+		}
+		// The order was taxed for its address countries; moving it to
+		// another country needs a new order.
+		if a.from != nil && a.from.Country != a.to.Country {
+			return OrderEdit{}, fmt.Errorf("%w: the country of %s cannot change", ErrInvalidOrderEdit, a.kind)
+		}
+		raw, err := marshalAddress(a.to)
+		if err != nil {
+			return OrderEdit{}, err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE orders SET "+a.column+" = $2::jsonb WHERE id = $1", o.ID, string(raw)); err != nil {
+			return OrderEdit{}, err
+		}
+		// Invoices fall back to the shipping address when there is no
+		// billing address.
+		if a.kind == EditBillingAddressSet || o.BillingAddress == nil {
+			billingChanged = true
+		}
+		changes = append(changes, OrderEditChange{Kind: a.kind, FromAddress: a.from, ToAddress: a.to})
+	}
+	if len(changes) == 0 {
+		return OrderEdit{}, fmt.Errorf("%w: nothing to change", ErrInvalidOrderEdit)
+	}
+
+	edit := OrderEdit{OrderID: o.ID, Actor: in.Actor, Reason: in.Reason, Changes: changes, PreviousTotalCents: o.TotalCents, TotalCents: o.TotalCents}
+	if linesChanged {
+		var netCents, taxCents int
+		if err := tx.QueryRowContext(ctx,
+			"SELECT COALESCE(SUM(net_cents),0), COALESCE(SUM(tax_cents),0) FROM order_items WHERE order_id = $1", o.ID,
+		).Scan(&netCents, &taxCents); err != nil {
+			return OrderEdit{}, err
+		}
+		subtotal := netCents
+		shippingGross := o.ShippingCents + o.ShippingTaxCents
+		if o.PricesIncludeTax && !o.TaxReverseCharge {
+			subtotal += taxCents
+			shippingGross = o.ShippingCents
+		}
+		edit.TotalCents = netCents + taxCents + shippingGross
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE orders SET subtotal_cents = $2, tax_cents = $3, total_cents = $4 WHERE id = $1",
+			o.ID, subtotal, taxCents+o.ShippingTaxCents, edit.TotalCents,
+		); err != nil {
+			return OrderEdit{}, err
+		}
+	}
+	paid := o.Status == "paid" || o.Status == "processing"
+	switch {
+	case edit.TotalCents == edit.PreviousTotalCents:
+	case !paid && o.PaymentRef != "":
+		return OrderEdit{}, fmt.Errorf("%w: the customer has been issued a payment for the current total", ErrInvalidOrderEdit)
+	case paid && edit.TotalCents > edit.PreviousTotalCents:
+		return OrderEdit{}, fmt.Errorf("%w: the total of a paid order cannot increase", ErrInvalidOrderEdit)
+	case paid:
+		edit.RefundedCents = edit.PreviousTotalCents - edit.TotalCents
+	}
+
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return OrderEdit{}, err
+	}
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO order_edits (order_id, actor, reason, changes_json, previous_total_cents, total_cents)
+		VALUES ($1,$2,$3,$4::jsonb,$5,$6)
+		RETURNING id, created_at`,
+		o.ID, edit.Actor, edit.Reason, string(changesJSON), edit.PreviousTotalCents, edit.TotalCents,
+	).Scan(&edit.ID, &edit.CreatedAt); err != nil {
+		return OrderEdit{}, err
+	}
+	var refund Refund
+	if edit.RefundedCents > 0 {
+		reason := edit.Reason
+		if reason == "" {
+			reason = "order edit"
+		}
+		if refund, err = reserveEditRefund(ctx, tx, edit.ID, edit.RefundedCents, o.Currency, reason, edit.Actor); err != nil {
+			return OrderEdit{}, err
+		}
+		edit.RefundID, edit.RefundStatus = refund.ID, refund.Status
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE orders SET updated_at = now() WHERE id = $1", o.ID); err != nil {
+		return OrderEdit{}, err
+	}
+	if linesChanged || billingChanged {
+		if err := reissueInvoice(ctx, tx, o.ID, edit.ID); err != nil {
+			return OrderEdit{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return OrderEdit{}, err
+	}
+	if refund.ID != "" {
+		if refund, err = s.settleRefund(ctx, o, refund, execute, nil); err != nil {
+			return OrderEdit{}, err
+		}
+		edit.RefundProvider, edit.RefundProviderRef, edit.RefundStatus = refund.Provider, refund.ProviderRef, refund.Status
+	}
+	return edit, nil
+}
+
+// ListOrderEdits returns the edits of an order, oldest first.
+func (s *Store) ListOrderEdits(ctx context.Context, orderID string) ([]OrderEdit, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, e.order_id, e.actor, e.reason, e.changes_json, e.previous_total_cents, e.total_cents,
+			COALESCE(r.id::text,''), COALESCE(r.amount_cents,0), COALESCE(r.provider,''), COALESCE(r.provider_ref,''), COALESCE(r.status,''), e.created_at
+		FROM order_edits e
+		LEFT JOIN LATERAL (
+			SELECT id, amount_cents, provider, provider_ref, status FROM order_refunds
+			WHERE order_edit_id = e.id ORDER BY created_at DESC, id DESC LIMIT 1
+		) r ON true
+		WHERE e.order_id::text = $1 ORDER BY e.created_at ASC, e.id ASC`, orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []OrderEdit{}
+	for rows.Next() {
+		var e OrderEdit
+		var changesJSON []byte
+		if err := rows.Scan(&e.ID, &e.OrderID, &e.Actor, &e.Reason, &changesJSON, &e.PreviousTotalCents, &e.TotalCents,
+			&e.RefundID, &e.RefundedCents, &e.RefundProvider, &e.RefundProviderRef, &e.RefundStatus, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(changesJSON, &e.Changes); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,182 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+
+	platformdb "goecommerce/internal/platform/db"
+	"goecommerce/internal/platform/invoices"
+	storcart "goecommerce/internal/storage/cart"
+)
+
+func TestEditPaidOrderAdjustsStockRefundsAndReissuesInvoice(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set; skipping order edit test")
+	}
+	ctx := context.Background()
+	db, err := platformdb.Open(ctx, dsn)
+	if err != nil {
+		t.Fatalf("db open error: %v", err)
+	}
+	defer db.Close()
+
+	var regclass *string
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('public.order_edits')").Scan(&regclass); err != nil || regclass == nil || *regclass == "" {
+		t.Skip("order_edits table not present; apply migrations to run this test")
+	}
+	var variantID string
+	if err := db.QueryRowContext(ctx, "SELECT id FROM product_variants WHERE stock >= 4 LIMIT 1").Scan(&variantID); err != nil {
+		if err == sql.ErrNoRows {
+			t.Skip("no product variants with stock seeded; skipping")
+		}
+		t.Fatalf("query variant: %v", err)
+	}
+	cartStore, err := storcart.NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("cart store init: %v", err)
+	}
+	orderStore, err := NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("orders store init: %v", err)
+	}
+	c, err := cartStore.CreateCart(ctx)
+	if err != nil {
+		t.Fatalf("create cart: %v", err)
+	}
+	if _, err := cartStore.AddItem(ctx, c.ID, variantID, 2, nil); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	c, err = cartStore.GetCart(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("get cart: %v", err)
+	}
+	o, err := orderStore.CreateOrder(ctx, c, CreateOrderInput{
+		Email:          "edit@example.com",
+		BillingAddress: &Address{FullName: "Jane Doe", Address1: "Main st 1", City: "Vilnius", Country: "LT"},
+	})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	// Once the customer has been sent to pay the current total, it is fixed.
+	if err := orderStore.SetPaymentRef(ctx, o.ID, "cs_test"); err != nil {
+		t.Fatalf("set payment ref: %v", err)
+	}
+	unpaidOne := 1
+	unpaid := EditOrderInput{OrderID: o.ID, Actor: "admin", Lines: []EditOrderLine{{OrderItemID: o.Items[0].ID, Quantity: &unpaidOne}}}
+	if _, err := orderStore.EditOrder(ctx, unpaid, nil); !errors.Is(err, ErrInvalidOrderEdit) {
+		t.Fatalf("expected the total of an order with an issued payment to be fixed, got %v", err)
+	}
+	if _, err := orderStore.MarkOrderPaid(ctx, o.ID, "test"); err != nil {
+		t.Fatalf("mark paid: %v", err)
+	}
+	o, err = orderStore.GetOrderByID(ctx, o.ID)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	stock := func() int {
+		var n int
+		if err := db.QueryRowContext(ctx, "SELECT stock FROM product_variants WHERE id = $1", variantID).Scan(&n); err != nil {
+			t.Fatalf("query stock: %v", err)
+		}
+		return n
+	}
+	before := stock()
+	one, two := 1, 2
+	refunded := 0
+	refund := func(_ Order, amount int, _ string) (string, string, error) {
+		refunded = amount
+		return "test", "re_edit", nil
+	}
+
+	in := EditOrderInput{OrderID: o.ID, Actor: "admin", Lines: []EditOrderLine{{OrderItemID: o.Items[0].ID, Quantity: &two}}}
+	if _, err := orderStore.EditOrder(ctx, in, refund); !errors.Is(err, ErrInvalidOrderEdit) {
+		t.Fatalf("expected an edit without changes to be rejected, got %v", err)
+	}
+	in.Lines[0].Quantity = &one
+	edit, err := orderStore.EditOrder(ctx, in, refund)
+	if err != nil {
+		t.Fatalf("edit order: %v", err)
+	}
+	if edit.PreviousTotalCents != o.TotalCents || edit.TotalCents >= o.TotalCents || edit.RefundedCents != o.TotalCents-edit.TotalCents || refunded != edit.RefundedCents ||
+		edit.RefundStatus != RefundStatusSucceeded || edit.RefundProviderRef != "re_edit" {
+		t.Fatalf("unexpected edit totals %+v (refunded %d)", edit, refunded)
+	}
+	if len(edit.Changes) != 1 || edit.Changes[0].Kind != EditLineChanged || edit.Changes[0].FromQuantity != 2 || edit.Changes[0].ToQuantity != 1 {
+		t.Fatalf("unexpected changes %+v", edit.Changes)
+	}
+	if got := stock(); got != before+1 {
+		t.Fatalf("expected one unit back in stock, got %d -> %d", before, got)
+	}
+	edited, err := orderStore.GetOrderByID(ctx, o.ID)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if edited.TotalCents != edit.TotalCents || edited.Items[0].Quantity != 1 {
+		t.Fatalf("order not updated: %+v", edited)
+	}
+
+	docs, err := orderStore.ListInvoices(ctx, o.ID)
+	if err != nil {
+		t.Fatalf("list invoices: %v", err)
+	}
+	if len(docs) != 3 || docs[0].SupersededAt == nil || docs[1].Kind != invoices.KindCreditNote || docs[1].OrderEditID != edit.ID ||
+		docs[1].TotalCents != -docs[0].TotalCents || docs[2].Kind != invoices.KindInvoice || docs[2].TotalCents != edit.TotalCents {
+		t.Fatalf("expected the invoice to be cancelled and reissued, got %+v", docs)
+	}
+
+	price := 1
+	in = EditOrderInput{OrderID: o.ID, Actor: "admin", Lines: []EditOrderLine{{OrderItemID: o.Items[0].ID, UnitPriceCents: &price}}}
+	if _, err := orderStore.EditOrder(ctx, in, refund); !errors.Is(err, ErrInvalidOrderEdit) {
+		t.Fatalf("expected a price override without reason to be rejected, got %v", err)
+	}
+
+	// The edit refund is an order refund that leaves the order paid; when it
+	// fails the edit stays applied and the refund can be retried.
+	refunds, err := orderStore.ListRefunds(ctx, o.ID)
+	if err != nil || len(refunds) != 1 || refunds[0].ID != edit.RefundID || refunds[0].OrderEditID != edit.ID || refunds[0].Status != RefundStatusSucceeded {
+		t.Fatalf("expected the edit refund to be recorded, got %+v err=%v", refunds, err)
+	}
+	if edited.Status != "paid" {
+		t.Fatalf("expected the edited order to stay paid, got %s", edited.Status)
+	}
+	providerErr := errors.New("provider down")
+	in.Lines[0].PriceReason = "goodwill"
+	if _, err := orderStore.EditOrder(ctx, in, func(Order, int, string) (string, string, error) {
+		return "", "", providerErr
+	}); !errors.Is(err, providerErr) {
+		t.Fatalf("expected the refund error, got %v", err)
+	}
+	edits, err := orderStore.ListOrderEdits(ctx, o.ID)
+	if err != nil || len(edits) != 2 || edits[1].RefundStatus != RefundStatusFailed || edits[1].RefundID == "" {
+		t.Fatalf("expected the second edit with a failed refund, got %+v err=%v", edits, err)
+	}
+	retried, err := orderStore.RetryRefund(ctx, o.ID, edits[1].RefundID, refund)
+	if err != nil || retried.Status != RefundStatusSucceeded || retried.OrderEditID != edits[1].ID || retried.AmountCents != edits[1].RefundedCents {
+		t.Fatalf("expected the failed edit refund to be retried, got %+v err=%v", retried, err)
+	}
+	if _, err := orderStore.RetryRefund(ctx, o.ID, edits[1].RefundID, refund); !errors.Is(err, ErrInvalidRefund) {
+		t.Fatalf("expected a refunded edit not to be refunded twice, got %v", err)
+	}
+	if edits, err = orderStore.ListOrderEdits(ctx, o.ID); err != nil || edits[1].RefundStatus != RefundStatusSucceeded || edits[1].RefundID != retried.ID {
+		t.Fatalf("expected the edit to show the retried refund, got %+v err=%v", edits, err)
+	}
+
+	if _, err := orderStore.AddOrderNote(ctx, AddOrderNoteInput{OrderID: o.ID, Body: "internal", Author: "admin"}); err != nil {
+		t.Fatalf("add note: %v", err)
+	}
+	if _, err := orderStore.AddOrderNote(ctx, AddOrderNoteInput{OrderID: o.ID, Visibility: NoteVisibilityCustomer, Body: "Ships Monday", Author: "admin"}); err != nil {
+		t.Fatalf("add note: %v", err)
+	}
+	all, err := orderStore.ListOrderNotes(ctx, o.ID, false)
+	if err != nil || len(all) != 2 {
+		t.Fatalf("expected two notes, got %+v err=%v", all, err)
+	}
+	visible, err := orderStore.ListOrderNotes(ctx, o.ID, true)
+	if err != nil || len(visible) != 1 || visible[0].Body != "Ships Monday" {
+		t.Fatalf("expected only the customer note, got %+v err=%v", visible, err)
+	}
+}
@@ -0,0 +1,559 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"goecommerce/internal/platform/invoices"
+	stormedia "goecommerce/internal/storage/media"
+)
+
+// Invoice is an issued invoice or credit note. The buyer details and lines
+// are a snapshot taken when the invoice was issued; credit notes copy the
+// buyer from the invoice they credit. A credit note belongs either to a
+// refund or to an order edit, which supersedes the invoice it credits.
+type Invoice struct {
+	ID                string     `json:"id"`
+	OrderID           string     `json:"order_id"`
+	Kind              string     `json:"kind"`
+	Number            string     `json:"number"`
+	RefundID          string     `json:"refund_id"`
+	OrderEditID       string     `json:"order_edit_id"`
+	CreditedInvoiceID string     `json:"credited_invoice_id"`
+	SupersededAt      *time.Time `json:"superseded_at"`
+	Currency          string     `json:"currency"`
+	NetCents          int        `json:"net_cents"`
+	TaxCents          int        `json:"tax_cents"`
+	TotalCents        int        `json:"total_cents"`
+	BuyerName         string     `json:"buyer_name"`
+	CompanyName       string     `json:"company_name"`
+	CompanyVAT        string     `json:"company_vat"`
+	Email             string     `json:"email"`
+	BillingAddress    *Address   `json:"billing_address"`
+	IssuedAt          time.Time  `json:"issued_at"`
+	// documentPath is the media storage path of the rendered PDF, empty
+	// until the document is first downloaded.
+	documentPath string
+	// lines is the line snapshot; nil for refund credit notes, which are
+	// laid out from the refund, and for invoices issued before snapshots.
+	lines []invoices.Line
+}
+
+var invoicePrefixes = map[string]string{
+	invoices.KindInvoice:    "INV",
+	invoices.KindCreditNote: "CN",
+}
+
+// nextInvoiceNumber takes the next number of kind for the current year. The
+// counter row stays locked until tx ends, so concurrent issuers queue up and
+// a rolled back transaction gives its number back.
+func nextInvoiceNumber(ctx context.Context, tx *sql.Tx, kind string) (year, seq int, number string, err error) {
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO invoice_sequences (kind, year, last_number)
+		VALUES ($1, EXTRACT(YEAR FROM now() AT TIME ZONE 'UTC')::int, 1)
+		ON CONFLICT (kind, year) DO UPDATE SET last_number = invoice_sequences.last_number + 1
+		RETURNING year, last_number`, kind,
+	).Scan(&year, &seq); err != nil {
+		return 0, 0, "", err
+	}
+	return year, seq, fmt.Sprintf("%s-%d-%06d", invoicePrefixes[kind], year, seq), nil
+}
+
+// issueInvoice numbers the invoice of an order that just became paid or was
+// edited after being invoiced. It snapshots the lines, billing address,
+// company and VAT details of the order and its customer. Orders that already
+// have a current invoice are left alone.
+func issueInvoice(ctx context.Context, tx *sql.Tx, orderID string) error {
+	var (
+		currency, email, orderVAT             string
+		taxCents, totalCents                  int
+		addressJSON                           []byte
+		companyName, companyVAT, invoiceEmail string
+		invoiced                              bool
+	)
+	if err := tx.QueryRowContext(ctx, `
+		SELECT o.currency, o.tax_cents, o.total_cents, o.email, o.customer_vat,
+			COALESCE(o.billing_address_json, o.shipping_address_json),
+			COALESCE(c.company_name, ''), COALESCE(c.company_vat, ''), COALESCE(c.invoice_email, ''),
+			EXISTS (SELECT 1 FROM order_invoices i WHERE i.order_id = o.id AND i.kind = 'invoice' AND i.superseded_at IS NULL)
+		FROM orders o
+		LEFT JOIN customers c ON c.id = o.customer_id
+		WHERE o.id = $1`, orderID,
+	).Scan(&currency, &taxCents, &totalCents, &email, &orderVAT, &addressJSON, &companyName, &companyVAT, &invoiceEmail, &invoiced); err != nil {
+		return err
+	}
+	if invoiced {
+		return nil
+	}
+	address, err := unmarshalAddress(addressJSON)
+	if err != nil {
+		return err
+	}
+	buyerName := ""
+	if address != nil {
+		buyerName = address.FullName
+	}
+	if orderVAT != "" {
+		companyVAT = orderVAT
+	}
+	if strings.TrimSpace(invoiceEmail) != "" {
+		email = strings.TrimSpace(invoiceEmail)
+	}
+	linesJSON, err := currentInvoiceLinesJSON(ctx, tx, orderID)
+	if err != nil {
+		return err
+	}
+	year, seq, number, err := nextInvoiceNumber(ctx, tx, invoices.KindInvoice)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO order_invoices (
+			order_id, kind, number, year, sequence, currency, net_cents, tax_cents, total_cents,
+			buyer_name, company_name, company_vat, email, billing_address_json, lines_json
+		)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14::jsonb,$15::jsonb)`,
+		orderID, invoices.KindInvoice, number, year, seq, currency, totalCents-taxCents, taxCents, totalCents,
+		buyerName, companyName, companyVAT, email, nullableJSON(addressJSON), string(linesJSON),
+	)
+	return err
+}
+
+// currentInvoiceLinesJSON lays out the order's current items and shipping as
+// invoice lines.
+func currentInvoiceLinesJSON(ctx context.Context, tx *sql.Tx, orderID string) ([]byte, error) {
+	var o Order
+	if err := tx.QueryRowContext(ctx,
+		"SELECT shipping_cents, shipping_tax_cents, prices_include_tax, shipping_method_title FROM orders WHERE id = $1", orderID,
+	).Scan(&o.ShippingCents, &o.ShippingTaxCents, &o.PricesIncludeTax, &o.Shipping.MethodTitle); err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT "+orderItemColumns+" FROM order_items WHERE order_id = $1 ORDER BY created_at ASC", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		it, err := scanOrderItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		o.Items = append(o.Items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(orderInvoiceLines(o))
+}
+
+// snapshotInvoiceLines stores the current lines on an invoice issued before
+// invoices kept their own, so changing the order does not change it.
+func snapshotInvoiceLines(ctx context.Context, tx *sql.Tx, orderID string) error {
+	var invoiceID string
+	err := tx.QueryRowContext(ctx,
+		"SELECT id FROM order_invoices WHERE order_id = $1 AND kind = 'invoice' AND superseded_at IS NULL AND lines_json IS NULL", orderID,
+	).Scan(&invoiceID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	linesJSON, err := currentInvoiceLinesJSON(ctx, tx, orderID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE order_invoices SET lines_json = $2::jsonb WHERE id = $1", invoiceID, string(linesJSON))
+	return err
+}
+
+// reissueInvoice replaces the current invoice of an edited order: a credit
+// note cancels it line by line and a new invoice bills the order as it is
+// now. Orders without an invoice are left alone. Callers must have run
+// snapshotInvoiceLines before changing the order.
+func reissueInvoice(ctx context.Context, tx *sql.Tx, orderID, editID string) error {
+	var invoiceID string
+	var linesJSON []byte
+	err := tx.QueryRowContext(ctx,
+		"SELECT id, lines_json FROM order_invoices WHERE order_id = $1 AND kind = 'invoice' AND superseded_at IS NULL FOR UPDATE", orderID,
+	).Scan(&invoiceID, &linesJSON)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var lines []invoices.Line
+	if len(linesJSON) > 0 {
+		if err := json.Unmarshal(linesJSON, &lines); err != nil {
+			return err
+		}
+	}
+	for i := range lines {
+		lines[i].UnitCents, lines[i].TotalCents = -lines[i].UnitCents, -lines[i].TotalCents
+	}
+	creditJSON, err := json.Marshal(lines)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE order_invoices SET superseded_at = now() WHERE id = $1", invoiceID); err != nil {
+		return err
+	}
+	year, seq, number, err := nextInvoiceNumber(ctx, tx, invoices.KindCreditNote)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO order_invoices (
+			order_id, kind, number, year, sequence, order_edit_id, credited_invoice_id, currency, net_cents, tax_cents, total_cents,
+			buyer_name, company_name, company_vat, email, billing_address_json, lines_json
+		)
+		SELECT order_id, $2, $3, $4, $5, $6, id, currency, -net_cents, -tax_cents, -total_cents,
+			buyer_name, company_name, company_vat, email, billing_address_json, $7::jsonb
+		FROM order_invoices WHERE id = $1`,
+		invoiceID, invoices.KindCreditNote, number, year, seq, editID, string(creditJSON),
+	); err != nil {
+		return err
+	}
+	return issueInvoice(ctx, tx, orderID)
+}
+
+// issueCreditNote records a credit note for a refund of an invoiced order.
+// The tax share of each refunded line follows the line's own tax; refunds
+// without lines take the order's overall tax share. Orders paid before
+// invoicing existed have no invoice to credit and get no credit note.
+func issueCreditNote(ctx context.Context, tx *sql.Tx, orderID string, refund Refund) error {
+	var invoiceID string
+	err := tx.QueryRowContext(ctx,
+		"SELECT id FROM order_invoices WHERE order_id = $1 AND kind = 'invoice' AND superseded_at IS NULL", orderID,
+	).Scan(&invoiceID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	taxCents := 0
+	if len(refund.Lines) == 0 {
+		var orderTax, orderTotal int
+		if err := tx.QueryRowContext(ctx, "SELECT tax_cents, total_cents FROM orders WHERE id = $1", orderID).Scan(&orderTax, &orderTotal); err != nil {
+			return err
+		}
+		taxCents = taxShare(refund.AmountCents, orderTax, orderTotal)
+	}
+	for _, line := range refund.Lines {
+		var lineTax, lineTotal int
+		if err := tx.QueryRowContext(ctx,
+			"SELECT tax_cents, net_cents + tax_cents FROM order_items WHERE id = $1", line.OrderItemID,
+		).Scan(&lineTax, &lineTotal); err != nil {
+			return err
+		}
+		taxCents += taxShare(line.AmountCents, lineTax, lineTotal)
+	}
+	year, seq, number, err := nextInvoiceNumber(ctx, tx, invoices.KindCreditNote)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO order_invoices (
+			order_id, kind, number, year, sequence, refund_id, credited_invoice_id, currency, net_cents, tax_cents, total_cents,
+			buyer_name, company_name, company_vat, email, billing_address_json
+		)
+		SELECT order_id, $2, $3, $4, $5, $6, id, currency, $7, $8, $9,
+			buyer_name, company_name, company_vat, email, billing_address_json
+		FROM order_invoices WHERE id = $1`,
+		invoiceID, invoices.KindCreditNote, number, year, seq, refund.ID,
+		-(refund.AmountCents - taxCents), -taxCents, -refund.AmountCents,
+	)
+	return err
+}
+
+// taxShare is the tax contained in amount when part of whole is tax.
+func taxShare(amount, part, whole int) int {
+	if whole <= 0 {
+		return 0
+	}
+	return (amount*part + whole/2) / whole
+}
+
+// ListInvoices returns the invoices and credit notes of an order in the order
+// they were issued. An order has one current invoice; edits supersede it.
+func (s *Store) ListInvoices(ctx context.Context, orderID string) ([]Invoice, error) {
+	return listInvoices(ctx, s.db, orderID, "")
+}
+
+// ListCustomerInvoices lists the invoices of an order owned by customerID
+// and returns sql.ErrNoRows for anyone else's order.
+func (s *Store) ListCustomerInvoices(ctx context.Context, orderID, customerID string) ([]Invoice, error) {
+	if err := s.checkCustomerOrder(ctx, orderID, customerID); err != nil {
+		return nil, err
+	}
+	return listInvoices(ctx, s.db, orderID, "")
+}
+
+func (s *Store) checkCustomerOrder(ctx context.Context, orderID, customerID string) error {
+	var owned bool
+	if err := s.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM orders WHERE id::text = $1 AND customer_id::text = $2)", orderID, customerID,
+	).Scan(&owned); err != nil {
+		return err
+	}
+	if !owned {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func listInvoices(ctx context.Context, q queryer, orderID, invoiceID string) ([]Invoice, error) {
+	// A reissue creates its credit note and new invoice in one transaction;
+	// the credit note sorts first.
+	rows, err := q.QueryContext(ctx, `
+		SELECT i.id, i.order_id, i.kind, i.number, COALESCE(i.refund_id::text, ''), COALESCE(i.order_edit_id::text, ''),
+			COALESCE(i.credited_invoice_id::text, ''), i.superseded_at, i.currency, i.net_cents, i.tax_cents, i.total_cents,
+			i.buyer_name, i.company_name, i.company_vat, i.email, i.billing_address_json, i.lines_json, i.issued_at, COALESCE(m.storage_path, '')
+		FROM order_invoices i
+		LEFT JOIN media_assets m ON m.id = i.media_asset_id
+		WHERE i.order_id::text = $1 AND ($2 = '' OR i.id::text = $2)
+		ORDER BY i.issued_at ASC, i.kind = 'invoice' ASC, i.sequence ASC`, orderID, invoiceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Invoice{}
+	for rows.Next() {
+		var inv Invoice
+		var addressJSON, linesJSON []byte
+		if err := rows.Scan(&inv.ID, &inv.OrderID, &inv.Kind, &inv.Number, &inv.RefundID, &inv.OrderEditID,
+			&inv.CreditedInvoiceID, &inv.SupersededAt, &inv.Currency, &inv.NetCents, &inv.TaxCents, &inv.TotalCents,
+			&inv.BuyerName, &inv.CompanyName, &inv.CompanyVAT, &inv.Email, &addressJSON, &linesJSON, &inv.IssuedAt, &inv.documentPath); err != nil {
+			return nil, err
+		}
+		if inv.BillingAddress, err = unmarshalAddress(addressJSON); err != nil {
+			return nil, err
+		}
+		if len(linesJSON) > 0 {
+			if err := json.Unmarshal(linesJSON, &inv.lines); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, inv)
+	}
+	return out, rows.Err()
+}
+
+// InvoicePDFInput selects the document to download. A non-empty CustomerID
+// restricts it to that customer's orders. UploadsDir is the media storage
+// root the PDF is kept in.
+type InvoicePDFInput struct {
+	OrderID    string
+	InvoiceID  string
+	CustomerID string
+	Seller     invoices.Party
+	UploadsDir string
+}
+
+// InvoicePDF returns an invoice or credit note as PDF. The document is
+// rendered on first download from the order snapshot and stored in media
+// storage below media.PrivateDir; later downloads return the stored file,
+// so a document never changes once handed out.
+func (s *Store) InvoicePDF(ctx context.Context, in InvoicePDFInput) (Invoice, []byte, error) {
+	if in.CustomerID != "" {
+		if err := s.checkCustomerOrder(ctx, in.OrderID, in.CustomerID); err != nil {
+			return Invoice{}, nil, err
+		}
+	}
+	items, err := listInvoices(ctx, s.db, in.OrderID, in.InvoiceID)
+	if err != nil {
+		return Invoice{}, nil, err
+	}
+	if len(items) == 0 {
+		return Invoice{}, nil, sql.ErrNoRows
+	}
+	inv := items[0]
+	if inv.documentPath != "" {
+		if data, err := stormedia.ReadFile(in.UploadsDir, inv.documentPath); err == nil {
+			return inv, data, nil
+		}
+	}
+
+	doc, err := s.invoiceDocument(ctx, inv)
+	if err != nil {
+		return Invoice{}, nil, err
+	}
+	doc.Seller = in.Seller
+	data := invoices.Render(doc)
+	storagePath, err := stormedia.WriteFile(in.UploadsDir, stormedia.PrivateDir+"/invoices", ".pdf", data)
+	if err != nil {
+		return Invoice{}, nil, err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Invoice{}, nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	// The URL is the admin download route, so a re-render after a lost file
+	// or a concurrent first download updates the same asset.
+	var assetID string
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO media_assets (url, storage_path, mime_type, size_bytes, alt, source_type)
+		VALUES ($1, $2, 'application/pdf', $3, $4, $5)
+		ON CONFLICT (url) DO UPDATE SET storage_path = EXCLUDED.storage_path, size_bytes = EXCLUDED.size_bytes
+		RETURNING id`,
+		"/admin/orders/"+inv.OrderID+"/invoices/"+inv.ID+"/pdf", storagePath, len(data), inv.Number, stormedia.SourceTypeInvoice,
+	).Scan(&assetID); err != nil {
+		return Invoice{}, nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE order_invoices SET media_asset_id = $2 WHERE id = $1", inv.ID, assetID); err != nil {
+		return Invoice{}, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Invoice{}, nil, err
+	}
+	return inv, data, nil
+}
+
+// invoiceDocument lays out inv for rendering: the order lines and shipping
+// for an invoice, the refunded lines for a credit note.
+func (s *Store) invoiceDocument(ctx context.Context, inv Invoice) (invoices.Document, error) {
+	o, err := s.GetOrderByID(ctx, inv.OrderID)
+	if err != nil {
+		return invoices.Document{}, err
+	}
+	doc := invoices.Document{
+		Kind:          inv.Kind,
+		Number:        inv.Number,
+		IssuedAt:      inv.IssuedAt,
+		OrderNumber:   o.Number,
+		Currency:      inv.Currency,
+		NetCents:      inv.NetCents,
+		TaxCents:      inv.TaxCents,
+		TotalCents:    inv.TotalCents,
+		ReverseCharge: o.TaxReverseCharge,
+		Buyer: invoices.Party{
+			Name:        inv.BuyerName,
+			CompanyName: inv.CompanyName,
+			VAT:         inv.CompanyVAT,
+			Email:       inv.Email,
+		},
+	}
+	if a := inv.BillingAddress; a != nil {
+		for _, line := range []string{a.Address1, a.Address2, strings.TrimSpace(a.Postcode + " " + a.City), a.State, a.Country} {
+			if line != "" {
+				doc.Buyer.AddressLines = append(doc.Buyer.AddressLines, line)
+			}
+		}
+	}
+	if inv.Kind != invoices.KindCreditNote {
+		doc.Lines = inv.lines
+		if doc.Lines == nil {
+			doc.Lines = orderInvoiceLines(o)
+		}
+		return doc, nil
+	}
+
+	if err := s.db.QueryRowContext(ctx,
+		"SELECT number FROM order_invoices WHERE id = $1", inv.CreditedInvoiceID,
+	).Scan(&doc.CreditedNumber); err != nil {
+		return invoices.Document{}, err
+	}
+	if inv.OrderEditID != "" {
+		doc.Lines = inv.lines
+		var reason string
+		if err := s.db.QueryRowContext(ctx, "SELECT reason FROM order_edits WHERE id = $1", inv.OrderEditID).Scan(&reason); err != nil {
+			return invoices.Document{}, err
+		}
+		doc.Note = "Cancelled and reissued after an order change"
+		if reason != "" {
+			doc.Note += ": " + reason
+		}
+		return doc, nil
+	}
+	itemsByID := map[string]OrderItem{}
+	for _, it := range o.Items {
+		itemsByID[it.ID] = it
+	}
+	refunds, err := s.ListRefunds(ctx, inv.OrderID)
+	if err != nil {
+		return invoices.Document{}, err
+	}
+	for _, r := range refunds {
+		if r.ID != inv.RefundID {
+			continue
+		}
+		if r.Reason != "" {
+			doc.Note = "Reason: " + r.Reason
+		}
+		for _, line := range r.Lines {
+			it := itemsByID[line.OrderItemID]
+			doc.Lines = append(doc.Lines, invoices.Line{
+				Description: itemDescription(it),
+				Quantity:    line.Quantity,
+				UnitCents:   -unitCents(line.AmountCents, line.Quantity),
+				TaxRateBps:  it.TaxRateBps,
+				TotalCents:  -line.AmountCents,
+			})
+		}
+		if len(r.Lines) == 0 {
+			doc.Lines = append(doc.Lines, invoices.Line{
+				Description: "Refund",
+				Quantity:    1,
+				UnitCents:   -r.AmountCents,
+				TotalCents:  -r.AmountCents,
+			})
+		}
+	}
+	return doc, nil
+}
+
+// orderInvoiceLines lays out the items and shipping of o as invoice lines.
+func orderInvoiceLines(o Order) []invoices.Line {
+	lines := []invoices.Line{}
+	for _, it := range o.Items {
+		total := it.NetCents + it.TaxCents
+		lines = append(lines, invoices.Line{
+			Description: itemDescription(it),
+			Quantity:    it.Quantity,
+			UnitCents:   unitCents(total, it.Quantity),
+			TaxRateBps:  it.TaxRateBps,
+			TotalCents:  total,
+		})
+	}
+	if o.ShippingCents > 0 {
+		total := o.ShippingCents
+		if !o.PricesIncludeTax {
+			total += o.ShippingTaxCents
+		}
+		rate := 0
+		if net := total - o.ShippingTaxCents; net > 0 {
+			// The shipping rate is not stored; derive it to the nearest 0.1%.
+			rate = (2*o.ShippingTaxCents*1000 + net) / (2 * net) * 10
+		}
+		lines = append(lines, invoices.Line{
+			Description: "Shipping: " + o.Shipping.MethodTitle,
+			Quantity:    1,
+			UnitCents:   total,
+			TaxRateBps:  rate,
+			TotalCents:  total,
+		})
+	}
+	return lines
+}
+
+func itemDescription(it OrderItem) string {
+	if it.SKU == "" {
+		return it.ProductTitle
+	}
+	return it.ProductTitle + " (" + it.SKU + ")"
+}
+
+func unitCents(total, quantity int) int {
+	if quantity <= 0 {
+		return total
+	}
+	return (total + quantity/2) / quantity
+}
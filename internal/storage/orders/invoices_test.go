@@ -0,0 +1,153 @@
+package orders
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+
+	platformdb "goecommerce/internal/platform/db"
+	"goecommerce/internal/platform/invoices"
+	storcart "goecommerce/internal/storage/cart"
+)
+
+func TestTaxShare(t *testing.T) {
+	if got := taxShare(1210, 210, 1210); got != 210 {
+		t.Fatalf("expected full tax, got %d", got)
+	}
+	if got := taxShare(605, 210, 1210); got != 105 {
+		t.Fatalf("expected half the tax, got %d", got)
+	}
+	if got := taxShare(500, 0, 0); got != 0 {
+		t.Fatalf("expected no tax for an empty order, got %d", got)
+	}
+}
+
+func TestInvoicesAreSequentialAndCreditNotesFollowRefunds(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set; skipping invoice test")
+	}
+	ctx := context.Background()
+	db, err := platformdb.Open(ctx, dsn)
+	if err != nil {
+		t.Fatalf("db open error: %v", err)
+	}
+	defer db.Close()
+
+	var regclass *string
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('public.order_invoices')").Scan(&regclass); err != nil || regclass == nil || *regclass == "" {
+		t.Skip("order_invoices table not present; apply migrations to run this test")
+	}
+	var variantID string
+	if err := db.QueryRowContext(ctx, "SELECT id FROM product_variants WHERE stock >= 4 LIMIT 1").Scan(&variantID); err != nil {
+		if err == sql.ErrNoRows {
+			t.Skip("no product variants with stock seeded; skipping")
+		}
+		t.Fatalf("query variant: %v", err)
+	}
+	cartStore, err := storcart.NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("cart store init: %v", err)
+	}
+	orderStore, err := NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("orders store init: %v", err)
+	}
+	orderIDs := make([]string, 4)
+	for i := range orderIDs {
+		c, err := cartStore.CreateCart(ctx)
+		if err != nil {
+			t.Fatalf("create cart: %v", err)
+		}
+		if _, err := cartStore.AddItem(ctx, c.ID, variantID, 1, nil); err != nil {
+			t.Fatalf("add item: %v", err)
+		}
+		c, err = cartStore.GetCart(ctx, c.ID)
+		if err != nil {
+			t.Fatalf("get cart: %v", err)
+		}
+		o, err := orderStore.CreateOrder(ctx, c, CreateOrderInput{
+			Email:          "invoice@example.com",
+			BillingAddress: &Address{FullName: "Jane Doe", Address1: "Main st 1", City: "Vilnius", Country: "LT"},
+		})
+		if err != nil {
+			t.Fatalf("create order: %v", err)
+		}
+		orderIDs[i] = o.ID
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(orderIDs))
+	for _, id := range orderIDs {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			_, err := orderStore.MarkOrderPaid(ctx, id, "test")
+			errs <- err
+		}(id)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("mark paid: %v", err)
+		}
+	}
+	var seqs []int
+	for _, id := range orderIDs {
+		items, err := orderStore.ListInvoices(ctx, id)
+		if err != nil {
+			t.Fatalf("list invoices: %v", err)
+		}
+		if len(items) != 1 || items[0].Kind != invoices.KindInvoice || items[0].BuyerName != "Jane Doe" {
+			t.Fatalf("expected one invoice for the buyer, got %+v", items)
+		}
+		var seq int
+		if err := db.QueryRowContext(ctx, "SELECT sequence FROM order_invoices WHERE id = $1", items[0].ID).Scan(&seq); err != nil {
+			t.Fatalf("query sequence: %v", err)
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+	for i := 1; i < len(seqs); i++ {
+		if seqs[i] != seqs[i-1]+1 {
+			t.Fatalf("invoice numbers are not consecutive: %v", seqs)
+		}
+	}
+
+	if _, err := orderStore.CreateRefund(ctx, CreateRefundInput{OrderID: orderIDs[0], AmountCents: 1}, func(Order, int, string) (string, string, error) {
+		return "test", "re_1", nil
+	}); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	items, err := orderStore.ListInvoices(ctx, orderIDs[0])
+	if err != nil {
+		t.Fatalf("list invoices: %v", err)
+	}
+	if len(items) != 2 || items[1].Kind != invoices.KindCreditNote || items[1].TotalCents != -1 || items[1].RefundID == "" {
+		t.Fatalf("expected a credit note for the refund, got %+v", items)
+	}
+
+	dir := t.TempDir()
+	in := InvoicePDFInput{OrderID: orderIDs[0], InvoiceID: items[1].ID, UploadsDir: dir, Seller: invoices.Party{Name: "Shop"}}
+	_, first, err := orderStore.InvoicePDF(ctx, in)
+	if err != nil {
+		t.Fatalf("credit note pdf: %v", err)
+	}
+	if !bytes.HasPrefix(first, []byte("%PDF")) || !bytes.Contains(first, []byte(items[0].Number)) {
+		t.Fatalf("credit note should reference invoice %s", items[0].Number)
+	}
+	in.Seller = invoices.Party{Name: "Renamed shop"}
+	if _, again, err := orderStore.InvoicePDF(ctx, in); err != nil || !bytes.Equal(first, again) {
+		t.Fatalf("expected the stored document on the second download, err=%v", err)
+	}
+	in.CustomerID = "00000000-0000-0000-0000-000000000000"
+	if _, _, err := orderStore.InvoicePDF(ctx, in); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected other customers not to see the invoice, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"goecommerce/internal/platform/tax"
+	storcart "goecommerce/internal/storage/cart"
+)
+
+const orderItemColumns = `id, order_id, COALESCE(product_variant_id::text,''), COALESCE(product_id::text,''), product_slug, product_title, sku,
+	variant_attributes_json, image_url, custom_options_json, unit_price_cents, currency, quantity,
+	tax_class, tax_rate_bps, net_cents, tax_cents, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanOrderItem(row rowScanner) (OrderItem, error) {
+	var it OrderItem
+	var attrsRaw, optionsRaw []byte
+	if err := row.Scan(&it.ID, &it.OrderID, &it.ProductVariantID, &it.ProductID, &it.ProductSlug, &it.ProductTitle, &it.SKU,
+		&attrsRaw, &it.ImageURL, &optionsRaw, &it.UnitPriceCents, &it.Currency, &it.Quantity,
+		&it.TaxClass, &it.TaxRateBps, &it.NetCents, &it.TaxCents, &it.CreatedAt, &it.UpdatedAt); err != nil {
+		return OrderItem{}, err
+	}
+	if len(attrsRaw) > 0 {
+		if err := json.Unmarshal(attrsRaw, &it.VariantAttributes); err != nil {
+			return OrderItem{}, err
+		}
+	}
+	if it.VariantAttributes == nil {
+		it.VariantAttributes = map[string]any{}
+	}
+	if len(optionsRaw) > 0 {
+		if err := json.Unmarshal(optionsRaw, &it.CustomOptions); err != nil {
+			return OrderItem{}, err
+		}
+	}
+	if it.CustomOptions == nil {
+		it.CustomOptions = []storcart.CartItemCustomOption{}
+	}
+	return it, nil
+}
+
+// insertOrderItemSnapshot copies the product title, slug, SKU, variant
+// attributes and first image from the catalog, together with the resolved
+// custom options, price and tax breakdown of the cart line, into a new order
+// item.
+func insertOrderItemSnapshot(ctx context.Context, tx *sql.Tx, orderID string, it storcart.CartItem, line tax.LineResult) (OrderItem, error) {
+	options := it.CustomOptions
+	if options == nil {
+		options = []storcart.CartItemCustomOption{}
+	}
+	optionsJSON, err := json.Marshal(options)
+	if err != nil {
+		return OrderItem{}, err
+	}
+	return scanOrderItem(tx.QueryRowContext(ctx, `
+		INSERT INTO order_items (
+			order_id, product_variant_id, unit_price_cents, currency, quantity,
+			product_id, product_slug, product_title, sku, variant_attributes_json, image_url, custom_options_json,
+			tax_class, tax_rate_bps, net_cents, tax_cents
+		)
+		SELECT $1, pv.id, $3, $4, $5,
+			p.id, p.slug, p.title, pv.sku, pv.attributes_json,
+			COALESCE((SELECT url FROM images WHERE product_id = p.id ORDER BY sort ASC LIMIT 1), ''),
+			$6::jsonb, $7, $8, $9, $10
+		FROM product_variants pv
+		JOIN products p ON p.id = pv.product_id
+		WHERE pv.id = $2
+		RETURNING `+orderItemColumns,
+		orderID, it.ProductVariantID, it.UnitPriceCents, it.Currency, it.Quantity, string(optionsJSON),
+		line.TaxClass, line.RateBps, line.NetCents, line.TaxCents,
+	))
+}
+
+func (s *Store) listOrderItems(ctx context.Context, orderID string) ([]OrderItem, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+orderItemColumns+" FROM order_items WHERE order_id = $1 ORDER BY created_at ASC", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []OrderItem
+	for rows.Next() {
+		it, err := scanOrderItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,103 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidOrderNote wraps validation failures of an order note; the wrapped
+// message is safe to show to admins.
+var ErrInvalidOrderNote = errors.New("invalid order note")
+
+// Internal notes are for staff only; customer notes are also shown on the
+// customer's order page.
+const (
+	NoteVisibilityInternal = "internal"
+	NoteVisibilityCustomer = "customer"
+)
+
+type OrderNote struct {
+	ID         string    `json:"id"`
+	OrderID    string    `json:"order_id"`
+	Visibility string    `json:"visibility"`
+	Body       string    `json:"body"`
+	Author     string    `json:"author"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type AddOrderNoteInput struct {
+	OrderID    string
+	Visibility string
+	Body       string
+	Author     string
+}
+
+// AddOrderNote attaches a note to an order. Visibility defaults to internal.
+func (s *Store) AddOrderNote(ctx context.Context, in AddOrderNoteInput) (OrderNote, error) {
+	n := OrderNote{
+		Visibility: strings.TrimSpace(in.Visibility),
+		Body:       strings.TrimSpace(in.Body),
+		Author:     strings.TrimSpace(in.Author),
+	}
+	if n.Visibility == "" {
+		n.Visibility = NoteVisibilityInternal
+	}
+	if n.Visibility != NoteVisibilityInternal && n.Visibility != NoteVisibilityCustomer {
+		return OrderNote{}, fmt.Errorf("%w: visibility must be %s or %s", ErrInvalidOrderNote, NoteVisibilityInternal, NoteVisibilityCustomer)
+	}
+	if n.Body == "" {
+		return OrderNote{}, fmt.Errorf("%w: body is required", ErrInvalidOrderNote)
+	}
+	if n.Author == "" {
+		return OrderNote{}, errors.New("author is required")
+	}
+	if err := s.db.QueryRowContext(ctx, `
+		INSERT INTO order_notes (order_id, visibility, body, author)
+		SELECT id, $2, $3, $4 FROM orders WHERE id::text = $1
+		RETURNING id, order_id, created_at`,
+		in.OrderID, n.Visibility, n.Body, n.Author,
+	).Scan(&n.ID, &n.OrderID, &n.CreatedAt); err != nil {
+		return OrderNote{}, err
+	}
+	return n, nil
+}
+
+// ListOrderNotes returns the notes of an order, oldest first, leaving out
+// internal notes when customerOnly is set.
+func (s *Store) ListOrderNotes(ctx context.Context, orderID string, customerOnly bool) ([]OrderNote, error) {
+	return listOrderNotes(ctx, s.db, orderID, customerOnly)
+}
+
+// ListCustomerOrderNotes returns the customer-visible notes of an order
+// owned by customerID.
+func (s *Store) ListCustomerOrderNotes(ctx context.Context, orderID, customerID string) ([]OrderNote, error) {
+	if err := s.checkCustomerOrder(ctx, orderID, customerID); err != nil {
+		return nil, err
+	}
+	return listOrderNotes(ctx, s.db, orderID, true)
+}
+
+func listOrderNotes(ctx context.Context, q queryer, orderID string, customerOnly bool) ([]OrderNote, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, order_id, visibility, body, author, created_at
+		FROM order_notes
+		WHERE order_id::text = $1 AND (NOT $2 OR visibility = 'customer')
+		ORDER BY created_at ASC, id ASC`, orderID, customerOnly,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []OrderNote{}
+	for rows.Next() {
+		var n OrderNote
+		if err := rows.Scan(&n.ID, &n.OrderID, &n.Visibility, &n.Body, &n.Author, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
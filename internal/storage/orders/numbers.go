@@ -0,0 +1,140 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Date parts an order number can carry. The counter restarts whenever the
+// rendered date part changes.
+const (
+	NumberDateDay   = "YYYYMMDD"
+	NumberDateMonth = "YYYYMM"
+	NumberDateYear  = "YYYY"
+	NumberDateNone  = "none"
+)
+
+var numberDateLayouts = map[string]string{
+	NumberDateDay:   "20060102",
+	NumberDateMonth: "200601",
+	NumberDateYear:  "2006",
+	NumberDateNone:  "",
+}
+
+// NumberFormat describes order numbers as
+// [StorePrefix-][Prefix-][date-]counter, e.g. "EU-ORD-20261017-000042".
+type NumberFormat struct {
+	StorePrefix string
+	Prefix      string
+	DatePart    string
+	// Padding is the minimum number of counter digits; larger counters
+	// simply grow.
+	Padding int
+}
+
+// DefaultNumberFormat gives numbers like "ORD-20261017-000001".
+var DefaultNumberFormat = NumberFormat{Prefix: "ORD", DatePart: NumberDateDay, Padding: 6}
+
+// NumberFormatFromEnv reads ORDER_NUMBER_STORE_PREFIX, ORDER_NUMBER_PREFIX
+// (set it empty to drop the prefix), ORDER_NUMBER_DATE (YYYYMMDD, YYYYMM,
+// YYYY or none) and ORDER_NUMBER_PADDING. Invalid values keep the default.
+func NumberFormatFromEnv() NumberFormat {
+	f := DefaultNumberFormat
+	f.StorePrefix = strings.TrimSpace(os.Getenv("ORDER_NUMBER_STORE_PREFIX"))
+	if v, ok := os.LookupEnv("ORDER_NUMBER_PREFIX"); ok {
+		f.Prefix = strings.TrimSpace(v)
+	}
+	if v := strings.TrimSpace(os.Getenv("ORDER_NUMBER_DATE")); v != "" {
+		if _, ok := numberDateLayouts[v]; ok {
+			f.DatePart = v
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("ORDER_NUMBER_PADDING")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			f.Padding = n
+		}
+	}
+	if f.Validate() != nil {
+		return DefaultNumberFormat
+	}
+	return f
+}
+
+// Validate checks that prefixes only contain letters and digits, so the "-"
+// separators keep numbers unambiguous, and that the date part and padding
+// are supported.
+func (f NumberFormat) Validate() error {
+	for _, p := range []string{f.StorePrefix, f.Prefix} {
+		for _, r := range p {
+			if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9') {
+				return fmt.Errorf("invalid order number prefix %q", p)
+			}
+		}
+	}
+	if _, ok := numberDateLayouts[f.DatePart]; !ok {
+		return fmt.Errorf("invalid order number date part %q", f.DatePart)
+	}
+	if f.Padding < 1 || f.Padding > 12 {
+		return errors.New("order number padding must be between 1 and 12")
+	}
+	return nil
+}
+
+// scope is the number without its counter. Each scope has its own counter.
+func (f NumberFormat) scope(now time.Time) string {
+	parts := []string{}
+	for _, p := range []string{f.StorePrefix, f.Prefix, now.UTC().Format(numberDateLayouts[f.DatePart])} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+func (f NumberFormat) format(scope string, n int64) string {
+	counter := fmt.Sprintf("%0*d", f.Padding, n)
+	if scope == "" {
+		return counter
+	}
+	return scope + "-" + counter
+}
+
+// nextOrderNumber takes the next order number for f at now. Like invoice
+// numbers it is a counter row updated inside the checkout transaction rather
+// than a Postgres SEQUENCE: nextval is not rolled back, so failed checkouts
+// would leave holes. Concurrent checkouts in the same scope queue on the row
+// until the order commits. Numbers already taken by orders from before the
+// counter existed are skipped, so the unique number constraint cannot fail.
+func nextOrderNumber(ctx context.Context, tx *sql.Tx, f NumberFormat, now time.Time) (string, error) {
+	if f == (NumberFormat{}) {
+		f = DefaultNumberFormat
+	}
+	if err := f.Validate(); err != nil {
+		return "", err
+	}
+	scope := f.scope(now)
+	for {
+		var n int64
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO order_number_sequences (scope, last_number) VALUES ($1, 1)
+			ON CONFLICT (scope) DO UPDATE SET last_number = order_number_sequences.last_number + 1
+			RETURNING last_number`, scope,
+		).Scan(&n); err != nil {
+			return "", err
+		}
+		number := f.format(scope, n)
+		var taken bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM orders WHERE number = $1)", number).Scan(&taken); err != nil {
+			return "", err
+		}
+		if !taken {
+			return number, nil
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	platformdb "goecommerce/internal/platform/db"
+	storcart "goecommerce/internal/storage/cart"
+)
+
+func TestNumberFormatRendersConfiguredParts(t *testing.T) {
+	now := time.Date(2026, 10, 17, 23, 30, 0, 0, time.FixedZone("EEST", 3*3600))
+	cases := []struct {
+		format NumberFormat
+		want   string
+	}{
+		{DefaultNumberFormat, "ORD-20261017-000042"},
+		{NumberFormat{StorePrefix: "EU", Prefix: "ORD", DatePart: NumberDateMonth, Padding: 4}, "EU-ORD-202610-0042"},
+		{NumberFormat{Prefix: "", DatePart: NumberDateYear, Padding: 2}, "2026-42"},
+		{NumberFormat{Prefix: "W", DatePart: NumberDateNone, Padding: 1}, "W-42"},
+		{NumberFormat{DatePart: NumberDateNone, Padding: 8}, "00000042"},
+	}
+	for _, tc := range cases {
+		if err := tc.format.Validate(); err != nil {
+			t.Fatalf("%+v: %v", tc.format, err)
+		}
+		if got := tc.format.format(tc.format.scope(now), 42); got != tc.want {
+			t.Fatalf("%+v: expected %q, got %q", tc.format, tc.want, got)
+		}
+	}
+	if got := DefaultNumberFormat.format(DefaultNumberFormat.scope(now), 1234567); got != "ORD-20261017-1234567" {
+		t.Fatalf("expected the counter to outgrow its padding, got %q", got)
+	}
+}
+
+func TestNumberFormatFromEnv(t *testing.T) {
+	t.Setenv("ORDER_NUMBER_STORE_PREFIX", "LT")
+	t.Setenv("ORDER_NUMBER_PREFIX", "")
+	t.Setenv("ORDER_NUMBER_DATE", "YYYY")
+	t.Setenv("ORDER_NUMBER_PADDING", "5")
+	if got := NumberFormatFromEnv(); got != (NumberFormat{StorePrefix: "LT", DatePart: NumberDateYear, Padding: 5}) {
+		t.Fatalf("unexpected format %+v", got)
+	}
+
+	t.Setenv("ORDER_NUMBER_STORE_PREFIX", "L T")
+	if got := NumberFormatFromEnv(); got != DefaultNumberFormat {
+		t.Fatalf("expected invalid prefix to fall back to the default, got %+v", got)
+	}
+	t.Setenv("ORDER_NUMBER_STORE_PREFIX", "")
+	t.Setenv("ORDER_NUMBER_PADDING", "40")
+	if got := NumberFormatFromEnv(); got != DefaultNumberFormat {
+		t.Fatalf("expected invalid padding to fall back to the default, got %+v", got)
+	}
+}
+
+func TestConcurrentCheckoutsGetConsecutiveNumbers(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set; skipping order number test")
+	}
+	ctx := context.Background()
+	db, err := platformdb.Open(ctx, dsn)
+	if err != nil {
+		t.Fatalf("db open error: %v", err)
+	}
+	defer db.Close()
+
+	var regclass *string
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('public.order_number_sequences')").Scan(&regclass); err != nil || regclass == nil || *regclass == "" {
+		t.Skip("order_number_sequences table not present; apply migrations to run this test")
+	}
+	var variantID string
+	if err := db.QueryRowContext(ctx, "SELECT id FROM product_variants WHERE stock >= 5 LIMIT 1").Scan(&variantID); err != nil {
+		if err == sql.ErrNoRows {
+			t.Skip("no product variants with stock seeded; skipping")
+		}
+		t.Fatalf("query variant: %v", err)
+	}
+	cartStore, err := storcart.NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("cart store init: %v", err)
+	}
+	orderStore, err := NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("orders store init: %v", err)
+	}
+
+	// A unique store prefix gives the test its own counter.
+	format := NumberFormat{StorePrefix: "T" + strings.ReplaceAll(time.Now().Format("150405.000000"), ".", ""), Prefix: "ORD", DatePart: NumberDateNone, Padding: 3}
+	scope := format.scope(time.Now())
+	// An order from before the counter existed already holds the first number.
+	legacy, err := cartStore.CreateCart(ctx)
+	if err != nil {
+		t.Fatalf("create cart: %v", err)
+	}
+	if _, err := cartStore.AddItem(ctx, legacy.ID, variantID, 1, nil); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	legacy, err = cartStore.GetCart(ctx, legacy.ID)
+	if err != nil {
+		t.Fatalf("get cart: %v", err)
+	}
+	lo, err := orderStore.CreateOrder(ctx, legacy, CreateOrderInput{NumberFormat: format})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if lo.Number != scope+"-001" {
+		t.Fatalf("expected first number, got %q", lo.Number)
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE orders SET number = $1 WHERE id = $2", scope+"-002", lo.ID); err != nil {
+		t.Fatalf("renumber legacy order: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, "DELETE FROM order_number_sequences WHERE scope = $1", scope); err != nil {
+		t.Fatalf("reset counter: %v", err)
+	}
+
+	carts := make([]storcart.Cart, 4)
+	for i := range carts {
+		c, err := cartStore.CreateCart(ctx)
+		if err != nil {
+			t.Fatalf("create cart: %v", err)
+		}
+		if _, err := cartStore.AddItem(ctx, c.ID, variantID, 1, nil); err != nil {
+			t.Fatalf("add item: %v", err)
+		}
+		if carts[i], err = cartStore.GetCart(ctx, c.ID); err != nil {
+			t.Fatalf("get cart: %v", err)
+		}
+	}
+	var mu sync.Mutex
+	numbers := map[string]bool{}
+	var wg sync.WaitGroup
+	errs := make(chan error, len(carts))
+	for _, c := range carts {
+		wg.Add(1)
+		go func(c storcart.Cart) {
+			defer wg.Done()
+			o, err := orderStore.CreateOrder(ctx, c, CreateOrderInput{NumberFormat: format})
+			if err != nil {
+				errs <- err
+				return
+			}
+			mu.Lock()
+			numbers[o.Number] = true
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("create order: %v", err)
+	}
+	for _, want := range []string{"-001", "-003", "-004", "-005"} {
+		if !numbers[scope+want] {
+			t.Fatalf("expected %s%s among %v", scope, want, numbers)
+		}
+	}
+}
@@ -3,12 +3,15 @@ package orders
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	platformdb "goecommerce/internal/platform/db"
+	"goecommerce/internal/platform/tax"
 	storcart "goecommerce/internal/storage/cart"
 	storcustomers "goecommerce/internal/storage/customers"
 )
@@ -176,7 +179,7 @@ func TestCreateFromCartForCustomerPersistsCustomerID(t *testing.T) {
 	}
 }
 
-func TestUpdateOrderStatusToNewStatuses(t *testing.T) {
+func TestUpdateOrderStatusFollowsStateMachine(t *testing.T) {
 	dsn := os.Getenv("DATABASE_URL")
 	if dsn == "" {
 		t.Skip("DATABASE_URL not set; skipping status update test")
@@ -189,37 +192,622 @@ func TestUpdateOrderStatusToNewStatuses(t *testing.T) {
 	defer db.Close()
 
 	var regclass *string
-	if err := db.QueryRowContext(ctx, "SELECT to_regclass('public.orders')").Scan(&regclass); err != nil || regclass == nil || *regclass == "" {
-		t.Skip("orders table not present; apply migrations to run this test")
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('public.order_status_history')").Scan(&regclass); err != nil || regclass == nil || *regclass == "" {
+		t.Skip("order_status_history table not present; apply migrations to run this test")
 	}
 
+	cartStore, err := storcart.NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("cart store init: %v", err)
+	}
 	orderStore, err := NewStore(ctx, db)
 	if err != nil {
 		t.Fatalf("orders store init: %v", err)
 	}
-
-	// Find an order to update
-	var orderID string
-	err = db.QueryRowContext(ctx, "SELECT id FROM orders LIMIT 1").Scan(&orderID)
+	c, err := cartStore.CreateCart(ctx)
 	if err != nil {
+		t.Fatalf("create cart: %v", err)
+	}
+	var variantID string
+	if err := db.QueryRowContext(ctx, "SELECT id FROM product_variants WHERE stock >= 1 LIMIT 1").Scan(&variantID); err != nil {
 		if err == sql.ErrNoRows {
-			t.Skip("no orders found; skipping status update test")
+			t.Skip("no product variants with stock seeded; skipping")
 		}
-		t.Fatalf("query order: %v", err)
+		t.Fatalf("query variant: %v", err)
+	}
+	if _, err := cartStore.AddItem(ctx, c.ID, variantID, 1, nil); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	c2, err := cartStore.GetCart(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("get cart: %v", err)
+	}
+	o, err := orderStore.CreateFromCart(ctx, c2)
+	if err != nil {
+		t.Fatalf("create from cart: %v", err)
 	}
 
-	newStatuses := []string{"processing", "completed", "paid", "cancelled", "pending_payment"}
-	for _, status := range newStatuses {
-		if err := orderStore.UpdateOrderStatus(ctx, orderID, status); err != nil {
+	for _, status := range []string{"paid", "processing", "completed"} {
+		if err := orderStore.UpdateOrderStatus(ctx, o.ID, status, "admin", "test"); err != nil {
 			t.Fatalf("UpdateOrderStatus to %s failed: %v", status, err)
 		}
+	}
+	if err := orderStore.UpdateOrderStatus(ctx, o.ID, "pending_payment", "admin", ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected ErrInvalidTransition for completed -> pending_payment, got %v", err)
+	}
+
+	got, err := orderStore.GetOrderByID(ctx, o.ID)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if got.Status != "completed" || got.PaidAt == nil {
+		t.Fatalf("expected completed with paid_at set, got %s %v", got.Status, got.PaidAt)
+	}
+	want := []string{"pending_payment", "paid", "processing", "completed"}
+	if len(got.StatusHistory) != len(want) {
+		t.Fatalf("expected %d history rows, got %#v", len(want), got.StatusHistory)
+	}
+	for i, change := range got.StatusHistory {
+		if change.To != want[i] {
+			t.Fatalf("history[%d]: expected %s, got %s", i, want[i], change.To)
+		}
+	}
+}
+
+func TestApplyPaymentEventIsIdempotent(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set; skipping payment event test")
+	}
+	ctx := context.Background()
+	db, err := platformdb.Open(ctx, dsn)
+	if err != nil {
+		t.Fatalf("db open error: %v", err)
+	}
+	defer db.Close()
+
+	var regclass *string
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('public.payment_events')").Scan(&regclass); err != nil || regclass == nil || *regclass == "" {
+		t.Skip("payment_events table not present; apply migrations to run this test")
+	}
+
+	cartStore, err := storcart.NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("cart store init: %v", err)
+	}
+	orderStore, err := NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("orders store init: %v", err)
+	}
+	c, err := cartStore.CreateCart(ctx)
+	if err != nil {
+		t.Fatalf("create cart: %v", err)
+	}
+	var variantID string
+	if err := db.QueryRowContext(ctx, "SELECT id FROM product_variants LIMIT 1").Scan(&variantID); err != nil {
+		if err == sql.ErrNoRows {
+			t.Skip("no product variants seeded; skipping")
+		}
+		t.Fatalf("query variant: %v", err)
+	}
+	if _, err := cartStore.AddItem(ctx, c.ID, variantID, 1, nil); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	c2, err := cartStore.GetCart(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("get cart: %v", err)
+	}
+	o, err := orderStore.CreateFromCart(ctx, c2)
+	if err != nil {
+		t.Fatalf("create from cart: %v", err)
+	}
+
+	in := PaymentEventInput{
+		Provider:    "stripe",
+		EventID:     fmt.Sprintf("evt_test_%d", time.Now().UnixNano()),
+		EventType:   "checkout.session.completed",
+		OrderNumber: o.Number,
+		PaymentRef:  "pi_test",
+		Status:      "paid",
+	}
+	result, err := orderStore.ApplyPaymentEvent(ctx, in)
+	if err != nil || result != PaymentEventApplied {
+		t.Fatalf("first apply: result=%v err=%v", result, err)
+	}
+	result, err = orderStore.ApplyPaymentEvent(ctx, in)
+	if err != nil || result != PaymentEventDuplicate {
+		t.Fatalf("replay: result=%v err=%v", result, err)
+	}
+	got, err := orderStore.GetOrderByID(ctx, o.ID)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if got.Status != "paid" {
+		t.Fatalf("expected paid, got %s", got.Status)
+	}
+
+	// A second payment for the now paid order is flagged for a refund.
+	in.EventID += "_again"
+	in.PaymentRef = "pi_test_again"
+	result, err = orderStore.ApplyPaymentEvent(ctx, in)
+	if err != nil || result != PaymentEventNeedsRefund {
+		t.Fatalf("second payment: result=%v err=%v", result, err)
+	}
+	got, err = orderStore.GetOrderByID(ctx, o.ID)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if got.Status != "paid" || got.PaymentRef != "pi_test" || !strings.Contains(got.PaymentIssue, "pi_test_again") {
+		t.Fatalf("expected the order flagged without changes, got status=%s ref=%s issue=%q", got.Status, got.PaymentRef, got.PaymentIssue)
+	}
+}
+
+func TestPaymentEventIssue(t *testing.T) {
+	paid := PaymentEventInput{Provider: "stripe", EventID: "evt_1", Status: "paid", AmountCents: 1000, Currency: "EUR"}
+	cases := []struct {
+		name      string
+		in        PaymentEventInput
+		status    string
+		method    string
+		wantIssue bool
+	}{
+		{"matching payment", paid, "pending_payment", "stripe", false},
+		{"order without a stored method", paid, "pending_payment", "", false},
+		{"amount not reported", PaymentEventInput{Provider: "stripe", EventID: "evt_1", Status: "paid"}, "pending_payment", "stripe", false},
+		{"order already cancelled", paid, "cancelled", "stripe", true},
+		{"order placed with another method", paid, "pending_payment", "bank_transfer", true},
+		{"offline order", paid, "awaiting_payment_offline", "stripe", true},
+		{"amount differs", PaymentEventInput{Provider: "stripe", EventID: "evt_1", Status: "paid", AmountCents: 900, Currency: "EUR"}, "pending_payment", "stripe", true},
+		{"currency differs", PaymentEventInput{Provider: "stripe", EventID: "evt_1", Status: "paid", AmountCents: 1000, Currency: "USD"}, "pending_payment", "stripe", true},
+	}
+	for _, tc := range cases {
+		if got := paymentEventIssue(tc.in, tc.status, tc.method, "EUR", 1000); (got != "") != tc.wantIssue {
+			t.Fatalf("%s: unexpected issue %q", tc.name, got)
+		}
+	}
+}
+
+func TestMarkOrderPaidFromOfflineStatus(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set; skipping mark paid test")
+	}
+	ctx := context.Background()
+	db, err := platformdb.Open(ctx, dsn)
+	if err != nil {
+		t.Fatalf("db open error: %v", err)
+	}
+	defer db.Close()
+
+	var hasColumn bool
+	if err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'orders' AND column_name = 'payment_confirmed_by')").Scan(&hasColumn); err != nil || !hasColumn {
+		t.Skip("orders.payment_confirmed_by not present; apply migrations to run this test")
+	}
+
+	cartStore, err := storcart.NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("cart store init: %v", err)
+	}
+	orderStore, err := NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("orders store init: %v", err)
+	}
+	c, err := cartStore.CreateCart(ctx)
+	if err != nil {
+		t.Fatalf("create cart: %v", err)
+	}
+	var variantID string
+	if err := db.QueryRowContext(ctx, "SELECT id FROM product_variants LIMIT 1").Scan(&variantID); err != nil {
+		if err == sql.ErrNoRows {
+			t.Skip("no product variants seeded; skipping")
+		}
+		t.Fatalf("query variant: %v", err)
+	}
+	if _, err := cartStore.AddItem(ctx, c.ID, variantID, 1, nil); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	c2, err := cartStore.GetCart(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("get cart: %v", err)
+	}
+	o, err := orderStore.CreateOrder(ctx, c2, CreateOrderInput{PaymentMethod: "cash-on-delivery", Status: "awaiting_payment_offline"})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if o.Status != "awaiting_payment_offline" {
+		t.Fatalf("expected awaiting_payment_offline, got %s", o.Status)
+	}
+	paid, err := orderStore.MarkOrderPaid(ctx, o.ID, "admin")
+	if err != nil {
+		t.Fatalf("mark paid: %v", err)
+	}
+	if paid.Status != "paid" || paid.PaidAt == nil || paid.PaymentConfirmedBy != "admin" {
+		t.Fatalf("unexpected order after mark paid: %#v", paid)
+	}
+	if _, err := orderStore.MarkOrderPaid(ctx, o.ID, "admin"); err != ErrInvalidTransition {
+		t.Fatalf("expected ErrInvalidTransition on second mark, got %v", err)
+	}
+}
+
+func TestUnitsRefundAmountAddsUpToLineTotal(t *testing.T) {
+	// A 10 cent line of 3 units refunded one unit at a time.
+	total := 0
+	for refunded := 0; refunded < 3; refunded++ {
+		amount := unitsRefundAmount(10, 3, refunded, 1)
+		if want := []int{3, 3, 4}[refunded]; amount != want {
+			t.Fatalf("unit %d: expected %d, got %d", refunded+1, want, amount)
+		}
+		total += amount
+	}
+	if total != 10 {
+		t.Fatalf("expected the units to add up to 10, got %d", total)
+	}
+	if got := unitsRefundAmount(10, 3, 0, 3); got != 10 {
+		t.Fatalf("expected the whole line to refund 10, got %d", got)
+	}
+	if got := unitsRefundAmount(10, 3, 1, 1); got != 3 {
+		t.Fatalf("expected a middle unit to refund 3, got %d", got)
+	}
+}
+
+func TestCreateRefundPartialThenFull(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set; skipping refund test")
+	}
+	ctx := context.Background()
+	db, err := platformdb.Open(ctx, dsn)
+	if err != nil {
+		t.Fatalf("db open error: %v", err)
+	}
+	defer db.Close()
+
+	var regclass *string
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('public.order_refunds')").Scan(&regclass); err != nil || regclass == nil || *regclass == "" {
+		t.Skip("order_refunds table not present; apply migrations to run this test")
+	}
+
+	cartStore, err := storcart.NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("cart store init: %v", err)
+	}
+	orderStore, err := NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("orders store init: %v", err)
+	}
+	c, err := cartStore.CreateCart(ctx)
+	if err != nil {
+		t.Fatalf("create cart: %v", err)
+	}
+	var variantID string
+	if err := db.QueryRowContext(ctx, "SELECT id FROM product_variants WHERE stock >= 2 LIMIT 1").Scan(&variantID); err != nil {
+		if err == sql.ErrNoRows {
+			t.Skip("no product variants with stock seeded; skipping")
+		}
+		t.Fatalf("query variant: %v", err)
+	}
+	if _, err := cartStore.AddItem(ctx, c.ID, variantID, 2, nil); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	c2, err := cartStore.GetCart(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("get cart: %v", err)
+	}
+	o, err := orderStore.CreateFromCart(ctx, c2)
+	if err != nil {
+		t.Fatalf("create from cart: %v", err)
+	}
+	if _, err := orderStore.MarkOrderPaid(ctx, o.ID, "test"); err != nil {
+		t.Fatalf("mark paid: %v", err)
+	}
+	execute := func(Order, int, string) (string, string, error) { return "test", "", nil }
+
+	var stockBefore int
+	if err := db.QueryRowContext(ctx, "SELECT stock FROM product_variants WHERE id = $1", variantID).Scan(&stockBefore); err != nil {
+		t.Fatalf("stock before: %v", err)
+	}
+	first, err := orderStore.CreateRefund(ctx, CreateRefundInput{OrderID: o.ID, Lines: []RefundLine{{OrderItemID: o.Items[0].ID, Quantity: 1}}, Restock: true}, execute)
+	if err != nil {
+		t.Fatalf("first refund: %v", err)
+	}
+	if first.AmountCents != o.Items[0].UnitPriceCents {
+		t.Fatalf("expected line amount %d, got %d", o.Items[0].UnitPriceCents, first.AmountCents)
+	}
+	var stockAfter int
+	if err := db.QueryRowContext(ctx, "SELECT stock FROM product_variants WHERE id = $1", variantID).Scan(&stockAfter); err != nil {
+		t.Fatalf("stock after: %v", err)
+	}
+	if stockAfter != stockBefore+1 {
+		t.Fatalf("expected restock to %d, got %d", stockBefore+1, stockAfter)
+	}
+	got, err := orderStore.GetOrderByID(ctx, o.ID)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if got.Status != "partially_refunded" {
+		t.Fatalf("expected partially_refunded, got %s", got.Status)
+	}
+	if _, err := orderStore.CreateRefund(ctx, CreateRefundInput{OrderID: o.ID, AmountCents: o.TotalCents}, execute); !errors.Is(err, ErrInvalidRefund) {
+		t.Fatalf("expected ErrInvalidRefund for over-refund, got %v", err)
+	}
+	// A failed provider call leaves a failed refund that does not hold the
+	// balance.
+	var gotKey string
+	providerErr := errors.New("provider down")
+	failing := func(_ Order, _ int, idempotencyKey string) (string, string, error) {
+		gotKey = idempotencyKey
+		return "", "", providerErr
+	}
+	if _, err := orderStore.CreateRefund(ctx, CreateRefundInput{OrderID: o.ID, AmountCents: 1}, failing); !errors.Is(err, providerErr) {
+		t.Fatalf("expected provider error, got %v", err)
+	}
+	refunds, err := orderStore.ListRefunds(ctx, o.ID)
+	if err != nil || len(refunds) != 2 || refunds[1].Status != RefundStatusFailed || refunds[1].ID != gotKey {
+		t.Fatalf("expected a failed refund keyed by its id, got %+v err=%v", refunds, err)
+	}
+
+	// A refund left pending, e.g. by a crash, is retried once its last
+	// provider call must have ended.
+	if _, err := db.ExecContext(ctx, "UPDATE order_refunds SET status = $2 WHERE id = $1", gotKey, RefundStatusPending); err != nil {
+		t.Fatalf("make refund pending: %v", err)
+	}
+	if _, err := orderStore.RetryRefund(ctx, o.ID, gotKey, execute); !errors.Is(err, ErrInvalidRefund) {
+		t.Fatalf("expected a fresh pending refund not to be retried, got %v", err)
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE order_refunds SET attempted_at = now() - interval '2 minutes' WHERE id = $1", gotKey); err != nil {
+		t.Fatalf("age refund: %v", err)
+	}
+	var retriedKey string
+	retried, err := orderStore.RetryRefund(ctx, o.ID, gotKey, func(_ Order, _ int, idempotencyKey string) (string, string, error) {
+		retriedKey = idempotencyKey
+		return "test", "re_retried", nil
+	})
+	if err != nil || retried.Status != RefundStatusSucceeded || retried.ProviderRef != "re_retried" || retriedKey != gotKey {
+		t.Fatalf("expected the retry to settle the refund under its id, got %+v err=%v", retried, err)
+	}
+	if _, err := orderStore.RetryRefund(ctx, o.ID, gotKey, execute); !errors.Is(err, ErrInvalidRefund) {
+		t.Fatalf("expected a settled refund not to be retried, got %v", err)
+	}
+	if _, err := orderStore.CreateRefund(ctx, CreateRefundInput{OrderID: o.ID, AmountCents: o.TotalCents - first.AmountCents - retried.AmountCents}, execute); err != nil {
+		t.Fatalf("second refund: %v", err)
+	}
+	got, err = orderStore.GetOrderByID(ctx, o.ID)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if got.Status != "refunded" {
+		t.Fatalf("expected refunded, got %s", got.Status)
+	}
+}
 
-		var savedStatus string
-		if err := db.QueryRowContext(ctx, "SELECT status::text FROM orders WHERE id = $1", orderID).Scan(&savedStatus); err != nil {
-			t.Fatalf("query saved status: %v", err)
+func TestConcurrentCheckoutDoesNotOversellLastUnit(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set; skipping stock reservation test")
+	}
+	ctx := context.Background()
+	db, err := platformdb.Open(ctx, dsn)
+	if err != nil {
+		t.Fatalf("db open error: %v", err)
+	}
+	defer db.Close()
+
+	var regclass *string
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('public.orders')").Scan(&regclass); err != nil || regclass == nil || *regclass == "" {
+		t.Skip("orders table not present; apply migrations to run this test")
+	}
+
+	cartStore, err := storcart.NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("cart store init: %v", err)
+	}
+	orderStore, err := NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("orders store init: %v", err)
+	}
+	var variantID string
+	var originalStock int
+	if err := db.QueryRowContext(ctx, "SELECT id, stock FROM product_variants WHERE stock >= 1 LIMIT 1").Scan(&variantID, &originalStock); err != nil {
+		if err == sql.ErrNoRows {
+			t.Skip("no product variants with stock seeded; skipping")
 		}
-		if savedStatus != status {
-			t.Fatalf("expected status %s, got %s", status, savedStatus)
+		t.Fatalf("query variant: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE product_variants SET stock = 1 WHERE id = $1", variantID); err != nil {
+		t.Fatalf("set stock: %v", err)
+	}
+	defer func() {
+		_, _ = db.ExecContext(context.Background(), "UPDATE product_variants SET stock = $1 WHERE id = $2", originalStock, variantID)
+	}()
+
+	carts := make([]storcart.Cart, 2)
+	for i := range carts {
+		c, err := cartStore.CreateCart(ctx)
+		if err != nil {
+			t.Fatalf("create cart: %v", err)
 		}
+		if _, err := cartStore.AddItem(ctx, c.ID, variantID, 1, nil); err != nil {
+			t.Fatalf("add item: %v", err)
+		}
+		if carts[i], err = cartStore.GetCart(ctx, c.ID); err != nil {
+			t.Fatalf("get cart: %v", err)
+		}
+	}
+
+	errs := make(chan error, len(carts))
+	for _, c := range carts {
+		go func(c storcart.Cart) {
+			_, err := orderStore.CreateFromCart(ctx, c)
+			errs <- err
+		}(c)
+	}
+	var created, shortages int
+	var placed Order
+	for range carts {
+		err := <-errs
+		var stockErr *InsufficientStockError
+		switch {
+		case err == nil:
+			created++
+		case errors.As(err, &stockErr):
+			shortages++
+			if len(stockErr.Lines) != 1 || stockErr.Lines[0].Available != 0 {
+				t.Fatalf("unexpected shortage lines %#v", stockErr.Lines)
+			}
+		default:
+			t.Fatalf("unexpected checkout error: %v", err)
+		}
+	}
+	if created != 1 || shortages != 1 {
+		t.Fatalf("expected one order and one shortage, got %d and %d", created, shortages)
+	}
+
+	if err := db.QueryRowContext(ctx, "SELECT o.id FROM orders o JOIN order_items oi ON oi.order_id = o.id WHERE oi.product_variant_id = $1 ORDER BY o.created_at DESC LIMIT 1", variantID).Scan(&placed.ID); err != nil {
+		t.Fatalf("find order: %v", err)
+	}
+	if err := orderStore.UpdateOrderStatus(ctx, placed.ID, "cancelled", "test", ""); err != nil {
+		t.Fatalf("cancel order: %v", err)
+	}
+	var stock int
+	if err := db.QueryRowContext(ctx, "SELECT stock FROM product_variants WHERE id = $1", variantID).Scan(&stock); err != nil {
+		t.Fatalf("stock after cancel: %v", err)
+	}
+	if stock != 1 {
+		t.Fatalf("expected stock released on cancel, got %d", stock)
+	}
+}
+
+func TestOrderItemsSnapshotSurvivesCatalogEdits(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set; skipping order item snapshot test")
+	}
+	ctx := context.Background()
+	db, err := platformdb.Open(ctx, dsn)
+	if err != nil {
+		t.Fatalf("db open error: %v", err)
+	}
+	defer db.Close()
+
+	var hasColumn bool
+	if err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'order_items' AND column_name = 'product_title')").Scan(&hasColumn); err != nil || !hasColumn {
+		t.Skip("order_items snapshot columns not present; apply migrations to run this test")
+	}
+
+	cartStore, err := storcart.NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("cart store init: %v", err)
+	}
+	orderStore, err := NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("orders store init: %v", err)
+	}
+	var variantID, productID, title, sku string
+	if err := db.QueryRowContext(ctx, "SELECT pv.id, p.id, p.title, pv.sku FROM product_variants pv JOIN products p ON p.id = pv.product_id WHERE pv.stock >= 1 LIMIT 1").Scan(&variantID, &productID, &title, &sku); err != nil {
+		if err == sql.ErrNoRows {
+			t.Skip("no product variants with stock seeded; skipping")
+		}
+		t.Fatalf("query variant: %v", err)
+	}
+	c, err := cartStore.CreateCart(ctx)
+	if err != nil {
+		t.Fatalf("create cart: %v", err)
+	}
+	if _, err := cartStore.AddItem(ctx, c.ID, variantID, 1, nil); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	c2, err := cartStore.GetCart(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("get cart: %v", err)
+	}
+	o, err := orderStore.CreateFromCart(ctx, c2)
+	if err != nil {
+		t.Fatalf("create from cart: %v", err)
+	}
+	if len(o.Items) != 1 || o.Items[0].ProductTitle != title || o.Items[0].SKU != sku {
+		t.Fatalf("unexpected snapshot %#v", o.Items)
+	}
+
+	if _, err := db.ExecContext(ctx, "UPDATE products SET title = title || ' (renamed)' WHERE id = $1", productID); err != nil {
+		t.Fatalf("rename product: %v", err)
+	}
+	defer func() {
+		_, _ = db.ExecContext(context.Background(), "UPDATE products SET title = $1 WHERE id = $2", title, productID)
+	}()
+	got, err := orderStore.GetOrderByID(ctx, o.ID)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if got.Items[0].ProductTitle != title {
+		t.Fatalf("expected snapshot title %q, got %q", title, got.Items[0].ProductTitle)
+	}
+}
+
+func TestCreateOrderStoresTaxBreakdown(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set; skipping order tax test")
+	}
+	ctx := context.Background()
+	db, err := platformdb.Open(ctx, dsn)
+	if err != nil {
+		t.Fatalf("db open error: %v", err)
+	}
+	defer db.Close()
+
+	var hasColumn bool
+	if err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'order_items' AND column_name = 'tax_rate_bps')").Scan(&hasColumn); err != nil || !hasColumn {
+		t.Skip("order tax columns not present; apply migrations to run this test")
+	}
+
+	cartStore, err := storcart.NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("cart store init: %v", err)
+	}
+	orderStore, err := NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("orders store init: %v", err)
+	}
+	var variantID string
+	if err := db.QueryRowContext(ctx, "SELECT id FROM product_variants WHERE stock >= 1 LIMIT 1").Scan(&variantID); err != nil {
+		if err == sql.ErrNoRows {
+			t.Skip("no product variants with stock seeded; skipping")
+		}
+		t.Fatalf("query variant: %v", err)
+	}
+	c, err := cartStore.CreateCart(ctx)
+	if err != nil {
+		t.Fatalf("create cart: %v", err)
+	}
+	if _, err := cartStore.AddItem(ctx, c.ID, variantID, 1, nil); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	c2, err := cartStore.GetCart(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("get cart: %v", err)
+	}
+	res := tax.Calculate(tax.Request{
+		Config:        tax.Config{ShopCountry: "LT", PricesIncludeTax: true},
+		Country:       "LT",
+		Lines:         c2.TaxLines(),
+		ShippingCents: 500,
+	}, tax.Rates{tax.ClassStandard: 2100, tax.ClassReduced: 900})
+	o, err := orderStore.CreateOrder(ctx, c2, CreateOrderInput{Shipping: ShippingSelection{PriceCents: 500}, Tax: &res})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if o.TaxCents != res.TaxCents || o.TotalCents != res.TotalCents {
+		t.Fatalf("expected tax %d total %d, got %d %d", res.TaxCents, res.TotalCents, o.TaxCents, o.TotalCents)
+	}
+	got, err := orderStore.GetOrderByID(ctx, o.ID)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if got.TaxCountry != "LT" || !got.PricesIncludeTax || got.ShippingTaxCents != res.Shipping.TaxCents {
+		t.Fatalf("unexpected order tax fields %#v", got)
+	}
+	it := got.Items[0]
+	if it.TaxRateBps != res.Lines[0].RateBps || it.TaxCents != res.Lines[0].TaxCents || it.NetCents != res.Lines[0].NetCents {
+		t.Fatalf("unexpected item tax breakdown %#v", it)
 	}
 }
@@ -0,0 +1,208 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidTransition is returned when an order is not in a state that
+// allows the requested change.
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+type PaymentEventInput struct {
+	Provider    string
+	EventID     string
+	EventType   string
+	OrderNumber string
+	PaymentRef  string
+	Status      string
+	// AmountCents and Currency are what the provider collected. They are
+	// checked against the order total when Currency is set.
+	AmountCents int
+	Currency    string
+}
+
+// PaymentEventResult says what ApplyPaymentEvent did with an event.
+type PaymentEventResult string
+
+const (
+	// PaymentEventApplied means the event was recorded and the order moved
+	// to its status, if it carried one.
+	PaymentEventApplied PaymentEventResult = "applied"
+	// PaymentEventDuplicate means the event had been recorded before.
+	PaymentEventDuplicate PaymentEventResult = "duplicate"
+	// PaymentEventIgnored means the event was recorded but left the order
+	// alone, e.g. a cancellation for an order that is no longer unpaid.
+	PaymentEventIgnored PaymentEventResult = "ignored"
+	// PaymentEventNeedsRefund means money was collected that the order could
+	// not take: it was no longer pending_payment, was placed with another
+	// payment method or the amount did not match. The order is flagged with
+	// a payment issue and the payment has to be refunded.
+	PaymentEventNeedsRefund PaymentEventResult = "needs_refund"
+)
+
+// ApplyPaymentEvent records a provider webhook event and moves the matching
+// pending_payment order to in.Status, issuing the invoice when it is paid.
+// Events already recorded return PaymentEventDuplicate without touching the
+// order, so provider retries are no-ops. A paid event the order cannot take
+// sets the order's payment_issue and returns PaymentEventNeedsRefund.
+func (s *Store) ApplyPaymentEvent(ctx context.Context, in PaymentEventInput) (PaymentEventResult, error) {
+	in.Provider = strings.TrimSpace(in.Provider)
+	in.EventID = strings.TrimSpace(in.EventID)
+	in.OrderNumber = strings.TrimSpace(in.OrderNumber)
+	in.Currency = strings.ToUpper(strings.TrimSpace(in.Currency))
+	if in.Provider == "" || in.EventID == "" || in.OrderNumber == "" {
+		return "", errors.New("invalid payment event")
+	}
+	if in.Status != "" && in.Status != "paid" && in.Status != "cancelled" {
+		return "", errors.New("invalid payment status")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var orderID, status, method, currency string
+	var totalCents int
+	if err := tx.QueryRowContext(ctx,
+		"SELECT id, status, COALESCE(payment_method,''), currency, total_cents FROM orders WHERE number = $1 FOR UPDATE",
+		in.OrderNumber,
+	).Scan(&orderID, &status, &method, &currency, &totalCents); err != nil {
+		return "", err
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO payment_events (provider, event_id, event_type, order_id) VALUES ($1,$2,$3,$4) ON CONFLICT (provider, event_id) DO NOTHING",
+		in.Provider, in.EventID, in.EventType, orderID,
+	)
+	if err != nil {
+		return "", err
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if inserted == 0 {
+		return PaymentEventDuplicate, nil
+	}
+	if in.Status == "" {
+		if err := tx.Commit(); err != nil {
+			return "", err
+		}
+		return PaymentEventApplied, nil
+	}
+
+	issue := paymentEventIssue(in, status, method, currency, totalCents)
+	result := PaymentEventApplied
+	switch {
+	case issue != "" && in.Status == "paid":
+		if in.PaymentRef != "" {
+			issue += " (payment " + in.PaymentRef + ")"
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE orders SET payment_issue = $1, updated_at = now() WHERE id = $2", issue, orderID); err != nil {
+			return "", err
+		}
+		result = PaymentEventNeedsRefund
+	case issue != "":
+		result = PaymentEventIgnored
+	default:
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE orders SET status = $1::order_status, payment_ref = COALESCE(NULLIF($2,''), payment_ref), paid_at = CASE WHEN $1 = 'paid' THEN now() ELSE paid_at END, updated_at = now() WHERE id = $3",
+			in.Status, in.PaymentRef, orderID,
+		); err != nil {
+			return "", err
+		}
+		if err := recordStatusChange(ctx, tx, orderID, status, in.Status, "payment:"+in.Provider, in.EventType); err != nil {
+			return "", err
+		}
+		if in.Status == "paid" {
+			if err := issueInvoice(ctx, tx, orderID); err != nil {
+				return "", err
+			}
+		}
+		// A failed or expired payment releases the checkout reservation.
+		if in.Status == "cancelled" {
+			if err := releaseStock(ctx, tx, orderID); err != nil {
+				return "", err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// paymentEventIssue says why an event with a status cannot be applied to an
+// order in the given state, or returns "" when it can. Orders created before
+// payment methods were stored have none and accept any provider.
+func paymentEventIssue(in PaymentEventInput, status, method, currency string, totalCents int) string {
+	switch {
+	case method != "" && method != in.Provider:
+		return fmt.Sprintf("%s event %s from %s for an order paid with %s", in.Status, in.EventID, in.Provider, method)
+	case status != "pending_payment":
+		return fmt.Sprintf("%s event %s from %s for a %s order", in.Status, in.EventID, in.Provider, status)
+	case in.Status == "paid" && in.Currency != "" && (in.AmountCents != totalCents || in.Currency != currency):
+		return fmt.Sprintf("paid event %s from %s collected %d %s, order total is %d %s", in.EventID, in.Provider, in.AmountCents, in.Currency, totalCents, currency)
+	}
+	return ""
+}
+
+// SetPaymentRef stores the provider or offline payment reference on an order.
+func (s *Store) SetPaymentRef(ctx context.Context, id string, ref string) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE orders SET payment_ref = NULLIF($1,''), updated_at = now() WHERE id = $2", strings.TrimSpace(ref), id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkOrderPaid confirms an offline payment. Only orders still waiting for
+// payment can be marked paid; confirmedBy records the admin who did it. The
+// order's invoice is issued in the same transaction.
+func (s *Store) MarkOrderPaid(ctx context.Context, id string, confirmedBy string) (Order, error) {
+	confirmedBy = strings.TrimSpace(confirmedBy)
+	if confirmedBy == "" {
+		return Order{}, errors.New("confirmed by is required")
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Order{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	var current string
+	if err := tx.QueryRowContext(ctx, "SELECT status FROM orders WHERE id = $1 FOR UPDATE", id).Scan(&current); err != nil {
+		return Order{}, err
+	}
+	if !CanTransition(current, "paid") {
+		return Order{}, ErrInvalidTransition
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE orders SET status = 'paid', paid_at = now(), payment_confirmed_by = $1, updated_at = now() WHERE id = $2",
+		confirmedBy, id,
+	); err != nil {
+		return Order{}, err
+	}
+	if err := recordStatusChange(ctx, tx, id, current, "paid", confirmedBy, "payment confirmed"); err != nil {
+		return Order{}, err
+	}
+	if err := issueInvoice(ctx, tx, id); err != nil {
+		return Order{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Order{}, err
+	}
+	return s.GetOrderByID(ctx, id)
+}
@@ -0,0 +1,532 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrInvalidRefund wraps validation failures of a refund request; the wrapped
+// message is safe to show to admins.
+var ErrInvalidRefund = errors.New("invalid refund")
+
+// Refund statuses. A refund is pending while the payment provider is
+// called; pending refunds count against the refundable balance, failed ones
+// do not.
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusSucceeded = "succeeded"
+	RefundStatusFailed    = "failed"
+)
+
+// Refund is money returned on an order. OrderEditID is set for the refund of
+// an edit that lowered a paid order's total; such refunds are already
+// excluded from the order total, so they neither count against the
+// refundable balance nor change the order status or get a credit note.
+type Refund struct {
+	ID          string       `json:"id"`
+	OrderID     string       `json:"order_id"`
+	OrderEditID string       `json:"order_edit_id"`
+	Status      string       `json:"status"`
+	AmountCents int          `json:"amount_cents"`
+	Currency    string       `json:"currency"`
+	Reason      string       `json:"reason"`
+	Provider    string       `json:"provider"`
+	ProviderRef string       `json:"provider_ref"`
+	Restocked   bool         `json:"restocked"`
+	CreatedBy   string       `json:"created_by"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Lines       []RefundLine `json:"lines"`
+}
+
+type RefundLine struct {
+	OrderItemID string `json:"order_item_id"`
+	Quantity    int    `json:"quantity"`
+	AmountCents int    `json:"amount_cents"`
+}
+
+// CreateRefundInput describes a refund. With Lines the amount is the sum of
+// the line amounts (a zero line amount means the quantity's share of the
+// line total including tax); without Lines AmountCents is refunded at order
+// level, e.g. for shipping or goodwill.
+type CreateRefundInput struct {
+	OrderID     string
+	Lines       []RefundLine
+	AmountCents int
+	Reason      string
+	Restock     bool
+	CreatedBy   string
+}
+
+// RefundExecutor performs the money movement for a validated refund and
+// returns the provider reference. It runs after the refund was recorded as
+// pending and outside any transaction; idempotencyKey is stable for the
+// refund so a retried provider call cannot pay out twice.
+type RefundExecutor func(o Order, amountCents int, idempotencyKey string) (provider string, providerRef string, err error)
+
+// CreateRefund validates the refund against what has already been refunded
+// and records it as pending, then calls execute. When execute succeeds the
+// refund is settled: it optionally restocks the refunded quantities, moves
+// the order to partially_refunded or refunded and issues a credit note
+// against the order's invoice. When it fails the refund is marked failed.
+func (s *Store) CreateRefund(ctx context.Context, in CreateRefundInput, execute RefundExecutor) (Refund, error) {
+	in.OrderID = strings.TrimSpace(in.OrderID)
+	if in.OrderID == "" {
+		return Refund{}, sql.ErrNoRows
+	}
+	if len(in.Lines) == 0 && in.AmountCents <= 0 {
+		return Refund{}, fmt.Errorf("%w: amount_cents or lines required", ErrInvalidRefund)
+	}
+	if len(in.Lines) > 0 && in.AmountCents != 0 {
+		return Refund{}, fmt.Errorf("%w: use either amount_cents or lines", ErrInvalidRefund)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Refund{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	out, o, err := reserveRefund(ctx, tx, in)
+	if err != nil {
+		return Refund{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Refund{}, err
+	}
+	return s.settleRefund(ctx, o, out, execute, nil)
+}
+
+// reserveRefund validates a refund under the order row lock and records it
+// as pending with its lines. The pending amount and quantities count as
+// refunded until the refund fails, so concurrent refunds cannot exceed the
+// order.
+func reserveRefund(ctx context.Context, tx *sql.Tx, in CreateRefundInput) (Refund, Order, error) {
+	var o Order
+	if err := tx.QueryRowContext(ctx,
+		"SELECT id, number, status, currency, total_cents, COALESCE(payment_method,''), COALESCE(payment_ref,'') FROM orders WHERE id = $1 FOR UPDATE",
+		in.OrderID,
+	).Scan(&o.ID, &o.Number, &o.Status, &o.Currency, &o.TotalCents, &o.PaymentMethod, &o.PaymentRef); err != nil {
+		return Refund{}, Order{}, err
+	}
+	if !CanTransition(o.Status, "refunded") {
+		return Refund{}, Order{}, ErrInvalidTransition
+	}
+
+	var refundedCents int
+	if err := tx.QueryRowContext(ctx,
+		"SELECT COALESCE(SUM(amount_cents),0) FROM order_refunds WHERE order_id = $1 AND status <> $2 AND order_edit_id IS NULL", o.ID, RefundStatusFailed,
+	).Scan(&refundedCents); err != nil {
+		return Refund{}, Order{}, err
+	}
+
+	// lineTotal is what the customer paid for the line, tax included.
+	type itemState struct {
+		lineTotal      int
+		quantity       int
+		refundedQty    int
+		refundedAmount int
+	}
+	items := map[string]*itemState{}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT oi.id, oi.net_cents + oi.tax_cents, oi.quantity,
+			COALESCE((`+refundedQuantity+`), 0),
+			COALESCE((`+refundedLineAmount+`), 0)
+		FROM order_items oi
+		WHERE oi.order_id = $1
+	`, o.ID)
+	if err != nil {
+		return Refund{}, Order{}, err
+	}
+	for rows.Next() {
+		var id string
+		st := &itemState{}
+		if err := rows.Scan(&id, &st.lineTotal, &st.quantity, &st.refundedQty, &st.refundedAmount); err != nil {
+			rows.Close()
+			return Refund{}, Order{}, err
+		}
+		items[id] = st
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return Refund{}, Order{}, err
+	}
+	rows.Close()
+
+	amount := in.AmountCents
+	lines := make([]RefundLine, 0, len(in.Lines))
+	for _, line := range in.Lines {
+		st, ok := items[strings.TrimSpace(line.OrderItemID)]
+		if !ok {
+			return Refund{}, Order{}, fmt.Errorf("%w: unknown order item %s", ErrInvalidRefund, line.OrderItemID)
+		}
+		if line.Quantity <= 0 || st.refundedQty+line.Quantity > st.quantity {
+			return Refund{}, Order{}, fmt.Errorf("%w: quantity exceeds refundable quantity for item %s", ErrInvalidRefund, line.OrderItemID)
+		}
+		// A line never returns more than was paid for it.
+		maxAmount := st.lineTotal - st.refundedAmount
+		if line.AmountCents == 0 {
+			line.AmountCents = min(unitsRefundAmount(st.lineTotal, st.quantity, st.refundedQty, line.Quantity), maxAmount)
+		}
+		if line.AmountCents < 0 || line.AmountCents > maxAmount {
+			return Refund{}, Order{}, fmt.Errorf("%w: invalid amount for item %s", ErrInvalidRefund, line.OrderItemID)
+		}
+		st.refundedQty += line.Quantity
+		st.refundedAmount += line.AmountCents
+		amount += line.AmountCents
+		lines = append(lines, RefundLine{OrderItemID: strings.TrimSpace(line.OrderItemID), Quantity: line.Quantity, AmountCents: line.AmountCents})
+	}
+	if amount <= 0 {
+		return Refund{}, Order{}, fmt.Errorf("%w: amount must be positive", ErrInvalidRefund)
+	}
+	if refundedCents+amount > o.TotalCents {
+		return Refund{}, Order{}, fmt.Errorf("%w: amount exceeds refundable balance of %d", ErrInvalidRefund, o.TotalCents-refundedCents)
+	}
+
+	out := Refund{
+		OrderID:     o.ID,
+		Status:      RefundStatusPending,
+		AmountCents: amount,
+		Currency:    o.Currency,
+		Reason:      strings.TrimSpace(in.Reason),
+		Restocked:   in.Restock && len(lines) > 0,
+		CreatedBy:   strings.TrimSpace(in.CreatedBy),
+		Lines:       lines,
+	}
+	if err := tx.QueryRowContext(ctx,
+		"INSERT INTO order_refunds (order_id, status, amount_cents, currency, reason, restocked, created_by) VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING id, created_at",
+		out.OrderID, out.Status, out.AmountCents, out.Currency, out.Reason, out.Restocked, out.CreatedBy,
+	).Scan(&out.ID, &out.CreatedAt); err != nil {
+		return Refund{}, Order{}, err
+	}
+	for _, line := range lines {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO order_refund_lines (refund_id, order_item_id, quantity, amount_cents) VALUES ($1,$2,$3,$4)",
+			out.ID, line.OrderItemID, line.Quantity, line.AmountCents,
+		); err != nil {
+			return Refund{}, Order{}, err
+		}
+	}
+	return out, o, nil
+}
+
+// unitsRefundAmount is the default refund for quantity more units of a line
+// of lineQuantity units paid lineTotal, refundedQty of which were refunded:
+// each unit's rounded-down share, and for the last unit also the rounding
+// remainder, so the units add up to the line total.
+func unitsRefundAmount(lineTotal, lineQuantity, refundedQty, quantity int) int {
+	amount := lineTotal / lineQuantity * quantity
+	if refundedQty+quantity == lineQuantity {
+		amount += lineTotal % lineQuantity
+	}
+	return amount
+}
+
+// refundedQuantity sums the quantity of order item oi in refunds that did
+// not fail.
+const refundedQuantity = `
+	SELECT SUM(rl.quantity)
+	FROM order_refund_lines rl
+	JOIN order_refunds rf ON rf.id = rl.refund_id
+	WHERE rl.order_item_id = oi.id AND rf.status <> 'failed'`
+
+// refundedLineAmount sums the amount refunded on order item oi by refunds
+// that did not fail.
+const refundedLineAmount = `
+	SELECT SUM(rl.amount_cents)
+	FROM order_refund_lines rl
+	JOIN order_refunds rf ON rf.id = rl.refund_id
+	WHERE rl.order_item_id = oi.id AND rf.status <> 'failed'`
+
+// refundRetryAfter is how long a pending refund is left to the call that
+// created it, or to an earlier retry, before it can be retried.
+const refundRetryAfter = time.Minute
+
+// RetryRefund settles a refund left pending, e.g. by a crash between
+// recording it and calling the provider. execute is called again with the
+// refund id as idempotency key, so a refund the provider already made is
+// returned rather than paid out twice. A return waiting on the refund is
+// received once it succeeds.
+//
+// A failed order edit refund is retried as a new refund of the same amount,
+// since the edit stays applied and the money is still owed; the new refund
+// is returned. Other failed refunds are not retried: their amount is free
+// to be refunded again.
+func (s *Store) RetryRefund(ctx context.Context, orderID, refundID string, execute RefundExecutor) (Refund, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Refund{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var o Order
+	if err := tx.QueryRowContext(ctx,
+		"SELECT id, number, status, currency, total_cents, COALESCE(payment_method,''), COALESCE(payment_ref,'') FROM orders WHERE id::text = $1 FOR UPDATE",
+		orderID,
+	).Scan(&o.ID, &o.Number, &o.Status, &o.Currency, &o.TotalCents, &o.PaymentMethod, &o.PaymentRef); err != nil {
+		return Refund{}, err
+	}
+	items, err := listRefunds(ctx, tx, o.ID, refundID)
+	if err != nil {
+		return Refund{}, err
+	}
+	if len(items) == 0 {
+		return Refund{}, sql.ErrNoRows
+	}
+	out := items[0]
+	if out.Status == RefundStatusFailed && out.OrderEditID != "" {
+		if out, err = reserveEditRefund(ctx, tx, out.OrderEditID, out.AmountCents, out.Currency, out.Reason, out.CreatedBy); err != nil {
+			return Refund{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return Refund{}, err
+		}
+		return s.settleRefund(ctx, o, out, execute, nil)
+	}
+	if out.Status != RefundStatusPending {
+		return Refund{}, fmt.Errorf("%w: only pending refunds and failed order edit refunds can be retried", ErrInvalidRefund)
+	}
+	// Claiming the attempt keeps a second retry from calling the provider
+	// while this one does.
+	res, err := tx.ExecContext(ctx,
+		"UPDATE order_refunds SET attempted_at = now() WHERE id = $1 AND attempted_at < now() - make_interval(secs => $2)",
+		out.ID, refundRetryAfter.Seconds(),
+	)
+	if err != nil {
+		return Refund{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Refund{}, fmt.Errorf("%w: the refund is still being processed", ErrInvalidRefund)
+	}
+	if err := tx.Commit(); err != nil {
+		return Refund{}, err
+	}
+	return s.settleRefund(ctx, o, out, execute, nil)
+}
+
+// reserveEditRefund records the pending refund of what order edit editID
+// took off a paid order. Only one refund per edit may be pending or
+// succeeded.
+func reserveEditRefund(ctx context.Context, tx *sql.Tx, editID string, amountCents int, currency, reason, createdBy string) (Refund, error) {
+	out := Refund{
+		OrderEditID: editID,
+		Status:      RefundStatusPending,
+		AmountCents: amountCents,
+		Currency:    currency,
+		Reason:      reason,
+		CreatedBy:   createdBy,
+		Lines:       []RefundLine{},
+	}
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO order_refunds (order_id, order_edit_id, status, amount_cents, currency, reason, created_by)
+		SELECT order_id, id, $2, $3, $4, $5, $6 FROM order_edits WHERE id = $1
+		RETURNING id, order_id, created_at`,
+		editID, out.Status, out.AmountCents, out.Currency, out.Reason, out.CreatedBy,
+	).Scan(&out.ID, &out.OrderID, &out.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return Refund{}, fmt.Errorf("%w: the order edit has already been refunded", ErrInvalidRefund)
+	}
+	return out, err
+}
+
+// settleRefund calls execute for a committed pending refund with the refund
+// id as idempotency key and records the outcome; finish, when set, runs in
+// the transaction settling a successful refund. A return linked to the
+// refund is received when it succeeds and released when it fails, so it can
+// be received again. The request context is not used once the provider was
+// called: the money has moved and the refund must be settled even if the
+// client went away.
+func (s *Store) settleRefund(ctx context.Context, o Order, out Refund, execute RefundExecutor, finish func(context.Context, *sql.Tx, Refund) error) (Refund, error) {
+	provider, providerRef, err := execute(o, out.AmountCents, out.ID)
+	ctx = context.WithoutCancel(ctx)
+	if err != nil {
+		if ferr := s.failRefund(ctx, out.ID); ferr != nil {
+			return Refund{}, errors.Join(err, ferr)
+		}
+		return Refund{}, err
+	}
+	out.Provider, out.ProviderRef = provider, providerRef
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Refund{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if out, err = finalizeRefund(ctx, tx, out); err != nil {
+		return Refund{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE order_returns
+		SET status = $2, restocked = $3, received_by = $4, received_at = now(), updated_at = now()
+		WHERE refund_id = $1 AND status = $5`,
+		out.ID, ReturnStatusReceived, out.Restocked, out.CreatedBy, ReturnStatusApproved,
+	); err != nil {
+		return Refund{}, err
+	}
+	if finish != nil {
+		if err := finish(ctx, tx, out); err != nil {
+			return Refund{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Refund{}, err
+	}
+	return out, nil
+}
+
+// failRefund marks a pending refund failed and unlinks the return waiting
+// on it.
+func (s *Store) failRefund(ctx context.Context, refundID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	res, err := tx.ExecContext(ctx,
+		"UPDATE order_refunds SET status = $2 WHERE id = $1 AND status = $3", refundID, RefundStatusFailed, RefundStatusPending,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE order_returns SET refund_id = NULL, updated_at = now() WHERE refund_id = $1", refundID,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// finalizeRefund marks a pending refund succeeded with the provider
+// reference in out, restocks its lines when requested, moves the order to
+// partially_refunded or refunded and issues a credit note. Order edit
+// refunds are only marked succeeded: the edit already adjusted stock, the
+// total and the invoice.
+func finalizeRefund(ctx context.Context, tx *sql.Tx, out Refund) (Refund, error) {
+	var status string
+	var totalCents int
+	if err := tx.QueryRowContext(ctx,
+		"SELECT status, total_cents FROM orders WHERE id = $1 FOR UPDATE", out.OrderID,
+	).Scan(&status, &totalCents); err != nil {
+		return Refund{}, err
+	}
+	res, err := tx.ExecContext(ctx,
+		"UPDATE order_refunds SET status = $2, provider = $3, provider_ref = NULLIF($4,'') WHERE id = $1 AND status = $5",
+		out.ID, RefundStatusSucceeded, out.Provider, out.ProviderRef, RefundStatusPending,
+	)
+	if err != nil {
+		return Refund{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Refund{}, fmt.Errorf("refund %s is no longer pending", out.ID)
+	}
+	out.Status = RefundStatusSucceeded
+	if out.OrderEditID != "" {
+		return out, nil
+	}
+
+	if out.Restocked {
+		// Lines whose variant was deleted from the catalog cannot be
+		// restocked.
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE product_variants pv
+			SET stock = pv.stock + rl.quantity
+			FROM order_refund_lines rl
+			JOIN order_items oi ON oi.id = rl.order_item_id
+			WHERE rl.refund_id = $1 AND pv.id = oi.product_variant_id`, out.ID,
+		); err != nil {
+			return Refund{}, err
+		}
+	}
+
+	var refundedCents int
+	if err := tx.QueryRowContext(ctx,
+		"SELECT COALESCE(SUM(amount_cents),0) FROM order_refunds WHERE order_id = $1 AND status = $2 AND order_edit_id IS NULL", out.OrderID, RefundStatusSucceeded,
+	).Scan(&refundedCents); err != nil {
+		return Refund{}, err
+	}
+	next := "partially_refunded"
+	if refundedCents >= totalCents {
+		next = "refunded"
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE orders SET status = $1::order_status, updated_at = now() WHERE id = $2", next, out.OrderID); err != nil {
+		return Refund{}, err
+	}
+	if err := recordStatusChange(ctx, tx, out.OrderID, status, next, out.CreatedBy, out.Reason); err != nil {
+		return Refund{}, err
+	}
+	if err := issueCreditNote(ctx, tx, out.OrderID, out); err != nil {
+		return Refund{}, err
+	}
+	return out, nil
+}
+
+func (s *Store) ListRefunds(ctx context.Context, orderID string) ([]Refund, error) {
+	return listRefunds(ctx, s.db, orderID, "")
+}
+
+func listRefunds(ctx context.Context, q queryer, orderID, refundID string) ([]Refund, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, order_id, COALESCE(order_edit_id::text,''), status, amount_cents, currency, reason, provider, COALESCE(provider_ref,''),
+			restocked, created_by, created_at
+		FROM order_refunds
+		WHERE order_id::text = $1 AND ($2 = '' OR id::text = $2)
+		ORDER BY created_at ASC`,
+		orderID, refundID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	out := []Refund{}
+	byID := map[string]int{}
+	for rows.Next() {
+		var r Refund
+		if err := rows.Scan(&r.ID, &r.OrderID, &r.OrderEditID, &r.Status, &r.AmountCents, &r.Currency, &r.Reason, &r.Provider, &r.ProviderRef, &r.Restocked, &r.CreatedBy, &r.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		r.Lines = []RefundLine{}
+		byID[r.ID] = len(out)
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+	if len(out) == 0 {
+		return out, nil
+	}
+	lineRows, err := q.QueryContext(ctx, `
+		SELECT rl.refund_id, rl.order_item_id, rl.quantity, rl.amount_cents
+		FROM order_refund_lines rl
+		JOIN order_refunds r ON r.id = rl.refund_id
+		WHERE r.order_id::text = $1 AND ($2 = '' OR r.id::text = $2)
+	`, orderID, refundID)
+	if err != nil {
+		return nil, err
+	}
+	defer lineRows.Close()
+	for lineRows.Next() {
+		var refundID string
+		var line RefundLine
+		if err := lineRows.Scan(&refundID, &line.OrderItemID, &line.Quantity, &line.AmountCents); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[refundID]; ok {
+			out[i].Lines = append(out[i].Lines, line)
+		}
+	}
+	if err := lineRows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,404 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidReturn wraps validation failures of a return request; the
+// wrapped message is safe to show to customers and admins.
+var ErrInvalidReturn = errors.New("invalid return")
+
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusReceived  = "received"
+)
+
+// returnableStatuses are the order statuses in which shipped goods may be
+// sent back.
+var returnableStatuses = map[string]bool{
+	"partially_shipped":  true,
+	"shipped":            true,
+	"completed":          true,
+	"partially_refunded": true,
+}
+
+type Return struct {
+	ID         string       `json:"id"`
+	OrderID    string       `json:"order_id"`
+	CustomerID string       `json:"customer_id"`
+	Status     string       `json:"status"`
+	Reason     string       `json:"reason"`
+	AdminNote  string       `json:"admin_note"`
+	Restocked  bool         `json:"restocked"`
+	RefundID   string       `json:"refund_id"`
+	DecidedBy  string       `json:"decided_by"`
+	DecidedAt  *time.Time   `json:"decided_at"`
+	ReceivedBy string       `json:"received_by"`
+	ReceivedAt *time.Time   `json:"received_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+	Lines      []ReturnLine `json:"lines"`
+}
+
+type ReturnLine struct {
+	OrderItemID string `json:"order_item_id"`
+	Quantity    int    `json:"quantity"`
+	Reason      string `json:"reason"`
+}
+
+// CreateReturnInput is a customer's request to send back shipped lines.
+// CustomerID must own the order.
+type CreateReturnInput struct {
+	OrderID    string
+	CustomerID string
+	Reason     string
+	Lines      []ReturnLine
+}
+
+// ReceiveReturnInput confirms that the goods of an approved return arrived.
+// With Restock the returned quantities go back into product_variants.stock.
+type ReceiveReturnInput struct {
+	OrderID  string
+	ReturnID string
+	Restock  bool
+	Note     string
+	Actor    string
+}
+
+// CreateReturn records a return request for shipped units that are neither
+// refunded nor part of another open or received return.
+func (s *Store) CreateReturn(ctx context.Context, in CreateReturnInput) (Return, error) {
+	in.OrderID = strings.TrimSpace(in.OrderID)
+	in.CustomerID = strings.TrimSpace(in.CustomerID)
+	if in.OrderID == "" || in.CustomerID == "" {
+		return Return{}, sql.ErrNoRows
+	}
+	if len(in.Lines) == 0 {
+		return Return{}, fmt.Errorf("%w: lines are required", ErrInvalidReturn)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Return{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var status string
+	if err := tx.QueryRowContext(ctx,
+		"SELECT status FROM orders WHERE id::text = $1 AND customer_id::text = $2 FOR UPDATE", in.OrderID, in.CustomerID,
+	).Scan(&status); err != nil {
+		return Return{}, err
+	}
+	if !returnableStatuses[status] {
+		return Return{}, fmt.Errorf("%w: order has no shipped items to return", ErrInvalidReturn)
+	}
+	returnable, err := loadReturnableQuantities(ctx, tx, in.OrderID)
+	if err != nil {
+		return Return{}, err
+	}
+	lines := make([]ReturnLine, 0, len(in.Lines))
+	for _, line := range in.Lines {
+		line.OrderItemID = strings.TrimSpace(line.OrderItemID)
+		line.Reason = strings.TrimSpace(line.Reason)
+		open, ok := returnable[line.OrderItemID]
+		if !ok {
+			return Return{}, fmt.Errorf("%w: unknown order item %s", ErrInvalidReturn, line.OrderItemID)
+		}
+		if line.Quantity <= 0 || line.Quantity > open {
+			return Return{}, fmt.Errorf("%w: quantity exceeds returnable quantity for item %s", ErrInvalidReturn, line.OrderItemID)
+		}
+		returnable[line.OrderItemID] -= line.Quantity
+		lines = append(lines, line)
+	}
+
+	out := Return{
+		OrderID:    in.OrderID,
+		CustomerID: in.CustomerID,
+		Status:     ReturnStatusRequested,
+		Reason:     strings.TrimSpace(in.Reason),
+		Lines:      lines,
+	}
+	if err := tx.QueryRowContext(ctx,
+		"INSERT INTO order_returns (order_id, customer_id, status, reason) VALUES ($1,$2,$3,$4) RETURNING id, created_at, updated_at",
+		out.OrderID, out.CustomerID, out.Status, out.Reason,
+	).Scan(&out.ID, &out.CreatedAt, &out.UpdatedAt); err != nil {
+		return Return{}, err
+	}
+	for _, line := range lines {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO order_return_lines (return_id, order_item_id, quantity, reason) VALUES ($1,$2,$3,$4)",
+			out.ID, line.OrderItemID, line.Quantity, line.Reason,
+		); err != nil {
+			return Return{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Return{}, err
+	}
+	return out, nil
+}
+
+// DecideReturn approves or rejects a requested return. Rejected units can be
+// requested again.
+func (s *Store) DecideReturn(ctx context.Context, orderID, returnID string, approve bool, note, actor string) (Return, error) {
+	next := ReturnStatusRejected
+	if approve {
+		next = ReturnStatusApproved
+	}
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE order_returns
+		SET status = $3, admin_note = $4, decided_by = $5, decided_at = now(), updated_at = now()
+		WHERE id::text = $1 AND order_id::text = $2 AND status = $6`,
+		returnID, orderID, next, strings.TrimSpace(note), strings.TrimSpace(actor), ReturnStatusRequested,
+	)
+	if err != nil {
+		return Return{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := s.GetReturn(ctx, orderID, returnID); err != nil {
+			return Return{}, err
+		}
+		return Return{}, fmt.Errorf("%w: only requested returns can be approved or rejected", ErrInvalidReturn)
+	}
+	return s.GetReturn(ctx, orderID, returnID)
+}
+
+// ReceiveReturn marks an approved return received and refunds its lines
+// through execute, optionally restocking them. The refund is recorded as
+// pending and linked to the return before the provider is called; the
+// return is marked received when the refund succeeds and stays approved
+// when it fails, so it can be received again. A refund left pending is
+// settled with RetryRefund.
+func (s *Store) ReceiveReturn(ctx context.Context, in ReceiveReturnInput, execute RefundExecutor) (Return, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Return{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var orderStatus string
+	if err := tx.QueryRowContext(ctx, "SELECT status FROM orders WHERE id::text = $1 FOR UPDATE", in.OrderID).Scan(&orderStatus); err != nil {
+		return Return{}, err
+	}
+	items, err := listReturns(ctx, tx, in.OrderID, in.ReturnID)
+	if err != nil {
+		return Return{}, err
+	}
+	if len(items) == 0 {
+		return Return{}, sql.ErrNoRows
+	}
+	ret := items[0]
+	if ret.Status != ReturnStatusApproved {
+		return Return{}, fmt.Errorf("%w: only approved returns can be received", ErrInvalidReturn)
+	}
+	if ret.RefundID != "" {
+		return Return{}, fmt.Errorf("%w: the return is already being refunded; retry its refund %s if it stays pending", ErrInvalidReturn, ret.RefundID)
+	}
+
+	refundIn := CreateRefundInput{
+		OrderID:   in.OrderID,
+		Reason:    "return " + ret.ID,
+		Restock:   in.Restock,
+		CreatedBy: strings.TrimSpace(in.Actor),
+	}
+	for _, line := range ret.Lines {
+		refundIn.Lines = append(refundIn.Lines, RefundLine{OrderItemID: line.OrderItemID, Quantity: line.Quantity})
+	}
+	refund, o, err := reserveRefund(ctx, tx, refundIn)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefund) || errors.Is(err, ErrInvalidTransition) {
+			return Return{}, fmt.Errorf("%w: %v", ErrInvalidReturn, err)
+		}
+		return Return{}, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE order_returns SET refund_id = $2, updated_at = now() WHERE id = $1", ret.ID, refund.ID); err != nil {
+		return Return{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Return{}, err
+	}
+
+	note := strings.TrimSpace(in.Note)
+	if _, err := s.settleRefund(ctx, o, refund, execute, func(ctx context.Context, tx *sql.Tx, _ Refund) error {
+		if note == "" {
+			return nil
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE order_returns SET admin_note = $2 WHERE id = $1", ret.ID, note)
+		return err
+	}); err != nil {
+		return Return{}, err
+	}
+	return s.GetReturn(ctx, in.OrderID, in.ReturnID)
+}
+
+func (s *Store) ListReturns(ctx context.Context, orderID string) ([]Return, error) {
+	return listReturns(ctx, s.db, orderID, "")
+}
+
+// ListCustomerReturns lists the returns of an order owned by customerID and
+// returns sql.ErrNoRows for anyone else's order.
+func (s *Store) ListCustomerReturns(ctx context.Context, orderID, customerID string) ([]Return, error) {
+	if err := s.checkCustomerOrder(ctx, orderID, customerID); err != nil {
+		return nil, err
+	}
+	return listReturns(ctx, s.db, orderID, "")
+}
+
+// ListReturnsByStatus is the admin work queue: the oldest returns in status
+// first, across all orders.
+func (s *Store) ListReturnsByStatus(ctx context.Context, status string, limit int) ([]Return, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, order_id FROM order_returns WHERE status = $1 ORDER BY created_at ASC LIMIT $2", status, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	type ref struct{ id, orderID string }
+	var refs []ref
+	for rows.Next() {
+		var r ref
+		if err := rows.Scan(&r.id, &r.orderID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		refs = append(refs, r)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+	out := make([]Return, 0, len(refs))
+	for _, r := range refs {
+		ret, err := s.GetReturn(ctx, r.orderID, r.id)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ret)
+	}
+	return out, nil
+}
+
+func (s *Store) GetReturn(ctx context.Context, orderID, returnID string) (Return, error) {
+	items, err := listReturns(ctx, s.db, orderID, returnID)
+	if err != nil {
+		return Return{}, err
+	}
+	if len(items) == 0 {
+		return Return{}, sql.ErrNoRows
+	}
+	return items[0], nil
+}
+
+func listReturns(ctx context.Context, q queryer, orderID, returnID string) ([]Return, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, order_id, COALESCE(customer_id::text, ''), status, reason, admin_note, restocked, COALESCE(refund_id::text, ''),
+			decided_by, decided_at, received_by, received_at, created_at, updated_at
+		FROM order_returns
+		WHERE order_id::text = $1 AND ($2 = '' OR id::text = $2)
+		ORDER BY created_at ASC`, orderID, returnID)
+	if err != nil {
+		return nil, err
+	}
+	out := []Return{}
+	byID := map[string]int{}
+	for rows.Next() {
+		var r Return
+		if err := rows.Scan(&r.ID, &r.OrderID, &r.CustomerID, &r.Status, &r.Reason, &r.AdminNote, &r.Restocked, &r.RefundID,
+			&r.DecidedBy, &r.DecidedAt, &r.ReceivedBy, &r.ReceivedAt, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		r.Lines = []ReturnLine{}
+		byID[r.ID] = len(out)
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+	if len(out) == 0 {
+		return out, nil
+	}
+	lineRows, err := q.QueryContext(ctx, `
+		SELECT rl.return_id, rl.order_item_id, rl.quantity, rl.reason
+		FROM order_return_lines rl
+		JOIN order_returns r ON r.id = rl.return_id
+		WHERE r.order_id = $1`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer lineRows.Close()
+	for lineRows.Next() {
+		var returnID string
+		var line ReturnLine
+		if err := lineRows.Scan(&returnID, &line.OrderItemID, &line.Quantity, &line.Reason); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[returnID]; ok {
+			out[i].Lines = append(out[i].Lines, line)
+		}
+	}
+	return out, lineRows.Err()
+}
+
+// loadReturnableQuantities maps each order item to how many units may still
+// be returned: what was shipped, capped by what was not refunded outside a
+// return, minus units in returns that were not rejected.
+func loadReturnableQuantities(ctx context.Context, tx *sql.Tx, orderID string) (map[string]int, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT oi.id, oi.quantity,
+			COALESCE((
+				SELECT SUM(sl.quantity)
+				FROM order_shipment_lines sl
+				JOIN order_shipments sh ON sh.id = sl.shipment_id
+				WHERE sl.order_item_id = oi.id AND sh.status <> 'cancelled'
+			), 0),
+			COALESCE((
+				SELECT SUM(rl.quantity)
+				FROM order_refund_lines rl
+				JOIN order_refunds rf ON rf.id = rl.refund_id
+				WHERE rl.order_item_id = oi.id AND rf.status <> 'failed'
+				AND NOT EXISTS (SELECT 1 FROM order_returns r WHERE r.refund_id = rl.refund_id)
+			), 0),
+			COALESCE((
+				SELECT SUM(retl.quantity)
+				FROM order_return_lines retl
+				JOIN order_returns r ON r.id = retl.return_id
+				WHERE retl.order_item_id = oi.id AND r.status <> 'rejected'
+			), 0)
+		FROM order_items oi
+		WHERE oi.order_id = $1`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]int{}
+	for rows.Next() {
+		var id string
+		var quantity, shipped, refunded, returned int
+		if err := rows.Scan(&id, &quantity, &shipped, &refunded, &returned); err != nil {
+			return nil, err
+		}
+		out[id] = returnableQuantity(quantity, shipped, refunded, returned)
+	}
+	return out, rows.Err()
+}
+
+func returnableQuantity(quantity, shipped, refundedOutsideReturns, returned int) int {
+	n := min(shipped, quantity-refundedOutsideReturns) - returned
+	if n < 0 {
+		return 0
+	}
+	return n
+}
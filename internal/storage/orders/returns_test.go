@@ -0,0 +1,178 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+
+	platformdb "goecommerce/internal/platform/db"
+	storcart "goecommerce/internal/storage/cart"
+)
+
+func TestReturnableQuantity(t *testing.T) {
+	cases := []struct {
+		name                                        string
+		quantity, shipped, refunded, returned, want int
+	}{
+		{"nothing shipped", 2, 0, 0, 0, 0},
+		{"all shipped", 3, 3, 0, 0, 3},
+		{"refunded before shipping", 3, 2, 1, 0, 2},
+		{"goodwill refund after shipping", 3, 3, 1, 0, 2},
+		{"already in a return", 3, 3, 0, 2, 1},
+		{"never negative", 1, 1, 1, 1, 0},
+	}
+	for _, tc := range cases {
+		if got := returnableQuantity(tc.quantity, tc.shipped, tc.refunded, tc.returned); got != tc.want {
+			t.Fatalf("%s: expected %d, got %d", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestReturnRequestApproveReceiveRefundsAndRestocks(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set; skipping return test")
+	}
+	ctx := context.Background()
+	db, err := platformdb.Open(ctx, dsn)
+	if err != nil {
+		t.Fatalf("db open error: %v", err)
+	}
+	defer db.Close()
+
+	var regclass *string
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('public.order_returns')").Scan(&regclass); err != nil || regclass == nil || *regclass == "" {
+		t.Skip("order_returns table not present; apply migrations to run this test")
+	}
+	var providerKey, variantID, customerID string
+	if err := db.QueryRowContext(ctx, "SELECT key FROM shipping_providers LIMIT 1").Scan(&providerKey); err != nil {
+		if err == sql.ErrNoRows {
+			t.Skip("no shipping providers seeded; skipping")
+		}
+		t.Fatalf("query provider: %v", err)
+	}
+	if err := db.QueryRowContext(ctx, "SELECT id FROM product_variants WHERE stock >= 2 LIMIT 1").Scan(&variantID); err != nil {
+		if err == sql.ErrNoRows {
+			t.Skip("no product variants with stock seeded; skipping")
+		}
+		t.Fatalf("query variant: %v", err)
+	}
+	if err := db.QueryRowContext(ctx, "INSERT INTO customers (email, password_hash) VALUES ('returns-' || gen_random_uuid() || '@example.com', 'x') RETURNING id").Scan(&customerID); err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+
+	cartStore, err := storcart.NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("cart store init: %v", err)
+	}
+	orderStore, err := NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("orders store init: %v", err)
+	}
+	c, err := cartStore.CreateCart(ctx)
+	if err != nil {
+		t.Fatalf("create cart: %v", err)
+	}
+	if _, err := cartStore.AddItem(ctx, c.ID, variantID, 2, nil); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	c2, err := cartStore.GetCart(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("get cart: %v", err)
+	}
+	o, err := orderStore.CreateOrder(ctx, c2, CreateOrderInput{CustomerID: customerID})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	itemID := o.Items[0].ID
+	if _, err := orderStore.MarkOrderPaid(ctx, o.ID, "test"); err != nil {
+		t.Fatalf("mark paid: %v", err)
+	}
+
+	lines := []ReturnLine{{OrderItemID: itemID, Quantity: 1, Reason: "too small"}}
+	if _, err := orderStore.CreateReturn(ctx, CreateReturnInput{OrderID: o.ID, CustomerID: customerID, Lines: lines}); !errors.Is(err, ErrInvalidReturn) {
+		t.Fatalf("expected unshipped order not to be returnable, got %v", err)
+	}
+	if _, err := orderStore.CreateShipment(ctx, CreateShipmentInput{OrderID: o.ID, ProviderKey: providerKey}, nil); err != nil {
+		t.Fatalf("create shipment: %v", err)
+	}
+	if _, err := orderStore.CreateReturn(ctx, CreateReturnInput{OrderID: o.ID, CustomerID: customerID, Lines: []ReturnLine{{OrderItemID: itemID, Quantity: 3}}}); !errors.Is(err, ErrInvalidReturn) {
+		t.Fatalf("expected ErrInvalidReturn for too many units, got %v", err)
+	}
+	ret, err := orderStore.CreateReturn(ctx, CreateReturnInput{OrderID: o.ID, CustomerID: customerID, Reason: "does not fit", Lines: lines})
+	if err != nil {
+		t.Fatalf("create return: %v", err)
+	}
+	if _, err := orderStore.ReceiveReturn(ctx, ReceiveReturnInput{OrderID: o.ID, ReturnID: ret.ID}, nil); !errors.Is(err, ErrInvalidReturn) {
+		t.Fatalf("expected a requested return not to be receivable, got %v", err)
+	}
+	if _, err := orderStore.DecideReturn(ctx, o.ID, ret.ID, true, "ok", "admin"); err != nil {
+		t.Fatalf("approve return: %v", err)
+	}
+	if _, err := orderStore.DecideReturn(ctx, o.ID, ret.ID, false, "", "admin"); !errors.Is(err, ErrInvalidReturn) {
+		t.Fatalf("expected ErrInvalidReturn deciding twice, got %v", err)
+	}
+
+	var stockBefore int
+	if err := db.QueryRowContext(ctx, "SELECT stock FROM product_variants WHERE id = $1", variantID).Scan(&stockBefore); err != nil {
+		t.Fatalf("query stock: %v", err)
+	}
+	// A failed refund leaves the return approved so it can be received again.
+	providerErr := errors.New("provider down")
+	if _, err := orderStore.ReceiveReturn(ctx, ReceiveReturnInput{OrderID: o.ID, ReturnID: ret.ID, Actor: "admin"}, func(Order, int, string) (string, string, error) {
+		return "", "", providerErr
+	}); !errors.Is(err, providerErr) {
+		t.Fatalf("expected provider error, got %v", err)
+	}
+	if again, err := orderStore.GetReturn(ctx, o.ID, ret.ID); err != nil || again.Status != ReturnStatusApproved || again.RefundID != "" {
+		t.Fatalf("expected the return to stay approved after a failed refund, got %+v err=%v", again, err)
+	}
+	received, err := orderStore.ReceiveReturn(ctx, ReceiveReturnInput{OrderID: o.ID, ReturnID: ret.ID, Restock: true, Actor: "admin"}, func(o Order, amountCents int, _ string) (string, string, error) {
+		return "test", "re_1", nil
+	})
+	if err != nil {
+		t.Fatalf("receive return: %v", err)
+	}
+	if received.Status != ReturnStatusReceived || received.RefundID == "" || !received.Restocked {
+		t.Fatalf("unexpected received return %+v", received)
+	}
+	var stockAfter int
+	if err := db.QueryRowContext(ctx, "SELECT stock FROM product_variants WHERE id = $1", variantID).Scan(&stockAfter); err != nil {
+		t.Fatalf("query stock: %v", err)
+	}
+	if stockAfter != stockBefore+1 {
+		t.Fatalf("expected stock restocked by 1, got %d -> %d", stockBefore, stockAfter)
+	}
+	got, err := orderStore.GetOrderByID(ctx, o.ID)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if got.Status != "partially_refunded" {
+		t.Fatalf("expected partially_refunded after return refund, got %s", got.Status)
+	}
+
+	second, err := orderStore.CreateReturn(ctx, CreateReturnInput{OrderID: o.ID, CustomerID: customerID, Lines: lines})
+	if err != nil {
+		t.Fatalf("expected the other unit to be returnable, got %v", err)
+	}
+	if _, err := orderStore.CreateReturn(ctx, CreateReturnInput{OrderID: o.ID, CustomerID: customerID, Lines: lines}); !errors.Is(err, ErrInvalidReturn) {
+		t.Fatalf("expected no units left to return, got %v", err)
+	}
+	if _, err := orderStore.DecideReturn(ctx, o.ID, second.ID, false, "worn", "admin"); err != nil {
+		t.Fatalf("reject return: %v", err)
+	}
+	if _, err := orderStore.CreateReturn(ctx, CreateReturnInput{OrderID: o.ID, CustomerID: "00000000-0000-0000-0000-000000000000", Lines: lines}); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected other customers not to see the order, got %v", err)
+	}
+	if _, err := orderStore.GetReturn(ctx, "not-a-uuid", ret.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected a malformed order id not to be found, got %v", err)
+	}
+	if _, err := orderStore.DecideReturn(ctx, o.ID, "not-a-uuid", true, "", "admin"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected a malformed return id not to be found, got %v", err)
+	}
+	if _, err := orderStore.ReceiveReturn(ctx, ReceiveReturnInput{OrderID: "not-a-uuid", ReturnID: ret.ID}, nil); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected a malformed order id not to be found on receive, got %v", err)
+	}
+}
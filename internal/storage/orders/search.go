@@ -0,0 +1,194 @@
+package orders
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SearchOrdersParams filters the admin order list. Empty fields do not
+// filter; From is inclusive and To exclusive.
+type SearchOrdersParams struct {
+	Page          int
+	Limit         int
+	Statuses      []string
+	From          *time.Time
+	To            *time.Time
+	Email         string
+	NumberPrefix  string
+	MinTotalCents *int
+	MaxTotalCents *int
+	PaymentMethod string
+	// PaymentIssue keeps only orders flagged with a payment to refund.
+	PaymentIssue bool
+	// Query matches words of the billing or shipping name; the last word
+	// may be incomplete.
+	Query string
+}
+
+type OrdersPage struct {
+	Items []Order
+	Total int
+	Page  int
+	Limit int
+}
+
+// orderFilter returns the WHERE clause for in and its arguments. It reads
+// from orders aliased as o.
+func orderFilter(in SearchOrdersParams) (string, []any) {
+	conditions := make([]string, 0, 8)
+	args := make([]any, 0, 8)
+	appendArg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if len(in.Statuses) > 0 {
+		conditions = append(conditions, "o.status::text = ANY("+appendArg(in.Statuses)+"::text[])")
+	}
+	if in.From != nil {
+		conditions = append(conditions, "o.created_at >= "+appendArg(*in.From))
+	}
+	if in.To != nil {
+		conditions = append(conditions, "o.created_at < "+appendArg(*in.To))
+	}
+	if email := strings.ToLower(strings.TrimSpace(in.Email)); email != "" {
+		conditions = append(conditions, "lower(o.email) = "+appendArg(email))
+	}
+	if prefix := strings.TrimSpace(in.NumberPrefix); prefix != "" {
+		conditions = append(conditions, "o.number LIKE "+appendArg(escapeLike(prefix)+"%"))
+	}
+	if in.MinTotalCents != nil {
+		conditions = append(conditions, "o.total_cents >= "+appendArg(*in.MinTotalCents))
+	}
+	if in.MaxTotalCents != nil {
+		conditions = append(conditions, "o.total_cents <= "+appendArg(*in.MaxTotalCents))
+	}
+	if method := strings.TrimSpace(in.PaymentMethod); method != "" {
+		conditions = append(conditions, "o.payment_method = "+appendArg(method))
+	}
+	if in.PaymentIssue {
+		conditions = append(conditions, "o.payment_issue IS NOT NULL")
+	}
+	if q := nameSearchQuery(in.Query); q != "" {
+		conditions = append(conditions, "o.customer_name_search @@ to_tsquery('simple', "+appendArg(q)+")")
+	}
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// nameSearchQuery turns free text into a tsquery matching every word, the
+// last one as a prefix so results follow typing. Characters other than
+// letters and digits are dropped so user input cannot form tsquery syntax.
+func nameSearchQuery(q string) string {
+	terms := []string{}
+	for _, word := range strings.Fields(q) {
+		word = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, word)
+		if word != "" {
+			terms = append(terms, word)
+		}
+	}
+	if len(terms) == 0 {
+		return ""
+	}
+	terms[len(terms)-1] += ":*"
+	return strings.Join(terms, " & ")
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+const searchOrderColumns = `o.id, o.number, o.status, o.currency, o.subtotal_cents, o.shipping_cents, o.tax_cents, o.total_cents,
+	COALESCE(o.payment_method,''), COALESCE(o.payment_ref,''), o.paid_at, COALESCE(o.payment_issue,''), o.email, o.shipping_address_json, o.billing_address_json,
+	o.customer_vat, o.created_at, o.updated_at`
+
+func scanSearchOrder(scan func(...any) error) (Order, error) {
+	var o Order
+	var shippingJSON, billingJSON []byte
+	if err := scan(&o.ID, &o.Number, &o.Status, &o.Currency, &o.SubtotalCents, &o.ShippingCents, &o.TaxCents, &o.TotalCents,
+		&o.PaymentMethod, &o.PaymentRef, &o.PaidAt, &o.PaymentIssue, &o.Email, &shippingJSON, &billingJSON,
+		&o.CustomerVAT, &o.CreatedAt, &o.UpdatedAt); err != nil {
+		return Order{}, err
+	}
+	var err error
+	if o.ShippingAddress, err = unmarshalAddress(shippingJSON); err != nil {
+		return Order{}, err
+	}
+	if o.BillingAddress, err = unmarshalAddress(billingJSON); err != nil {
+		return Order{}, err
+	}
+	return o, nil
+}
+
+// SearchOrders returns one page of the orders matching in, newest first,
+// with the total number of matches. Items carry the order header and
+// addresses but not lines, history or shipments.
+func (s *Store) SearchOrders(ctx context.Context, in SearchOrdersParams) (OrdersPage, error) {
+	page, limit := in.Page, in.Limit
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	out := OrdersPage{Items: []Order{}, Page: page, Limit: limit}
+	where, args := orderFilter(in)
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders o"+where, args...).Scan(&out.Total); err != nil {
+		return OrdersPage{}, err
+	}
+	n := len(args)
+	args = append(args, limit, (page-1)*limit)
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+searchOrderColumns+" FROM orders o"+where+
+			" ORDER BY o.created_at DESC, o.id DESC LIMIT $"+strconv.Itoa(n+1)+" OFFSET $"+strconv.Itoa(n+2),
+		args...,
+	)
+	if err != nil {
+		return OrdersPage{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		o, err := scanSearchOrder(rows.Scan)
+		if err != nil {
+			return OrdersPage{}, err
+		}
+		out.Items = append(out.Items, o)
+	}
+	if err := rows.Err(); err != nil {
+		return OrdersPage{}, err
+	}
+	return out, nil
+}
+
+// ExportOrders calls fn for every order matching in, oldest first, ignoring
+// Page and Limit. Rows are read from the database as fn consumes them, so
+// large exports are never held in memory. An error from fn stops the export
+// and is returned.
+func (s *Store) ExportOrders(ctx context.Context, in SearchOrdersParams, fn func(Order) error) error {
+	where, args := orderFilter(in)
+	rows, err := s.db.QueryContext(ctx, "SELECT "+searchOrderColumns+" FROM orders o"+where+" ORDER BY o.created_at ASC, o.id ASC", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		o, err := scanSearchOrder(rows.Scan)
+		if err != nil {
+			return err
+		}
+		if err := fn(o); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,133 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	platformdb "goecommerce/internal/platform/db"
+	storcart "goecommerce/internal/storage/cart"
+)
+
+func TestNameSearchQuery(t *testing.T) {
+	cases := map[string]string{
+		"":                  "",
+		"  jane ":           "jane:*",
+		"Jane D":            "jane & d:*",
+		"o'brien & | !x:*":  "obrien & x:*",
+		"Žemaitė Jonaitytė": "žemaitė & jonaitytė:*",
+		"& |":               "",
+	}
+	for in, want := range cases {
+		if got := nameSearchQuery(in); got != want {
+			t.Fatalf("%q: expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestOrderFilterBuildsPlaceholders(t *testing.T) {
+	if where, args := orderFilter(SearchOrdersParams{}); where != "" || len(args) != 0 {
+		t.Fatalf("expected no filter, got %q %v", where, args)
+	}
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	minTotal := 100
+	where, args := orderFilter(SearchOrdersParams{
+		Statuses:      []string{"paid"},
+		From:          &from,
+		Email:         " Jane@Example.com ",
+		NumberPrefix:  "ORD_1%",
+		MinTotalCents: &minTotal,
+		Query:         "jane",
+	})
+	for _, want := range []string{"o.status::text = ANY($1::text[])", "o.created_at >= $2", "lower(o.email) = $3", "o.number LIKE $4", "o.total_cents >= $5", "to_tsquery('simple', $6)"} {
+		if !strings.Contains(where, want) {
+			t.Fatalf("expected %q in %q", want, where)
+		}
+	}
+	if len(args) != 6 || args[2] != "jane@example.com" || args[3] != `ORD\_1\%%` || args[5] != "jane:*" {
+		t.Fatalf("unexpected args %v", args)
+	}
+}
+
+func TestSearchAndExportOrders(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set; skipping order search test")
+	}
+	ctx := context.Background()
+	db, err := platformdb.Open(ctx, dsn)
+	if err != nil {
+		t.Fatalf("db open error: %v", err)
+	}
+	defer db.Close()
+
+	var column *string
+	if err := db.QueryRowContext(ctx, "SELECT column_name FROM information_schema.columns WHERE table_name = 'orders' AND column_name = 'customer_name_search'").Scan(&column); err != nil {
+		t.Skip("orders.customer_name_search not present; apply migrations to run this test")
+	}
+	var variantID string
+	if err := db.QueryRowContext(ctx, "SELECT id FROM product_variants WHERE stock >= 1 LIMIT 1").Scan(&variantID); err != nil {
+		if err == sql.ErrNoRows {
+			t.Skip("no product variants with stock seeded; skipping")
+		}
+		t.Fatalf("query variant: %v", err)
+	}
+	cartStore, err := storcart.NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("cart store init: %v", err)
+	}
+	orderStore, err := NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("orders store init: %v", err)
+	}
+	c, err := cartStore.CreateCart(ctx)
+	if err != nil {
+		t.Fatalf("create cart: %v", err)
+	}
+	if _, err := cartStore.AddItem(ctx, c.ID, variantID, 1, nil); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	if c, err = cartStore.GetCart(ctx, c.ID); err != nil {
+		t.Fatalf("get cart: %v", err)
+	}
+	// A unique prefix and surname keep other test orders out of the results.
+	tag := "S" + strings.ReplaceAll(time.Now().Format("150405.000000"), ".", "")
+	format := NumberFormat{StorePrefix: tag, DatePart: NumberDateNone, Padding: 3}
+	o, err := orderStore.CreateOrder(ctx, c, CreateOrderInput{
+		NumberFormat:   format,
+		Email:          "Search@Example.com",
+		PaymentMethod:  "cash-on-delivery",
+		BillingAddress: &Address{FullName: "Ada " + tag},
+	})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+
+	page, err := orderStore.SearchOrders(ctx, SearchOrdersParams{Query: "ada " + strings.ToLower(tag[:5]), Email: "search@example.com", NumberPrefix: tag, PaymentMethod: "cash-on-delivery"})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if page.Total != 1 || len(page.Items) != 1 || page.Items[0].ID != o.ID || page.Items[0].BillingAddress == nil {
+		t.Fatalf("expected the order, got %+v", page)
+	}
+	page, err = orderStore.SearchOrders(ctx, SearchOrdersParams{NumberPrefix: tag, Statuses: []string{"paid"}})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if page.Total != 0 {
+		t.Fatalf("expected no paid orders, got %+v", page)
+	}
+	var exported []string
+	if err := orderStore.ExportOrders(ctx, SearchOrdersParams{NumberPrefix: tag}, func(o Order) error {
+		exported = append(exported, o.Number)
+		return nil
+	}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(exported) != 1 || exported[0] != o.Number {
+		t.Fatalf("unexpected export %v", exported)
+	}
+}
@@ -0,0 +1,670 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidShipment wraps validation failures of a shipment request; the
+// wrapped message is safe to show to admins.
+var ErrInvalidShipment = errors.New("invalid shipment")
+
+// A shipment is pending while it is being booked with the carrier and
+// cancelling while its booking is being voided; in both its units count as
+// shipped so they cannot be booked twice.
+const (
+	ShipmentStatusPending    = "pending"
+	ShipmentStatusShipped    = "shipped"
+	ShipmentStatusDelivered  = "delivered"
+	ShipmentStatusCancelling = "cancelling"
+	ShipmentStatusCancelled  = "cancelled"
+)
+
+// carrierCallTimeout is how long a pending or cancelling shipment is left to
+// the carrier call that set it before CancelShipment may take it over.
+const carrierCallTimeout = time.Minute
+
+// shippableStatuses are the order statuses in which goods may be sent. A
+// partially refunded order can still ship what was not refunded.
+var shippableStatuses = map[string]bool{
+	"paid":               true,
+	"processing":         true,
+	"partially_shipped":  true,
+	"partially_refunded": true,
+}
+
+type Shipment struct {
+	ID             string          `json:"id"`
+	OrderID        string          `json:"order_id"`
+	ProviderKey    string          `json:"provider_key"`
+	TrackingNumber string          `json:"tracking_number"`
+	TrackingURL    string          `json:"tracking_url"`
+	CarrierRef     string          `json:"carrier_ref"`
+	Status         string          `json:"status"`
+	TrackingStatus string          `json:"tracking_status"`
+	ShippedAt      time.Time       `json:"shipped_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	CancelledAt    *time.Time      `json:"cancelled_at"`
+	CreatedBy      string          `json:"created_by"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	Lines          []ShipmentLine  `json:"lines"`
+	Events         []TrackingEvent `json:"tracking_events"`
+}
+
+type ShipmentLine struct {
+	OrderItemID string `json:"order_item_id"`
+	Quantity    int    `json:"quantity"`
+}
+
+// CreateShipmentInput describes goods handed to a carrier. Without Lines
+// everything not yet shipped (or refunded) is included. ProviderKey defaults
+// to the carrier chosen at checkout.
+type CreateShipmentInput struct {
+	OrderID        string
+	ProviderKey    string
+	TrackingNumber string
+	TrackingURL    string
+	Lines          []ShipmentLine
+	ShippedAt      *time.Time
+	CreatedBy      string
+}
+
+// CarrierBooking is the carrier's reference for a parcel registered through
+// its API. Ref is what label downloads and cancellations are keyed on.
+type CarrierBooking struct {
+	Ref            string
+	TrackingNumber string
+	TrackingURL    string
+}
+
+// ShipmentBooker registers a validated shipment with the carrier. It runs
+// after the shipment was recorded as pending and outside any transaction.
+type ShipmentBooker func(sh Shipment) (CarrierBooking, error)
+
+// ShipmentCanceller voids a carrier booking before the shipment is marked
+// cancelled. It runs after the shipment was marked cancelling and outside
+// any transaction; an error puts the shipment back to shipped.
+type ShipmentCanceller func(sh Shipment) error
+
+// UpdateShipmentInput changes tracking details or confirms delivery. Nil
+// fields are left unchanged.
+type UpdateShipmentInput struct {
+	OrderID        string
+	ShipmentID     string
+	TrackingNumber *string
+	TrackingURL    *string
+	Delivered      bool
+	DeliveredAt    *time.Time
+	Actor          string
+}
+
+// CreateShipment records a full or partial shipment and moves the order to
+// partially_shipped or shipped depending on how much of it has been sent.
+// With a non-nil book the shipment is recorded as pending, then registered
+// with the carrier, whose tracking number replaces in.TrackingNumber. It is
+// marked shipped once booked and cancelled if the carrier refuses it.
+func (s *Store) CreateShipment(ctx context.Context, in CreateShipmentInput, book ShipmentBooker) (Shipment, error) {
+	in.OrderID = strings.TrimSpace(in.OrderID)
+	if in.OrderID == "" {
+		return Shipment{}, sql.ErrNoRows
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Shipment{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var status, checkoutProvider string
+	if err := tx.QueryRowContext(ctx,
+		"SELECT status, shipping_provider_key FROM orders WHERE id = $1 FOR UPDATE", in.OrderID,
+	).Scan(&status, &checkoutProvider); err != nil {
+		return Shipment{}, err
+	}
+	if !shippableStatuses[status] {
+		return Shipment{}, ErrInvalidTransition
+	}
+	providerKey := strings.TrimSpace(in.ProviderKey)
+	if providerKey == "" {
+		providerKey = checkoutProvider
+	}
+	if providerKey == "" {
+		return Shipment{}, fmt.Errorf("%w: provider_key is required", ErrInvalidShipment)
+	}
+	var known bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM shipping_providers WHERE key = $1)", providerKey).Scan(&known); err != nil {
+		return Shipment{}, err
+	}
+	if !known {
+		return Shipment{}, fmt.Errorf("%w: unknown carrier %s", ErrInvalidShipment, providerKey)
+	}
+
+	coverage, err := loadShipmentCoverage(ctx, tx, in.OrderID)
+	if err != nil {
+		return Shipment{}, err
+	}
+	lines := make([]ShipmentLine, 0, len(in.Lines))
+	if len(in.Lines) == 0 {
+		for _, it := range coverage {
+			if open := it.open(); open > 0 {
+				lines = append(lines, ShipmentLine{OrderItemID: it.id, Quantity: open})
+			}
+		}
+		if len(lines) == 0 {
+			return Shipment{}, fmt.Errorf("%w: nothing left to ship", ErrInvalidShipment)
+		}
+	}
+	for _, line := range in.Lines {
+		line.OrderItemID = strings.TrimSpace(line.OrderItemID)
+		it := coverage.find(line.OrderItemID)
+		if it == nil {
+			return Shipment{}, fmt.Errorf("%w: unknown order item %s", ErrInvalidShipment, line.OrderItemID)
+		}
+		if line.Quantity <= 0 || line.Quantity > it.open() {
+			return Shipment{}, fmt.Errorf("%w: quantity exceeds unshipped quantity for item %s", ErrInvalidShipment, line.OrderItemID)
+		}
+		it.shipped += line.Quantity
+		lines = append(lines, line)
+	}
+
+	out := Shipment{
+		OrderID:        in.OrderID,
+		ProviderKey:    providerKey,
+		TrackingNumber: strings.TrimSpace(in.TrackingNumber),
+		TrackingURL:    strings.TrimSpace(in.TrackingURL),
+		Status:         ShipmentStatusShipped,
+		CreatedBy:      strings.TrimSpace(in.CreatedBy),
+		Lines:          lines,
+		Events:         []TrackingEvent{},
+	}
+	shippedAt := time.Now()
+	if in.ShippedAt != nil {
+		shippedAt = *in.ShippedAt
+	}
+	if book != nil {
+		out.Status = ShipmentStatusPending
+	}
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO order_shipments (order_id, provider_key, tracking_number, tracking_url, carrier_ref, status, shipped_at, created_by)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+		RETURNING id, shipped_at, created_at, updated_at`,
+		out.OrderID, out.ProviderKey, out.TrackingNumber, out.TrackingURL, out.CarrierRef, out.Status, shippedAt, out.CreatedBy,
+	).Scan(&out.ID, &out.ShippedAt, &out.CreatedAt, &out.UpdatedAt); err != nil {
+		return Shipment{}, err
+	}
+	for _, line := range lines {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO order_shipment_lines (shipment_id, order_item_id, quantity) VALUES ($1,$2,$3)",
+			out.ID, line.OrderItemID, line.Quantity,
+		); err != nil {
+			return Shipment{}, err
+		}
+	}
+	if book != nil {
+		if err := tx.Commit(); err != nil {
+			return Shipment{}, err
+		}
+		return s.bookShipment(ctx, out, book)
+	}
+	if err := syncFulfilmentStatus(ctx, tx, in.OrderID, status, out.CreatedBy); err != nil {
+		return Shipment{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Shipment{}, err
+	}
+	return out, nil
+}
+
+// bookShipment registers a committed pending shipment with the carrier and
+// marks it shipped, or cancels it when booking fails so its units can be
+// shipped again. The request context is not used once the carrier was
+// called, so a booked label is always recorded.
+func (s *Store) bookShipment(ctx context.Context, out Shipment, book ShipmentBooker) (Shipment, error) {
+	booking, err := book(out)
+	ctx = context.WithoutCancel(ctx)
+	if err != nil {
+		if _, cerr := s.db.ExecContext(ctx,
+			"UPDATE order_shipments SET status = $2, cancelled_at = now(), updated_at = now() WHERE id = $1 AND status = $3",
+			out.ID, ShipmentStatusCancelled, ShipmentStatusPending,
+		); cerr != nil {
+			return Shipment{}, errors.Join(err, cerr)
+		}
+		return Shipment{}, err
+	}
+	out.Status = ShipmentStatusShipped
+	out.CarrierRef = booking.Ref
+	out.TrackingNumber = booking.TrackingNumber
+	out.TrackingURL = booking.TrackingURL
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Shipment{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	var status string
+	if err := tx.QueryRowContext(ctx, "SELECT status FROM orders WHERE id = $1 FOR UPDATE", out.OrderID).Scan(&status); err != nil {
+		return Shipment{}, err
+	}
+	if err := tx.QueryRowContext(ctx, `
+		UPDATE order_shipments
+		SET status = $2, carrier_ref = $3, tracking_number = $4, tracking_url = $5, updated_at = now()
+		WHERE id = $1 AND status = $6
+		RETURNING updated_at`,
+		out.ID, out.Status, out.CarrierRef, out.TrackingNumber, out.TrackingURL, ShipmentStatusPending,
+	).Scan(&out.UpdatedAt); err != nil {
+		return Shipment{}, err
+	}
+	if err := syncFulfilmentStatus(ctx, tx, out.OrderID, status, out.CreatedBy); err != nil {
+		return Shipment{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Shipment{}, err
+	}
+	return out, nil
+}
+
+// UpdateShipment edits tracking details or marks a shipment delivered. Once
+// every shipment of a fully shipped order is delivered the order completes.
+func (s *Store) UpdateShipment(ctx context.Context, in UpdateShipmentInput) (Shipment, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Shipment{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var status string
+	if err := tx.QueryRowContext(ctx, "SELECT status FROM orders WHERE id = $1 FOR UPDATE", in.OrderID).Scan(&status); err != nil {
+		return Shipment{}, err
+	}
+	var current string
+	if err := tx.QueryRowContext(ctx,
+		"SELECT status FROM order_shipments WHERE id = $1 AND order_id = $2 FOR UPDATE", in.ShipmentID, in.OrderID,
+	).Scan(&current); err != nil {
+		return Shipment{}, err
+	}
+	switch current {
+	case ShipmentStatusCancelled:
+		return Shipment{}, fmt.Errorf("%w: shipment is cancelled", ErrInvalidShipment)
+	case ShipmentStatusPending:
+		return Shipment{}, fmt.Errorf("%w: shipment is still being booked", ErrInvalidShipment)
+	case ShipmentStatusCancelling:
+		return Shipment{}, fmt.Errorf("%w: shipment is being cancelled", ErrInvalidShipment)
+	}
+	if in.TrackingNumber != nil || in.TrackingURL != nil {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE order_shipments
+			SET tracking_number = COALESCE($2, tracking_number), tracking_url = COALESCE($3, tracking_url), updated_at = now()
+			WHERE id = $1`,
+			in.ShipmentID, trimmedOrNil(in.TrackingNumber), trimmedOrNil(in.TrackingURL),
+		); err != nil {
+			return Shipment{}, err
+		}
+	}
+	if in.Delivered && current != ShipmentStatusDelivered {
+		if err := markShipmentDelivered(ctx, tx, in.ShipmentID, in.DeliveredAt); err != nil {
+			return Shipment{}, err
+		}
+		if err := syncFulfilmentStatus(ctx, tx, in.OrderID, status, strings.TrimSpace(in.Actor)); err != nil {
+			return Shipment{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Shipment{}, err
+	}
+	return s.GetShipment(ctx, in.OrderID, in.ShipmentID)
+}
+
+// CancelShipment voids a shipment that has not been delivered, e.g. a label
+// printed for the wrong parcel. Their units become shippable again and the
+// order moves back to the status matching what is still on its way.
+//
+// A shipment booked with the carrier is marked cancelling and committed
+// before cancel is called, so no order lock is held during the call; it is
+// cancelled once the carrier confirms. A shipment left pending or
+// cancelling by a failed or crashed carrier call can be cancelled once that
+// call must have ended: a pending one has no booking recorded and is
+// cancelled without calling the carrier, a cancelling one is voided again.
+func (s *Store) CancelShipment(ctx context.Context, orderID, shipmentID, actor string, cancel ShipmentCanceller) (Shipment, error) {
+	actor = strings.TrimSpace(actor)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Shipment{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var status string
+	if err := tx.QueryRowContext(ctx, "SELECT status FROM orders WHERE id = $1 FOR UPDATE", orderID).Scan(&status); err != nil {
+		return Shipment{}, err
+	}
+	items, err := listShipments(ctx, tx, orderID, shipmentID)
+	if err != nil {
+		return Shipment{}, err
+	}
+	if len(items) == 0 {
+		return Shipment{}, sql.ErrNoRows
+	}
+	sh := items[0]
+	switch sh.Status {
+	case ShipmentStatusDelivered:
+		return Shipment{}, fmt.Errorf("%w: delivered shipments cannot be cancelled", ErrInvalidShipment)
+	case ShipmentStatusCancelled:
+		return Shipment{}, fmt.Errorf("%w: shipment is already cancelled", ErrInvalidShipment)
+	case ShipmentStatusPending, ShipmentStatusCancelling:
+		var stale bool
+		if err := tx.QueryRowContext(ctx,
+			"SELECT updated_at < now() - make_interval(secs => $2) FROM order_shipments WHERE id = $1",
+			sh.ID, carrierCallTimeout.Seconds(),
+		).Scan(&stale); err != nil {
+			return Shipment{}, err
+		}
+		if !stale {
+			return Shipment{}, fmt.Errorf("%w: the carrier is still being called for this shipment", ErrInvalidShipment)
+		}
+	}
+	if cancel == nil || sh.CarrierRef == "" || sh.Status == ShipmentStatusPending {
+		if err := finishShipmentCancel(ctx, tx, orderID, sh.ID, status, actor); err != nil {
+			return Shipment{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return Shipment{}, err
+		}
+		return s.GetShipment(ctx, orderID, shipmentID)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE order_shipments SET status = $2, updated_at = now() WHERE id = $1",
+		sh.ID, ShipmentStatusCancelling,
+	); err != nil {
+		return Shipment{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Shipment{}, err
+	}
+
+	// The request context is not used once the carrier was called, so a
+	// voided booking is always recorded.
+	err = cancel(sh)
+	ctx = context.WithoutCancel(ctx)
+	if err != nil {
+		if _, rerr := s.db.ExecContext(ctx,
+			"UPDATE order_shipments SET status = $2, updated_at = now() WHERE id = $1 AND status = $3",
+			sh.ID, ShipmentStatusShipped, ShipmentStatusCancelling,
+		); rerr != nil {
+			return Shipment{}, errors.Join(err, rerr)
+		}
+		return Shipment{}, err
+	}
+	tx, err = s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Shipment{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := tx.QueryRowContext(ctx, "SELECT status FROM orders WHERE id = $1 FOR UPDATE", orderID).Scan(&status); err != nil {
+		return Shipment{}, err
+	}
+	if err := finishShipmentCancel(ctx, tx, orderID, sh.ID, status, actor); err != nil {
+		return Shipment{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Shipment{}, err
+	}
+	return s.GetShipment(ctx, orderID, shipmentID)
+}
+
+// finishShipmentCancel marks a shipment cancelled and moves the order, whose
+// row the caller has locked in status, back to what is still on its way.
+func finishShipmentCancel(ctx context.Context, tx *sql.Tx, orderID, shipmentID, status, actor string) error {
+	res, err := tx.ExecContext(ctx,
+		"UPDATE order_shipments SET status = $2, cancelled_at = now(), updated_at = now() WHERE id = $1 AND status NOT IN ($2, $3)",
+		shipmentID, ShipmentStatusCancelled, ShipmentStatusDelivered,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: shipment can no longer be cancelled", ErrInvalidShipment)
+	}
+	return syncFulfilmentStatus(ctx, tx, orderID, status, actor)
+}
+
+func (s *Store) ListShipments(ctx context.Context, orderID string) ([]Shipment, error) {
+	return listShipments(ctx, s.db, orderID, "")
+}
+
+func (s *Store) GetShipment(ctx context.Context, orderID, shipmentID string) (Shipment, error) {
+	items, err := listShipments(ctx, s.db, orderID, shipmentID)
+	if err != nil {
+		return Shipment{}, err
+	}
+	if len(items) == 0 {
+		return Shipment{}, sql.ErrNoRows
+	}
+	return items[0], nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func listShipments(ctx context.Context, q queryer, orderID, shipmentID string) ([]Shipment, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, order_id, provider_key, tracking_number, tracking_url, carrier_ref, status, tracking_status, shipped_at, delivered_at, cancelled_at, created_by, created_at, updated_at
+		FROM order_shipments
+		WHERE order_id = $1 AND ($2 = '' OR id::text = $2)
+		ORDER BY shipped_at ASC, created_at ASC`, orderID, shipmentID)
+	if err != nil {
+		return nil, err
+	}
+	out := []Shipment{}
+	byID := map[string]int{}
+	for rows.Next() {
+		var sh Shipment
+		if err := rows.Scan(&sh.ID, &sh.OrderID, &sh.ProviderKey, &sh.TrackingNumber, &sh.TrackingURL, &sh.CarrierRef, &sh.Status, &sh.TrackingStatus, &sh.ShippedAt, &sh.DeliveredAt, &sh.CancelledAt, &sh.CreatedBy, &sh.CreatedAt, &sh.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sh.Lines = []ShipmentLine{}
+		sh.Events = []TrackingEvent{}
+		byID[sh.ID] = len(out)
+		out = append(out, sh)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	rows.Close()
+	if len(out) == 0 {
+		return out, nil
+	}
+	events, err := listTrackingEvents(ctx, q, orderID)
+	if err != nil {
+		return nil, err
+	}
+	for id, evs := range events {
+		if i, ok := byID[id]; ok {
+			out[i].Events = evs
+		}
+	}
+	lineRows, err := q.QueryContext(ctx, `
+		SELECT sl.shipment_id, sl.order_item_id, sl.quantity
+		FROM order_shipment_lines sl
+		JOIN order_shipments sh ON sh.id = sl.shipment_id
+		WHERE sh.order_id = $1`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer lineRows.Close()
+	for lineRows.Next() {
+		var shipmentID string
+		var line ShipmentLine
+		if err := lineRows.Scan(&shipmentID, &line.OrderItemID, &line.Quantity); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[shipmentID]; ok {
+			out[i].Lines = append(out[i].Lines, line)
+		}
+	}
+	return out, lineRows.Err()
+}
+
+func markShipmentDelivered(ctx context.Context, tx *sql.Tx, shipmentID string, deliveredAt *time.Time) error {
+	at := time.Now()
+	if deliveredAt != nil {
+		at = *deliveredAt
+	}
+	_, err := tx.ExecContext(ctx,
+		"UPDATE order_shipments SET status = $2, delivered_at = $3, updated_at = now() WHERE id = $1",
+		shipmentID, ShipmentStatusDelivered, at,
+	)
+	return err
+}
+
+// itemCoverage is how much of an order line has been shipped. Refunded units
+// are never shipped, so they count as covered; cancelled shipments do not.
+type itemCoverage struct {
+	id       string
+	quantity int
+	refunded int
+	shipped  int
+}
+
+func (c *itemCoverage) open() int {
+	if n := c.quantity - c.refunded - c.shipped; n > 0 {
+		return n
+	}
+	return 0
+}
+
+type shipmentCoverage []*itemCoverage
+
+func (c shipmentCoverage) find(orderItemID string) *itemCoverage {
+	for _, it := range c {
+		if it.id == orderItemID {
+			return it
+		}
+	}
+	return nil
+}
+
+func loadShipmentCoverage(ctx context.Context, tx *sql.Tx, orderID string) (shipmentCoverage, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT oi.id, oi.quantity,
+			COALESCE((`+refundedQuantity+`), 0),
+			COALESCE((
+				SELECT SUM(sl.quantity)
+				FROM order_shipment_lines sl
+				JOIN order_shipments sh ON sh.id = sl.shipment_id
+				WHERE sl.order_item_id = oi.id AND sh.status <> 'cancelled'
+			), 0)
+		FROM order_items oi
+		WHERE oi.order_id = $1
+		ORDER BY oi.created_at ASC, oi.id ASC`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out shipmentCoverage
+	for rows.Next() {
+		it := &itemCoverage{}
+		if err := rows.Scan(&it.id, &it.quantity, &it.refunded, &it.shipped); err != nil {
+			return nil, err
+		}
+		out = append(out, it)
+	}
+	return out, rows.Err()
+}
+
+// fulfilmentStatus derives the order status from shipment coverage: some
+// units shipped is partially_shipped, everything shipped is shipped, and
+// everything shipped and delivered is completed. It returns "" when nothing
+// has been shipped.
+func fulfilmentStatus(coverage shipmentCoverage, allDelivered bool) string {
+	shippedAny, open := false, false
+	for _, it := range coverage {
+		if it.shipped > 0 {
+			shippedAny = true
+		}
+		if it.open() > 0 {
+			open = true
+		}
+	}
+	switch {
+	case !shippedAny:
+		return ""
+	case open:
+		return "partially_shipped"
+	case allDelivered:
+		return "completed"
+	default:
+		return "shipped"
+	}
+}
+
+// fulfilmentReverts are the steps back taken when a shipment is cancelled.
+// They are deliberately not in transitions: admins cannot undo a shipment by
+// changing the order status.
+var fulfilmentReverts = map[string][]string{
+	"partially_shipped": {"processing"},
+	"shipped":           {"partially_shipped", "processing"},
+}
+
+func canRevertFulfilment(from, to string) bool {
+	for _, next := range fulfilmentReverts[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// syncFulfilmentStatus moves the order to the status derived from its
+// shipments, recording each step in the status history. Orders in a status
+// the derived one cannot follow (e.g. refunded) are left alone.
+// Once nothing is on its way any more a shipped order goes back to
+// processing.
+func syncFulfilmentStatus(ctx context.Context, tx *sql.Tx, orderID, current, actor string) error {
+	coverage, err := loadShipmentCoverage(ctx, tx, orderID)
+	if err != nil {
+		return err
+	}
+	var undelivered int
+	if err := tx.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM order_shipments WHERE order_id = $1 AND status IN ($2, $3)", orderID, ShipmentStatusShipped, ShipmentStatusCancelling,
+	).Scan(&undelivered); err != nil {
+		return err
+	}
+	target := fulfilmentStatus(coverage, undelivered == 0)
+	if target == "" && fulfilmentReverts[current] != nil {
+		target = "processing"
+	}
+	if target == "" || target == current {
+		return nil
+	}
+	path := []string{target}
+	if target == "completed" && current != "shipped" {
+		path = []string{"shipped", "completed"}
+	}
+	for _, next := range path {
+		if next == current || (!CanTransition(current, next) && !canRevertFulfilment(current, next)) {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE orders SET status = $1::order_status, updated_at = now() WHERE id = $2", next, orderID); err != nil {
+			return err
+		}
+		if err := recordStatusChange(ctx, tx, orderID, current, next, actor, "fulfilment"); err != nil {
+			return err
+		}
+		current = next
+	}
+	return nil
+}
+
+func trimmedOrNil(v *string) any {
+	if v == nil {
+		return nil
+	}
+	return strings.TrimSpace(*v)
+}
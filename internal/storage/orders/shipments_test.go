@@ -0,0 +1,225 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+
+	platformdb "goecommerce/internal/platform/db"
+	storcart "goecommerce/internal/storage/cart"
+)
+
+func TestFulfilmentStatusFromCoverage(t *testing.T) {
+	cases := []struct {
+		name         string
+		coverage     shipmentCoverage
+		allDelivered bool
+		want         string
+	}{
+		{"nothing shipped", shipmentCoverage{{id: "a", quantity: 2}}, true, ""},
+		{"partial line", shipmentCoverage{{id: "a", quantity: 2, shipped: 1}}, false, "partially_shipped"},
+		{"one of two lines", shipmentCoverage{{id: "a", quantity: 1, shipped: 1}, {id: "b", quantity: 1}}, false, "partially_shipped"},
+		{"refunded units count as covered", shipmentCoverage{{id: "a", quantity: 3, refunded: 1, shipped: 2}}, false, "shipped"},
+		{"all shipped and delivered", shipmentCoverage{{id: "a", quantity: 2, shipped: 2}}, true, "completed"},
+	}
+	for _, tc := range cases {
+		if got := fulfilmentStatus(tc.coverage, tc.allDelivered); got != tc.want {
+			t.Fatalf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestShippableOrdersCanReachShippedAndCompleted(t *testing.T) {
+	for status := range shippableStatuses {
+		if !CanTransition(status, "partially_shipped") && status != "partially_shipped" {
+			t.Fatalf("%s orders cannot become partially_shipped", status)
+		}
+		if !CanTransition(status, "shipped") {
+			t.Fatalf("%s orders cannot become shipped", status)
+		}
+	}
+	if !CanTransition("shipped", "completed") {
+		t.Fatalf("shipped orders cannot complete")
+	}
+}
+
+func TestCreateShipmentPartialThenFullThenDelivered(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set; skipping shipment test")
+	}
+	ctx := context.Background()
+	db, err := platformdb.Open(ctx, dsn)
+	if err != nil {
+		t.Fatalf("db open error: %v", err)
+	}
+	defer db.Close()
+
+	var regclass *string
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('public.order_shipments')").Scan(&regclass); err != nil || regclass == nil || *regclass == "" {
+		t.Skip("order_shipments table not present; apply migrations to run this test")
+	}
+	var providerKey string
+	if err := db.QueryRowContext(ctx, "SELECT key FROM shipping_providers LIMIT 1").Scan(&providerKey); err != nil {
+		if err == sql.ErrNoRows {
+			t.Skip("no shipping providers seeded; skipping")
+		}
+		t.Fatalf("query provider: %v", err)
+	}
+
+	cartStore, err := storcart.NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("cart store init: %v", err)
+	}
+	orderStore, err := NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("orders store init: %v", err)
+	}
+	c, err := cartStore.CreateCart(ctx)
+	if err != nil {
+		t.Fatalf("create cart: %v", err)
+	}
+	var variantID string
+	if err := db.QueryRowContext(ctx, "SELECT id FROM product_variants WHERE stock >= 3 LIMIT 1").Scan(&variantID); err != nil {
+		if err == sql.ErrNoRows {
+			t.Skip("no product variants with stock seeded; skipping")
+		}
+		t.Fatalf("query variant: %v", err)
+	}
+	if _, err := cartStore.AddItem(ctx, c.ID, variantID, 3, nil); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	c2, err := cartStore.GetCart(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("get cart: %v", err)
+	}
+	o, err := orderStore.CreateFromCart(ctx, c2)
+	if err != nil {
+		t.Fatalf("create from cart: %v", err)
+	}
+	itemID := o.Items[0].ID
+
+	if _, err := orderStore.CreateShipment(ctx, CreateShipmentInput{OrderID: o.ID, ProviderKey: providerKey}, nil); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected unpaid order not to ship, got %v", err)
+	}
+	if _, err := orderStore.MarkOrderPaid(ctx, o.ID, "test"); err != nil {
+		t.Fatalf("mark paid: %v", err)
+	}
+	if _, err := orderStore.CreateShipment(ctx, CreateShipmentInput{OrderID: o.ID, ProviderKey: providerKey, Lines: []ShipmentLine{{OrderItemID: itemID, Quantity: 4}}}, nil); !errors.Is(err, ErrInvalidShipment) {
+		t.Fatalf("expected ErrInvalidShipment for over-shipping, got %v", err)
+	}
+	first, err := orderStore.CreateShipment(ctx, CreateShipmentInput{OrderID: o.ID, ProviderKey: providerKey, TrackingNumber: "TRK1", Lines: []ShipmentLine{{OrderItemID: itemID, Quantity: 1}}}, nil)
+	if err != nil {
+		t.Fatalf("first shipment: %v", err)
+	}
+	got, err := orderStore.GetOrderByID(ctx, o.ID)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if got.Status != "partially_shipped" || len(got.Shipments) != 1 || got.Shipments[0].TrackingNumber != "TRK1" {
+		t.Fatalf("expected partially_shipped with one shipment, got %s %+v", got.Status, got.Shipments)
+	}
+
+	// A refused booking cancels the pending shipment and frees its units.
+	carrierErr := errors.New("carrier down")
+	if _, err := orderStore.CreateShipment(ctx, CreateShipmentInput{OrderID: o.ID, ProviderKey: providerKey}, func(sh Shipment) (CarrierBooking, error) {
+		if sh.ID == "" || sh.Status != ShipmentStatusPending {
+			t.Fatalf("expected a recorded pending shipment to be booked, got %+v", sh)
+		}
+		return CarrierBooking{}, carrierErr
+	}); !errors.Is(err, carrierErr) {
+		t.Fatalf("expected carrier error, got %v", err)
+	}
+	booked, err := orderStore.CreateShipment(ctx, CreateShipmentInput{OrderID: o.ID, ProviderKey: providerKey}, func(sh Shipment) (CarrierBooking, error) {
+		return CarrierBooking{Ref: "shp_2", TrackingNumber: "CE2", TrackingURL: "https://track.example.com/CE2"}, nil
+	})
+	if err != nil {
+		t.Fatalf("booked shipment: %v", err)
+	}
+	if booked.CarrierRef != "shp_2" || booked.TrackingNumber != "CE2" || len(booked.Lines) != 1 || booked.Lines[0].Quantity != 2 {
+		t.Fatalf("expected booked shipment of the remaining 2 units, got %+v", booked)
+	}
+	if got, _ = orderStore.GetOrderByID(ctx, o.ID); got.Status != "shipped" {
+		t.Fatalf("expected shipped, got %s", got.Status)
+	}
+
+	// The carrier is called without the order locked; a refused void puts
+	// the shipment back.
+	if _, err := orderStore.CancelShipment(ctx, o.ID, booked.ID, "test", func(sh Shipment) error {
+		var status string
+		if err := db.QueryRowContext(ctx, "SELECT status FROM order_shipments WHERE id = $1", sh.ID).Scan(&status); err != nil || status != ShipmentStatusCancelling {
+			t.Fatalf("expected the shipment marked cancelling during the carrier call, got %q err=%v", status, err)
+		}
+		return carrierErr
+	}); !errors.Is(err, carrierErr) {
+		t.Fatalf("expected carrier error, got %v", err)
+	}
+	if again, err := orderStore.GetShipment(ctx, o.ID, booked.ID); err != nil || again.Status != ShipmentStatusShipped {
+		t.Fatalf("expected the shipment back to shipped, got %+v err=%v", again, err)
+	}
+
+	var voided string
+	cancelled, err := orderStore.CancelShipment(ctx, o.ID, booked.ID, "test", func(sh Shipment) error {
+		voided = sh.CarrierRef
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("cancel shipment: %v", err)
+	}
+	if voided != "shp_2" || cancelled.Status != ShipmentStatusCancelled || cancelled.CancelledAt == nil {
+		t.Fatalf("expected carrier booking voided and shipment cancelled, got %q %+v", voided, cancelled)
+	}
+	if got, _ = orderStore.GetOrderByID(ctx, o.ID); got.Status != "partially_shipped" {
+		t.Fatalf("expected partially_shipped after cancellation, got %s", got.Status)
+	}
+	if _, err := orderStore.CancelShipment(ctx, o.ID, booked.ID, "test", nil); !errors.Is(err, ErrInvalidShipment) {
+		t.Fatalf("expected ErrInvalidShipment cancelling twice, got %v", err)
+	}
+
+	// A shipment left pending by a crashed booking can be cancelled once the
+	// booking call must have ended.
+	stuck, err := orderStore.CreateShipment(ctx, CreateShipmentInput{OrderID: o.ID, ProviderKey: providerKey}, func(sh Shipment) (CarrierBooking, error) {
+		if _, err := orderStore.CancelShipment(ctx, o.ID, sh.ID, "test", nil); !errors.Is(err, ErrInvalidShipment) {
+			t.Fatalf("expected a shipment being booked not to be cancelled, got %v", err)
+		}
+		if _, err := db.ExecContext(ctx, "UPDATE order_shipments SET updated_at = now() - interval '2 minutes' WHERE id = $1", sh.ID); err != nil {
+			t.Fatalf("age shipment: %v", err)
+		}
+		if _, err := orderStore.CancelShipment(ctx, o.ID, sh.ID, "test", func(Shipment) error {
+			t.Fatalf("expected no carrier call for a shipment without a booking")
+			return nil
+		}); err != nil {
+			t.Fatalf("cancel stuck shipment: %v", err)
+		}
+		return CarrierBooking{}, carrierErr
+	})
+	if !errors.Is(err, carrierErr) {
+		t.Fatalf("expected carrier error, got %v %+v", err, stuck)
+	}
+
+	second, err := orderStore.CreateShipment(ctx, CreateShipmentInput{OrderID: o.ID, ProviderKey: providerKey, TrackingNumber: "TRK2"}, nil)
+	if err != nil {
+		t.Fatalf("second shipment: %v", err)
+	}
+	if len(second.Lines) != 1 || second.Lines[0].Quantity != 2 {
+		t.Fatalf("expected remaining 2 units in second shipment, got %+v", second.Lines)
+	}
+	if got, _ = orderStore.GetOrderByID(ctx, o.ID); got.Status != "shipped" {
+		t.Fatalf("expected shipped, got %s", got.Status)
+	}
+
+	for _, id := range []string{first.ID, second.ID} {
+		if _, err := orderStore.UpdateShipment(ctx, UpdateShipmentInput{OrderID: o.ID, ShipmentID: id, Delivered: true, Actor: "test"}); err != nil {
+			t.Fatalf("mark delivered: %v", err)
+		}
+	}
+	got, err = orderStore.GetOrderByID(ctx, o.ID)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if got.Status != "completed" || got.Shipments[2].DeliveredAt == nil {
+		t.Fatalf("expected completed after delivery, got %s %+v", got.Status, got.Shipments)
+	}
+}
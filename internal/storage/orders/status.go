@@ -0,0 +1,86 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// transitions is the order state machine: every status maps to the statuses
+// it may move to. Cancelled and refunded are terminal. Only unpaid orders
+// can be cancelled; a paid order is taken back with a refund so the money
+// is returned. partially_refunded may repeat because each further partial
+// refund records a transition.
+// partially_shipped and shipped are normally set from shipment coverage, see
+// syncFulfilmentStatus. A partially refunded order still ships what was not
+// refunded, so it moves on to them; what was refunded stays visible as the
+// order's RefundedCents.
+var transitions = map[string][]string{
+	"pending_payment":          {"paid", "cancelled"},
+	"awaiting_payment_offline": {"paid", "cancelled"},
+	"paid":                     {"processing", "partially_shipped", "shipped", "partially_refunded", "refunded"},
+	"processing":               {"partially_shipped", "shipped", "completed", "partially_refunded", "refunded"},
+	"partially_shipped":        {"shipped", "partially_refunded", "refunded"},
+	"shipped":                  {"completed", "partially_refunded", "refunded"},
+	"completed":                {"partially_refunded", "refunded"},
+	"partially_refunded":       {"partially_shipped", "shipped", "completed", "partially_refunded", "refunded"},
+	"cancelled":                {},
+	"refunded":                 {},
+}
+
+// IsValidStatus reports whether status is a known order status.
+func IsValidStatus(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+// CanTransition reports whether an order may move from one status to another.
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusChange is one row of an order's status history. From is empty for
+// the status the order was created in.
+type StatusChange struct {
+	From      string
+	To        string
+	Actor     string
+	Note      string
+	CreatedAt time.Time
+}
+
+func recordStatusChange(ctx context.Context, tx *sql.Tx, orderID, from, to, actor, note string) error {
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO order_status_history (order_id, from_status, to_status, actor, note) VALUES ($1,NULLIF($2,''),$3,$4,$5)",
+		orderID, from, to, actor, note,
+	)
+	return err
+}
+
+func (s *Store) ListStatusHistory(ctx context.Context, orderID string) ([]StatusChange, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT COALESCE(from_status,''), to_status, actor, note, created_at FROM order_status_history WHERE order_id = $1 ORDER BY created_at ASC",
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []StatusChange{}
+	for rows.Next() {
+		var c StatusChange
+		if err := rows.Scan(&c.From, &c.To, &c.Actor, &c.Note, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,115 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	storcart "goecommerce/internal/storage/cart"
+)
+
+// StockShortage describes a cart line that cannot be fulfilled.
+type StockShortage struct {
+	ProductVariantID string `json:"product_variant_id"`
+	Requested        int    `json:"requested"`
+	Available        int    `json:"available"`
+}
+
+// InsufficientStockError is returned by CreateOrder when one or more lines
+// exceed the available stock. Nothing is reserved in that case.
+type InsufficientStockError struct {
+	Lines []StockShortage
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("insufficient stock for %d line(s)", len(e.Lines))
+}
+
+// reserveStock decrements stock for every cart line inside tx. Variants are
+// locked in id order so concurrent checkouts cannot deadlock, and the
+// conditional UPDATE makes overselling impossible even without the lock.
+func reserveStock(ctx context.Context, tx *sql.Tx, items []storcart.CartItem) error {
+	requested := map[string]int{}
+	for _, it := range items {
+		requested[it.ProductVariantID] += it.Quantity
+	}
+	ids := make([]string, 0, len(requested))
+	for id := range requested {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var shortages []StockShortage
+	for _, id := range ids {
+		var stock int
+		if err := tx.QueryRowContext(ctx, "SELECT stock FROM product_variants WHERE id = $1 FOR UPDATE", id).Scan(&stock); err != nil {
+			if err == sql.ErrNoRows {
+				shortages = append(shortages, StockShortage{ProductVariantID: id, Requested: requested[id], Available: 0})
+				continue
+			}
+			return err
+		}
+		if stock < requested[id] {
+			shortages = append(shortages, StockShortage{ProductVariantID: id, Requested: requested[id], Available: stock})
+			continue
+		}
+		res, err := tx.ExecContext(ctx, "UPDATE product_variants SET stock = stock - $1 WHERE id = $2 AND stock >= $1", requested[id], id)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			shortages = append(shortages, StockShortage{ProductVariantID: id, Requested: requested[id], Available: stock})
+		}
+	}
+	if len(shortages) > 0 {
+		return &InsufficientStockError{Lines: shortages}
+	}
+	return nil
+}
+
+// releaseStock puts the quantities of an order back on the shelf. Callers
+// only use it when an order that still holds its reservation is cancelled.
+func releaseStock(ctx context.Context, tx *sql.Tx, orderID string) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE product_variants pv
+		SET stock = pv.stock + oi.quantity
+		FROM (
+			SELECT product_variant_id, SUM(quantity) AS quantity
+			FROM order_items
+			WHERE order_id = $1
+			GROUP BY product_variant_id
+		) oi
+		WHERE pv.id = oi.product_variant_id
+	`, orderID)
+	return err
+}
+
+// reservingStatuses are the statuses in which an order still holds the stock
+// it reserved at checkout. Refunded orders return stock per refund line.
+var reservingStatuses = map[string]bool{
+	"pending_payment":          true,
+	"awaiting_payment_offline": true,
+	"paid":                     true,
+	"processing":               true,
+}
+
+// adjustStock applies per-variant quantity changes of an edited order:
+// positive deltas are reserved like checkout lines and negative ones go back
+// on the shelf.
+func adjustStock(ctx context.Context, tx *sql.Tx, deltas map[string]int) error {
+	var reserve []storcart.CartItem
+	for id, n := range deltas {
+		switch {
+		case n > 0:
+			reserve = append(reserve, storcart.CartItem{ProductVariantID: id, Quantity: n})
+		case n < 0:
+			if _, err := tx.ExecContext(ctx, "UPDATE product_variants SET stock = stock + $1 WHERE id = $2", -n, id); err != nil {
+				return err
+			}
+		}
+	}
+	return reserveStock(ctx, tx, reserve)
+}
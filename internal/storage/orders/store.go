@@ -4,9 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
+	"strings"
 	"time"
 
+	"goecommerce/internal/platform/tax"
 	storcart "goecommerce/internal/storage/cart"
 )
 
@@ -19,20 +20,61 @@ type Order struct {
 	ShippingCents int
 	TaxCents      int
 	TotalCents    int
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Items         []OrderItem
+	PaymentMethod string
+	PaymentRef    string
+	// PaidAt and PaymentConfirmedBy are set when the payment is confirmed,
+	// either by a provider webhook or by an admin for offline methods.
+	PaidAt             *time.Time
+	PaymentConfirmedBy string
+	// PaymentIssue describes a payment the order could not take, such as
+	// one collected after the order was cancelled. It has to be refunded.
+	PaymentIssue string
+	// RefundedCents is what succeeded refunds returned, not counting
+	// refunds of order edits, which the total already excludes.
+	RefundedCents   int
+	Email           string
+	Phone           string
+	ShippingAddress *Address
+	BillingAddress  *Address
+	Shipping        ShippingSelection
+	// Tax details as calculated at checkout. With PricesIncludeTax the
+	// subtotal and shipping amounts include TaxCents; otherwise tax is added
+	// on top of them.
+	TaxCountry       string
+	PricesIncludeTax bool
+	TaxReverseCharge bool
+	CustomerVAT      string
+	ShippingTaxCents int
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Items            []OrderItem
+	StatusHistory    []StatusChange
+	Shipments        []Shipment
 }
 
+// OrderItem is an immutable snapshot of a cart line taken at checkout.
+// ProductVariantID and ProductID become empty when the catalog entry is
+// deleted; the remaining fields keep describing what was bought.
 type OrderItem struct {
-	ID               string
-	OrderID          string
-	ProductVariantID string
-	UnitPriceCents   int
-	Currency         string
-	Quantity         int
-	CreatedAt        time.Time
-	UpdatedAt        time.Time
+	ID                string
+	OrderID           string
+	ProductVariantID  string
+	ProductID         string
+	ProductSlug       string
+	ProductTitle      string
+	SKU               string
+	VariantAttributes map[string]any
+	ImageURL          string
+	CustomOptions     []storcart.CartItemCustomOption
+	UnitPriceCents    int
+	Currency          string
+	Quantity          int
+	TaxClass          string
+	TaxRateBps        int
+	NetCents          int
+	TaxCents          int
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
 }
 
 type Store struct{ db *sql.DB }
@@ -46,15 +88,34 @@ func NewStore(_ context.Context, db *sql.DB) (*Store, error) {
 
 func (s *Store) Close() error { return nil }
 
-func generateOrderNumber(now time.Time) string {
-	return fmt.Sprintf("ORD-%s-%d", now.UTC().Format("20060102"), now.UnixNano()%1000000)
+type CreateOrderInput struct {
+	CustomerID    string
+	PaymentMethod string
+	// Status defaults to pending_payment.
+	Status          string
+	Email           string
+	Phone           string
+	ShippingAddress *Address
+	BillingAddress  *Address
+	Shipping        ShippingSelection
+	// Tax is the tax engine result for the cart lines and shipping price.
+	// Without it the order is created untaxed.
+	Tax         *tax.Result
+	CustomerVAT string
+	// NumberFormat formats the order number; the zero value means
+	// DefaultNumberFormat.
+	NumberFormat NumberFormat
 }
 
 func (s *Store) CreateFromCart(ctx context.Context, c storcart.Cart) (Order, error) {
-	return s.CreateFromCartForCustomer(ctx, c, "")
+	return s.CreateOrder(ctx, c, CreateOrderInput{})
 }
 
 func (s *Store) CreateFromCartForCustomer(ctx context.Context, c storcart.Cart, customerID string) (Order, error) {
+	return s.CreateOrder(ctx, c, CreateOrderInput{CustomerID: customerID})
+}
+
+func (s *Store) CreateOrder(ctx context.Context, c storcart.Cart, in CreateOrderInput) (Order, error) {
 	if c.ID == "" {
 		return Order{}, errors.New("invalid cart")
 	}
@@ -65,38 +126,81 @@ func (s *Store) CreateFromCartForCustomer(ctx context.Context, c storcart.Cart,
 	if currency == "" {
 		return Order{}, errors.New("invalid currency")
 	}
-	for _, it := range c.Items {
-		var stock int
-		if err := s.db.QueryRowContext(ctx, "SELECT stock FROM product_variants WHERE id = $1", it.ProductVariantID).Scan(&stock); err != nil {
-			return Order{}, err
-		}
-		if stock < it.Quantity {
-			return Order{}, errors.New("insufficient stock")
-		}
+	status := in.Status
+	if status == "" {
+		status = "pending_payment"
+	}
+	if status != "pending_payment" && status != "awaiting_payment_offline" {
+		return Order{}, errors.New("invalid initial status")
 	}
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return Order{}, err
 	}
 	defer func() { _ = tx.Rollback() }()
-	now := time.Now()
-	num := generateOrderNumber(now)
+	if err := reserveStock(ctx, tx, c.Items); err != nil {
+		return Order{}, err
+	}
+	if in.Shipping.PriceCents < 0 {
+		return Order{}, errors.New("invalid shipping price")
+	}
+	taxes := in.Tax
+	if taxes == nil {
+		res := tax.Calculate(tax.Request{Config: tax.Config{PricesIncludeTax: true}, Lines: c.TaxLines(), ShippingCents: in.Shipping.PriceCents}, nil)
+		taxes = &res
+	}
+	if len(taxes.Lines) != len(c.Items) {
+		return Order{}, errors.New("tax lines do not match cart items")
+	}
+	shippingAddressJSON, err := marshalAddress(in.ShippingAddress)
+	if err != nil {
+		return Order{}, err
+	}
+	billingAddressJSON, err := marshalAddress(in.BillingAddress)
+	if err != nil {
+		return Order{}, err
+	}
+	num, err := nextOrderNumber(ctx, tx, in.NumberFormat, time.Now())
+	if err != nil {
+		return Order{}, err
+	}
 	var o Order
 	var oid string
-	if err := tx.QueryRowContext(ctx,
-		"INSERT INTO orders (number, status, currency, subtotal_cents, shipping_cents, tax_cents, total_cents, customer_id) VALUES ($1,'pending_payment',$2,$3,0,0,$4,NULLIF($5,'')::uuid) RETURNING id, number, status, currency, subtotal_cents, shipping_cents, tax_cents, total_cents, created_at, updated_at",
-		num, currency, c.Totals.SubtotalCents, c.Totals.SubtotalCents, customerID,
-	).Scan(&o.ID, &o.Number, &o.Status, &o.Currency, &o.SubtotalCents, &o.ShippingCents, &o.TaxCents, &o.TotalCents, &o.CreatedAt, &o.UpdatedAt); err != nil {
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO orders (
+			number, status, currency, subtotal_cents, shipping_cents, tax_cents, total_cents, customer_id, payment_method,
+			email, phone, shipping_address_json, billing_address_json,
+			shipping_method_id, shipping_method_title, shipping_provider_key, shipping_service_code, shipping_terminal_id,
+			tax_country, prices_include_tax, tax_reverse_charge, customer_vat, shipping_tax_cents
+		)
+		VALUES ($1,$2::order_status,$3,$4,$5,$6,$7,NULLIF($8,'')::uuid,NULLIF($9,''),$10,$11,$12::jsonb,$13::jsonb,NULLIF($14,'')::uuid,$15,$16,$17,$18,$19,$20,$21,$22,$23)
+		RETURNING id, number, status, currency, subtotal_cents, shipping_cents, tax_cents, total_cents, COALESCE(payment_method,''), created_at, updated_at`,
+		num, status, currency, taxes.SubtotalCents, taxes.ShippingCents, taxes.TaxCents, taxes.TotalCents, in.CustomerID, in.PaymentMethod,
+		strings.TrimSpace(in.Email), strings.TrimSpace(in.Phone), nullableJSON(shippingAddressJSON), nullableJSON(billingAddressJSON),
+		in.Shipping.MethodID, in.Shipping.MethodTitle, in.Shipping.ProviderKey, in.Shipping.ServiceCode, in.Shipping.TerminalID,
+		taxes.Country, taxes.PricesIncludeTax, taxes.ReverseCharge, strings.TrimSpace(in.CustomerVAT), taxes.Shipping.TaxCents,
+	).Scan(&o.ID, &o.Number, &o.Status, &o.Currency, &o.SubtotalCents, &o.ShippingCents, &o.TaxCents, &o.TotalCents, &o.PaymentMethod, &o.CreatedAt, &o.UpdatedAt); err != nil {
 		return Order{}, err
 	}
+	o.Email = strings.TrimSpace(in.Email)
+	o.Phone = strings.TrimSpace(in.Phone)
+	o.ShippingAddress = in.ShippingAddress
+	o.BillingAddress = in.BillingAddress
+	o.Shipping = in.Shipping
+	o.Shipping.PriceCents = o.ShippingCents
+	o.TaxCountry = taxes.Country
+	o.PricesIncludeTax = taxes.PricesIncludeTax
+	o.TaxReverseCharge = taxes.ReverseCharge
+	o.CustomerVAT = strings.TrimSpace(in.CustomerVAT)
+	o.ShippingTaxCents = taxes.Shipping.TaxCents
 	oid = o.ID
+	if err := recordStatusChange(ctx, tx, oid, "", o.Status, "checkout", ""); err != nil {
+		return Order{}, err
+	}
 	items := make([]OrderItem, 0, len(c.Items))
-	for _, it := range c.Items {
-		var oi OrderItem
-		if err := tx.QueryRowContext(ctx,
-			"INSERT INTO order_items (order_id, product_variant_id, unit_price_cents, currency, quantity) VALUES ($1,$2,$3,$4,$5) RETURNING id, order_id, product_variant_id, unit_price_cents, currency, quantity, created_at, updated_at",
-			oid, it.ProductVariantID, it.UnitPriceCents, it.Currency, it.Quantity,
-		).Scan(&oi.ID, &oi.OrderID, &oi.ProductVariantID, &oi.UnitPriceCents, &oi.Currency, &oi.Quantity, &oi.CreatedAt, &oi.UpdatedAt); err != nil {
+	for i, it := range c.Items {
+		oi, err := insertOrderItemSnapshot(ctx, tx, oid, it, taxes.Lines[i])
+		if err != nil {
 			return Order{}, err
 		}
 		items = append(items, oi)
@@ -115,7 +219,7 @@ func (s *Store) ListOrders(ctx context.Context, limit, offset int) ([]Order, err
 	if offset < 0 {
 		offset = 0
 	}
-	rows, err := s.db.QueryContext(ctx, "SELECT id, number, status, currency, subtotal_cents, shipping_cents, tax_cents, total_cents, created_at, updated_at FROM orders ORDER BY created_at DESC LIMIT $1 OFFSET $2", limit, offset)
+	rows, err := s.db.QueryContext(ctx, "SELECT id, number, status, currency, subtotal_cents, shipping_cents, tax_cents, total_cents, COALESCE(payment_method,''), created_at, updated_at FROM orders ORDER BY created_at DESC LIMIT $1 OFFSET $2", limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -123,7 +227,7 @@ func (s *Store) ListOrders(ctx context.Context, limit, offset int) ([]Order, err
 	var items []Order
 	for rows.Next() {
 		var o Order
-		if err := rows.Scan(&o.ID, &o.Number, &o.Status, &o.Currency, &o.SubtotalCents, &o.ShippingCents, &o.TaxCents, &o.TotalCents, &o.CreatedAt, &o.UpdatedAt); err != nil {
+		if err := rows.Scan(&o.ID, &o.Number, &o.Status, &o.Currency, &o.SubtotalCents, &o.ShippingCents, &o.TaxCents, &o.TotalCents, &o.PaymentMethod, &o.CreatedAt, &o.UpdatedAt); err != nil {
 			return nil, err
 		}
 		items = append(items, o)
@@ -135,12 +239,15 @@ func (s *Store) ListOrders(ctx context.Context, limit, offset int) ([]Order, err
 }
 
 type OrderMetrics struct {
-	TotalOrders    int `json:"total_orders"`
-	PendingPayment int `json:"pending_payment"`
-	Paid           int `json:"paid"`
-	Processing     int `json:"processing"`
-	Completed      int `json:"completed"`
-	Cancelled      int `json:"cancelled"`
+	TotalOrders            int `json:"total_orders"`
+	PendingPayment         int `json:"pending_payment"`
+	AwaitingPaymentOffline int `json:"awaiting_payment_offline"`
+	Paid                   int `json:"paid"`
+	Processing             int `json:"processing"`
+	PartiallyShipped       int `json:"partially_shipped"`
+	Shipped                int `json:"shipped"`
+	Completed              int `json:"completed"`
+	Cancelled              int `json:"cancelled"`
 }
 
 func (s *Store) GetOrderMetrics(ctx context.Context) (OrderMetrics, error) {
@@ -149,39 +256,109 @@ func (s *Store) GetOrderMetrics(ctx context.Context) (OrderMetrics, error) {
 		SELECT 
 			COUNT(*),
 			COUNT(*) FILTER (WHERE status = 'pending_payment'),
+			COUNT(*) FILTER (WHERE status = 'awaiting_payment_offline'),
 			COUNT(*) FILTER (WHERE status = 'paid'),
 			COUNT(*) FILTER (WHERE status = 'processing'),
+			COUNT(*) FILTER (WHERE status = 'partially_shipped'),
+			COUNT(*) FILTER (WHERE status = 'shipped'),
 			COUNT(*) FILTER (WHERE status = 'completed'),
 			COUNT(*) FILTER (WHERE status = 'cancelled')
 		FROM orders
-	`).Scan(&m.TotalOrders, &m.PendingPayment, &m.Paid, &m.Processing, &m.Completed, &m.Cancelled)
+	`).Scan(&m.TotalOrders, &m.PendingPayment, &m.AwaitingPaymentOffline, &m.Paid, &m.Processing, &m.PartiallyShipped, &m.Shipped, &m.Completed, &m.Cancelled)
 	return m, err
 }
 
 func (s *Store) GetOrderByID(ctx context.Context, id string) (Order, error) {
 	var o Order
-	if err := s.db.QueryRowContext(ctx, "SELECT id, number, status, currency, subtotal_cents, shipping_cents, tax_cents, total_cents, created_at, updated_at FROM orders WHERE id = $1", id).Scan(&o.ID, &o.Number, &o.Status, &o.Currency, &o.SubtotalCents, &o.ShippingCents, &o.TaxCents, &o.TotalCents, &o.CreatedAt, &o.UpdatedAt); err != nil {
+	var shippingAddressJSON, billingAddressJSON []byte
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT id, number, status, currency, subtotal_cents, shipping_cents, tax_cents, total_cents,
+			COALESCE(payment_method,''), COALESCE(payment_ref,''), paid_at, COALESCE(payment_confirmed_by,''), COALESCE(payment_issue,''),
+			(SELECT COALESCE(SUM(amount_cents),0) FROM order_refunds WHERE order_id = orders.id AND status = 'succeeded' AND order_edit_id IS NULL),
+			email, phone, shipping_address_json, billing_address_json,
+			COALESCE(shipping_method_id::text,''), shipping_method_title, shipping_provider_key, shipping_service_code, shipping_terminal_id,
+			tax_country, prices_include_tax, tax_reverse_charge, customer_vat, shipping_tax_cents,
+			created_at, updated_at
+		FROM orders WHERE id = $1`, id).Scan(
+		&o.ID, &o.Number, &o.Status, &o.Currency, &o.SubtotalCents, &o.ShippingCents, &o.TaxCents, &o.TotalCents,
+		&o.PaymentMethod, &o.PaymentRef, &o.PaidAt, &o.PaymentConfirmedBy, &o.PaymentIssue, &o.RefundedCents,
+		&o.Email, &o.Phone, &shippingAddressJSON, &billingAddressJSON,
+		&o.Shipping.MethodID, &o.Shipping.MethodTitle, &o.Shipping.ProviderKey, &o.Shipping.ServiceCode, &o.Shipping.TerminalID,
+		&o.TaxCountry, &o.PricesIncludeTax, &o.TaxReverseCharge, &o.CustomerVAT, &o.ShippingTaxCents,
+		&o.CreatedAt, &o.UpdatedAt,
+	); err != nil {
+		return Order{}, err
+	}
+	o.Shipping.PriceCents = o.ShippingCents
+	var err error
+	if o.ShippingAddress, err = unmarshalAddress(shippingAddressJSON); err != nil {
 		return Order{}, err
 	}
-	rows, err := s.db.QueryContext(ctx, "SELECT id, order_id, product_variant_id, unit_price_cents, currency, quantity, created_at, updated_at FROM order_items WHERE order_id = $1 ORDER BY created_at ASC", o.ID)
+	if o.BillingAddress, err = unmarshalAddress(billingAddressJSON); err != nil {
+		return Order{}, err
+	}
+	items, err := s.listOrderItems(ctx, o.ID)
 	if err != nil {
 		return Order{}, err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var it OrderItem
-		if err := rows.Scan(&it.ID, &it.OrderID, &it.ProductVariantID, &it.UnitPriceCents, &it.Currency, &it.Quantity, &it.CreatedAt, &it.UpdatedAt); err != nil {
-			return Order{}, err
-		}
-		o.Items = append(o.Items, it)
+	o.Items = items
+	history, err := s.ListStatusHistory(ctx, o.ID)
+	if err != nil {
+		return Order{}, err
 	}
-	if err := rows.Err(); err != nil {
+	o.StatusHistory = history
+	shipments, err := s.ListShipments(ctx, o.ID)
+	if err != nil {
 		return Order{}, err
 	}
+	o.Shipments = shipments
 	return o, nil
 }
 
-func (s *Store) UpdateOrderStatus(ctx context.Context, id string, status string) error {
-	_, err := s.db.ExecContext(ctx, "UPDATE orders SET status = $1, updated_at = now() WHERE id = $2", status, id)
-	return err
+// GetOrderByNumber loads an order by its customer-facing number.
+func (s *Store) GetOrderByNumber(ctx context.Context, number string) (Order, error) {
+	var id string
+	if err := s.db.QueryRowContext(ctx, "SELECT id FROM orders WHERE number = $1", strings.TrimSpace(number)).Scan(&id); err != nil {
+		return Order{}, err
+	}
+	return s.GetOrderByID(ctx, id)
+}
+
+// UpdateOrderStatus moves an order along the state machine in status.go and
+// records the change. Illegal transitions return ErrInvalidTransition.
+// Cancelling an order that still holds its checkout reservation returns the
+// stock; moving it to paid stamps paid_at and issues its invoice.
+func (s *Store) UpdateOrderStatus(ctx context.Context, id string, status string, actor string, note string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	var current string
+	if err := tx.QueryRowContext(ctx, "SELECT status FROM orders WHERE id = $1 FOR UPDATE", id).Scan(&current); err != nil {
+		return err
+	}
+	if !CanTransition(current, status) {
+		return ErrInvalidTransition
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE orders SET status = $1, paid_at = CASE WHEN $1 = 'paid' THEN now() ELSE paid_at END, updated_at = now() WHERE id = $2",
+		status, id,
+	); err != nil {
+		return err
+	}
+	if err := recordStatusChange(ctx, tx, id, current, status, actor, note); err != nil {
+		return err
+	}
+	if status == "paid" {
+		if err := issueInvoice(ctx, tx, id); err != nil {
+			return err
+		}
+	}
+	if status == "cancelled" && reservingStatuses[current] {
+		if err := releaseStock(ctx, tx, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
@@ -0,0 +1,151 @@
+package orders
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TrackingEvent is one carrier scan in a shipment's timeline. A "delivered"
+// event confirms delivery of the shipment.
+type TrackingEvent struct {
+	Status      string    `json:"status"`
+	Description string    `json:"description"`
+	Location    string    `json:"location"`
+	OccurredAt  time.Time `json:"occurred_at"`
+}
+
+// RecordTrackingInput is the carrier timeline fetched for a shipment. Events
+// already stored are ignored, so the full timeline can be passed every time.
+type RecordTrackingInput struct {
+	OrderID    string
+	ShipmentID string
+	Events     []TrackingEvent
+	Actor      string
+}
+
+// ClaimShipmentsForTracking returns up to limit shipments still on their way
+// that have a tracking number and were not checked within recheckAfter, and
+// marks them checked. Rows locked by another instance are skipped, so
+// concurrent pollers never track the same shipment twice.
+func (s *Store) ClaimShipmentsForTracking(ctx context.Context, limit int, recheckAfter time.Duration) ([]Shipment, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE order_shipments
+		SET tracking_checked_at = now()
+		WHERE id IN (
+			SELECT id FROM order_shipments
+			WHERE status = $1 AND tracking_number <> ''
+			AND (tracking_checked_at IS NULL OR tracking_checked_at < now() - make_interval(secs => $2))
+			ORDER BY tracking_checked_at ASC NULLS FIRST
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, order_id, provider_key, tracking_number, tracking_url, carrier_ref, status, tracking_status, shipped_at`,
+		ShipmentStatusShipped, recheckAfter.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Shipment
+	for rows.Next() {
+		var sh Shipment
+		if err := rows.Scan(&sh.ID, &sh.OrderID, &sh.ProviderKey, &sh.TrackingNumber, &sh.TrackingURL, &sh.CarrierRef, &sh.Status, &sh.TrackingStatus, &sh.ShippedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, sh)
+	}
+	return out, rows.Err()
+}
+
+// RecordTrackingEvents stores new timeline events and the latest tracking
+// status. A delivered event marks the shipment delivered, which completes
+// the order once everything has arrived.
+func (s *Store) RecordTrackingEvents(ctx context.Context, in RecordTrackingInput) (Shipment, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Shipment{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var status string
+	if err := tx.QueryRowContext(ctx, "SELECT status FROM orders WHERE id = $1 FOR UPDATE", in.OrderID).Scan(&status); err != nil {
+		return Shipment{}, err
+	}
+	var current string
+	if err := tx.QueryRowContext(ctx,
+		"SELECT status FROM order_shipments WHERE id = $1 AND order_id = $2 FOR UPDATE", in.ShipmentID, in.OrderID,
+	).Scan(&current); err != nil {
+		return Shipment{}, err
+	}
+	if current == ShipmentStatusCancelled || len(in.Events) == 0 {
+		return s.GetShipment(ctx, in.OrderID, in.ShipmentID)
+	}
+
+	events := append([]TrackingEvent(nil), in.Events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].OccurredAt.Before(events[j].OccurredAt) })
+	var deliveredAt *time.Time
+	for _, ev := range events {
+		ev.Status = strings.TrimSpace(ev.Status)
+		if ev.Status == "" || ev.OccurredAt.IsZero() {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO order_shipment_tracking_events (shipment_id, status, description, location, occurred_at)
+			VALUES ($1,$2,$3,$4,$5)
+			ON CONFLICT DO NOTHING`,
+			in.ShipmentID, ev.Status, strings.TrimSpace(ev.Description), strings.TrimSpace(ev.Location), ev.OccurredAt,
+		); err != nil {
+			return Shipment{}, err
+		}
+		if ev.Status == ShipmentStatusDelivered && deliveredAt == nil {
+			at := ev.OccurredAt
+			deliveredAt = &at
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE order_shipments
+		SET tracking_status = $2, updated_at = now()
+		WHERE id = $1`, in.ShipmentID, events[len(events)-1].Status,
+	); err != nil {
+		return Shipment{}, err
+	}
+	if deliveredAt != nil && current == ShipmentStatusShipped {
+		if err := markShipmentDelivered(ctx, tx, in.ShipmentID, deliveredAt); err != nil {
+			return Shipment{}, err
+		}
+		if err := syncFulfilmentStatus(ctx, tx, in.OrderID, status, strings.TrimSpace(in.Actor)); err != nil {
+			return Shipment{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Shipment{}, err
+	}
+	return s.GetShipment(ctx, in.OrderID, in.ShipmentID)
+}
+
+func listTrackingEvents(ctx context.Context, q queryer, orderID string) (map[string][]TrackingEvent, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT te.shipment_id, te.status, te.description, te.location, te.occurred_at
+		FROM order_shipment_tracking_events te
+		JOIN order_shipments sh ON sh.id = te.shipment_id
+		WHERE sh.order_id = $1
+		ORDER BY te.occurred_at ASC, te.created_at ASC`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string][]TrackingEvent{}
+	for rows.Next() {
+		var shipmentID string
+		var ev TrackingEvent
+		if err := rows.Scan(&shipmentID, &ev.Status, &ev.Description, &ev.Location, &ev.OccurredAt); err != nil {
+			return nil, err
+		}
+		out[shipmentID] = append(out[shipmentID], ev)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,124 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	platformdb "goecommerce/internal/platform/db"
+	storcart "goecommerce/internal/storage/cart"
+)
+
+func TestRecordTrackingEventsCompletesOrderOnDelivery(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set; skipping tracking test")
+	}
+	ctx := context.Background()
+	db, err := platformdb.Open(ctx, dsn)
+	if err != nil {
+		t.Fatalf("db open error: %v", err)
+	}
+	defer db.Close()
+
+	var regclass *string
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('public.order_shipment_tracking_events')").Scan(&regclass); err != nil || regclass == nil || *regclass == "" {
+		t.Skip("order_shipment_tracking_events table not present; apply migrations to run this test")
+	}
+	var providerKey, variantID string
+	if err := db.QueryRowContext(ctx, "SELECT key FROM shipping_providers LIMIT 1").Scan(&providerKey); err != nil {
+		if err == sql.ErrNoRows {
+			t.Skip("no shipping providers seeded; skipping")
+		}
+		t.Fatalf("query provider: %v", err)
+	}
+	if err := db.QueryRowContext(ctx, "SELECT id FROM product_variants WHERE stock >= 1 LIMIT 1").Scan(&variantID); err != nil {
+		if err == sql.ErrNoRows {
+			t.Skip("no product variants with stock seeded; skipping")
+		}
+		t.Fatalf("query variant: %v", err)
+	}
+
+	cartStore, err := storcart.NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("cart store init: %v", err)
+	}
+	orderStore, err := NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("orders store init: %v", err)
+	}
+	c, err := cartStore.CreateCart(ctx)
+	if err != nil {
+		t.Fatalf("create cart: %v", err)
+	}
+	if _, err := cartStore.AddItem(ctx, c.ID, variantID, 1, nil); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+	c2, err := cartStore.GetCart(ctx, c.ID)
+	if err != nil {
+		t.Fatalf("get cart: %v", err)
+	}
+	o, err := orderStore.CreateFromCart(ctx, c2)
+	if err != nil {
+		t.Fatalf("create from cart: %v", err)
+	}
+	if _, err := orderStore.MarkOrderPaid(ctx, o.ID, "test"); err != nil {
+		t.Fatalf("mark paid: %v", err)
+	}
+	shippedAt := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	sh, err := orderStore.CreateShipment(ctx, CreateShipmentInput{OrderID: o.ID, ProviderKey: providerKey, TrackingNumber: "TRK-" + o.Number, ShippedAt: &shippedAt}, nil)
+	if err != nil {
+		t.Fatalf("create shipment: %v", err)
+	}
+
+	claimed, err := orderStore.ClaimShipmentsForTracking(ctx, 1000, time.Hour)
+	if err != nil {
+		t.Fatalf("claim shipments: %v", err)
+	}
+	found := false
+	for _, c := range claimed {
+		found = found || c.ID == sh.ID
+	}
+	if !found {
+		t.Fatalf("expected new shipment to be claimed for tracking")
+	}
+	again, err := orderStore.ClaimShipmentsForTracking(ctx, 1000, time.Hour)
+	if err != nil {
+		t.Fatalf("claim shipments: %v", err)
+	}
+	for _, c := range again {
+		if c.ID == sh.ID {
+			t.Fatalf("shipment checked just now must not be claimed again")
+		}
+	}
+
+	inTransit := []TrackingEvent{
+		{Status: "registered", Description: "Shipment data received", OccurredAt: shippedAt},
+		{Status: "in_transit", Description: "Sorting centre", Location: "Vilnius", OccurredAt: shippedAt.Add(6 * time.Hour)},
+	}
+	got, err := orderStore.RecordTrackingEvents(ctx, RecordTrackingInput{OrderID: o.ID, ShipmentID: sh.ID, Events: inTransit, Actor: "tracking"})
+	if err != nil {
+		t.Fatalf("record events: %v", err)
+	}
+	if got.TrackingStatus != "in_transit" || len(got.Events) != 2 || got.Status != ShipmentStatusShipped {
+		t.Fatalf("unexpected shipment after in-transit events %+v", got)
+	}
+
+	delivered := append(inTransit, TrackingEvent{Status: "delivered", Description: "Delivered", OccurredAt: shippedAt.Add(26 * time.Hour)})
+	got, err = orderStore.RecordTrackingEvents(ctx, RecordTrackingInput{OrderID: o.ID, ShipmentID: sh.ID, Events: delivered, Actor: "tracking"})
+	if err != nil {
+		t.Fatalf("record events: %v", err)
+	}
+	if len(got.Events) != 3 || got.Status != ShipmentStatusDelivered || got.DeliveredAt == nil || !got.DeliveredAt.Equal(shippedAt.Add(26*time.Hour)) {
+		t.Fatalf("expected delivered shipment with 3 events, got %+v", got)
+	}
+	order, err := orderStore.GetOrderByID(ctx, o.ID)
+	if err != nil {
+		t.Fatalf("get order: %v", err)
+	}
+	if order.Status != "completed" {
+		t.Fatalf("expected completed order after delivery, got %s", order.Status)
+	}
+}
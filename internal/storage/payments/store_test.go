@@ -0,0 +1,64 @@
+package payments
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+
+	platformdb "goecommerce/internal/platform/db"
+)
+
+func TestProvidersStoreCRUD(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL not set; skipping integration test")
+	}
+	ctx := context.Background()
+	db, err := platformdb.Open(ctx, dsn)
+	if err != nil {
+		t.Fatalf("db open error: %v", err)
+	}
+	defer db.Close()
+
+	var regclass *string
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('public.payment_providers')").Scan(&regclass); err != nil || regclass == nil || *regclass == "" {
+		t.Skip("payment_providers table not present; apply migrations to run this test")
+	}
+
+	store, err := NewStore(ctx, db)
+	if err != nil {
+		t.Fatalf("new store error: %v", err)
+	}
+	const key = "test-payments-provider"
+	_, _ = db.ExecContext(ctx, "DELETE FROM payment_providers WHERE key = $1", key)
+	defer func() { _, _ = db.ExecContext(ctx, "DELETE FROM payment_providers WHERE key = $1", key) }()
+
+	if err := store.CreateProvider(ctx, key, "Test", "", nil); err != nil {
+		t.Fatalf("CreateProvider error: %v", err)
+	}
+	p, err := store.GetProvider(ctx, key)
+	if err != nil {
+		t.Fatalf("GetProvider error: %v", err)
+	}
+	if p.Enabled || p.Mode != "sandbox" {
+		t.Fatalf("unexpected defaults: enabled=%v mode=%s", p.Enabled, p.Mode)
+	}
+	if err := store.UpdateProvider(ctx, key, "Test live", true, "live", []byte(`{"a":1}`)); err != nil {
+		t.Fatalf("UpdateProvider error: %v", err)
+	}
+	p, err = store.GetProvider(ctx, key)
+	if err != nil {
+		t.Fatalf("GetProvider error: %v", err)
+	}
+	if !p.Enabled || p.Mode != "live" || p.Name != "Test live" {
+		t.Fatalf("update not applied: %#v", p)
+	}
+	if err := store.DeleteProvider(ctx, key); err != nil {
+		t.Fatalf("DeleteProvider error: %v", err)
+	}
+	if _, err := store.GetProvider(ctx, key); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows after delete, got %v", err)
+	}
+}
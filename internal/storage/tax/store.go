@@ -0,0 +1,128 @@
+package tax
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	platformtax "goecommerce/internal/platform/tax"
+)
+
+type Class struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type Rate struct {
+	ID        string    `json:"id"`
+	Country   string    `json:"country"`
+	TaxClass  string    `json:"tax_class"`
+	RateBps   int       `json:"rate_bps"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RatesSource loads the rates of one country for the tax engine.
+type RatesSource interface {
+	GetRates(ctx context.Context, country string) (platformtax.Rates, error)
+}
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(_ context.Context, db *sql.DB) (*Store, error) {
+	if db == nil {
+		return nil, errors.New("nil db")
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error { return nil }
+
+// GetRates returns the rates configured for country. A country without rates
+// (outside the EU) yields an empty map, i.e. zero-rated exports.
+func (s *Store) GetRates(ctx context.Context, country string) (platformtax.Rates, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT tax_class, rate_bps FROM tax_rates WHERE country = $1", strings.ToUpper(strings.TrimSpace(country)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := platformtax.Rates{}
+	for rows.Next() {
+		var class string
+		var bps int
+		if err := rows.Scan(&class, &bps); err != nil {
+			return nil, err
+		}
+		out[class] = bps
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) ListClasses(ctx context.Context) ([]Class, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT code, name FROM tax_classes ORDER BY code ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Class{}
+	for rows.Next() {
+		var c Class
+		if err := rows.Scan(&c.Code, &c.Name); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) ListRates(ctx context.Context, country string) ([]Rate, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, country, tax_class, rate_bps, created_at, updated_at
+		FROM tax_rates
+		WHERE $1 = '' OR country = $1
+		ORDER BY country ASC, tax_class ASC`,
+		strings.ToUpper(strings.TrimSpace(country)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Rate{}
+	for rows.Next() {
+		var r Rate
+		if err := rows.Scan(&r.ID, &r.Country, &r.TaxClass, &r.RateBps, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// UpsertRate sets the rate of a country and class, creating it when missing.
+func (s *Store) UpsertRate(ctx context.Context, country, class string, rateBps int) (Rate, error) {
+	var r Rate
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO tax_rates (country, tax_class, rate_bps)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (country, tax_class)
+		DO UPDATE SET rate_bps = EXCLUDED.rate_bps, updated_at = now()
+		RETURNING id, country, tax_class, rate_bps, created_at, updated_at`,
+		strings.ToUpper(strings.TrimSpace(country)), strings.TrimSpace(class), rateBps,
+	).Scan(&r.ID, &r.Country, &r.TaxClass, &r.RateBps, &r.CreatedAt, &r.UpdatedAt)
+	return r, err
+}
+
+func (s *Store) DeleteRate(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM tax_rates WHERE id = $1::uuid", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+-- +goose Up
+-- payment_issue is set when a provider collects money the order cannot
+-- take (e.g. paid after it was cancelled); that payment has to be refunded.
+ALTER TABLE orders
+  ADD COLUMN IF NOT EXISTS payment_ref text NULL,
+  ADD COLUMN IF NOT EXISTS payment_issue text NULL;
+
+CREATE INDEX IF NOT EXISTS idx_orders_payment_issue ON orders(created_at) WHERE payment_issue IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS payment_events (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  provider text NOT NULL,
+  event_id text NOT NULL,
+  event_type text NOT NULL,
+  order_id uuid NULL REFERENCES orders(id) ON DELETE SET NULL,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  UNIQUE (provider, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_events_order_id ON payment_events(order_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_payment_events_order_id;
+DROP TABLE IF EXISTS payment_events;
+
+DROP INDEX IF EXISTS idx_orders_payment_issue;
+ALTER TABLE orders
+  DROP COLUMN IF EXISTS payment_issue,
+  DROP COLUMN IF EXISTS payment_ref;
@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS payment_providers (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  key text NOT NULL UNIQUE,
+  name text NOT NULL,
+  enabled boolean NOT NULL DEFAULT false,
+  mode text NOT NULL DEFAULT 'sandbox' CHECK (mode IN ('sandbox', 'live')),
+  config_json jsonb NOT NULL DEFAULT '{}',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_providers_enabled ON payment_providers(enabled);
+
+ALTER TABLE orders
+  ADD COLUMN IF NOT EXISTS payment_method text NULL;
+
+CREATE INDEX IF NOT EXISTS idx_orders_payment_method ON orders(payment_method);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_orders_payment_method;
+
+ALTER TABLE orders
+  DROP COLUMN IF EXISTS payment_method;
+
+DROP INDEX IF EXISTS idx_payment_providers_enabled;
+DROP TABLE IF EXISTS payment_providers;
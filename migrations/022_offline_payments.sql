@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'awaiting_payment_offline';
+-- +goose StatementEnd
+
+ALTER TABLE orders
+  ADD COLUMN IF NOT EXISTS paid_at timestamptz NULL,
+  ADD COLUMN IF NOT EXISTS payment_confirmed_by text NULL;
+
+-- +goose Down
+-- Note: the awaiting_payment_offline enum value is left in place, see 015.
+ALTER TABLE orders
+  DROP COLUMN IF EXISTS payment_confirmed_by,
+  DROP COLUMN IF EXISTS paid_at;
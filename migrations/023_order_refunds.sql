@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'partially_refunded';
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'refunded';
+-- +goose StatementEnd
+
+-- Refunds are recorded as pending before the payment provider is called and
+-- settled afterwards, so a provider call never runs inside a transaction.
+-- Pending refunds hold their amount against the refundable balance; failed
+-- ones release it. attempted_at is when the provider was last called, so a
+-- refund left pending is only retried once that call must have ended.
+CREATE TABLE IF NOT EXISTS order_refunds (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  order_id uuid NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  amount_cents integer NOT NULL CHECK (amount_cents > 0),
+  currency text NOT NULL,
+  reason text NOT NULL DEFAULT '',
+  provider text NOT NULL DEFAULT '',
+  provider_ref text NULL,
+  restocked boolean NOT NULL DEFAULT false,
+  status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+  attempted_at timestamptz NOT NULL DEFAULT now(),
+  created_by text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_refunds_order_id ON order_refunds(order_id);
+
+CREATE TABLE IF NOT EXISTS order_refund_lines (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  refund_id uuid NOT NULL REFERENCES order_refunds(id) ON DELETE CASCADE,
+  order_item_id uuid NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+  quantity integer NOT NULL CHECK (quantity > 0),
+  amount_cents integer NOT NULL CHECK (amount_cents >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_refund_lines_refund_id ON order_refund_lines(refund_id);
+CREATE INDEX IF NOT EXISTS idx_order_refund_lines_order_item_id ON order_refund_lines(order_item_id);
+
+-- +goose Down
+-- Note: the partially_refunded/refunded enum values are left in place, see 015.
+DROP INDEX IF EXISTS idx_order_refund_lines_order_item_id;
+DROP INDEX IF EXISTS idx_order_refund_lines_refund_id;
+DROP TABLE IF EXISTS order_refund_lines;
+DROP INDEX IF EXISTS idx_order_refunds_order_id;
+DROP TABLE IF EXISTS order_refunds;
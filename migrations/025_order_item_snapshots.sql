@@ -0,0 +1,46 @@
+-- +goose Up
+ALTER TABLE order_items
+  ADD COLUMN IF NOT EXISTS product_id uuid NULL,
+  ADD COLUMN IF NOT EXISTS product_slug text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS product_title text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS sku text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS variant_attributes_json jsonb NOT NULL DEFAULT '{}'::jsonb,
+  ADD COLUMN IF NOT EXISTS image_url text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS custom_options_json jsonb NOT NULL DEFAULT '[]'::jsonb;
+
+-- Backfill existing lines from the current catalog; new lines are snapshotted at checkout.
+UPDATE order_items oi
+SET product_id = p.id,
+    product_slug = p.slug,
+    product_title = p.title,
+    sku = pv.sku,
+    variant_attributes_json = pv.attributes_json,
+    image_url = COALESCE((SELECT url FROM images WHERE product_id = p.id ORDER BY sort ASC LIMIT 1), '')
+FROM product_variants pv
+JOIN products p ON p.id = pv.product_id
+WHERE pv.id = oi.product_variant_id;
+
+-- Snapshots keep past orders readable, so the catalog may now delete variants.
+ALTER TABLE order_items
+  ALTER COLUMN product_variant_id DROP NOT NULL,
+  DROP CONSTRAINT IF EXISTS order_items_product_variant_id_fkey,
+  ADD CONSTRAINT order_items_product_variant_id_fkey
+    FOREIGN KEY (product_variant_id) REFERENCES product_variants(id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE order_items
+  DROP CONSTRAINT IF EXISTS order_items_product_variant_id_fkey;
+DELETE FROM order_items WHERE product_variant_id IS NULL;
+ALTER TABLE order_items
+  ALTER COLUMN product_variant_id SET NOT NULL,
+  ADD CONSTRAINT order_items_product_variant_id_fkey
+    FOREIGN KEY (product_variant_id) REFERENCES product_variants(id) ON DELETE RESTRICT;
+
+ALTER TABLE order_items
+  DROP COLUMN IF EXISTS custom_options_json,
+  DROP COLUMN IF EXISTS image_url,
+  DROP COLUMN IF EXISTS variant_attributes_json,
+  DROP COLUMN IF EXISTS sku,
+  DROP COLUMN IF EXISTS product_title,
+  DROP COLUMN IF EXISTS product_slug,
+  DROP COLUMN IF EXISTS product_id;
@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE orders
+  ADD COLUMN IF NOT EXISTS email text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS phone text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS shipping_address_json jsonb NULL,
+  ADD COLUMN IF NOT EXISTS billing_address_json jsonb NULL,
+  ADD COLUMN IF NOT EXISTS shipping_method_id uuid NULL REFERENCES shipping_methods(id) ON DELETE SET NULL,
+  ADD COLUMN IF NOT EXISTS shipping_method_title text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS shipping_provider_key text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS shipping_service_code text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS shipping_terminal_id text NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_orders_email ON orders(lower(email));
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_orders_email;
+
+ALTER TABLE orders
+  DROP COLUMN IF EXISTS shipping_terminal_id,
+  DROP COLUMN IF EXISTS shipping_service_code,
+  DROP COLUMN IF EXISTS shipping_provider_key,
+  DROP COLUMN IF EXISTS shipping_method_title,
+  DROP COLUMN IF EXISTS shipping_method_id,
+  DROP COLUMN IF EXISTS billing_address_json,
+  DROP COLUMN IF EXISTS shipping_address_json,
+  DROP COLUMN IF EXISTS phone,
+  DROP COLUMN IF EXISTS email;
@@ -0,0 +1,94 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS tax_classes (
+  code text PRIMARY KEY,
+  name text NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+INSERT INTO tax_classes (code, name) VALUES
+  ('standard', 'Standard rate'),
+  ('reduced', 'Reduced rate'),
+  ('zero', 'Zero rate')
+ON CONFLICT (code) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS tax_rates (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  country text NOT NULL,
+  tax_class text NOT NULL REFERENCES tax_classes(code) ON DELETE CASCADE,
+  rate_bps integer NOT NULL CHECK (rate_bps >= 0 AND rate_bps <= 10000),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  UNIQUE (country, tax_class)
+);
+
+-- EU standard and main reduced VAT rates; adjust through /admin/tax/rates.
+INSERT INTO tax_rates (country, tax_class, rate_bps) VALUES
+  ('AT', 'standard', 2000), ('AT', 'reduced', 1000),
+  ('BE', 'standard', 2100), ('BE', 'reduced', 600),
+  ('BG', 'standard', 2000), ('BG', 'reduced', 900),
+  ('CY', 'standard', 1900), ('CY', 'reduced', 900),
+  ('CZ', 'standard', 2100), ('CZ', 'reduced', 1200),
+  ('DE', 'standard', 1900), ('DE', 'reduced', 700),
+  ('DK', 'standard', 2500),
+  ('EE', 'standard', 2400), ('EE', 'reduced', 900),
+  ('ES', 'standard', 2100), ('ES', 'reduced', 1000),
+  ('FI', 'standard', 2550), ('FI', 'reduced', 1400),
+  ('FR', 'standard', 2000), ('FR', 'reduced', 550),
+  ('GR', 'standard', 2400), ('GR', 'reduced', 1300),
+  ('HR', 'standard', 2500), ('HR', 'reduced', 1300),
+  ('HU', 'standard', 2700), ('HU', 'reduced', 500),
+  ('IE', 'standard', 2300), ('IE', 'reduced', 1350),
+  ('IT', 'standard', 2200), ('IT', 'reduced', 1000),
+  ('LT', 'standard', 2100), ('LT', 'reduced', 900),
+  ('LU', 'standard', 1700), ('LU', 'reduced', 800),
+  ('LV', 'standard', 2100), ('LV', 'reduced', 1200),
+  ('MT', 'standard', 1800), ('MT', 'reduced', 700),
+  ('NL', 'standard', 2100), ('NL', 'reduced', 900),
+  ('PL', 'standard', 2300), ('PL', 'reduced', 800),
+  ('PT', 'standard', 2300), ('PT', 'reduced', 600),
+  ('RO', 'standard', 2100), ('RO', 'reduced', 1100),
+  ('SE', 'standard', 2500), ('SE', 'reduced', 1200),
+  ('SI', 'standard', 2200), ('SI', 'reduced', 950),
+  ('SK', 'standard', 2300), ('SK', 'reduced', 1900)
+ON CONFLICT (country, tax_class) DO NOTHING;
+
+ALTER TABLE products
+  ADD COLUMN IF NOT EXISTS tax_class text NOT NULL DEFAULT 'standard' REFERENCES tax_classes(code);
+
+ALTER TABLE product_variants
+  ADD COLUMN IF NOT EXISTS tax_class text NULL REFERENCES tax_classes(code);
+
+ALTER TABLE order_items
+  ADD COLUMN IF NOT EXISTS tax_class text NOT NULL DEFAULT 'standard',
+  ADD COLUMN IF NOT EXISTS tax_rate_bps integer NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS net_cents integer NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS tax_cents integer NOT NULL DEFAULT 0;
+
+UPDATE order_items SET net_cents = unit_price_cents * quantity WHERE net_cents = 0;
+
+ALTER TABLE orders
+  ADD COLUMN IF NOT EXISTS tax_country text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS prices_include_tax boolean NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS tax_reverse_charge boolean NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS customer_vat text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS shipping_tax_cents integer NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE orders
+  DROP COLUMN IF EXISTS shipping_tax_cents,
+  DROP COLUMN IF EXISTS customer_vat,
+  DROP COLUMN IF EXISTS tax_reverse_charge,
+  DROP COLUMN IF EXISTS prices_include_tax,
+  DROP COLUMN IF EXISTS tax_country;
+
+ALTER TABLE order_items
+  DROP COLUMN IF EXISTS tax_cents,
+  DROP COLUMN IF EXISTS net_cents,
+  DROP COLUMN IF EXISTS tax_rate_bps,
+  DROP COLUMN IF EXISTS tax_class;
+
+ALTER TABLE product_variants DROP COLUMN IF EXISTS tax_class;
+ALTER TABLE products DROP COLUMN IF EXISTS tax_class;
+
+DROP TABLE IF EXISTS tax_rates;
+DROP TABLE IF EXISTS tax_classes;
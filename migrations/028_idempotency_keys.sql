@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  key text PRIMARY KEY,
+  request_hash text NOT NULL,
+  completed boolean NOT NULL DEFAULT false,
+  status_code integer NOT NULL DEFAULT 0,
+  response_headers_json jsonb NOT NULL DEFAULT '{}'::jsonb,
+  response_body bytea NULL,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  expires_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS idempotency_keys;
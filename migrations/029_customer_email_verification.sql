@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS email_verified_at timestamptz NULL;
+
+CREATE TABLE IF NOT EXISTS customer_email_verifications (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  customer_id uuid NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+  email text NOT NULL,
+  token_hash text NOT NULL UNIQUE,
+  expires_at timestamptz NOT NULL,
+  used_at timestamptz NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_customer_email_verifications_customer_id
+  ON customer_email_verifications(customer_id);
+CREATE INDEX IF NOT EXISTS idx_orders_guest_email
+  ON orders(lower(email)) WHERE customer_id IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_orders_guest_email;
+DROP INDEX IF EXISTS idx_customer_email_verifications_customer_id;
+DROP TABLE IF EXISTS customer_email_verifications;
+ALTER TABLE customers DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'partially_shipped';
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'shipped';
+-- +goose StatementEnd
+
+CREATE TABLE IF NOT EXISTS order_shipments (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  order_id uuid NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  provider_key text NOT NULL REFERENCES shipping_providers(key) ON DELETE RESTRICT,
+  tracking_number text NOT NULL DEFAULT '',
+  tracking_url text NOT NULL DEFAULT '',
+  status text NOT NULL DEFAULT 'shipped' CHECK (status IN ('shipped', 'delivered')),
+  shipped_at timestamptz NOT NULL DEFAULT now(),
+  delivered_at timestamptz NULL,
+  created_by text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_shipments_order_id ON order_shipments(order_id);
+CREATE INDEX IF NOT EXISTS idx_order_shipments_tracking_number ON order_shipments(tracking_number) WHERE tracking_number <> '';
+
+CREATE TABLE IF NOT EXISTS order_shipment_lines (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  shipment_id uuid NOT NULL REFERENCES order_shipments(id) ON DELETE CASCADE,
+  order_item_id uuid NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+  quantity integer NOT NULL CHECK (quantity > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_shipment_lines_shipment_id ON order_shipment_lines(shipment_id);
+CREATE INDEX IF NOT EXISTS idx_order_shipment_lines_order_item_id ON order_shipment_lines(order_item_id);
+
+-- +goose Down
+-- Note: the partially_shipped/shipped enum values are left in place, see 015.
+DROP INDEX IF EXISTS idx_order_shipment_lines_order_item_id;
+DROP INDEX IF EXISTS idx_order_shipment_lines_shipment_id;
+DROP TABLE IF EXISTS order_shipment_lines;
+DROP INDEX IF EXISTS idx_order_shipments_tracking_number;
+DROP INDEX IF EXISTS idx_order_shipments_order_id;
+DROP TABLE IF EXISTS order_shipments;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- Shipments booked with a carrier are recorded as pending before the carrier
+-- is called, and marked cancelling before their booking is voided, so their
+-- units stay reserved without holding a transaction open during the call.
+ALTER TABLE order_shipments ADD COLUMN IF NOT EXISTS carrier_ref text NOT NULL DEFAULT '';
+ALTER TABLE order_shipments ADD COLUMN IF NOT EXISTS cancelled_at timestamptz NULL;
+ALTER TABLE order_shipments DROP CONSTRAINT IF EXISTS order_shipments_status_check;
+ALTER TABLE order_shipments ADD CONSTRAINT order_shipments_status_check CHECK (status IN ('pending', 'shipped', 'delivered', 'cancelling', 'cancelled'));
+
+-- +goose Down
+UPDATE order_shipments SET status = 'shipped' WHERE status = 'cancelling';
+UPDATE order_shipments SET status = 'cancelled', cancelled_at = COALESCE(cancelled_at, now()) WHERE status = 'pending';
+UPDATE order_shipments SET status = 'shipped' WHERE status = 'cancelled';
+ALTER TABLE order_shipments DROP CONSTRAINT IF EXISTS order_shipments_status_check;
+ALTER TABLE order_shipments ADD CONSTRAINT order_shipments_status_check CHECK (status IN ('shipped', 'delivered'));
+ALTER TABLE order_shipments DROP COLUMN IF EXISTS cancelled_at;
+ALTER TABLE order_shipments DROP COLUMN IF EXISTS carrier_ref;
@@ -0,0 +1,26 @@
+-- +goose Up
+ALTER TABLE order_shipments ADD COLUMN IF NOT EXISTS tracking_status text NOT NULL DEFAULT '';
+ALTER TABLE order_shipments ADD COLUMN IF NOT EXISTS tracking_checked_at timestamptz NULL;
+
+CREATE INDEX IF NOT EXISTS idx_order_shipments_tracking_due ON order_shipments(tracking_checked_at NULLS FIRST)
+  WHERE status = 'shipped' AND tracking_number <> '';
+
+CREATE TABLE IF NOT EXISTS order_shipment_tracking_events (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  shipment_id uuid NOT NULL REFERENCES order_shipments(id) ON DELETE CASCADE,
+  status text NOT NULL,
+  description text NOT NULL DEFAULT '',
+  location text NOT NULL DEFAULT '',
+  occurred_at timestamptz NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  UNIQUE (shipment_id, occurred_at, status, location, description)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_shipment_tracking_events_shipment_id ON order_shipment_tracking_events(shipment_id, occurred_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_order_shipment_tracking_events_shipment_id;
+DROP TABLE IF EXISTS order_shipment_tracking_events;
+DROP INDEX IF EXISTS idx_order_shipments_tracking_due;
+ALTER TABLE order_shipments DROP COLUMN IF EXISTS tracking_checked_at;
+ALTER TABLE order_shipments DROP COLUMN IF EXISTS tracking_status;
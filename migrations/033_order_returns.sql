@@ -0,0 +1,39 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS order_returns (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  order_id uuid NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  customer_id uuid NULL REFERENCES customers(id) ON DELETE SET NULL,
+  status text NOT NULL DEFAULT 'requested' CHECK (status IN ('requested', 'approved', 'rejected', 'received')),
+  reason text NOT NULL DEFAULT '',
+  admin_note text NOT NULL DEFAULT '',
+  restocked boolean NOT NULL DEFAULT false,
+  refund_id uuid NULL REFERENCES order_refunds(id) ON DELETE SET NULL,
+  decided_by text NOT NULL DEFAULT '',
+  decided_at timestamptz NULL,
+  received_by text NOT NULL DEFAULT '',
+  received_at timestamptz NULL,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_returns_order_id ON order_returns(order_id);
+CREATE INDEX IF NOT EXISTS idx_order_returns_status ON order_returns(status, created_at);
+
+CREATE TABLE IF NOT EXISTS order_return_lines (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  return_id uuid NOT NULL REFERENCES order_returns(id) ON DELETE CASCADE,
+  order_item_id uuid NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+  quantity integer NOT NULL CHECK (quantity > 0),
+  reason text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_return_lines_return_id ON order_return_lines(return_id);
+CREATE INDEX IF NOT EXISTS idx_order_return_lines_order_item_id ON order_return_lines(order_item_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_order_return_lines_order_item_id;
+DROP INDEX IF EXISTS idx_order_return_lines_return_id;
+DROP TABLE IF EXISTS order_return_lines;
+DROP INDEX IF EXISTS idx_order_returns_status;
+DROP INDEX IF EXISTS idx_order_returns_order_id;
+DROP TABLE IF EXISTS order_returns;
@@ -0,0 +1,52 @@
+-- +goose Up
+-- One counter row per document kind and year. Numbers are taken with an
+-- upsert inside the transaction that issues the document, so the row lock
+-- serialises concurrent issuers and a rolled back transaction returns its
+-- number: the sequence stays gap-free.
+CREATE TABLE IF NOT EXISTS invoice_sequences (
+  kind text NOT NULL,
+  year integer NOT NULL,
+  last_number integer NOT NULL CHECK (last_number > 0),
+  PRIMARY KEY (kind, year)
+);
+
+-- Issued invoices and credit notes are kept even if their order goes away.
+CREATE TABLE IF NOT EXISTS order_invoices (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  order_id uuid NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+  kind text NOT NULL CHECK (kind IN ('invoice', 'credit_note')),
+  number text NOT NULL UNIQUE,
+  year integer NOT NULL,
+  sequence integer NOT NULL,
+  refund_id uuid NULL UNIQUE REFERENCES order_refunds(id) ON DELETE RESTRICT,
+  currency text NOT NULL,
+  net_cents integer NOT NULL,
+  tax_cents integer NOT NULL,
+  total_cents integer NOT NULL,
+  buyer_name text NOT NULL DEFAULT '',
+  company_name text NOT NULL DEFAULT '',
+  company_vat text NOT NULL DEFAULT '',
+  email text NOT NULL DEFAULT '',
+  billing_address_json jsonb NULL,
+  media_asset_id uuid NULL REFERENCES media_assets(id) ON DELETE SET NULL,
+  issued_at timestamptz NOT NULL DEFAULT now(),
+  UNIQUE (kind, year, sequence),
+  CONSTRAINT order_invoices_refund_check CHECK ((kind = 'credit_note') = (refund_id IS NOT NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_order_invoices_one_invoice_per_order ON order_invoices(order_id) WHERE kind = 'invoice';
+CREATE INDEX IF NOT EXISTS idx_order_invoices_order_id ON order_invoices(order_id, issued_at);
+
+ALTER TABLE media_assets DROP CONSTRAINT IF EXISTS media_assets_source_type_check;
+ALTER TABLE media_assets
+  ADD CONSTRAINT media_assets_source_type_check CHECK (source_type IN ('upload', 'url_import', 'invoice'));
+
+-- +goose Down
+DELETE FROM media_assets WHERE source_type = 'invoice';
+ALTER TABLE media_assets DROP CONSTRAINT IF EXISTS media_assets_source_type_check;
+ALTER TABLE media_assets
+  ADD CONSTRAINT media_assets_source_type_check CHECK (source_type IN ('upload', 'url_import'));
+DROP INDEX IF EXISTS idx_order_invoices_order_id;
+DROP INDEX IF EXISTS idx_order_invoices_one_invoice_per_order;
+DROP TABLE IF EXISTS order_invoices;
+DROP TABLE IF EXISTS invoice_sequences;
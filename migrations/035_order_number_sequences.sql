@@ -0,0 +1,13 @@
+-- +goose Up
+-- One counter row per order number scope, i.e. the number without its
+-- counter ("ORD-20261017"). Checkout takes the next number with an upsert in
+-- its own transaction, so numbers are unique and a failed checkout gives its
+-- number back. Existing orders keep the numbers customers and payment
+-- providers already know; the generator skips any of them it would repeat.
+CREATE TABLE IF NOT EXISTS order_number_sequences (
+  scope text PRIMARY KEY,
+  last_number bigint NOT NULL CHECK (last_number > 0)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS order_number_sequences;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- Admin order search: full-text on the buyer names of the order snapshot
+-- and prefix matches on the order number.
+ALTER TABLE orders
+  ADD COLUMN IF NOT EXISTS customer_name_search tsvector GENERATED ALWAYS AS (
+    to_tsvector('simple',
+      COALESCE(billing_address_json->>'full_name', '') || ' ' || COALESCE(shipping_address_json->>'full_name', ''))
+  ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_orders_customer_name_search ON orders USING gin (customer_name_search);
+CREATE INDEX IF NOT EXISTS idx_orders_number_pattern ON orders (number text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_orders_total_cents ON orders (total_cents);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_orders_total_cents;
+DROP INDEX IF EXISTS idx_orders_number_pattern;
+DROP INDEX IF EXISTS idx_orders_customer_name_search;
+ALTER TABLE orders DROP COLUMN IF EXISTS customer_name_search;
@@ -0,0 +1,85 @@
+-- +goose Up
+-- Admin edits of unfulfilled orders. changes_json lists every line and
+-- address change with its before and after values.
+CREATE TABLE IF NOT EXISTS order_edits (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  order_id uuid NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  actor text NOT NULL,
+  reason text NOT NULL DEFAULT '',
+  changes_json jsonb NOT NULL DEFAULT '[]'::jsonb,
+  previous_total_cents integer NOT NULL,
+  total_cents integer NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_edits_order_id ON order_edits(order_id, created_at);
+
+-- When an edit lowers the total of a paid order the difference is refunded
+-- as an order_refunds row linked to the edit, so it goes through the same
+-- pending, failed and retry handling. The order total already excludes it,
+-- so edit refunds do not count against the refundable balance. A failed
+-- edit refund is retried with a new row; at most one per edit may be live.
+ALTER TABLE order_refunds
+  ADD COLUMN IF NOT EXISTS order_edit_id uuid NULL REFERENCES order_edits(id) ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_order_refunds_one_per_edit
+  ON order_refunds(order_edit_id) WHERE order_edit_id IS NOT NULL AND status <> 'failed';
+
+CREATE TABLE IF NOT EXISTS order_notes (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  order_id uuid NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  visibility text NOT NULL CHECK (visibility IN ('internal', 'customer')),
+  body text NOT NULL CHECK (body <> ''),
+  author text NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_notes_order_id ON order_notes(order_id, created_at);
+
+-- Editing an invoiced order supersedes its invoice: a credit note cancels it
+-- and a new invoice is issued. Invoices keep their own line snapshot so a
+-- superseded invoice still shows what it billed.
+ALTER TABLE order_invoices
+  ADD COLUMN IF NOT EXISTS order_edit_id uuid NULL REFERENCES order_edits(id) ON DELETE RESTRICT,
+  ADD COLUMN IF NOT EXISTS credited_invoice_id uuid NULL REFERENCES order_invoices(id) ON DELETE RESTRICT,
+  ADD COLUMN IF NOT EXISTS superseded_at timestamptz NULL,
+  ADD COLUMN IF NOT EXISTS lines_json jsonb NULL;
+
+UPDATE order_invoices cn
+SET credited_invoice_id = inv.id
+FROM order_invoices inv
+WHERE cn.kind = 'credit_note' AND inv.kind = 'invoice' AND inv.order_id = cn.order_id AND cn.credited_invoice_id IS NULL;
+
+ALTER TABLE order_invoices DROP CONSTRAINT IF EXISTS order_invoices_refund_check;
+ALTER TABLE order_invoices
+  ADD CONSTRAINT order_invoices_refund_check CHECK (
+    (kind = 'invoice' AND refund_id IS NULL AND order_edit_id IS NULL AND credited_invoice_id IS NULL)
+    OR (kind = 'credit_note' AND credited_invoice_id IS NOT NULL AND (refund_id IS NULL) <> (order_edit_id IS NULL))
+  );
+
+DROP INDEX IF EXISTS idx_order_invoices_one_invoice_per_order;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_order_invoices_one_invoice_per_order
+  ON order_invoices(order_id) WHERE kind = 'invoice' AND superseded_at IS NULL;
+
+-- +goose Down
+-- Reissued documents cannot be represented without the new columns.
+DROP INDEX IF EXISTS idx_order_invoices_one_invoice_per_order;
+ALTER TABLE order_invoices DROP CONSTRAINT IF EXISTS order_invoices_refund_check;
+ALTER TABLE order_invoices DROP COLUMN IF EXISTS credited_invoice_id;
+DELETE FROM order_invoices WHERE order_edit_id IS NOT NULL;
+DELETE FROM order_invoices WHERE superseded_at IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_order_invoices_one_invoice_per_order ON order_invoices(order_id) WHERE kind = 'invoice';
+ALTER TABLE order_invoices
+  ADD CONSTRAINT order_invoices_refund_check CHECK ((kind = 'credit_note') = (refund_id IS NOT NULL));
+ALTER TABLE order_invoices
+  DROP COLUMN IF EXISTS lines_json,
+  DROP COLUMN IF EXISTS superseded_at,
+  DROP COLUMN IF EXISTS order_edit_id;
+DROP INDEX IF EXISTS idx_order_notes_order_id;
+DROP TABLE IF EXISTS order_notes;
+-- Edit refunds would otherwise count against the edited order totals.
+DELETE FROM order_refunds WHERE order_edit_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_order_refunds_one_per_edit;
+ALTER TABLE order_refunds DROP COLUMN IF EXISTS order_edit_id;
+DROP INDEX IF EXISTS idx_order_edits_order_id;
+DROP TABLE IF EXISTS order_edits;
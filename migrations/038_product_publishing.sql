@@ -0,0 +1,24 @@
+-- +goose Up
+-- Storefront visibility: only published products inside their optional
+-- publish_at/unpublish_at window are served. preview_token lets admins share
+-- a link to a product the storefront does not show yet.
+ALTER TABLE products
+  ADD COLUMN IF NOT EXISTS publish_at timestamptz NULL,
+  ADD COLUMN IF NOT EXISTS unpublish_at timestamptz NULL,
+  ADD COLUMN IF NOT EXISTS preview_token text NULL;
+
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_publish_window_check;
+ALTER TABLE products
+  ADD CONSTRAINT products_publish_window_check CHECK (publish_at IS NULL OR unpublish_at IS NULL OR unpublish_at > publish_at);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_products_preview_token ON products(preview_token) WHERE preview_token IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_products_status_publish ON products(status, publish_at, unpublish_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_products_status_publish;
+DROP INDEX IF EXISTS idx_products_preview_token;
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_publish_window_check;
+ALTER TABLE products
+  DROP COLUMN IF EXISTS preview_token,
+  DROP COLUMN IF EXISTS unpublish_at,
+  DROP COLUMN IF EXISTS publish_at;
@@ -0,0 +1,94 @@
+-- +goose Up
+-- Storefront search. products.search_vector is kept up to date by triggers
+-- on products and product_variants (variant SKUs are searchable). Every
+-- field is indexed twice: stemmed with the english configuration and
+-- unstemmed and unaccented with simple, so Lithuanian and other non-English
+-- words still match whole or by prefix, with or without diacritics.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector NOT NULL DEFAULT ''::tsvector;
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION product_search_document(title text, description text, tags text[], skus text)
+RETURNS tsvector
+LANGUAGE sql STABLE
+AS $$
+  SELECT
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('simple', unaccent(coalesce(title, ''))), 'A') ||
+    setweight(to_tsvector('simple', coalesce(skus, '')), 'A') ||
+    setweight(to_tsvector('english', array_to_string(coalesce(tags, '{}'), ' ')), 'B') ||
+    setweight(to_tsvector('simple', unaccent(array_to_string(coalesce(tags, '{}'), ' '))), 'B') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'C') ||
+    setweight(to_tsvector('simple', unaccent(coalesce(description, ''))), 'D')
+$$;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION products_search_vector_trigger()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  NEW.search_vector := product_search_document(
+    NEW.title, NEW.description, NEW.tags,
+    (SELECT string_agg(sku, ' ') FROM product_variants WHERE product_id = NEW.id)
+  );
+  RETURN NEW;
+END;
+$$;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION product_variants_search_vector_trigger()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF TG_OP = 'UPDATE' AND NEW.sku IS NOT DISTINCT FROM OLD.sku AND NEW.product_id = OLD.product_id THEN
+    RETURN NULL;
+  END IF;
+  UPDATE products p
+  SET search_vector = product_search_document(
+    p.title, p.description, p.tags,
+    (SELECT string_agg(v.sku, ' ') FROM product_variants v WHERE v.product_id = p.id)
+  )
+  WHERE p.id IN (
+    CASE WHEN TG_OP = 'DELETE' THEN NULL ELSE NEW.product_id END,
+    CASE WHEN TG_OP = 'INSERT' THEN NULL ELSE OLD.product_id END
+  );
+  RETURN NULL;
+END;
+$$;
+-- +goose StatementEnd
+
+DROP TRIGGER IF EXISTS products_search_vector ON products;
+CREATE TRIGGER products_search_vector
+  BEFORE INSERT OR UPDATE OF title, description, tags ON products
+  FOR EACH ROW EXECUTE FUNCTION products_search_vector_trigger();
+
+DROP TRIGGER IF EXISTS product_variants_search_vector ON product_variants;
+CREATE TRIGGER product_variants_search_vector
+  AFTER INSERT OR UPDATE OR DELETE ON product_variants
+  FOR EACH ROW EXECUTE FUNCTION product_variants_search_vector_trigger();
+
+UPDATE products p
+SET search_vector = product_search_document(
+  p.title, p.description, p.tags,
+  (SELECT string_agg(v.sku, ' ') FROM product_variants v WHERE v.product_id = p.id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING gin (search_vector);
+-- Typo tolerance: word similarity between the query and product titles.
+CREATE INDEX IF NOT EXISTS idx_products_title_trgm ON products USING gin (title gin_trgm_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_products_title_trgm;
+DROP INDEX IF EXISTS idx_products_search_vector;
+DROP TRIGGER IF EXISTS product_variants_search_vector ON product_variants;
+DROP TRIGGER IF EXISTS products_search_vector ON products;
+DROP FUNCTION IF EXISTS product_variants_search_vector_trigger();
+DROP FUNCTION IF EXISTS products_search_vector_trigger();
+DROP FUNCTION IF EXISTS product_search_document(text, text, text[], text);
+ALTER TABLE products DROP COLUMN IF EXISTS search_vector;
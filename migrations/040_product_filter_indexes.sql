@@ -0,0 +1,8 @@
+-- +goose Up
+-- Storefront filters: tags are matched with && and variant prices by range.
+CREATE INDEX IF NOT EXISTS idx_products_tags ON products USING gin (tags);
+CREATE INDEX IF NOT EXISTS idx_product_variants_product_price ON product_variants(product_id, price_cents);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_product_variants_product_price;
+DROP INDEX IF EXISTS idx_products_tags;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Keyset pagination of the storefront list by title and by newest.
+CREATE INDEX IF NOT EXISTS idx_products_title_id ON products(title, id);
+CREATE INDEX IF NOT EXISTS idx_products_created_at_id ON products(created_at DESC, id DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_products_created_at_id;
+DROP INDEX IF EXISTS idx_products_title_id;
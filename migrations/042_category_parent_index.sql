@@ -0,0 +1,7 @@
+-- +goose Up
+-- Category tree walks (breadcrumbs, descendant-inclusive listing) follow
+-- parent_id downwards.
+CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories(parent_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_categories_parent_id;